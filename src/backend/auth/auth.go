@@ -4,11 +4,15 @@ import (
 	"errors"
 	"time"
 
+	"defi-backend/models"
+	"defi-backend/repository"
+
 	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// User 令牌中使用的用户字段，用户数据保存在 models.User 中
 type User struct {
 	gorm.Model
 	Email         string `gorm:"uniqueIndex"`
@@ -17,10 +21,28 @@ type User struct {
 	Role          string
 }
 
+const (
+	RoleUser     = "user"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+	RoleAuditor  = "auditor"
+)
+
+// ValidRole 判断是否为已知角色
+func ValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleOperator, RoleAdmin, RoleAuditor:
+		return true
+	}
+	return false
+}
+
 type Claims struct {
 	UserID uint
 	Email  string
 	Role   string
+	// SessionID 同一次登录签发的令牌共享，用于吊销整个会话
+	SessionID string `json:",omitempty"`
 	jwt.StandardClaims
 }
 
@@ -39,7 +61,7 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-func GenerateToken(user *User, secretKey string) (string, error) {
+func GenerateToken(user *User, keys *KeyManager) (string, error) {
 	expirationTime := time.Now().Add(24 * time.Hour)
 	claims := &Claims{
 		UserID: user.ID,
@@ -50,15 +72,12 @@ func GenerateToken(user *User, secretKey string) (string, error) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
+	return keys.Sign(claims)
 }
 
-func ValidateToken(tokenString, secretKey string) (*Claims, error) {
+func ValidateToken(tokenString string, keys *KeyManager) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
-	})
+	token, err := keys.Parse(tokenString, claims)
 
 	if err != nil {
 		return nil, err
@@ -71,47 +90,67 @@ func ValidateToken(tokenString, secretKey string) (*Claims, error) {
 	return claims, nil
 }
 
-func RegisterUser(db *gorm.DB, email, password, walletAddress string) (*User, error) {
+// NewUser 把用户转换为签发令牌需要的字段
+func NewUser(user *models.User) *User {
+	u := &User{
+		Model: gorm.Model{ID: user.ID},
+		Role:  user.Role,
+	}
+	if user.Email != nil {
+		u.Email = *user.Email
+	}
+	if user.WalletAddress != nil {
+		u.WalletAddress = *user.WalletAddress
+	}
+	return u
+}
+
+// RegisterUser 按邮箱注册用户，邮箱同时作为用户名
+func RegisterUser(users repository.UserRepository, email, password, walletAddress string) (*User, error) {
 	passwordHash, err := HashPassword(password)
 	if err != nil {
 		return nil, err
 	}
 
-	user := &User{
-		Email:         email,
-		PasswordHash:  passwordHash,
-		WalletAddress: walletAddress,
-		Role:          "user",
+	user := &models.User{
+		Username: email,
+		Email:    &email,
+		Password: passwordHash,
+		Role:     RoleUser,
+		IsActive: true,
+	}
+	if walletAddress != "" {
+		user.WalletAddress = &walletAddress
 	}
 
-	if err := db.Create(user).Error; err != nil {
+	if err := users.Create(user); err != nil {
 		return nil, err
 	}
 
-	return user, nil
+	return NewUser(user), nil
 }
 
-func LoginUser(db *gorm.DB, email, password string) (*User, error) {
-	var user User
-	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+func LoginUser(users repository.UserRepository, email, password string) (*User, error) {
+	user, err := users.FindByEmail(email)
+	if err != nil {
 		return nil, ErrUserNotFound
 	}
 
-	if !CheckPasswordHash(password, user.PasswordHash) {
+	if !CheckPasswordHash(password, user.Password) {
 		return nil, ErrInvalidCredentials
 	}
 
-	return &user, nil
+	return NewUser(user), nil
 }
 
-func UpdateUserRole(db *gorm.DB, userID uint, role string) error {
-	return db.Model(&User{}).Where("id = ?", userID).Update("role", role).Error
+func UpdateUserRole(users repository.UserRepository, userID uint, role string) error {
+	return users.UpdateRole(userID, role)
 }
 
-func GetUserByID(db *gorm.DB, userID uint) (*User, error) {
-	var user User
-	if err := db.First(&user, userID).Error; err != nil {
+func GetUserByID(users repository.UserRepository, userID uint) (*User, error) {
+	user, err := users.FindByID(userID)
+	if err != nil {
 		return nil, err
 	}
-	return &user, nil
+	return NewUser(user), nil
 }
@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+
+	"defi-backend/config"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrNoSigningKey = errors.New("no signing key configured")
+	ErrUnknownKeyID = errors.New("unknown key id")
+)
+
+// verificationKey 一个已解析的密钥，signKey 为空表示只能校验
+type verificationKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeyManager 管理签名和校验密钥，令牌头部的 kid 决定使用哪个密钥校验
+type KeyManager struct {
+	mu      sync.RWMutex
+	signing *verificationKey
+	keys    map[string]*verificationKey
+}
+
+// NewKeyManager 从配置加载密钥，SigningKey 必须指向一个带私钥的密钥
+func NewKeyManager(cfg config.JWTConfig) (*KeyManager, error) {
+	m := &KeyManager{}
+	if err := m.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload 用新配置替换全部密钥，配置有误时保留原有密钥。
+// 已签发令牌的 kid 不在新列表中时，这些令牌随即失效
+func (m *KeyManager) Reload(cfg config.JWTConfig) error {
+	// 没有配置 Keys 时使用 Secret 作为 HS256 密钥
+	if len(cfg.Keys) == 0 && cfg.Secret != "" {
+		cfg.SigningKey = "default"
+		cfg.Keys = []config.JWTKeyConfig{{ID: "default", Algorithm: "HS256", Secret: cfg.Secret}}
+	}
+
+	keys := make(map[string]*verificationKey)
+	for _, kc := range cfg.Keys {
+		key, err := parseKey(kc)
+		if err != nil {
+			return fmt.Errorf("invalid jwt key %q: %v", kc.ID, err)
+		}
+		if _, ok := keys[key.id]; ok {
+			return fmt.Errorf("duplicate jwt key id %q", key.id)
+		}
+		keys[key.id] = key
+	}
+
+	signing, ok := keys[cfg.SigningKey]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrNoSigningKey, cfg.SigningKey)
+	}
+	if signing.signKey == nil {
+		return fmt.Errorf("signing key %q has no private key", cfg.SigningKey)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.signing = signing
+	m.keys = keys
+	return nil
+}
+
+// SigningKeyID 返回当前签名使用的 kid
+func (m *KeyManager) SigningKeyID() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.signing.id
+}
+
+// Sign 使用当前签名密钥签发令牌，并在头部写入 kid
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	signing := m.signing
+	m.mu.RUnlock()
+
+	token := jwt.NewWithClaims(signing.method, claims)
+	token.Header["kid"] = signing.id
+	return token.SignedString(signing.signKey)
+}
+
+// Parse 按 kid 选择密钥校验令牌，令牌声明的算法必须与该密钥一致
+func (m *KeyManager) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		m.mu.RLock()
+		key, ok := m.keys[kid]
+		m.mu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+		}
+		return key.verifyKey, nil
+	})
+}
+
+// JWK JSON Web Key，只包含公钥参数
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS 返回所有非对称密钥的公钥，HS256 密钥不会公开
+func (m *KeyManager) JWKS() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(m.keys))
+	for id := range m.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, id := range ids {
+		key := m.keys[id]
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.id,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.id,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
+
+func parseKey(kc config.JWTKeyConfig) (*verificationKey, error) {
+	if kc.ID == "" {
+		return nil, errors.New("kid is required")
+	}
+	key := &verificationKey{id: kc.ID}
+
+	switch kc.Algorithm {
+	case "HS256":
+		if kc.Secret == "" {
+			return nil, errors.New("secret is required for HS256")
+		}
+		key.method = jwt.SigningMethodHS256
+		key.signKey = []byte(kc.Secret)
+		key.verifyKey = []byte(kc.Secret)
+		return key, nil
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+	case "EdDSA":
+		key.method = EdDSA
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", kc.Algorithm)
+	}
+
+	privatePEM, err := readPEM(kc.PrivateKey, kc.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	publicPEM, err := readPEM(kc.PublicKey, kc.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case privatePEM != nil:
+		priv, err := parsePrivateKey(privatePEM)
+		if err != nil {
+			return nil, err
+		}
+		switch k := priv.(type) {
+		case *rsa.PrivateKey:
+			if kc.Algorithm != "RS256" {
+				return nil, errors.New("rsa key requires RS256")
+			}
+			key.signKey, key.verifyKey = k, &k.PublicKey
+		case ed25519.PrivateKey:
+			if kc.Algorithm != "EdDSA" {
+				return nil, errors.New("ed25519 key requires EdDSA")
+			}
+			key.signKey, key.verifyKey = k, k.Public()
+		default:
+			return nil, fmt.Errorf("unsupported private key type %T", priv)
+		}
+	case publicPEM != nil:
+		pub, err := x509.ParsePKIXPublicKey(publicPEM)
+		if err != nil {
+			return nil, err
+		}
+		switch k := pub.(type) {
+		case *rsa.PublicKey:
+			if kc.Algorithm != "RS256" {
+				return nil, errors.New("rsa key requires RS256")
+			}
+		case ed25519.PublicKey:
+			if kc.Algorithm != "EdDSA" {
+				return nil, errors.New("ed25519 key requires EdDSA")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", k)
+		}
+		key.verifyKey = pub
+	default:
+		return nil, errors.New("private_key or public_key is required")
+	}
+	return key, nil
+}
+
+func parsePrivateKey(der []byte) (interface{}, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return x509.ParsePKCS8PrivateKey(der)
+}
+
+// readPEM 读取内联或文件中的 PEM，返回 DER 字节；两者都为空时返回 nil
+func readPEM(inline, file string) ([]byte, error) {
+	data := []byte(inline)
+	if inline == "" && file != "" {
+		var err error
+		if data, err = os.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+	return block.Bytes, nil
+}
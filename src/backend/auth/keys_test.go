@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"defi-backend/config"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func hsKeys(signing string, ids ...string) config.JWTConfig {
+	cfg := config.JWTConfig{SigningKey: signing}
+	for _, id := range ids {
+		cfg.Keys = append(cfg.Keys, config.JWTKeyConfig{ID: id, Algorithm: "HS256", Secret: "secret-" + id})
+	}
+	return cfg
+}
+
+func TestNewKeyManagerFallsBackToSecret(t *testing.T) {
+	m, err := NewKeyManager(config.JWTConfig{Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.SigningKeyID() != "default" {
+		t.Fatalf("signing kid = %q, want default", m.SigningKeyID())
+	}
+	if _, err := NewKeyManager(config.JWTConfig{}); !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("empty config err = %v, want ErrNoSigningKey", err)
+	}
+}
+
+func TestKeyManagerReload(t *testing.T) {
+	m, err := NewKeyManager(hsKeys("old", "old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := m.Sign(&jwt.StandardClaims{Subject: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 轮换期间旧密钥仍可校验
+	if err := m.Reload(hsKeys("new", "new", "old")); err != nil {
+		t.Fatal(err)
+	}
+	if m.SigningKeyID() != "new" {
+		t.Fatalf("signing kid = %q, want new", m.SigningKeyID())
+	}
+	if _, err := m.Parse(oldToken, &jwt.StandardClaims{}); err != nil {
+		t.Fatalf("old token during rotation: %v", err)
+	}
+
+	// 无效配置不影响当前密钥
+	if err := m.Reload(hsKeys("missing", "new")); !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("invalid reload err = %v, want ErrNoSigningKey", err)
+	}
+	if m.SigningKeyID() != "new" {
+		t.Fatalf("signing kid after rejected reload = %q, want new", m.SigningKeyID())
+	}
+
+	if err := m.Reload(hsKeys("new", "new")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Parse(oldToken, &jwt.StandardClaims{})
+	var ve *jwt.ValidationError
+	if !errors.As(err, &ve) || !errors.Is(ve.Inner, ErrUnknownKeyID) {
+		t.Fatalf("token signed by removed key: err = %v, want ErrUnknownKeyID", err)
+	}
+}
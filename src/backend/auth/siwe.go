@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"defi-backend/chain"
+)
+
+const siweHeaderSuffix = " wants you to sign in with your Ethereum account:"
+
+var ErrInvalidSIWEMessage = errors.New("invalid sign-in message")
+
+// SIWEMessage EIP-4361 Sign-In with Ethereum 消息
+type SIWEMessage struct {
+	Domain         string
+	Address        string
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        uint64
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime *time.Time
+	NotBefore      *time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// ParseSIWEMessage 按 EIP-4361 的 ABNF 解析消息文本
+func ParseSIWEMessage(text string) (*SIWEMessage, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if len(lines) < 3 || !strings.HasSuffix(lines[0], siweHeaderSuffix) {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidSIWEMessage)
+	}
+
+	msg := &SIWEMessage{
+		Domain:  strings.TrimSuffix(lines[0], siweHeaderSuffix),
+		Address: lines[1],
+	}
+	if msg.Domain == "" {
+		return nil, fmt.Errorf("%w: missing domain", ErrInvalidSIWEMessage)
+	}
+	if !chain.IsHexAddress(msg.Address) || chain.ChecksumAddress(msg.Address) != msg.Address {
+		return nil, fmt.Errorf("%w: address must be EIP-55 checksummed", ErrInvalidSIWEMessage)
+	}
+	if lines[2] != "" {
+		return nil, fmt.Errorf("%w: expected empty line after address", ErrInvalidSIWEMessage)
+	}
+
+	// 地址之后是可选的 statement，以空行结束
+	i := 3
+	if i < len(lines) && !strings.HasPrefix(lines[i], "URI: ") {
+		msg.Statement = lines[i]
+		i++
+		if i >= len(lines) || lines[i] != "" {
+			return nil, fmt.Errorf("%w: expected empty line after statement", ErrInvalidSIWEMessage)
+		}
+		i++
+	} else if i < len(lines) && lines[i] == "" {
+		i++
+	}
+
+	var err error
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "Resources:" {
+			for i++; i < len(lines); i++ {
+				if !strings.HasPrefix(lines[i], "- ") {
+					return nil, fmt.Errorf("%w: invalid resource line %q", ErrInvalidSIWEMessage, lines[i])
+				}
+				msg.Resources = append(msg.Resources, strings.TrimPrefix(lines[i], "- "))
+			}
+			break
+		}
+
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid line %q", ErrInvalidSIWEMessage, line)
+		}
+		switch key {
+		case "URI":
+			msg.URI = value
+		case "Version":
+			msg.Version = value
+		case "Chain ID":
+			msg.ChainID, err = strconv.ParseUint(value, 10, 64)
+		case "Nonce":
+			msg.Nonce = value
+		case "Issued At":
+			msg.IssuedAt, err = time.Parse(time.RFC3339, value)
+		case "Expiration Time":
+			msg.ExpirationTime, err = parseSIWETime(value)
+		case "Not Before":
+			msg.NotBefore, err = parseSIWETime(value)
+		case "Request ID":
+			msg.RequestID = value
+		default:
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidSIWEMessage, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid %s: %v", ErrInvalidSIWEMessage, key, err)
+		}
+	}
+
+	switch {
+	case msg.URI == "":
+		return nil, fmt.Errorf("%w: missing URI", ErrInvalidSIWEMessage)
+	case msg.Version != "1":
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrInvalidSIWEMessage, msg.Version)
+	case msg.ChainID == 0:
+		return nil, fmt.Errorf("%w: missing chain id", ErrInvalidSIWEMessage)
+	case len(msg.Nonce) < 8:
+		return nil, fmt.Errorf("%w: nonce too short", ErrInvalidSIWEMessage)
+	case msg.IssuedAt.IsZero():
+		return nil, fmt.Errorf("%w: missing issued at", ErrInvalidSIWEMessage)
+	}
+	return msg, nil
+}
+
+// VerifySIWE 校验消息的域名、有效期和 personal_sign 签名，成功时返回签名地址
+// chainID 为 0 时不限制链
+func VerifySIWE(text string, signature string, domain string, chainID uint64, now time.Time) (*SIWEMessage, error) {
+	msg, err := ParseSIWEMessage(text)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Domain != domain {
+		return nil, fmt.Errorf("%w: domain mismatch", ErrInvalidSIWEMessage)
+	}
+	if chainID != 0 && msg.ChainID != chainID {
+		return nil, fmt.Errorf("%w: chain id mismatch", ErrInvalidSIWEMessage)
+	}
+	if msg.ExpirationTime != nil && !now.Before(*msg.ExpirationTime) {
+		return nil, fmt.Errorf("%w: message expired", ErrInvalidSIWEMessage)
+	}
+	if msg.NotBefore != nil && now.Before(*msg.NotBefore) {
+		return nil, fmt.Errorf("%w: message not yet valid", ErrInvalidSIWEMessage)
+	}
+
+	sig, err := chain.DecodeHex(signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", chain.ErrInvalidSignature, err)
+	}
+	signer, err := chain.RecoverPersonalSign([]byte(text), sig)
+	if err != nil {
+		return nil, err
+	}
+	if signer != msg.Address {
+		return nil, fmt.Errorf("%w: signer does not match address", chain.ErrInvalidSignature)
+	}
+	return msg, nil
+}
+
+func parseSIWETime(value string) (*time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrTokenRevoked        = errors.New("token has been revoked")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// TokenPair 登录或刷新后返回给客户端的令牌
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// refreshSession 刷新令牌在 Redis 中保存的会话信息，同一次登录轮换出的令牌共享 SessionID
+type refreshSession struct {
+	UserID    uint   `json:"user_id"`
+	SessionID string `json:"sid"`
+}
+
+// TokenService 签发短期访问令牌和可轮换的刷新令牌，吊销信息保存在 Redis 中
+//
+// Redis 键：
+//
+//	auth:refresh:<hash>        当前有效的刷新令牌 -> 会话
+//	auth:refresh_used:<hash>   已被轮换掉的刷新令牌 -> sid，再次出现即视为被盗用
+//	auth:session:<sid>         会话当前刷新令牌的 hash
+//	auth:session_revoked:<sid> 已吊销的会话，携带该 sid 的访问令牌失效
+//	auth:user_sessions:<uid>   用户的全部会话
+//	auth:revoked:<jti>         已吊销的访问令牌
+//	auth:revoked_before:<uid>  早于该秒签发的访问令牌全部失效，同一秒内签发的旧令牌由会话吊销覆盖
+type TokenService struct {
+	redis      *redis.Client
+	keys       *KeyManager
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewTokenService(redisClient *redis.Client, keys *KeyManager, accessTTL, refreshTTL time.Duration) *TokenService {
+	if accessTTL <= 0 {
+		accessTTL = DefaultAccessTokenTTL
+	}
+	if refreshTTL <= 0 {
+		refreshTTL = DefaultRefreshTokenTTL
+	}
+	return &TokenService{
+		redis:      redisClient,
+		keys:       keys,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// Issue 为一次新的登录创建会话并签发令牌
+func (s *TokenService) Issue(ctx context.Context, user *User) (*TokenPair, error) {
+	sid, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(ctx, user, sid)
+}
+
+// Refresh 用刷新令牌换取新的令牌对，旧刷新令牌立即作废
+// 已作废的刷新令牌被再次使用时吊销整个会话并返回 ErrRefreshTokenReused
+// load 用于重新读取用户，使角色变更和禁用在刷新时生效
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string, load func(userID uint) (*User, error)) (*TokenPair, error) {
+	hash := hashToken(refreshToken)
+	data, err := s.redis.GetDel(ctx, refreshKey(hash)).Result()
+	if errors.Is(err, redis.Nil) {
+		sid, err := s.redis.Get(ctx, usedRefreshKey(hash)).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.revokeSession(ctx, sid); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session refreshSession
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err := s.redis.Set(ctx, usedRefreshKey(hash), session.SessionID, s.refreshTTL).Err(); err != nil {
+		return nil, err
+	}
+
+	user, err := load(session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(ctx, user, session.SessionID)
+}
+
+// Validate 校验访问令牌的签名、有效期以及是否已被吊销
+func (s *TokenService) Validate(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := ValidateToken(tokenString, s.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.redis.Pipeline()
+	var jtiRevoked, sessionRevoked *redis.IntCmd
+	if claims.Id != "" {
+		jtiRevoked = pipe.Exists(ctx, revokedKey(claims.Id))
+	}
+	if claims.SessionID != "" {
+		sessionRevoked = pipe.Exists(ctx, revokedSessionKey(claims.SessionID))
+	}
+	before := pipe.Get(ctx, revokedBeforeKey(claims.UserID))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	if jtiRevoked != nil && jtiRevoked.Val() > 0 {
+		return nil, ErrTokenRevoked
+	}
+	if sessionRevoked != nil && sessionRevoked.Val() > 0 {
+		return nil, ErrTokenRevoked
+	}
+	if ts, err := before.Int64(); err == nil && claims.IssuedAt < ts {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// Logout 吊销当前访问令牌及其所属会话的刷新令牌
+func (s *TokenService) Logout(ctx context.Context, claims *Claims) error {
+	if claims.Id != "" {
+		ttl := time.Until(time.Unix(claims.ExpiresAt, 0))
+		if ttl > 0 {
+			if err := s.redis.Set(ctx, revokedKey(claims.Id), 1, ttl).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	if claims.SessionID != "" {
+		return s.revokeSession(ctx, claims.SessionID)
+	}
+	return nil
+}
+
+// LogoutAll 吊销用户所有会话，此前签发的访问令牌全部失效
+func (s *TokenService) LogoutAll(ctx context.Context, userID uint) error {
+	now := time.Now().Unix()
+	if err := s.redis.Set(ctx, revokedBeforeKey(userID), now, s.accessTTL).Err(); err != nil {
+		return err
+	}
+
+	sids, err := s.redis.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, sid := range sids {
+		if err := s.revokeSession(ctx, sid); err != nil {
+			return err
+		}
+	}
+	return s.redis.Del(ctx, userSessionsKey(userID)).Err()
+}
+
+func (s *TokenService) issue(ctx context.Context, user *User, sid string) (*TokenPair, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionID: sid,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(s.accessTTL).Unix(),
+		},
+	}
+	accessToken, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(refreshSession{UserID: user.ID, SessionID: sid})
+	if err != nil {
+		return nil, err
+	}
+	hash := hashToken(refreshToken)
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, refreshKey(hash), data, s.refreshTTL)
+	pipe.Set(ctx, sessionKey(sid), hash, s.refreshTTL)
+	pipe.SAdd(ctx, userSessionsKey(user.ID), sid)
+	pipe.Expire(ctx, userSessionsKey(user.ID), s.refreshTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.accessTTL / time.Second),
+	}, nil
+}
+
+// JWKS 返回用于校验访问令牌的公钥
+func (s *TokenService) JWKS() JWKSet {
+	return s.keys.JWKS()
+}
+
+// revokeSession 删除会话当前的刷新令牌，并让该会话签发的访问令牌失效
+func (s *TokenService) revokeSession(ctx context.Context, sid string) error {
+	hash, err := s.redis.Get(ctx, sessionKey(sid)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	pipe := s.redis.TxPipeline()
+	if hash != "" {
+		pipe.Del(ctx, refreshKey(hash))
+	}
+	pipe.Del(ctx, sessionKey(sid))
+	pipe.Set(ctx, revokedSessionKey(sid), 1, s.accessTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// 刷新令牌只保存哈希，Redis 泄露时无法直接使用
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func refreshKey(hash string) string       { return "auth:refresh:" + hash }
+func usedRefreshKey(hash string) string   { return "auth:refresh_used:" + hash }
+func sessionKey(sid string) string        { return "auth:session:" + sid }
+func revokedSessionKey(sid string) string { return "auth:session_revoked:" + sid }
+func revokedKey(jti string) string        { return "auth:revoked:" + jti }
+func userSessionsKey(userID uint) string {
+	return "auth:user_sessions:" + strconv.FormatUint(uint64(userID), 10)
+}
+func revokedBeforeKey(userID uint) string {
+	return "auth:revoked_before:" + strconv.FormatUint(uint64(userID), 10)
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"defi-backend/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+func newTestTokenService(t *testing.T) *TokenService {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+
+	keys, err := NewKeyManager(config.JWTConfig{
+		SigningKey: "test",
+		Keys:       []config.JWTKeyConfig{{ID: "test", Algorithm: "HS256", Secret: "test-secret"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewTokenService(redis.NewClient(&redis.Options{Addr: mr.Addr()}), keys, time.Minute, time.Hour)
+}
+
+func TestLogoutAllRevokesEarlierTokensOnly(t *testing.T) {
+	s := newTestTokenService(t)
+	ctx := context.Background()
+	user := &User{Model: gorm.Model{ID: 1}, Role: RoleUser}
+
+	before, err := s.Issue(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LogoutAll(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Validate(ctx, before.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("token issued before LogoutAll: err = %v, want ErrTokenRevoked", err)
+	}
+
+	// 与 LogoutAll 同一秒重新登录签发的令牌仍然有效
+	after, err := s.Issue(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Validate(ctx, after.AccessToken); err != nil {
+		t.Fatalf("token issued after LogoutAll: %v", err)
+	}
+	if _, err := s.Refresh(ctx, before.RefreshToken, func(uint) (*User, error) { return user, nil }); err == nil {
+		t.Fatal("refresh token issued before LogoutAll still works")
+	}
+}
@@ -0,0 +1,122 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var ErrNoEndpoint = errors.New("ethereum rpc url is not configured")
+
+// Client 以太坊 JSON-RPC 客户端，只实现后端需要的少量方法
+type Client struct {
+	url        string
+	httpClient *http.Client
+	nextID     uint64
+}
+
+func NewClient(url string) *Client {
+	return &Client{
+		url:        url,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// Call 发送一次 JSON-RPC 请求并把 result 解码到 result
+func (c *Client) Call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+	if c.url == "" {
+		return ErrNoEndpoint
+	}
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	body, err := json.Marshal(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      atomic.AddUint64(&c.nextID, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to call %s: http status %d", method, resp.StatusCode)
+	}
+
+	var out rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %v", method, err)
+	}
+	if out.Error != nil {
+		return out.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(out.Result, result)
+}
+
+// BlockNumber 返回当前链上最新区块高度
+func (c *Client) BlockNumber(ctx context.Context) (uint64, error) {
+	var hex string
+	if err := c.Call(ctx, &hex, "eth_blockNumber"); err != nil {
+		return 0, err
+	}
+	return ParseQuantity(hex)
+}
+
+// ParseQuantity 解析 JSON-RPC 中 0x 前缀的十六进制数量
+func ParseQuantity(hex string) (uint64, error) {
+	if !strings.HasPrefix(hex, "0x") {
+		return 0, fmt.Errorf("invalid quantity: %q", hex)
+	}
+	return strconv.ParseUint(hex[2:], 16, 64)
+}
+
+// EncodeQuantity 把数字编码为 JSON-RPC 的十六进制数量
+func EncodeQuantity(n uint64) string {
+	return "0x" + strconv.FormatUint(n, 16)
+}
@@ -0,0 +1,41 @@
+package chain
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+)
+
+type callMsg struct {
+	To   string `json:"to"`
+	Data string `json:"data"`
+}
+
+// CallContract 在最新区块上以 eth_call 调用合约的只读方法，返回 ABI 编码的返回值
+func (c *Client) CallContract(ctx context.Context, to string, data []byte) ([]byte, error) {
+	var result string
+	msg := callMsg{To: to, Data: "0x" + hex.EncodeToString(data)}
+	if err := c.Call(ctx, &result, "eth_call", msg, "latest"); err != nil {
+		return nil, err
+	}
+	return DecodeHex(result)
+}
+
+// MethodID 返回方法签名的 4 字节选择器，例如 "pools(address,address)"
+func MethodID(signature string) []byte {
+	return Keccak256([]byte(signature))[:4]
+}
+
+// AddressWord 把地址编码为 ABI 的 32 字节参数
+func AddressWord(address string) ([]byte, error) {
+	if !IsHexAddress(address) {
+		return nil, fmt.Errorf("invalid address: %q", address)
+	}
+	b, err := DecodeHex(address)
+	if err != nil {
+		return nil, err
+	}
+	word := make([]byte, 32)
+	copy(word[12:], b)
+	return word, nil
+}
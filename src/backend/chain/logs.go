@@ -0,0 +1,195 @@
+package chain
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Log eth_getLogs 返回的单条日志
+type Log struct {
+	Address         string
+	Topics          []string
+	Data            []byte
+	BlockNumber     uint64
+	BlockHash       string
+	TransactionHash string
+	LogIndex        uint
+	Removed         bool
+}
+
+type rpcLog struct {
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	BlockNumber     string   `json:"blockNumber"`
+	BlockHash       string   `json:"blockHash"`
+	TransactionHash string   `json:"transactionHash"`
+	LogIndex        string   `json:"logIndex"`
+	Removed         bool     `json:"removed"`
+}
+
+func (l *Log) UnmarshalJSON(data []byte) error {
+	var raw rpcLog
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	blockNumber, err := ParseQuantity(raw.BlockNumber)
+	if err != nil {
+		return fmt.Errorf("invalid log blockNumber: %v", err)
+	}
+	logIndex, err := ParseQuantity(raw.LogIndex)
+	if err != nil {
+		return fmt.Errorf("invalid log logIndex: %v", err)
+	}
+	payload, err := DecodeHex(raw.Data)
+	if err != nil {
+		return fmt.Errorf("invalid log data: %v", err)
+	}
+
+	*l = Log{
+		Address:         strings.ToLower(raw.Address),
+		Topics:          make([]string, len(raw.Topics)),
+		Data:            payload,
+		BlockNumber:     blockNumber,
+		BlockHash:       strings.ToLower(raw.BlockHash),
+		TransactionHash: strings.ToLower(raw.TransactionHash),
+		LogIndex:        uint(logIndex),
+		Removed:         raw.Removed,
+	}
+	for i, topic := range raw.Topics {
+		l.Topics[i] = strings.ToLower(topic)
+	}
+	return nil
+}
+
+// FilterQuery eth_getLogs 的过滤条件，区块范围为闭区间
+type FilterQuery struct {
+	FromBlock uint64
+	ToBlock   uint64
+	Addresses []string
+	Topics    [][]string
+}
+
+// GetLogs 按过滤条件拉取日志
+func (c *Client) GetLogs(ctx context.Context, q FilterQuery) ([]Log, error) {
+	filter := map[string]interface{}{
+		"fromBlock": EncodeQuantity(q.FromBlock),
+		"toBlock":   EncodeQuantity(q.ToBlock),
+	}
+	if len(q.Addresses) > 0 {
+		filter["address"] = q.Addresses
+	}
+	if len(q.Topics) > 0 {
+		filter["topics"] = q.Topics
+	}
+
+	var logs []Log
+	if err := c.Call(ctx, &logs, "eth_getLogs", filter); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+var ErrBlockNotFound = errors.New("block not found")
+
+// Header 区块头中后端关心的字段
+type Header struct {
+	Number     uint64
+	Hash       string
+	ParentHash string
+	Timestamp  uint64
+}
+
+// HeaderByNumber 通过 eth_getBlockByNumber 获取区块头，不包含交易
+func (c *Client) HeaderByNumber(ctx context.Context, number uint64) (*Header, error) {
+	var raw *struct {
+		Number     string `json:"number"`
+		Hash       string `json:"hash"`
+		ParentHash string `json:"parentHash"`
+		Timestamp  string `json:"timestamp"`
+	}
+	if err := c.Call(ctx, &raw, "eth_getBlockByNumber", EncodeQuantity(number), false); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("%w: %d", ErrBlockNotFound, number)
+	}
+
+	n, err := ParseQuantity(raw.Number)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block number: %v", err)
+	}
+	ts, err := ParseQuantity(raw.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block timestamp: %v", err)
+	}
+	return &Header{
+		Number:     n,
+		Hash:       strings.ToLower(raw.Hash),
+		ParentHash: strings.ToLower(raw.ParentHash),
+		Timestamp:  ts,
+	}, nil
+}
+
+// Keccak256 以太坊使用的 legacy keccak256
+func Keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// EventTopic 返回事件签名对应的 topic0，例如 "Transfer(address,address,uint256)"
+func EventTopic(signature string) string {
+	return "0x" + hex.EncodeToString(Keccak256([]byte(signature)))
+}
+
+// DecodeHex 解析 0x 前缀的十六进制字节串
+func DecodeHex(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return nil, fmt.Errorf("missing 0x prefix: %q", s)
+	}
+	return hex.DecodeString(s[2:])
+}
+
+// TopicAddress 把 indexed address 参数还原为 0x 开头的小写地址
+func TopicAddress(topic string) (string, error) {
+	b, err := DecodeHex(topic)
+	if err != nil {
+		return "", err
+	}
+	if len(b) != 32 {
+		return "", fmt.Errorf("invalid topic length: %d", len(b))
+	}
+	return "0x" + hex.EncodeToString(b[12:]), nil
+}
+
+// TopicUint 把 indexed uint256 参数还原为整数
+func TopicUint(topic string) (*big.Int, error) {
+	b, err := DecodeHex(topic)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("invalid topic length: %d", len(b))
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// WordUint 读取 ABI 编码数据中第 i 个 32 字节的 uint256
+func WordUint(data []byte, i int) (*big.Int, error) {
+	start := i * 32
+	if start+32 > len(data) {
+		return nil, fmt.Errorf("data too short for word %d", i)
+	}
+	return new(big.Int).SetBytes(data[start : start+32]), nil
+}
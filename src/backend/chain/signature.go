@@ -0,0 +1,73 @@
+package chain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// PersonalMessageHash 按 personal_sign (EIP-191) 规则计算待签名哈希
+func PersonalMessageHash(message []byte) []byte {
+	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(message))
+	return Keccak256([]byte(prefix), message)
+}
+
+// RecoverPersonalSign 从 personal_sign 签名 (r || s || v) 中恢复签名者地址，返回 EIP-55 格式
+func RecoverPersonalSign(message, signature []byte) (string, error) {
+	if len(signature) != 65 {
+		return "", fmt.Errorf("%w: expected 65 bytes, got %d", ErrInvalidSignature, len(signature))
+	}
+	v := signature[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return "", fmt.Errorf("%w: invalid recovery id", ErrInvalidSignature)
+	}
+
+	// secp256k1 库的紧凑签名格式为 <27 + recid> || r || s
+	compact := make([]byte, 65)
+	compact[0] = 27 + v
+	copy(compact[1:], signature[:64])
+
+	pub, _, err := ecdsa.RecoverCompact(compact, PersonalMessageHash(message))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return PubkeyToAddress(pub), nil
+}
+
+// PubkeyToAddress 取未压缩公钥哈希的后 20 字节作为地址
+func PubkeyToAddress(pub *secp256k1.PublicKey) string {
+	hash := Keccak256(pub.SerializeUncompressed()[1:])
+	return ChecksumAddress("0x" + hex.EncodeToString(hash[12:]))
+}
+
+// IsHexAddress 判断是否为 0x 开头的 20 字节十六进制地址
+func IsHexAddress(s string) bool {
+	if len(s) != 42 || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	_, err := hex.DecodeString(s[2:])
+	return err == nil
+}
+
+// ChecksumAddress 返回 EIP-55 大小写校验格式的地址
+func ChecksumAddress(address string) string {
+	addr := strings.ToLower(strings.TrimPrefix(address, "0x"))
+	hash := hex.EncodeToString(Keccak256([]byte(addr)))
+
+	out := []byte(addr)
+	for i, c := range out {
+		if c >= 'a' && c <= 'f' && hash[i] >= '8' {
+			out[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(out)
+}
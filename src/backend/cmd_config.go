@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"defi-backend/config"
+)
+
+const configUsage = `Usage:
+  config print [--resolved] [--offline] [--file path]
+      打印合并后的配置 (默认值 < 配置文件 < Nacos < 环境变量)，密钥会被隐藏；
+      --resolved 同时显示每个值的来源，--offline 不连接 Nacos
+  config encrypt [--key-file path] [value]
+      加密一个值并输出可以写入配置的 ENC(...)，没有给出 value 时从标准输入读取一行；
+      密钥文件默认为环境变量 CONFIG_KEY_FILE
+  config keygen [--out path]
+      生成新的密钥，默认输出到标准输出
+`
+
+// runConfigCommand 处理 config 子命令，返回进程退出码
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, configUsage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "print":
+		err = configPrint(args[1:])
+	case "encrypt":
+		err = configEncrypt(args[1:])
+	case "keygen":
+		err = configKeygen(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, configUsage)
+		return 2
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func configPrint(args []string) error {
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	resolvedView := fs.Bool("resolved", false, "show the source of each value")
+	file := fs.String("file", configFile, "local config file")
+	offline := fs.Bool("offline", false, "do not connect to Nacos")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	loader, err := config.Bootstrap(*file, config.BootstrapOptions{Offline: *offline})
+	if err != nil {
+		return err
+	}
+	resolved, err := loader.Load()
+	if err != nil {
+		return err
+	}
+	return resolved.Print(os.Stdout, *resolvedView)
+}
+
+func configEncrypt(args []string) error {
+	fs := flag.NewFlagSet("config encrypt", flag.ContinueOnError)
+	keyFile := fs.String("key-file", os.Getenv(config.KeyFileEnv), "secret key file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *keyFile == "" {
+		return fmt.Errorf("--key-file or %s is required", config.KeyFileEnv)
+	}
+	cipher, err := config.LoadKeyFile(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	// 从标准输入读取可以避免明文出现在 shell 历史中
+	var value string
+	switch fs.NArg() {
+	case 0:
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		value = strings.TrimRight(line, "\r\n")
+	case 1:
+		value = fs.Arg(0)
+	default:
+		return errors.New("expected a single value")
+	}
+
+	encrypted, err := config.EncryptValue(cipher, value)
+	if err != nil {
+		return err
+	}
+	fmt.Println(encrypted)
+	return nil
+}
+
+func configKeygen(args []string) error {
+	fs := flag.NewFlagSet("config keygen", flag.ContinueOnError)
+	out := fs.String("out", "", "write the key to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	key, err := config.GenerateKey()
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		fmt.Println(key)
+		return nil
+	}
+	// O_EXCL 避免覆盖已有密钥，否则用旧密钥加密的值将无法解密
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, key); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
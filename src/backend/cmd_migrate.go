@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"defi-backend/config"
+	"defi-backend/database"
+	"defi-backend/migrate"
+	"defi-backend/migrations"
+
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `Usage:
+  migrate up [--to version] [--offline]   执行未执行的迁移，--to 只执行到指定版本
+  migrate down [--steps n] [--offline]    回滚最近执行的 n 个迁移，默认 1 个
+  migrate status [--offline]              查看所有迁移的执行状态
+  migrate create <name> [--go]            创建 SQL 迁移，--go 创建 Go 迁移
+`
+
+// 启动时自动迁移等待迁移锁的最长时间
+const startupMigrateTimeout = 10 * time.Minute
+
+// runMigrateCommand 处理 migrate 子命令，返回进程退出码
+func runMigrateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "up", "down", "status":
+		err = migrateDatabase(args[0], args[1:])
+	case "create":
+		err = migrateCreate(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func migrateDatabase(command string, args []string) error {
+	fs := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	offline := fs.Bool("offline", false, "do not connect to Nacos")
+	target := fs.Int64("to", 0, "target version for up")
+	steps := fs.Int("steps", 1, "number of migrations to revert")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	loader, err := config.Bootstrap(configFile, config.BootstrapOptions{Offline: *offline})
+	if err != nil {
+		return err
+	}
+	resolved, err := loader.Load()
+	if err != nil {
+		return err
+	}
+	db, err := database.InitDB(resolved.Config)
+	if err != nil {
+		return err
+	}
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch command {
+	case "up":
+		done, err := migrator.Up(ctx, *target)
+		printMigrations("Applied", done)
+		return err
+	case "down":
+		done, err := migrator.Down(ctx, *steps)
+		printMigrations("Reverted", done)
+		return err
+	default:
+		return printStatus(migrator)
+	}
+}
+
+func migrateCreate(args []string) error {
+	fs := flag.NewFlagSet("migrate create", flag.ContinueOnError)
+	goMigration := fs.Bool("go", false, "create a Go migration instead of SQL files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// 允许 flag 写在名称之后，如 migrate create add_index --go
+	if fs.NArg() == 0 {
+		return errors.New("migrate create requires a name")
+	}
+	name := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("migrate create requires a single name")
+	}
+
+	files, err := migrate.Create(migrations.Dir, migrations.SQLDir, name, *goMigration, time.Now())
+	for _, file := range files {
+		fmt.Println("Created", file)
+	}
+	return err
+}
+
+func newMigrator(db *gorm.DB) (*migrate.Migrator, error) {
+	all, err := migrations.All()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, all)
+}
+
+// migrateOnStartup 按 database.migrate 检查或执行迁移，schema 落后时返回错误
+func migrateOnStartup(db *gorm.DB, mode string) error {
+	if mode == config.MigrateOff {
+		return nil
+	}
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	if mode != config.MigrateAuto {
+		if err := migrator.Check(); err != nil {
+			return fmt.Errorf("%v; run `migrate up` or set database.migrate to auto", err)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), startupMigrateTimeout)
+	defer cancel()
+	done, err := migrator.Up(ctx, 0)
+	for _, m := range done {
+		log.Printf("Applied migration %d_%s", m.Version, m.Name)
+	}
+	return err
+}
+
+func printMigrations(verb string, done []migrate.Migration) {
+	for _, m := range done {
+		fmt.Printf("%s %d_%s\n", verb, m.Version, m.Name)
+	}
+	if len(done) == 0 {
+		fmt.Println("Nothing to do")
+	}
+}
+
+func printStatus(migrator *migrate.Migrator) error {
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Missing {
+			applied += " (not in this build)"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// KeyFileEnv 指定解密配置所用密钥文件的环境变量
+const KeyFileEnv = "CONFIG_KEY_FILE"
+
+// BootstrapOptions Offline 为 true 时不连接 Nacos；Cipher 为空时使用 CONFIG_KEY_FILE 指定的密钥文件
+type BootstrapOptions struct {
+	Offline bool
+	Cipher  Cipher
+}
+
+// Bootstrap 创建服务启动使用的配置源：本地配置文件 < Nacos < 环境变量。
+// opts.Offline 为 true 或配置了 nacos.offline 时不连接 Nacos；
+// Nacos 不可用时按 nacos.fallback 使用缓存、只用本地配置或启动失败
+func Bootstrap(configPath string, opts BootstrapOptions) (*Loader, error) {
+	cipher := opts.Cipher
+	if cipher == nil {
+		if keyFile := os.Getenv(KeyFileEnv); keyFile != "" {
+			c, err := LoadKeyFile(keyFile)
+			if err != nil {
+				return nil, err
+			}
+			cipher = c
+		}
+	}
+	newLoader := func(sources ...ConfigSource) *Loader {
+		l := NewLoader(sources...)
+		l.SetCipher(cipher)
+		return l
+	}
+
+	file := NewFileSource(configPath)
+	env := NewEnvSource()
+
+	local, err := newLoader(file, env).Load()
+	if err != nil {
+		return nil, err
+	}
+	cfg := local.Config.Nacos
+	if opts.Offline || cfg.Offline {
+		log.Println("Offline mode: Nacos is disabled, using local config only")
+		return newLoader(file, env, NewMemorySource(SourceMemory, map[string]interface{}{"nacos.offline": true})), nil
+	}
+
+	client, err := NewNacosClient(cfg)
+	nacos := NewNacosSource(client, cfg)
+	if err == nil {
+		err = nacos.Fetch()
+	}
+	if err == nil {
+		loader := newLoader(file, nacos, env)
+		// 只缓存校验通过的配置，未通过时由调用方报告校验错误
+		if resolved, err := loader.Load(); err == nil && resolved.Config.Validate() == nil {
+			if err := nacos.SaveCache(); err != nil {
+				log.Printf("Failed to cache Nacos config: %v", err)
+			}
+		}
+		return loader, nil
+	}
+
+	switch cfg.Fallback {
+	case FallbackCache:
+		if cacheErr := nacos.LoadCache(); cacheErr != nil {
+			return nil, fmt.Errorf("nacos is unavailable (%v) and no cached config can be used: %v", err, cacheErr)
+		}
+		log.Printf("Nacos is unavailable, using cached config: %v", err)
+		return newLoader(file, nacos, env), nil
+	case FallbackFile:
+		log.Printf("Nacos is unavailable, using local config only: %v", err)
+		if client == nil {
+			return newLoader(file, env), nil
+		}
+		// 保留 Nacos 配置源，服务器恢复后通过监听获取配置
+		return newLoader(file, nacos, env), nil
+	default:
+		return nil, fmt.Errorf("failed to get config from Nacos: %v", err)
+	}
+}
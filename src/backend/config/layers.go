@@ -0,0 +1,223 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Source 配置值的来源
+type Source string
+
+// 服务启动时配置按以下顺序合并，后面的来源覆盖前面的来源：
+//
+//	默认值 < 本地配置文件 < Nacos < 环境变量
+//
+// 环境变量只覆盖 EnvBindings 中列出的键，值为空的环境变量视为未设置
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceNacos   Source = "nacos"
+	SourceEnv     Source = "env"
+	SourceMemory  Source = "memory"
+)
+
+// Defaults 配置的默认值
+var Defaults = map[string]interface{}{
+	"server.port":                      8080,
+	"nacos.port":                       8848,
+	"nacos.namespace":                  "public",
+	"nacos.group":                      "DEFAULT_GROUP",
+	"database.driver":                  DriverMySQL,
+	"database.migrate":                 MigrateCheck,
+	"database.replicas.max_lag":        "5s",
+	"database.replicas.check_interval": "5s",
+	"database.replicas.sticky_window":  "10s",
+	"redis.host":                       "localhost",
+	"redis.port":                       6379,
+	"jwt.access_ttl":                   "15m",
+	"jwt.refresh_ttl":                  "720h",
+	"ethereum.chain_id":                1,
+	"ethereum.indexer.confirmations":   12,
+	"ethereum.indexer.finality_depth":  64,
+	"nacos.fallback":                   FallbackCache,
+	"log.level":                        "info",
+	"oracle.max_age":                   "2m",
+	"oracle.manual_max_age":            "24h",
+	"oracle.max_deviation":             0.05,
+	"oracle.min_sources":               2,
+	"oracle.dex_interval":              "30s",
+	"oracle.dex_price":                 "spot",
+	"oracle.dex_twap_window":           "30m",
+	"twap.sample_interval":             "15s",
+	"twap.retention":                   "24h",
+	"alerts.default_cooldown":          "1h",
+	"alerts.min_cooldown":              "1m",
+	"alerts.max_per_user":              50,
+	"alerts.webhook_timeout":           "5s",
+}
+
+// EnvBindings 环境变量到配置键的映射
+var EnvBindings = map[string]string{
+	"CONFIG_OFFLINE":           "nacos.offline",
+	"NACOS_FALLBACK":           "nacos.fallback",
+	"PORT":                     "server.port",
+	"SIWE_DOMAIN":              "server.domain",
+	"DB_DRIVER":                "database.driver",
+	"DB_DSN":                   "database.dsn",
+	"DB_MIGRATE":               "database.migrate",
+	"DB_REPLICA_DSNS":          "database.replicas.dsns",
+	"REDIS_ADDR":               "redis.addr",
+	"REDIS_PASSWORD":           "redis.password",
+	"RABBITMQ_URL":             "rabbitmq.url",
+	"JWT_SECRET":               "jwt.secret",
+	"JWT_EXPIRATION":           "jwt.access_ttl",
+	"JWT_REFRESH_EXPIRATION":   "jwt.refresh_ttl",
+	"ETH_RPC_URL":              "ethereum.rpc_url",
+	"SIWE_CHAIN_ID":            "ethereum.chain_id",
+	"DEX_CONTRACT_ADDRESS":     "ethereum.contracts.dex",
+	"LENDING_CONTRACT_ADDRESS": "ethereum.contracts.lending",
+	"FARMING_CONTRACT_ADDRESS": "ethereum.contracts.farming",
+	"INDEXER_START_BLOCK":      "ethereum.indexer.start_block",
+	"INDEXER_CONFIRMATIONS":    "ethereum.indexer.confirmations",
+	"INDEXER_FINALITY_DEPTH":   "ethereum.indexer.finality_depth",
+}
+
+// Loader 按顺序合并配置源，后面的配置源覆盖前面的，默认值始终在最底层。
+// 各配置源中的 ENC(...) 值在合并前用 cipher 解密
+type Loader struct {
+	sources []ConfigSource
+	cipher  Cipher
+}
+
+// Resolved 合并后的配置，Settings、Sources 和 Encrypted 以 "section.key" 为键
+type Resolved struct {
+	Config    *Config
+	Settings  map[string]interface{}
+	Sources   map[string]Source
+	Encrypted map[string]bool
+
+	plaintexts map[string]string
+}
+
+func NewLoader(sources ...ConfigSource) *Loader {
+	return &Loader{sources: sources}
+}
+
+// SetCipher 设置解密 ENC(...) 值使用的密钥，未设置时遇到加密值会返回 ErrNoSecretKey
+func (l *Loader) SetCipher(c Cipher) {
+	l.cipher = c
+}
+
+// Sources 返回配置源，按优先级从低到高排列
+func (l *Loader) Sources() []ConfigSource {
+	return l.sources
+}
+
+// Load 读取并合并所有配置源
+func (l *Loader) Load() (*Resolved, error) {
+	return l.LoadWith("", nil)
+}
+
+// LoadWith 与 Load 相同，但名为 name 的配置源使用 settings 代替其当前内容，
+// 用于在接受变更之前预先合并和校验
+func (l *Loader) LoadWith(name Source, settings map[string]interface{}) (*Resolved, error) {
+	v := viper.New()
+	sources := make(map[string]Source)
+	plaintexts := make(map[string]string)
+
+	for key, value := range Defaults {
+		v.SetDefault(key, value)
+		sources[key] = SourceDefault
+	}
+
+	for _, src := range l.sources {
+		layer := settings
+		if src.Name() != name {
+			var err error
+			if layer, err = src.Load(); err != nil {
+				return nil, fmt.Errorf("failed to load %s config: %v", src.Name(), err)
+			}
+		}
+		layer = copySettings(layer)
+		if err := decryptSettings(l.cipher, "", layer, plaintexts); err != nil {
+			return nil, fmt.Errorf("failed to load %s config: %v", src.Name(), err)
+		}
+		if err := mergeLayer(v, layer, src.Name(), sources); err != nil {
+			return nil, err
+		}
+	}
+
+	var config Config
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %v", scrubError(err, plaintexts))
+	}
+
+	resolved := &Resolved{
+		Config:     &config,
+		Settings:   make(map[string]interface{}),
+		Sources:    sources,
+		Encrypted:  make(map[string]bool),
+		plaintexts: plaintexts,
+	}
+	for _, key := range v.AllKeys() {
+		resolved.Settings[key] = v.Get(key)
+	}
+	for key := range plaintexts {
+		resolved.Encrypted[key] = true
+	}
+	return resolved, nil
+}
+
+// Scrub 去掉错误信息中出现的解密后的明文，用于记录配置相关的错误
+func (r *Resolved) Scrub(err error) error {
+	if err == nil {
+		return nil
+	}
+	return scrubError(err, r.plaintexts)
+}
+
+// mergeLayer 把一层配置合并到 v，并记录其中每个叶子键的来源
+func mergeLayer(v *viper.Viper, layer map[string]interface{}, source Source, sources map[string]Source) error {
+	if len(layer) == 0 {
+		return nil
+	}
+	// viper 合并时会引用并修改传入的 map，这里传入副本以免改动配置源的内容
+	if err := v.MergeConfigMap(copySettings(layer)); err != nil {
+		return fmt.Errorf("failed to merge %s config: %v", source, err)
+	}
+	for _, key := range flattenKeys("", layer) {
+		sources[key] = source
+	}
+	return nil
+}
+
+func flattenKeys(prefix string, m map[string]interface{}) []string {
+	var keys []string
+	for k, value := range m {
+		key := strings.ToLower(k)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			keys = append(keys, flattenKeys(key, nested)...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func copySettings(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, value := range m {
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = copySettings(nested)
+		}
+		out[k] = value
+	}
+	return out
+}
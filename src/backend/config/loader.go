@@ -1,44 +1,196 @@
 package config
 
-import (
-	"fmt"
-
-	"github.com/spf13/viper"
-)
+import "time"
 
 type Config struct {
+	Server   ServerConfig
 	Nacos    NacosConfig
 	Database DatabaseConfig
 	Redis    RedisConfig
+	RabbitMQ RabbitMQConfig
+	Ethereum EthereumConfig
+	Alerts   AlertsConfig
+
+	// 以下配置支持通过 Nacos 热更新，JWT 只有密钥热更新，有效期修改后需要重启
+	JWT       JWTConfig
+	Log       LogConfig
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	Interest  InterestConfig
+	Oracle    OracleConfig
+	TWAP      TWAPConfig `mapstructure:"twap"`
+	Features  map[string]bool
 }
 
+// ServerConfig Domain 为 SIWE 消息中要求的域名，为空时不开放钱包登录
+type ServerConfig struct {
+	Port   int
+	Domain string
+}
+
+// DatabaseConfig 设置 DSN 时忽略其他连接字段，DSN 的格式取决于 Driver；
+// SQLite 没有设置 DSN 时使用 DBName 作为数据库文件路径，Port 为 0 时使用驱动的默认端口。
+// Migrate 为启动时的迁移策略：check 有未执行的迁移时拒绝启动，auto 自动执行，off 不检查
 type DatabaseConfig struct {
+	Driver   string
+	DSN      string
+	Migrate  string
 	Host     string
 	Port     int
 	Username string
 	Password string
 	DBName   string
+	Replicas ReplicasConfig
 }
 
+// ReplicasConfig 只读副本，驱动与主库相同；列表和历史查询在健康的副本上执行，
+// 复制延迟超过 MaxLag 的副本暂停使用。客户端写入后 StickyWindow 内的请求仍读主库
+type ReplicasConfig struct {
+	DSNs          []string      `mapstructure:"dsns"`
+	MaxLag        time.Duration `mapstructure:"max_lag"`
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+	StickyWindow  time.Duration `mapstructure:"sticky_window"`
+}
+
+// 支持的数据库驱动
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// 启动时的迁移策略
+const (
+	MigrateCheck = "check"
+	MigrateAuto  = "auto"
+	MigrateOff   = "off"
+)
+
+// RedisConfig 设置 Addr (host:port) 时忽略 Host 和 Port
 type RedisConfig struct {
+	Addr     string
 	Host     string
 	Port     int
 	Password string
 	DB       int
 }
 
-func LoadConfig(configPath string) (*Config, error) {
-	// 加载本地配置文件
-	viper.SetConfigFile(configPath)
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("failed to read config file: %v", err)
-	}
+type RabbitMQConfig struct {
+	URL string
+}
 
-	// 解析配置
-	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %v", err)
-	}
+// EthereumConfig 链上节点、合约地址和事件索引参数，RPCURL 为空时不启动索引
+type EthereumConfig struct {
+	RPCURL    string `mapstructure:"rpc_url"`
+	ChainID   uint64 `mapstructure:"chain_id"`
+	Contracts ContractsConfig
+	Indexer   IndexerConfig
+}
+
+type ContractsConfig struct {
+	Dex     string
+	Lending string
+	Farming string
+}
+
+type IndexerConfig struct {
+	StartBlock    uint64 `mapstructure:"start_block"`
+	Confirmations uint64
+	FinalityDepth uint64 `mapstructure:"finality_depth"`
+}
+
+// AlertsConfig 价格提醒：未指定冷却时间的提醒使用 DefaultCooldown，不能短于 MinCooldown，
+// 每个用户最多 MaxPerUser 个提醒。默认不允许 webhook 回调到回环和内网地址
+type AlertsConfig struct {
+	DefaultCooldown      time.Duration `mapstructure:"default_cooldown"`
+	MinCooldown          time.Duration `mapstructure:"min_cooldown"`
+	MaxPerUser           int           `mapstructure:"max_per_user"`
+	WebhookTimeout       time.Duration `mapstructure:"webhook_timeout"`
+	AllowPrivateWebhooks bool          `mapstructure:"allow_private_webhooks"`
+}
+
+// LogConfig 日志级别：debug、info、warn、error，为空时为 info
+type LogConfig struct {
+	Level string
+}
+
+// RateLimitConfig 按客户端 IP 限流，RequestsPerSecond 为 0 时不限流
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	Burst             int
+}
+
+// InterestConfig 按代币覆盖借贷市场的利率参数，未配置的市场使用数据库中的参数
+type InterestConfig struct {
+	Markets map[string]MarketRateConfig
+}
+
+// MarketRateConfig 字段含义与 models.LendingMarket 相同，按 1e18 放大；空字段表示不覆盖
+type MarketRateConfig struct {
+	RateModel             string `mapstructure:"rate_model"`
+	BaseRatePerYear       string `mapstructure:"base_rate_per_year"`
+	MultiplierPerYear     string `mapstructure:"multiplier_per_year"`
+	JumpMultiplierPerYear string `mapstructure:"jump_multiplier_per_year"`
+	Kink                  string `mapstructure:"kink"`
+	ReserveFactor         string `mapstructure:"reserve_factor"`
+}
+
+// OracleConfig 多来源价格聚合：超过 MaxAge 的报价 (manual 来源为 ManualMaxAge) 不参与计算，
+// 与中位数的偏离超过 MaxDeviation 的报价被剔除，剩余来源少于 MinSources 时不发布价格。
+// DEX 价格每隔 DexInterval 从与 DexQuoteTokens 组成的交易对计算，这些代币按 1 计价；列表为空时不采集。
+// DexPrice 为 spot 时使用当前储备的现货价格，为 twap 时使用最近 DexTWAPWindow 的时间加权平均价格。
+// Sources 为允许从队列提交报价的来源，只能是 cex:<名称>，例如 cex:binance；dex 和 manual 报价只在内部产生
+type OracleConfig struct {
+	Sources        []string      `mapstructure:"sources"`
+	MaxAge         time.Duration `mapstructure:"max_age"`
+	ManualMaxAge   time.Duration `mapstructure:"manual_max_age"`
+	MaxDeviation   float64       `mapstructure:"max_deviation"`
+	MinSources     int           `mapstructure:"min_sources"`
+	DexInterval    time.Duration `mapstructure:"dex_interval"`
+	DexQuoteTokens []string      `mapstructure:"dex_quote_tokens"`
+	DexPrice       string        `mapstructure:"dex_price"`
+	DexTWAPWindow  time.Duration `mapstructure:"dex_twap_window"`
+}
 
-	return &config, nil
+// 可选的 DEX 价格
+const (
+	DexPriceSpot = "spot"
+	DexPriceTWAP = "twap"
+)
+
+// TWAPConfig 每隔 SampleInterval 采样一次交易对储备，累计价格的观测点保留 Retention
+type TWAPConfig struct {
+	SampleInterval time.Duration `mapstructure:"sample_interval"`
+	Retention      time.Duration
+}
+
+// JWTConfig 令牌签名密钥，SigningKey 为当前用于签名的 kid，
+// 列表中的其他密钥只用于校验，轮换期间新旧密钥同时有效。
+// 没有配置 Keys 时使用 Secret 作为 HS256 密钥
+type JWTConfig struct {
+	SigningKey string         `mapstructure:"signing_key"`
+	Keys       []JWTKeyConfig `mapstructure:"keys"`
+	Secret     string         `mapstructure:"secret"`
+	AccessTTL  time.Duration  `mapstructure:"access_ttl"`
+	RefreshTTL time.Duration  `mapstructure:"refresh_ttl"`
+}
+
+// JWTKeyConfig 单个密钥，HS256 使用 Secret，RS256/EdDSA 使用 PEM 格式的密钥或密钥文件；
+// 只配置公钥的密钥只能用于校验
+type JWTKeyConfig struct {
+	ID             string `mapstructure:"kid"`
+	Algorithm      string `mapstructure:"alg"`
+	Secret         string `mapstructure:"secret"`
+	PrivateKey     string `mapstructure:"private_key"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	PublicKey      string `mapstructure:"public_key"`
+	PublicKeyFile  string `mapstructure:"public_key_file"`
+}
+
+// LoadConfig 加载默认值、本地配置文件和环境变量，不包含 Nacos 配置
+func LoadConfig(configPath string) (*Config, error) {
+	resolved, err := NewLoader(NewFileSource(configPath), NewEnvSource()).Load()
+	if err != nil {
+		return nil, err
+	}
+	return resolved.Config, nil
 }
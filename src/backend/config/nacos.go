@@ -1,22 +1,42 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/nacos-group/nacos-sdk-go/clients"
+	"github.com/nacos-group/nacos-sdk-go/clients/config_client"
 	"github.com/nacos-group/nacos-sdk-go/common/constant"
 	"github.com/nacos-group/nacos-sdk-go/vo"
 )
 
+// NacosConfig Offline 为 true 时不连接 Nacos；Fallback 决定启动时 Nacos 不可用的处理方式，
+// CacheFile 保存最近一次校验通过的 Nacos 配置，为空时放在临时目录
 type NacosConfig struct {
-	ServerAddr string
+	ServerAddr string `mapstructure:"server_addr"`
 	Port       uint64
 	Namespace  string
 	Group      string
-	DataId     string
+	DataId     string `mapstructure:"data_id"`
+	Offline    bool
+	Fallback   string
+	CacheFile  string `mapstructure:"cache_file"`
 }
 
-func NewNacosClient(config NacosConfig) (clients.IConfigClient, error) {
+// 启动时 Nacos 不可用的处理方式
+const (
+	// FallbackNone 启动失败
+	FallbackNone = "none"
+	// FallbackCache 使用最近一次校验通过的缓存，没有缓存时启动失败
+	FallbackCache = "cache"
+	// FallbackFile 只使用本地配置和环境变量启动，Nacos 恢复后通过监听获取配置
+	FallbackFile = "file"
+)
+
+func NewNacosClient(config NacosConfig) (config_client.IConfigClient, error) {
 	// 创建clientConfig
 	clientConfig := constant.ClientConfig{
 		NamespaceId:         config.Namespace,
@@ -49,7 +69,7 @@ func NewNacosClient(config NacosConfig) (clients.IConfigClient, error) {
 	return configClient, nil
 }
 
-func GetConfig(configClient clients.IConfigClient, group, dataId string) (string, error) {
+func GetConfig(configClient config_client.IConfigClient, group, dataId string) (string, error) {
 	content, err := configClient.GetConfig(vo.ConfigParam{
 		DataId: dataId,
 		Group:  group,
@@ -59,3 +79,122 @@ func GetConfig(configClient clients.IConfigClient, group, dataId string) (string
 	}
 	return content, nil
 }
+
+// NacosSource Nacos 中的 YAML 配置。Load 返回最近一次被接受的内容，不会访问网络；
+// 被接受的内容会写入 CacheFile，作为下次启动时的 last-known-good 配置。
+// Nacos SDK 自带的缓存保存的是最近一次下发的内容，可能是被拒绝的配置，因此不使用它
+type NacosSource struct {
+	client    config_client.IConfigClient
+	group     string
+	dataId    string
+	cacheFile string
+
+	mu      sync.Mutex
+	content string
+}
+
+// NewNacosSource client 为空时只能从缓存加载
+func NewNacosSource(client config_client.IConfigClient, cfg NacosConfig) *NacosSource {
+	cacheFile := cfg.CacheFile
+	if cacheFile == "" {
+		cacheFile = filepath.Join(os.TempDir(), "nacos", "last-good", cfg.Group+"_"+cfg.DataId+".yaml")
+	}
+	return &NacosSource{
+		client:    client,
+		group:     cfg.Group,
+		dataId:    cfg.DataId,
+		cacheFile: cacheFile,
+	}
+}
+
+func (s *NacosSource) Name() Source {
+	return SourceNacos
+}
+
+func (s *NacosSource) Load() (map[string]interface{}, error) {
+	s.mu.Lock()
+	content := s.content
+	s.mu.Unlock()
+	return parseYAML(content)
+}
+
+// Fetch 从 Nacos 读取配置
+func (s *NacosSource) Fetch() error {
+	if s.client == nil {
+		return errors.New("nacos client is not available")
+	}
+	content, err := GetConfig(s.client, s.group, s.dataId)
+	if err != nil {
+		return err
+	}
+	if _, err := parseYAML(content); err != nil {
+		return err
+	}
+	s.set(content)
+	return nil
+}
+
+// LoadCache 从缓存文件读取最近一次校验通过的配置
+func (s *NacosSource) LoadCache() error {
+	data, err := os.ReadFile(s.cacheFile)
+	if err != nil {
+		return err
+	}
+	if _, err := parseYAML(string(data)); err != nil {
+		return err
+	}
+	s.set(string(data))
+	return nil
+}
+
+// SaveCache 把当前内容写入缓存文件，应在配置校验通过后调用
+func (s *NacosSource) SaveCache() error {
+	s.mu.Lock()
+	content := s.content
+	s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.cacheFile), 0o700); err != nil {
+		return err
+	}
+	tmp := s.cacheFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.cacheFile)
+}
+
+// Watch 监听 Nacos 配置变更，onChange 接受后更新内容并写入缓存
+func (s *NacosSource) Watch(onChange ChangeFunc) error {
+	if s.client == nil {
+		return errors.New("nacos client is not available")
+	}
+	return s.client.ListenConfig(vo.ConfigParam{
+		DataId: s.dataId,
+		Group:  s.group,
+		OnChange: func(namespace, group, dataId, data string) {
+			settings, err := parseYAML(data)
+			if onChange(settings, err) != nil {
+				return
+			}
+			s.set(data)
+			// 缓存写入失败不影响已生效的配置，下次启动时使用旧缓存
+			_ = s.SaveCache()
+		},
+	})
+}
+
+func (s *NacosSource) Stop() error {
+	if s.client == nil {
+		return nil
+	}
+	return s.client.CancelListenConfig(vo.ConfigParam{
+		DataId: s.dataId,
+		Group:  s.group,
+	})
+}
+
+func (s *NacosSource) set(content string) {
+	s.mu.Lock()
+	s.content = content
+	s.mu.Unlock()
+}
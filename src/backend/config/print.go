@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const redacted = "******"
+
+// 以这些名字结尾的键视为密钥，打印时隐藏
+var secretKeySuffixes = []string{"password", "secret", "private_key"}
+
+var (
+	// MySQL 的 user:password@tcp(host)/db 形式的 DSN
+	dsnPassword = regexp.MustCompile(`^([^:@/]*):[^@]*@`)
+	// PostgreSQL 的 host=... password=... 形式的 DSN
+	dsnKeyValuePassword = regexp.MustCompile(`(password=)('[^']*'|\S*)`)
+)
+
+// Print 按键排序打印合并后的配置，密钥和加密过的值会被隐藏；withSources 为 true 时附带每个值的来源
+func (r *Resolved) Print(w io.Writer, withSources bool) error {
+	keys := make([]string, 0, len(r.Settings))
+	for key := range r.Settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if withSources {
+		fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	} else {
+		fmt.Fprintln(tw, "KEY\tVALUE")
+	}
+	for _, key := range keys {
+		value := Redact(key, r.Settings[key])
+		if r.Encrypted[key] {
+			value = redacted
+		}
+		if withSources {
+			source := r.Sources[key]
+			if source == "" {
+				source = SourceDefault
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", key, value, source)
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\n", key, value)
+		}
+	}
+	return tw.Flush()
+}
+
+// Redact 返回可以安全打印的配置值
+func Redact(key string, value interface{}) string {
+	s := fmt.Sprint(value)
+	if s == "" {
+		return s
+	}
+
+	for _, suffix := range secretKeySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return redacted
+		}
+	}
+
+	switch key {
+	case "jwt.keys":
+		return redactJWTKeys(value)
+	case "database.dsn":
+		return redactDSN(s)
+	case "database.replicas.dsns":
+		return redactDSNList(value)
+	case "rabbitmq.url":
+		return redactURL(s, false)
+	case "ethereum.rpc_url":
+		// 节点服务商的 API key 通常放在路径中
+		return redactURL(s, true)
+	}
+	return s
+}
+
+// redactURL 隐藏 URL 中的密码和查询参数，hidePath 为 true 时同时隐藏路径
+func redactURL(s string, hidePath bool) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redacted
+	}
+	if hidePath && u.Path != "" && u.Path != "/" {
+		u.Path = "/" + redacted
+	}
+	// url 会转义占位符中的 *
+	return strings.ReplaceAll(u.String(), "%2A", "*")
+}
+
+// redactDSN 隐藏三种数据库 DSN 中的密码，SQLite 的文件路径原样打印
+func redactDSN(s string) string {
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return redacted
+		}
+		if u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+			}
+		}
+		if q := u.Query(); q.Get("password") != "" {
+			q.Set("password", redacted)
+			u.RawQuery = q.Encode()
+		}
+		return strings.ReplaceAll(u.String(), "%2A", "*")
+	}
+	if dsnKeyValuePassword.MatchString(s) {
+		return dsnKeyValuePassword.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return dsnPassword.ReplaceAllString(s, "$1:"+redacted+"@")
+}
+
+// redactDSNList 副本 DSN 可能来自配置文件中的列表，或环境变量中逗号分隔的字符串
+func redactDSNList(value interface{}) string {
+	var dsns []string
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			dsns = append(dsns, fmt.Sprint(item))
+		}
+	case []string:
+		dsns = v
+	default:
+		dsns = strings.Split(fmt.Sprint(v), ",")
+	}
+	for i, dsn := range dsns {
+		dsns[i] = redactDSN(strings.TrimSpace(dsn))
+	}
+	return "[" + strings.Join(dsns, " ") + "]"
+}
+
+// redactJWTKeys 只打印每个密钥的 kid 和算法
+func redactJWTKeys(value interface{}) string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return redacted
+	}
+	keys := make([]string, 0, len(list))
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			keys = append(keys, redacted)
+			continue
+		}
+		keys = append(keys, fmt.Sprintf("%v(%v)", m["kid"], m["alg"]))
+	}
+	return "[" + strings.Join(keys, " ") + "]"
+}
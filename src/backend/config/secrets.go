@@ -0,0 +1,196 @@
+package config
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 配置中的加密值写成 ENC(<base64 密文>)，在加载时解密；
+// 本地配置文件和 Nacos 中保存的始终是密文
+var encryptedValue = regexp.MustCompile(`^ENC\(([A-Za-z0-9+/=_-]*)\)$`)
+
+var ErrNoSecretKey = errors.New("config contains encrypted values but no secret key is configured")
+
+// Cipher 加解密配置中的密文，可以由本地密钥或 KMS 实现
+type Cipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// AESCipher AES-256-GCM，密文格式为 nonce || ciphertext
+type AESCipher struct {
+	aead cipher.AEAD
+}
+
+func NewAESCipher(key []byte) (*AESCipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secret key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESCipher{aead: aead}, nil
+}
+
+// LoadKeyFile 读取密钥文件，内容可以是 32 字节原始密钥、hex 或 base64 编码
+func LoadKeyFile(path string) (*AESCipher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret key file: %v", err)
+	}
+	key, err := decodeKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key file %s: %v", path, err)
+	}
+	return NewAESCipher(key)
+}
+
+// GenerateKey 生成 base64 编码的随机密钥，可以直接写入密钥文件
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func (c *AESCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (c *AESCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(ciphertext) < size {
+		return nil, errors.New("ciphertext too short")
+	}
+	return c.aead.Open(nil, ciphertext[:size], ciphertext[size:], nil)
+}
+
+func decodeKey(data []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if len(data) == 32 {
+		return data, nil
+	}
+	return nil, errors.New("expected 32 bytes as raw, hex or base64")
+}
+
+// KMS 外部密钥管理服务，密文中自带密钥标识
+type KMS interface {
+	Encrypt(ctx context.Context, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error)
+}
+
+// KMSCipher 把 KMS 适配为 Cipher，每次调用的超时为 timeout
+type KMSCipher struct {
+	kms     KMS
+	timeout time.Duration
+}
+
+func NewKMSCipher(kms KMS, timeout time.Duration) *KMSCipher {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &KMSCipher{kms: kms, timeout: timeout}
+}
+
+func (c *KMSCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	return c.kms.Encrypt(ctx, plaintext)
+}
+
+func (c *KMSCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	return c.kms.Decrypt(ctx, ciphertext)
+}
+
+// EncryptValue 返回可以写入配置的 ENC(...) 值
+func EncryptValue(c Cipher, plaintext string) (string, error) {
+	ciphertext, err := c.Encrypt([]byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return "ENC(" + base64.StdEncoding.EncodeToString(ciphertext) + ")", nil
+}
+
+// IsEncrypted 判断配置值是否为 ENC(...)
+func IsEncrypted(value string) bool {
+	return encryptedValue.MatchString(value)
+}
+
+// decryptSettings 原地解密 settings 中所有 ENC(...) 值，返回被解密的键 (section.key) 和明文。
+// 错误信息中不包含密文或明文
+func decryptSettings(c Cipher, prefix string, settings map[string]interface{}, plaintexts map[string]string) error {
+	for k, value := range settings {
+		key := strings.ToLower(k)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := decryptSettings(c, key, v, plaintexts); err != nil {
+				return err
+			}
+		case string:
+			m := encryptedValue.FindStringSubmatch(v)
+			if m == nil {
+				continue
+			}
+			if c == nil {
+				return fmt.Errorf("%w: %s", ErrNoSecretKey, key)
+			}
+			ciphertext, err := base64.StdEncoding.DecodeString(m[1])
+			if err != nil {
+				return fmt.Errorf("invalid encrypted value for %s", key)
+			}
+			plaintext, err := c.Decrypt(ciphertext)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt %s: %v", key, err)
+			}
+			settings[k] = string(plaintext)
+			plaintexts[key] = string(plaintext)
+		}
+	}
+	return nil
+}
+
+// scrubError 把错误信息中出现的明文替换为占位符，例如 viper 类型转换错误会带上原始值
+func scrubError(err error, plaintexts map[string]string) error {
+	msg := err.Error()
+	scrubbed := msg
+	for _, plaintext := range plaintexts {
+		if plaintext != "" {
+			scrubbed = strings.ReplaceAll(scrubbed, plaintext, redacted)
+		}
+	}
+	if scrubbed == msg {
+		return err
+	}
+	return errors.New(scrubbed)
+}
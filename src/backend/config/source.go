@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// ConfigSource 一层配置，Load 返回按 section 嵌套的配置项
+type ConfigSource interface {
+	Name() Source
+	Load() (map[string]interface{}, error)
+}
+
+// ChangeFunc 配置源内容变化时调用，err 不为空表示新内容无法解析；
+// 返回 nil 时配置源才会保留新内容
+type ChangeFunc func(settings map[string]interface{}, err error) error
+
+// WatchableSource 可以推送变更的配置源
+type WatchableSource interface {
+	ConfigSource
+	Watch(onChange ChangeFunc) error
+	Stop() error
+}
+
+// FileSource 本地 YAML 配置文件，每次 Load 都重新读取
+type FileSource struct {
+	Path string
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{Path: path}
+}
+
+func (s *FileSource) Name() Source {
+	return SourceFile
+}
+
+func (s *FileSource) Load() (map[string]interface{}, error) {
+	v := viper.New()
+	v.SetConfigFile(s.Path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	return v.AllSettings(), nil
+}
+
+// EnvSource 按 Bindings 读取环境变量，值为空的变量视为未设置
+type EnvSource struct {
+	Bindings  map[string]string
+	LookupEnv func(string) (string, bool)
+}
+
+// NewEnvSource 使用 EnvBindings 和进程环境变量
+func NewEnvSource() *EnvSource {
+	return &EnvSource{Bindings: EnvBindings, LookupEnv: os.LookupEnv}
+}
+
+func (s *EnvSource) Name() Source {
+	return SourceEnv
+}
+
+func (s *EnvSource) Load() (map[string]interface{}, error) {
+	flat := make(map[string]interface{})
+	for env, key := range s.Bindings {
+		if value, ok := s.LookupEnv(env); ok && value != "" {
+			flat[key] = value
+		}
+	}
+	return nestSettings(flat), nil
+}
+
+// MemorySource 内存中的配置，用于测试和离线模式；Set 会像远端变更一样推送给订阅者
+type MemorySource struct {
+	name Source
+
+	mu       sync.Mutex
+	settings map[string]interface{}
+	onChange ChangeFunc
+}
+
+// NewMemorySource settings 可以使用 "section.key" 形式的键
+func NewMemorySource(name Source, settings map[string]interface{}) *MemorySource {
+	return &MemorySource{name: name, settings: nestSettings(settings)}
+}
+
+func (s *MemorySource) Name() Source {
+	return s.name
+}
+
+func (s *MemorySource) Load() (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copySettings(s.settings), nil
+}
+
+// Set 替换配置内容，订阅者拒绝时返回错误且内容保持不变
+func (s *MemorySource) Set(settings map[string]interface{}) error {
+	settings = nestSettings(settings)
+
+	s.mu.Lock()
+	onChange := s.onChange
+	s.mu.Unlock()
+	if onChange != nil {
+		if err := onChange(copySettings(settings), nil); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.settings = settings
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemorySource) Watch(onChange ChangeFunc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = onChange
+	return nil
+}
+
+func (s *MemorySource) Stop() error {
+	return s.Watch(nil)
+}
+
+// parseYAML 解析 YAML 配置内容，键统一为小写
+func parseYAML(content string) (map[string]interface{}, error) {
+	if strings.TrimSpace(content) == "" {
+		return map[string]interface{}{}, nil
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(content)); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	return v.AllSettings(), nil
+}
+
+// nestSettings 把 "a.b.c" 形式的键展开为嵌套的 map
+func nestSettings(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	for key, value := range m {
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = nestSettings(nested)
+		}
+		parts := strings.Split(strings.ToLower(key), ".")
+		node := out
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[part] = child
+			}
+			node = child
+		}
+		last := parts[len(parts)-1]
+		if existing, ok := node[last].(map[string]interface{}); ok {
+			if nested, ok := value.(map[string]interface{}); ok {
+				for k, v := range nested {
+					existing[k] = v
+				}
+				continue
+			}
+		}
+		node[last] = value
+	}
+	return out
+}
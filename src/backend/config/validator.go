@@ -2,53 +2,230 @@ package config
 
 import (
 	"fmt"
+	"math/big"
 	"strings"
+
+	"defi-backend/models"
 )
 
 // Validate 验证配置是否有效
 func (c *Config) Validate() error {
-	// 验证 Nacos 配置
-	if c.Nacos.ServerAddr == "" {
-		return fmt.Errorf("nacos server address is required")
+	// 验证 Nacos 配置，离线模式下不需要
+	if !c.Nacos.Offline {
+		if c.Nacos.ServerAddr == "" {
+			return fmt.Errorf("nacos server address is required")
+		}
+		if c.Nacos.Port == 0 {
+			return fmt.Errorf("nacos port is required")
+		}
+		if c.Nacos.Namespace == "" {
+			return fmt.Errorf("nacos namespace is required")
+		}
+		if c.Nacos.Group == "" {
+			return fmt.Errorf("nacos group is required")
+		}
+		if c.Nacos.DataId == "" {
+			return fmt.Errorf("nacos data id is required")
+		}
 	}
-	if c.Nacos.Port == 0 {
-		return fmt.Errorf("nacos port is required")
+	switch c.Nacos.Fallback {
+	case "", FallbackNone, FallbackCache, FallbackFile:
+	default:
+		return fmt.Errorf("invalid nacos fallback: %s", c.Nacos.Fallback)
 	}
-	if c.Nacos.Namespace == "" {
-		return fmt.Errorf("nacos namespace is required")
+
+	// 验证数据库配置，设置 DSN 时不检查其他字段
+	switch c.Database.Driver {
+	case "", DriverMySQL, DriverPostgres, DriverSQLite:
+	default:
+		return fmt.Errorf("unsupported database driver: %s", c.Database.Driver)
 	}
-	if c.Nacos.Group == "" {
-		return fmt.Errorf("nacos group is required")
+	if c.Database.DSN == "" && c.Database.Driver == DriverSQLite {
+		if c.Database.DBName == "" {
+			return fmt.Errorf("database name (sqlite file path) is required")
+		}
+	} else if c.Database.DSN == "" {
+		if c.Database.Host == "" {
+			return fmt.Errorf("database host is required")
+		}
+		if c.Database.Port < 0 || c.Database.Port > 65535 {
+			return fmt.Errorf("invalid database port: %d", c.Database.Port)
+		}
+		if c.Database.Username == "" {
+			return fmt.Errorf("database username is required")
+		}
+		if c.Database.Password == "" {
+			return fmt.Errorf("database password is required")
+		}
+		if c.Database.DBName == "" {
+			return fmt.Errorf("database name is required")
+		}
 	}
-	if c.Nacos.DataId == "" {
-		return fmt.Errorf("nacos data id is required")
+
+	replicas := c.Database.Replicas
+	if replicas.MaxLag < 0 || replicas.CheckInterval < 0 || replicas.StickyWindow < 0 {
+		return fmt.Errorf("database replica durations must not be negative")
+	}
+	for _, dsn := range replicas.DSNs {
+		if strings.TrimSpace(dsn) == "" {
+			return fmt.Errorf("database replica dsn must not be empty")
+		}
 	}
 
-	// 验证数据库配置
-	if c.Database.Host == "" {
-		return fmt.Errorf("database host is required")
+	switch c.Database.Migrate {
+	case "", MigrateCheck, MigrateAuto, MigrateOff:
+	default:
+		return fmt.Errorf("invalid database migrate mode: %s", c.Database.Migrate)
 	}
-	if c.Database.Port == 0 {
-		return fmt.Errorf("database port is required")
+
+	// 验证 Redis 配置，设置 Addr 时不检查 Host 和 Port
+	if c.Redis.Addr == "" {
+		if c.Redis.Host == "" {
+			return fmt.Errorf("redis host is required")
+		}
+		if c.Redis.Port == 0 {
+			return fmt.Errorf("redis port is required")
+		}
 	}
-	if c.Database.Username == "" {
-		return fmt.Errorf("database username is required")
+
+	// 验证服务和令牌配置
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		return fmt.Errorf("invalid server port: %d", c.Server.Port)
 	}
-	if c.Database.Password == "" {
-		return fmt.Errorf("database password is required")
+	if c.JWT.AccessTTL < 0 || c.JWT.RefreshTTL < 0 {
+		return fmt.Errorf("jwt token ttl must not be negative")
 	}
-	if c.Database.DBName == "" {
-		return fmt.Errorf("database name is required")
+	if len(c.JWT.Keys) == 0 && c.JWT.Secret == "" {
+		return fmt.Errorf("jwt keys or jwt secret (JWT_SECRET) is required")
 	}
 
-	// 验证 Redis 配置
-	if c.Redis.Host == "" {
-		return fmt.Errorf("redis host is required")
+	// 验证可热更新的配置
+	switch c.Log.Level {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("invalid log level: %s", c.Log.Level)
+	}
+	if c.RateLimit.RequestsPerSecond < 0 || c.RateLimit.Burst < 0 {
+		return fmt.Errorf("rate limit must not be negative")
+	}
+	if c.RateLimit.RequestsPerSecond > 0 && c.RateLimit.Burst == 0 {
+		return fmt.Errorf("rate limit burst is required")
+	}
+	for token, market := range c.Interest.Markets {
+		if err := market.Validate(); err != nil {
+			return fmt.Errorf("invalid interest config for %s: %v", token, err)
+		}
+	}
+	if err := c.Alerts.Validate(); err != nil {
+		return fmt.Errorf("invalid alerts config: %v", err)
 	}
-	if c.Redis.Port == 0 {
-		return fmt.Errorf("redis port is required")
+	if err := c.Oracle.Validate(); err != nil {
+		return fmt.Errorf("invalid oracle config: %v", err)
 	}
+	if err := c.TWAP.Validate(); err != nil {
+		return fmt.Errorf("invalid twap config: %v", err)
+	}
+	if c.Oracle.DexTWAPWindow > c.TWAP.Retention {
+		return fmt.Errorf("oracle dex_twap_window must not exceed twap retention")
+	}
+
+	return nil
+}
 
+// Validate 检查预言机的时间窗口、偏离范围、最少来源数和来源名称
+func (o OracleConfig) Validate() error {
+	if o.MaxAge <= 0 || o.ManualMaxAge <= 0 || o.DexInterval <= 0 {
+		return fmt.Errorf("max_age, manual_max_age and dex_interval must be positive")
+	}
+	if o.MaxDeviation <= 0 || o.MaxDeviation >= 1 {
+		return fmt.Errorf("max_deviation must be between 0 and 1")
+	}
+	if o.MinSources < 1 {
+		return fmt.Errorf("min_sources must be at least 1")
+	}
+	switch o.DexPrice {
+	case DexPriceSpot, DexPriceTWAP:
+	default:
+		return fmt.Errorf("invalid dex_price: %s", o.DexPrice)
+	}
+	if o.DexTWAPWindow <= 0 {
+		return fmt.Errorf("dex_twap_window must be positive")
+	}
+	seen := make(map[string]bool)
+	for _, source := range o.Sources {
+		kind, name, _ := strings.Cut(source, ":")
+		// dex 和 manual 报价只在内部产生，不能从队列提交
+		if kind != "cex" {
+			return fmt.Errorf("source %q must start with cex:", source)
+		}
+		if name == "" || strings.ContainsAny(name, ": ") {
+			return fmt.Errorf("invalid source name %q", source)
+		}
+		if seen[source] {
+			return fmt.Errorf("duplicate source %q", source)
+		}
+		seen[source] = true
+	}
+	return nil
+}
+
+// Validate 检查冷却时间、数量上限和 webhook 超时
+func (a AlertsConfig) Validate() error {
+	if a.MinCooldown <= 0 || a.WebhookTimeout <= 0 {
+		return fmt.Errorf("min_cooldown and webhook_timeout must be positive")
+	}
+	if a.DefaultCooldown < a.MinCooldown {
+		return fmt.Errorf("default_cooldown must not be shorter than min_cooldown")
+	}
+	if a.MaxPerUser < 1 {
+		return fmt.Errorf("max_per_user must be at least 1")
+	}
+	return nil
+}
+
+// Validate 检查采样间隔和保留时间
+func (t TWAPConfig) Validate() error {
+	if t.SampleInterval <= 0 || t.Retention <= 0 {
+		return fmt.Errorf("sample_interval and retention must be positive")
+	}
+	if t.Retention < t.SampleInterval {
+		return fmt.Errorf("retention must not be shorter than sample_interval")
+	}
+	return nil
+}
+
+// Validate 检查利率参数是否为合法的非负整数，kink 和 reserve_factor 不超过 1e18
+func (m MarketRateConfig) Validate() error {
+	switch m.RateModel {
+	case "", "linear", "jump":
+	default:
+		return fmt.Errorf("unknown rate model %q", m.RateModel)
+	}
+
+	one := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	fields := []struct {
+		name  string
+		value string
+		max   *big.Int
+	}{
+		{"base_rate_per_year", m.BaseRatePerYear, nil},
+		{"multiplier_per_year", m.MultiplierPerYear, nil},
+		{"jump_multiplier_per_year", m.JumpMultiplierPerYear, nil},
+		{"kink", m.Kink, one},
+		{"reserve_factor", m.ReserveFactor, one},
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		v, ok := new(big.Int).SetString(f.value, 10)
+		if !ok || v.Sign() < 0 {
+			return fmt.Errorf("%s must be a non-negative integer", f.name)
+		}
+		if f.max != nil && v.Cmp(f.max) > 0 {
+			return fmt.Errorf("%s must not exceed 1e18", f.name)
+		}
+	}
 	return nil
 }
 
@@ -66,20 +243,20 @@ func ValidateUser(username, email, password string) error {
 	return nil
 }
 
-// ValidateTrade 验证交易参数
-func ValidateTrade(amount, price float64) error {
-	if amount <= 0 {
+// ValidateTrade 验证交易参数，minAmountOut 为零表示不限制最小成交量
+func ValidateTrade(amountIn, minAmountOut models.Amount) error {
+	if amountIn.Sign() <= 0 {
 		return fmt.Errorf("amount must be greater than 0")
 	}
-	if price <= 0 {
-		return fmt.Errorf("price must be greater than 0")
+	if minAmountOut.Sign() < 0 {
+		return fmt.Errorf("min amount out must not be negative")
 	}
 	return nil
 }
 
 // ValidatePosition 验证仓位参数
-func ValidatePosition(amount float64) error {
-	if amount <= 0 {
+func ValidatePosition(amount models.Amount) error {
+	if amount.Sign() <= 0 {
 		return fmt.Errorf("amount must be greater than 0")
 	}
 	return nil
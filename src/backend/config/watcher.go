@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// Subscriber 接收配置变更，返回错误表示拒绝新配置。
+// 回滚时会以 (new, old) 再次调用，因此实现应当按 new 声明式地设置状态
+type Subscriber func(old, new *Config) error
+
+type subscriber struct {
+	name string
+	fn   Subscriber
+}
+
+// Watcher 监听可推送变更的配置源，合并、校验后依次推送给订阅者。
+// 任一订阅者拒绝时，已应用的订阅者会按逆序恢复旧配置，当前配置保持不变。
+// 数据库、Redis 等连接类配置只在启动时读取，修改后需要重启
+type Watcher struct {
+	loader *Loader
+
+	mu          sync.Mutex // 串行化配置更新和订阅
+	current     atomic.Value
+	subscribers []subscriber
+}
+
+// NewWatcher 加载并校验初始配置。配置源变更时通过 loader 与其他配置源重新合并，
+// 因此各配置源的优先级保持不变
+func NewWatcher(loader *Loader) (*Watcher, error) {
+	resolved, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := resolved.Config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", resolved.Scrub(err))
+	}
+	w := &Watcher{loader: loader}
+	w.current.Store(resolved.Config)
+	return w, nil
+}
+
+// Current 返回当前生效的配置，调用方不应修改返回值
+func (w *Watcher) Current() *Config {
+	return w.current.Load().(*Config)
+}
+
+// Subscribe 注册订阅者，并立即以当前配置调用一次 (old 为 nil)
+func (w *Watcher) Subscribe(name string, fn Subscriber) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := fn(nil, w.Current()); err != nil {
+		return fmt.Errorf("subscriber %s rejected config: %v", name, err)
+	}
+	w.subscribers = append(w.subscribers, subscriber{name: name, fn: fn})
+	return nil
+}
+
+// apply 用 settings 作为配置源 name 的新内容，合并校验后推送给所有订阅者
+func (w *Watcher) apply(name Source, settings map[string]interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	resolved, err := w.loader.LoadWith(name, settings)
+	if err != nil {
+		return err
+	}
+	next := resolved.Config
+	if err := next.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %v", resolved.Scrub(err))
+	}
+
+	old := w.Current()
+	for i, s := range w.subscribers {
+		if err := s.fn(old, next); err != nil {
+			err = resolved.Scrub(err)
+			rollbackErr := resolved.Scrub(w.rollback(w.subscribers[:i], next, old))
+			if rollbackErr != nil {
+				return fmt.Errorf("subscriber %s rejected config: %v (rollback failed: %v)", s.name, err, rollbackErr)
+			}
+			return fmt.Errorf("subscriber %s rejected config: %v", s.name, err)
+		}
+	}
+	w.current.Store(next)
+	return nil
+}
+
+// rollback 按逆序把已应用的订阅者恢复到旧配置
+func (w *Watcher) rollback(applied []subscriber, next, old *Config) error {
+	var firstErr error
+	for i := len(applied) - 1; i >= 0; i-- {
+		if err := applied[i].fn(next, old); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %v", applied[i].name, err)
+		}
+	}
+	return firstErr
+}
+
+// Start 开始监听所有可推送变更的配置源，被拒绝的变更只记录日志
+func (w *Watcher) Start(logger *zap.Logger) error {
+	var firstErr error
+	for _, src := range w.loader.Sources() {
+		ws, ok := src.(WatchableSource)
+		if !ok {
+			continue
+		}
+		name := src.Name()
+		err := ws.Watch(func(settings map[string]interface{}, err error) error {
+			if err == nil {
+				err = w.apply(name, settings)
+			}
+			if err != nil {
+				logger.Error("Rejected config update", zap.String("source", string(name)), zap.Error(err))
+				return err
+			}
+			logger.Info("Config updated", zap.String("source", string(name)))
+			return nil
+		})
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to watch %s config: %v", name, err)
+		}
+	}
+	return firstErr
+}
+
+// Stop 停止监听所有配置源
+func (w *Watcher) Stop() error {
+	var firstErr error
+	for _, src := range w.loader.Sources() {
+		if ws, ok := src.(WatchableSource); ok {
+			if err := ws.Stop(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
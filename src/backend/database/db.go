@@ -3,24 +3,26 @@ package database
 import (
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"defi-backend/config"
+	"defi-backend/replica"
 
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// InitDB 按 database.driver 连接数据库，配置了副本时安装 replica 路由；
+// 表结构由 migrate 包中的版本化迁移管理
 func InitDB(cfg *config.Config) (*gorm.DB, error) {
-	// 构建 DSN
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		cfg.Database.Username,
-		cfg.Database.Password,
-		cfg.Database.Host,
-		cfg.Database.Port,
-		cfg.Database.DBName,
-	)
+	dialector, err := Dialector(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
 
 	// 配置 GORM
 	gormConfig := &gorm.Config{
@@ -28,7 +30,7 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 	}
 
 	// 连接数据库
-	db, err := gorm.Open(mysql.Open(dsn), gormConfig)
+	db, err := gorm.Open(dialector, gormConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
@@ -39,23 +41,95 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to get database instance: %v", err)
 	}
 
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-
-	// 自动迁移数据库表
-	if err := db.AutoMigrate(
-		&models.User{},
-		&models.UserProfile{},
-		&models.TradingPair{},
-		&models.Trade{},
-		&models.LendingPosition{},
-		&models.FarmingPosition{},
-		&models.Reward{},
-	); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	if dialector.Name() == config.DriverSQLite {
+		// SQLite 同一时间只允许一个写入者，单连接可以避免 database is locked；
+		// 内存数据库的每个连接都是独立的库，也必须只用一个连接
+		sqlDB.SetMaxOpenConns(1)
+	} else {
+		sqlDB.SetMaxIdleConns(10)
+		sqlDB.SetMaxOpenConns(100)
+		sqlDB.SetConnMaxLifetime(time.Hour)
 	}
 
-	log.Println("Database connection established successfully")
+	log.Printf("Database connection established successfully (%s)", dialector.Name())
+
+	if err := useReplicas(db, cfg.Database); err != nil {
+		return nil, err
+	}
 	return db, nil
 }
+
+// useReplicas 安装只读副本路由，副本使用与主库相同的驱动
+func useReplicas(db *gorm.DB, cfg config.DatabaseConfig) error {
+	if len(cfg.Replicas.DSNs) == 0 {
+		return nil
+	}
+	dialectors := make([]gorm.Dialector, 0, len(cfg.Replicas.DSNs))
+	for _, dsn := range cfg.Replicas.DSNs {
+		dialector, err := Dialector(config.DatabaseConfig{Driver: cfg.Driver, DSN: dsn})
+		if err != nil {
+			return err
+		}
+		dialectors = append(dialectors, dialector)
+	}
+	err := db.Use(replica.New(dialectors, replica.Options{
+		MaxLag:        cfg.Replicas.MaxLag,
+		CheckInterval: cfg.Replicas.CheckInterval,
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to init database replicas: %v", err)
+	}
+	log.Printf("Routing read-only queries to %d database replica(s)", len(dialectors))
+	return nil
+}
+
+// Dialector 返回驱动对应的 GORM Dialector，配置了完整 DSN 时直接使用
+func Dialector(cfg config.DatabaseConfig) (gorm.Dialector, error) {
+	dsn := cfg.DSN
+	switch cfg.Driver {
+	case config.DriverMySQL, "":
+		if dsn == "" {
+			dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+				cfg.Username,
+				cfg.Password,
+				cfg.Host,
+				portOrDefault(cfg.Port, 3306),
+				cfg.DBName,
+			)
+		}
+		// MySQL 不能对没有长度的 longtext 建索引，没有指定长度的字符串列使用 varchar(191)
+		return mysql.New(mysql.Config{DSN: dsn, DefaultStringSize: 191}), nil
+	case config.DriverPostgres:
+		if dsn == "" {
+			dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=prefer",
+				pgQuote(cfg.Host),
+				portOrDefault(cfg.Port, 5432),
+				pgQuote(cfg.Username),
+				pgQuote(cfg.Password),
+				pgQuote(cfg.DBName),
+			)
+		}
+		return postgres.Open(dsn), nil
+	case config.DriverSQLite:
+		// DBName 为文件路径，":memory:" 为内存数据库
+		if dsn == "" {
+			dsn = cfg.DBName
+		}
+		return sqlite.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Driver)
+	}
+}
+
+// pgQuote 转义 key=value 形式 DSN 中的值，密码中可能有空格和引号
+func pgQuote(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	return "'" + strings.ReplaceAll(v, "'", `\'`) + "'"
+}
+
+func portOrDefault(port, defaultPort int) int {
+	if port == 0 {
+		return defaultPort
+	}
+	return port
+}
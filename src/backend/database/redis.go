@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"defi-backend/config"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func InitRedis(cfg *config.Config) (*redis.Client, error) {
+	addr := cfg.Redis.Addr
+	if addr == "" {
+		addr = fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port)
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %v", err)
+	}
+
+	log.Println("Redis connection established successfully")
+	return client, nil
+}
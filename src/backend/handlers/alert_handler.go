@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"defi-backend/models"
+	"defi-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultNotifications = 50
+	maxNotifications     = 200
+)
+
+type AlertHandler struct {
+	alerts *services.AlertService
+}
+
+func NewAlertHandler(alerts *services.AlertService) *AlertHandler {
+	return &AlertHandler{alerts: alerts}
+}
+
+// AlertRequest 创建和修改提醒的请求，Token 和 PairID 二选一；Active 不传时为 true
+type AlertRequest struct {
+	Token           string  `json:"token"`
+	PairID          uint    `json:"pair_id"`
+	Condition       string  `json:"condition" binding:"required"`
+	Threshold       float64 `json:"threshold" binding:"required"`
+	Window          string  `json:"window"`
+	CooldownSeconds int64   `json:"cooldown_seconds"`
+	WebhookURL      string  `json:"webhook_url"`
+	Note            string  `json:"note"`
+	Active          *bool   `json:"active"`
+}
+
+// alertWithSecret 创建提醒的响应，WebhookSecret 只在这里返回一次
+type alertWithSecret struct {
+	*models.PriceAlert
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+func (r AlertRequest) input() services.AlertInput {
+	return services.AlertInput{
+		Token:           r.Token,
+		PairID:          r.PairID,
+		Condition:       r.Condition,
+		Threshold:       r.Threshold,
+		Window:          r.Window,
+		CooldownSeconds: r.CooldownSeconds,
+		WebhookURL:      r.WebhookURL,
+		Note:            r.Note,
+		Active:          r.Active == nil || *r.Active,
+	}
+}
+
+func (h *AlertHandler) ListAlerts(c *gin.Context) {
+	alerts, err := h.alerts.ListAlerts(c.Request.Context(), c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, alerts)
+}
+
+func (h *AlertHandler) CreateAlert(c *gin.Context) {
+	var req AlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alert, err := h.alerts.CreateAlert(c.Request.Context(), c.GetUint("userID"), req.input())
+	if err != nil {
+		c.JSON(alertErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, alertWithSecret{PriceAlert: alert, WebhookSecret: alert.WebhookSecret})
+}
+
+func (h *AlertHandler) GetAlert(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid alert id"})
+		return
+	}
+
+	alert, err := h.alerts.GetAlert(c.GetUint("userID"), uint(id))
+	if err != nil {
+		c.JSON(alertErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, alert)
+}
+
+// UpdateAlert 用请求替换提醒的全部设置
+func (h *AlertHandler) UpdateAlert(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid alert id"})
+		return
+	}
+	var req AlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alert, err := h.alerts.UpdateAlert(c.Request.Context(), c.GetUint("userID"), uint(id), req.input())
+	if err != nil {
+		c.JSON(alertErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, alert)
+}
+
+// RotateWebhookSecret 生成新的 webhook 签名密钥并返回，旧密钥立即失效
+func (h *AlertHandler) RotateWebhookSecret(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid alert id"})
+		return
+	}
+
+	alert, err := h.alerts.RotateWebhookSecret(c.GetUint("userID"), uint(id))
+	if err != nil {
+		c.JSON(alertErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook_secret": alert.WebhookSecret})
+}
+
+func (h *AlertHandler) DeleteAlert(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid alert id"})
+		return
+	}
+
+	if err := h.alerts.DeleteAlert(c.Request.Context(), c.GetUint("userID"), uint(id)); err != nil {
+		c.JSON(alertErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListNotifications 返回最近的站内信，unread=true 时只返回未读的
+func (h *AlertHandler) ListNotifications(c *gin.Context) {
+	limit := defaultNotifications
+	if q := c.Query("limit"); q != "" {
+		n, err := strconv.Atoi(q)
+		if err != nil || n <= 0 || n > maxNotifications {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = n
+	}
+
+	notifications, unread, err := h.alerts.Notifications(c.Request.Context(), c.GetUint("userID"), c.Query("unread") == "true", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"unread":        unread,
+	})
+}
+
+func (h *AlertHandler) MarkNotificationRead(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid notification id"})
+		return
+	}
+
+	if err := h.alerts.MarkNotificationRead(c.GetUint("userID"), uint(id)); err != nil {
+		c.JSON(alertErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func alertErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidAlert):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrAlertNotFound), errors.Is(err, services.ErrNotificationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrTooManyAlerts):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,81 +1,640 @@
 package handlers
 
 import (
+	"errors"
+	"math/big"
 	"net/http"
+	"strconv"
+	"time"
+
+	"defi-backend/config"
+	"defi-backend/models"
+	"defi-backend/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 type DefiHandler struct {
-	// 可以在这里添加依赖，如智能合约客户端、数据库连接等
+	defiService *services.DefiService
+	riskEngine  *services.RiskEngine
+	candles     *services.CandleService
+	twap        *services.TWAPService
+}
+
+func NewDefiHandler(defiService *services.DefiService, riskEngine *services.RiskEngine, candles *services.CandleService, twap *services.TWAPService) *DefiHandler {
+	return &DefiHandler{
+		defiService: defiService,
+		riskEngine:  riskEngine,
+		candles:     candles,
+		twap:        twap,
+	}
+}
+
+// 请求中的数量均以代币为单位的十进制字符串表示，例如 "1.5"，服务端按代币精度换算
+
+type PositionRequest struct {
+	Token  string        `json:"token" binding:"required"`
+	Amount models.Amount `json:"amount"`
+}
+
+type StakeRequest struct {
+	PoolID uint          `json:"pool_id"`
+	Amount models.Amount `json:"amount"`
+}
+
+// FarmRequest 初始化挖矿，reward_decimals 缺省为 18
+type FarmRequest struct {
+	RewardToken    string        `json:"reward_token" binding:"required"`
+	RewardDecimals *uint8        `json:"reward_decimals"`
+	RewardPerBlock models.Amount `json:"reward_per_block"`
+	StartBlock     uint64        `json:"start_block"`
+}
+
+type RewardRateRequest struct {
+	RewardPerBlock models.Amount `json:"reward_per_block"`
+}
+
+// FarmingPoolRequest 添加挖矿池，lp_decimals 缺省为 18
+type FarmingPoolRequest struct {
+	LPToken    string `json:"lp_token" binding:"required"`
+	LPDecimals *uint8 `json:"lp_decimals"`
+	AllocPoint uint64 `json:"alloc_point"`
+	WithUpdate bool   `json:"with_update"`
 }
 
-func NewDefiHandler() *DefiHandler {
-	return &DefiHandler{}
+type PoolWeightRequest struct {
+	AllocPoint uint64 `json:"alloc_point"`
+	WithUpdate bool   `json:"with_update"`
+}
+
+type SwapRequest struct {
+	PairID       uint          `json:"pair_id" binding:"required"`
+	TokenIn      string        `json:"token_in" binding:"required"`
+	AmountIn     models.Amount `json:"amount_in"`
+	MinAmountOut models.Amount `json:"min_amount_out"`
 }
 
 // DEX 相关处理函数
 func (h *DefiHandler) SwapTokens(c *gin.Context) {
-	// TODO: 实现代币交换逻辑
+	var req SwapRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.ValidateTrade(req.AmountIn, req.MinAmountOut); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	trade, quote, err := h.defiService.Swap(c.GetUint("userID"), req.PairID, req.TokenIn, req.AmountIn, req.MinAmountOut)
+	if err != nil {
+		c.JSON(swapErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Tokens swapped successfully",
+		"trade": trade,
+		"quote": quote,
 	})
 }
 
+// QuoteSwap 返回兑换报价，供前端在签名前展示
+func (h *DefiHandler) QuoteSwap(c *gin.Context) {
+	pairID, err := strconv.ParseUint(c.Query("pair_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid pair_id"})
+		return
+	}
+
+	amountIn, err := models.ParseAmount(c.Query("amount_in"))
+	if err == nil {
+		err = config.ValidateTrade(amountIn, models.Amount{})
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	quote, err := h.defiService.QuoteSwap(uint(pairID), c.Query("token_in"), amountIn)
+	if err != nil {
+		c.JSON(swapErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, quote)
+}
+
+// FindRoute 返回多跳/拆单的最优兑换路径
+func (h *DefiHandler) FindRoute(c *gin.Context) {
+	amount, err := models.ParseAmount(c.Query("amount"))
+	if err == nil {
+		err = config.ValidateTrade(amount, models.Amount{})
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	maxHops, err := strconv.Atoi(c.DefaultQuery("max_hops", strconv.Itoa(services.DefaultMaxHops)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid max_hops"})
+		return
+	}
+	maxSplits, err := strconv.Atoi(c.DefaultQuery("max_splits", "1"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid max_splits"})
+		return
+	}
+
+	tradeType := c.DefaultQuery("type", services.TradeTypeExactIn)
+	route, err := h.defiService.FindRoute(tradeType, c.Query("token_in"), c.Query("token_out"), amount, maxHops, maxSplits)
+	if err != nil {
+		c.JSON(swapErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, route)
+}
+
 func (h *DefiHandler) GetTradingPairs(c *gin.Context) {
-	// TODO: 实现获取交易对逻辑
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Trading pairs retrieved successfully",
-	})
+	pairs, err := h.defiService.GetTradingPairs(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pairs": pairs})
 }
 
+// GetTokenPrice 返回交易对按精度换算后的现货价格 reserve1 / reserve0，:pair 可以是 ID 或 symbol
 func (h *DefiHandler) GetTokenPrice(c *gin.Context) {
-	// TODO: 实现获取代币价格逻辑
+	pair, err := findPair(h.defiService, c.Param("pair"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	reserve0, reserve1, err := services.PairReserves(pair)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if reserve0.Sign() <= 0 || reserve1.Sign() <= 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": services.ErrInsufficientLiquidity.Error()})
+		return
+	}
+
+	amount0 := models.NewAmount(reserve0, pair.Decimals0)
+	amount1 := models.NewAmount(reserve1, pair.Decimals1)
+	price, _ := new(big.Rat).Quo(amount1.Rat(), amount0.Rat()).Float64()
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Token price retrieved successfully",
+		"pair":     pair.Symbol,
+		"token0":   pair.Token0,
+		"token1":   pair.Token1,
+		"reserve0": amount0,
+		"reserve1": amount1,
+		"price":    price,
 	})
 }
 
-// 借贷相关处理函数
-func (h *DefiHandler) Deposit(c *gin.Context) {
-	// TODO: 实现存款逻辑
+// 未指定 from 时返回截至 to 的 defaultCandles 根 K 线
+const defaultCandles = 300
+
+// GetCandles 返回交易对 token0 的 OHLCV K 线，interval 为 1m、5m、1h 或 1d，默认 1h；
+// from 和 to 为 Unix 毫秒，to 默认为当前时间
+func (h *DefiHandler) GetCandles(c *gin.Context) {
+	pair, err := findPair(h.defiService, c.Param("pair"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	interval, err := services.ParseCandleInterval(c.DefaultQuery("interval", "1h"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to := time.Now().UnixMilli()
+	if q := c.Query("to"); q != "" {
+		if to, err = strconv.ParseInt(q, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to"})
+			return
+		}
+	}
+	from := to - defaultCandles*interval.Duration.Milliseconds()
+	if q := c.Query("from"); q != "" {
+		if from, err = strconv.ParseInt(q, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from"})
+			return
+		}
+	}
+
+	candles, err := h.candles.PairCandles(c.Request.Context(), pair, interval, from, to)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidCandleRange) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Deposit successful",
+		"pair":     pair.Symbol,
+		"token":    pair.Token0,
+		"interval": interval.Name,
+		"candles":  candles,
 	})
 }
 
-func (h *DefiHandler) Borrow(c *gin.Context) {
-	// TODO: 实现借款逻辑
+// 未指定 from 时返回截至 to 的 defaultTWAPWindow 内的 TWAP
+const defaultTWAPWindow = 30 * time.Minute
+
+// GetTWAP 返回交易对的时间加权平均价格，区间为 [from, to] (Unix 毫秒)，
+// 或者截至 to (默认当前时间) 的 window，例如 window=1h
+func (h *DefiHandler) GetTWAP(c *gin.Context) {
+	pair, err := findPair(h.defiService, c.Param("pair"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	to := time.Now().UnixMilli()
+	if q := c.Query("to"); q != "" {
+		if to, err = strconv.ParseInt(q, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to"})
+			return
+		}
+	}
+	window := defaultTWAPWindow
+	if q := c.Query("window"); q != "" {
+		if window, err = time.ParseDuration(q); err != nil || window <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid window"})
+			return
+		}
+	}
+	from := to - window.Milliseconds()
+	if q := c.Query("from"); q != "" {
+		if from, err = strconv.ParseInt(q, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from"})
+			return
+		}
+	}
+
+	twap, err := h.twap.TWAP(c.Request.Context(), pair, from, to)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrInvalidTWAPRange):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrTWAPUnavailable):
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Borrow successful",
+		"pair": pair.Symbol,
+		"twap": twap,
 	})
 }
 
+// 借贷相关处理函数
+func (h *DefiHandler) Deposit(c *gin.Context) {
+	var req PositionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.ValidatePosition(req.Amount); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	position, err := h.defiService.CreateLendingPosition(c.GetUint("userID"), req.Token, req.Amount, models.PositionTypeSupply)
+	if err != nil {
+		c.JSON(riskErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"position": position})
+}
+
+func (h *DefiHandler) Borrow(c *gin.Context) {
+	var req PositionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.ValidatePosition(req.Amount); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	position, err := h.defiService.Borrow(h.riskEngine, c.GetUint("userID"), req.Token, req.Amount)
+	if err != nil {
+		c.JSON(riskErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"position": position})
+}
+
 func (h *DefiHandler) GetPositions(c *gin.Context) {
-	// TODO: 实现获取仓位逻辑
+	userID := c.GetUint("userID")
+	positions, err := h.defiService.GetUserPositions(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := h.riskEngine.AccountLiquidity(userID)
+	if err != nil {
+		c.JSON(riskErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Positions retrieved successfully",
+		"positions": positions,
+		"account":   account,
 	})
 }
 
+// GetMarketRates 返回市场利用率和存借款年化利率
+func (h *DefiHandler) GetMarketRates(c *gin.Context) {
+	rates, err := h.defiService.GetMarketRates(c.Param("token"))
+	if err != nil {
+		c.JSON(riskErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
+}
+
+// GetLiquidatableAccounts 列出可清算账户及最大偿还/扣押数量
+func (h *DefiHandler) GetLiquidatableAccounts(c *gin.Context) {
+	candidates, err := h.riskEngine.LiquidatableAccounts(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accounts": candidates})
+}
+
 // 挖矿相关处理函数
 func (h *DefiHandler) StakeTokens(c *gin.Context) {
-	// TODO: 实现质押代币逻辑
+	var req StakeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.ValidatePosition(req.Amount); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	position, reward, err := h.defiService.Stake(c.GetUint("userID"), req.PoolID, req.Amount)
+	if err != nil {
+		c.JSON(farmingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Tokens staked successfully",
+		"position": position,
+		"reward":   reward,
 	})
 }
 
 func (h *DefiHandler) UnstakeTokens(c *gin.Context) {
-	// TODO: 实现解除质押逻辑
+	var req StakeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.ValidatePosition(req.Amount); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	position, reward, err := h.defiService.Unstake(c.GetUint("userID"), req.PoolID, req.Amount)
+	if err != nil {
+		c.JSON(farmingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Tokens unstaked successfully",
+		"position": position,
+		"reward":   reward,
 	})
 }
 
+// EmergencyWithdraw 放弃未领取奖励，取回全部质押
+func (h *DefiHandler) EmergencyWithdraw(c *gin.Context) {
+	poolID, err := strconv.ParseUint(c.Param("pool"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid pool id"})
+		return
+	}
+
+	position, err := h.defiService.EmergencyWithdraw(c.GetUint("userID"), uint(poolID))
+	if err != nil {
+		c.JSON(farmingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"position": position})
+}
+
+// ClaimRewards 领取某个仓位的待领取奖励
+func (h *DefiHandler) ClaimRewards(c *gin.Context) {
+	positionID, err := strconv.ParseUint(c.Param("position"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid position id"})
+		return
+	}
+
+	reward, err := h.defiService.ClaimRewards(c.GetUint("userID"), uint(positionID))
+	if err != nil {
+		c.JSON(farmingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reward": reward})
+}
+
+// GetPendingReward 返回用户在某个池子中按 pendingReward 计算的待领取奖励
+func (h *DefiHandler) GetPendingReward(c *gin.Context) {
+	poolID, err := strconv.ParseUint(c.Param("pool"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid pool id"})
+		return
+	}
+
+	pending, err := h.defiService.PendingReward(c.Request.Context(), c.GetUint("userID"), uint(poolID))
+	if err != nil {
+		c.JSON(farmingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pool_id": poolID, "pending": pending})
+}
+
+// GetRewards 返回各仓位按 pendingReward 计算的待领取奖励以及已领取记录
 func (h *DefiHandler) GetRewards(c *gin.Context) {
-	// TODO: 实现获取奖励逻辑
+	userID := c.GetUint("userID")
+	positions, err := h.defiService.GetFarmingPositions(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(farmingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	rewards, err := h.defiService.GetUserRewards(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Rewards retrieved successfully",
+		"positions": positions,
+		"claimed":   rewards,
 	})
 }
+
+// 挖矿管理处理函数
+
+// InitFarm 设置奖励代币、每区块奖励和开始区块，只能调用一次
+func (h *DefiHandler) InitFarm(c *gin.Context) {
+	var req FarmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	decimals := uint8(18)
+	if req.RewardDecimals != nil {
+		decimals = *req.RewardDecimals
+	}
+	farm, err := h.defiService.InitFarm(req.RewardToken, decimals, req.RewardPerBlock, req.StartBlock)
+	if err != nil {
+		c.JSON(farmingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"farm": farm})
+}
+
+// SetRewardPerBlock 调整每区块奖励，已产生的奖励按旧速率结算
+func (h *DefiHandler) SetRewardPerBlock(c *gin.Context) {
+	var req RewardRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	farm, err := h.defiService.SetRewardPerBlock(req.RewardPerBlock)
+	if err != nil {
+		c.JSON(farmingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"farm": farm})
+}
+
+func (h *DefiHandler) AddFarmingPool(c *gin.Context) {
+	var req FarmingPoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	decimals := uint8(18)
+	if req.LPDecimals != nil {
+		decimals = *req.LPDecimals
+	}
+	pool, err := h.defiService.AddFarmingPool(req.LPToken, decimals, req.AllocPoint, req.WithUpdate)
+	if err != nil {
+		c.JSON(farmingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"pool": pool})
+}
+
+// SetFarmingPool 调整池子的分配权重
+func (h *DefiHandler) SetFarmingPool(c *gin.Context) {
+	poolID, err := strconv.ParseUint(c.Param("pool"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid pool id"})
+		return
+	}
+
+	var req PoolWeightRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pool, err := h.defiService.SetFarmingPool(uint(poolID), req.AllocPoint, req.WithUpdate)
+	if err != nil {
+		c.JSON(farmingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pool": pool})
+}
+
+// findPair 按 ID 或 symbol 查找交易对
+func findPair(defiService *services.DefiService, param string) (*models.TradingPair, error) {
+	if id, err := strconv.ParseUint(param, 10, 64); err == nil {
+		return defiService.GetTradingPair(uint(id))
+	}
+	return defiService.GetTradingPairBySymbol(param)
+}
+
+func riskErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrMarketNotListed):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInsufficientCollateral), errors.Is(err, services.ErrInsufficientMarketCash):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInsufficientInputAmount), errors.Is(err, models.ErrInvalidAmount):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrPriceUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func farmingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrFarmingPoolNotFound), errors.Is(err, services.ErrFarmNotInitialized):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInsufficientStake), errors.Is(err, services.ErrFarmInitialized):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrNoBlockNumberProvider):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, models.ErrInvalidAmount):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func swapErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPoolNotFound), errors.Is(err, services.ErrNoRoute):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInsufficientLiquidity), errors.Is(err, services.ErrInsufficientOutput):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"defi-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OracleHandler struct {
+	oracle *services.Oracle
+}
+
+func NewOracleHandler(oracle *services.Oracle) *OracleHandler {
+	return &OracleHandler{oracle: oracle}
+}
+
+type ManualPriceRequest struct {
+	Price float64 `json:"price" binding:"required"`
+}
+
+// GetPrice 返回代币各来源的报价、状态和聚合结果
+func (h *OracleHandler) GetPrice(c *gin.Context) {
+	price, err := h.oracle.Inspect(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, price)
+}
+
+// SetManualPrice 以 manual 来源提交管理员价格，与其他来源一起参与聚合
+func (h *OracleHandler) SetManualPrice(c *gin.Context) {
+	var req ManualPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.oracle.SetManualPrice(c.Request.Context(), c.Param("token"), req.Price); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidQuote) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetPrice(c)
+}
+
+// DeleteManualPrice 撤销管理员价格
+func (h *OracleHandler) DeleteManualPrice(c *gin.Context) {
+	if err := h.oracle.RemoveQuote(c.Request.Context(), c.Param("token"), services.SourceManual); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetPrice(c)
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"defi-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// maxPriceChannels 一个连接最多订阅的代币数
+	maxPriceChannels = 50
+	// 没有价格更新时发送心跳，避免代理断开空闲连接
+	priceHeartbeat = 15 * time.Second
+	// 客户端在 priceWriteTimeout 内读不完一批事件时断开连接
+	priceWriteTimeout = 10 * time.Second
+	// 客户端发来的订阅消息的最大长度
+	maxPriceMessageBytes = 4096
+)
+
+var errTooManyChannels = fmt.Errorf("at most %d tokens per connection", maxPriceChannels)
+
+// PriceStreamHandler 通过 SSE 和 WebSocket 推送价格。频道为 token:<代币> 或 pair:<ID 或 symbol>，
+// 交易对频道会订阅 token0 和 token1 两个代币；订阅后先推送每个代币的最新价格快照
+type PriceStreamHandler struct {
+	hub         *services.PriceHub
+	defiService *services.DefiService
+}
+
+func NewPriceStreamHandler(hub *services.PriceHub, defiService *services.DefiService) *PriceStreamHandler {
+	return &PriceStreamHandler{
+		hub:         hub,
+		defiService: defiService,
+	}
+}
+
+// priceMessage 客户端通过 WebSocket 发送的订阅变更
+type priceMessage struct {
+	Action   string   `json:"action"`
+	Channels []string `json:"channels"`
+}
+
+// resolveChannels 返回每个频道对应的代币和去重后的全部代币
+func (h *PriceStreamHandler) resolveChannels(channels []string) (map[string][]string, []string, error) {
+	resolved := make(map[string][]string, len(channels))
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, channel := range channels {
+		kind, name, ok := strings.Cut(channel, ":")
+		if !ok || name == "" {
+			return nil, nil, fmt.Errorf("invalid channel %q", channel)
+		}
+		switch kind {
+		case "token":
+			resolved[channel] = []string{name}
+		case "pair":
+			pair, err := findPair(h.defiService, name)
+			if err != nil {
+				return nil, nil, fmt.Errorf("channel %q: %v", channel, err)
+			}
+			resolved[channel] = []string{pair.Token0, pair.Token1}
+		default:
+			return nil, nil, fmt.Errorf("invalid channel %q", channel)
+		}
+		for _, token := range resolved[channel] {
+			if !seen[token] {
+				seen[token] = true
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	if len(tokens) > maxPriceChannels {
+		return nil, nil, errTooManyChannels
+	}
+	return resolved, tokens, nil
+}
+
+func splitChannels(query string) []string {
+	var channels []string
+	for _, channel := range strings.Split(query, ",") {
+		if channel = strings.TrimSpace(channel); channel != "" {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// Stream 以 SSE 推送 channels 参数 (逗号分隔) 中的价格，
+// 先发送 subscribed 事件，之后是 snapshot 和 update 事件；更换频道需要重新连接
+func (h *PriceStreamHandler) Stream(c *gin.Context) {
+	channels := splitChannels(c.Query("channels"))
+	if len(channels) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "channels is required"})
+		return
+	}
+	resolved, tokens, err := h.resolveChannels(channels)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	sub, err := h.hub.Subscribe(ctx, tokens)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer sub.Close()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("subscribed", gin.H{"channels": resolved})
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(priceHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := c.Writer.WriteString(": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-sub.Ready():
+			for _, event := range sub.Drain() {
+				c.SSEvent(event.Type, event)
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+// WebSocket 推送与 Stream 相同的事件，事件类型在 JSON 的 type 字段中。
+// 连接后可以发送 {"action": "subscribe" 或 "unsubscribe", "channels": [...]} 调整订阅，退订按代币进行
+func (h *PriceStreamHandler) WebSocket(c *gin.Context) {
+	resolved, tokens, err := h.resolveChannels(splitChannels(c.Query("channels")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 价格是公开数据，不检查 Origin
+	server := websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			h.serveWebSocket(ws, resolved, tokens)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+func (h *PriceStreamHandler) serveWebSocket(ws *websocket.Conn, resolved map[string][]string, tokens []string) {
+	defer ws.Close()
+	ws.MaxPayloadBytes = maxPriceMessageBytes
+	ctx := ws.Request().Context()
+
+	var writeMu sync.Mutex
+	send := func(v interface{}) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		ws.SetWriteDeadline(time.Now().Add(priceWriteTimeout))
+		return websocket.JSON.Send(ws, v)
+	}
+	sendError := func(err error) error {
+		return send(gin.H{"type": "error", "error": err.Error()})
+	}
+
+	sub, err := h.hub.Subscribe(ctx, tokens)
+	if err != nil {
+		sendError(err)
+		return
+	}
+	defer sub.Close()
+	if err := send(gin.H{"type": "subscribed", "channels": resolved}); err != nil {
+		return
+	}
+
+	// 读取订阅变更，连接关闭时 done 关闭
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var msg priceMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				return
+			}
+			if err := h.applyMessage(ctx, sub, msg, send); err != nil {
+				if sendError(err) != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(priceHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-heartbeat.C:
+			if err := send(gin.H{"type": "heartbeat"}); err != nil {
+				return
+			}
+		case <-sub.Ready():
+			for _, event := range sub.Drain() {
+				if err := send(event); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (h *PriceStreamHandler) applyMessage(ctx context.Context, sub *services.PriceSubscription, msg priceMessage, send func(interface{}) error) error {
+	resolved, tokens, err := h.resolveChannels(msg.Channels)
+	if err != nil {
+		return err
+	}
+	switch msg.Action {
+	case "subscribe":
+		if sub.Len()+len(tokens) > maxPriceChannels {
+			return errTooManyChannels
+		}
+		if err := sub.Add(ctx, tokens); err != nil {
+			return err
+		}
+		return send(gin.H{"type": "subscribed", "channels": resolved})
+	case "unsubscribe":
+		sub.Remove(tokens)
+		return send(gin.H{"type": "unsubscribed", "channels": resolved})
+	default:
+		return errors.New(`action must be "subscribe" or "unsubscribe"`)
+	}
+}
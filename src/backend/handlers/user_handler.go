@@ -1,17 +1,51 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
+
+	"defi-backend/auth"
+	"defi-backend/chain"
+	"defi-backend/repository"
+	"defi-backend/services"
 
 	"github.com/gin-gonic/gin"
 )
 
+// WalletLoginConfig Sign-In with Ethereum 校验参数，Domain 为空时不开放钱包登录，ChainID 为 0 时不限制链
+type WalletLoginConfig struct {
+	Domain  string
+	ChainID uint64
+}
+
 type UserHandler struct {
-	// 可以在这里添加依赖，如数据库连接、缓存等
+	userService *services.UserService
+	tokens      *auth.TokenService
+	wallet      WalletLoginConfig
+}
+
+func NewUserHandler(userService *services.UserService, tokens *auth.TokenService, wallet WalletLoginConfig) *UserHandler {
+	return &UserHandler{
+		userService: userService,
+		tokens:      tokens,
+		wallet:      wallet,
+	}
+}
+
+// WalletLoginRequest message 为 EIP-4361 消息原文，signature 为 personal_sign 的 0x 十六进制签名
+type WalletLoginRequest struct {
+	Message   string `json:"message" binding:"required"`
+	Signature string `json:"signature" binding:"required"`
 }
 
-func NewUserHandler() *UserHandler {
-	return &UserHandler{}
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required"`
 }
 
 func (h *UserHandler) Register(c *gin.Context) {
@@ -34,3 +68,183 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 		"message": "User profile retrieved successfully",
 	})
 }
+
+// WalletNonce 签发钱包登录使用的 nonce，前端把它填入 EIP-4361 消息
+func (h *UserHandler) WalletNonce(c *gin.Context) {
+	if h.wallet.Domain == "" {
+		c.JSON(walletErrorStatus(services.ErrWalletLoginDisabled), gin.H{"error": services.ErrWalletLoginDisabled.Error()})
+		return
+	}
+
+	nonce, err := h.userService.IssueWalletNonce()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"nonce":      nonce.Nonce,
+		"domain":     h.wallet.Domain,
+		"chain_id":   h.wallet.ChainID,
+		"expires_at": nonce.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// WalletLogin 校验签名后登录，钱包没有对应用户时自动注册
+func (h *UserHandler) WalletLogin(c *gin.Context) {
+	var req WalletLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userService.LoginWithWallet(req.Message, req.Signature, h.wallet.Domain, h.wallet.ChainID)
+	if err != nil {
+		c.JSON(walletErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.tokens.Issue(c.Request.Context(), auth.NewUser(user))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+		"user":   user,
+	})
+}
+
+// Refresh 用刷新令牌换取新的令牌对，旧刷新令牌随即失效
+func (h *UserHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.tokens.Refresh(c.Request.Context(), req.RefreshToken, h.loadUser)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, auth.ErrInvalidRefreshToken), errors.Is(err, auth.ErrRefreshTokenReused),
+			errors.Is(err, auth.ErrUserNotFound):
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// Logout 吊销当前访问令牌和所属会话
+func (h *UserHandler) Logout(c *gin.Context) {
+	claims, _ := c.MustGet("claims").(*auth.Claims)
+	if err := h.tokens.Logout(c.Request.Context(), claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAll 吊销当前用户在所有设备上的会话
+func (h *UserHandler) LogoutAll(c *gin.Context) {
+	if err := h.tokens.LogoutAll(c.Request.Context(), c.GetUint("userID")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions"})
+}
+
+// LinkWallet 把签名的钱包绑定到当前登录用户
+func (h *UserHandler) LinkWallet(c *gin.Context) {
+	var req WalletLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userService.LinkWallet(c.GetUint("userID"), req.Message, req.Signature, h.wallet.Domain, h.wallet.ChainID)
+	if err != nil {
+		c.JSON(walletErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// UpdateUserRole 管理员修改用户角色
+func (h *UserHandler) UpdateUserRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.userService.UpdateRole(uint(userID), req.Role); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrInvalidRole):
+			status = http.StatusBadRequest
+		case errors.Is(err, repository.ErrNotFound):
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": userID,
+		"role":    req.Role,
+	})
+}
+
+// ListUsers 返回所有用户及其角色
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	users, err := h.userService.ListUsers(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// JWKS 公开访问令牌的校验公钥，供其他服务验证本服务签发的令牌
+func (h *UserHandler) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, h.tokens.JWKS())
+}
+
+// loadUser 刷新令牌时重新读取用户，被禁用的用户不能继续刷新
+func (h *UserHandler) loadUser(userID uint) (*auth.User, error) {
+	user, err := h.userService.GetUser(userID)
+	if err != nil || !user.IsActive {
+		return nil, auth.ErrUserNotFound
+	}
+	return auth.NewUser(user), nil
+}
+
+func walletErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrInvalidSIWEMessage):
+		return http.StatusBadRequest
+	case errors.Is(err, chain.ErrInvalidSignature), errors.Is(err, services.ErrInvalidNonce):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrUserInactive):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrWalletAlreadyLinked):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrWalletLoginDisabled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
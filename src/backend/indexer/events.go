@@ -0,0 +1,168 @@
+package indexer
+
+import (
+	"fmt"
+	"math/big"
+
+	"defi-backend/chain"
+	"defi-backend/models"
+)
+
+// event 合约事件的解码结果，数量均为最小单位整数
+// TokenIn/AmountIn 表示流入合约的一侧，TokenOut/AmountOut 表示流出的一侧；
+// 流动性事件中分别对应 token0 和 token1
+type event struct {
+	Type      models.TransactionType
+	Account   string
+	TokenIn   string
+	TokenOut  string
+	AmountIn  *big.Int
+	AmountOut *big.Int
+	// Farming 事件只有 pid，代币在写库前通过 FarmingPool 查出
+	PoolID *big.Int
+}
+
+type eventDecoder struct {
+	signature string
+	decode    func(log chain.Log) (*event, error)
+}
+
+// Dex.sol 事件
+var dexEvents = []eventDecoder{
+	{"Swap(address,address,address,uint256,uint256)", decodeSwap},
+	{"AddLiquidity(address,address,address,uint256,uint256,uint256)", decodeLiquidity(models.TransactionTypeAddLiquidity)},
+	{"RemoveLiquidity(address,address,address,uint256,uint256,uint256)", decodeLiquidity(models.TransactionTypeRemoveLiquidity)},
+}
+
+// Lending.sol 事件
+var lendingEvents = []eventDecoder{
+	{"Supply(address,address,uint256)", decodeLending(models.TransactionTypeDeposit, true)},
+	{"Withdraw(address,address,uint256)", decodeLending(models.TransactionTypeWithdraw, false)},
+	{"Borrow(address,address,uint256)", decodeLending(models.TransactionTypeBorrow, false)},
+	{"Repay(address,address,uint256)", decodeLending(models.TransactionTypeRepay, true)},
+}
+
+// Farming.sol 事件
+var farmingEvents = []eventDecoder{
+	{"Deposit(address,uint256,uint256)", decodeFarming(models.TransactionTypeStake, true)},
+	{"Withdraw(address,uint256,uint256)", decodeFarming(models.TransactionTypeUnstake, false)},
+	{"EmergencyWithdraw(address,uint256,uint256)", decodeFarming(models.TransactionTypeEmergencyWithdraw, false)},
+}
+
+// Swap(sender indexed, tokenIn indexed, tokenOut indexed, amountIn, amountOut)
+func decodeSwap(log chain.Log) (*event, error) {
+	addrs, err := topicAddresses(log, 3)
+	if err != nil {
+		return nil, err
+	}
+	words, err := dataWords(log, 2)
+	if err != nil {
+		return nil, err
+	}
+	return &event{
+		Type:      models.TransactionTypeSwap,
+		Account:   addrs[0],
+		TokenIn:   addrs[1],
+		TokenOut:  addrs[2],
+		AmountIn:  words[0],
+		AmountOut: words[1],
+	}, nil
+}
+
+// AddLiquidity/RemoveLiquidity(provider indexed, token0 indexed, token1 indexed, amount0, amount1, liquidity)
+func decodeLiquidity(typ models.TransactionType) func(chain.Log) (*event, error) {
+	return func(log chain.Log) (*event, error) {
+		addrs, err := topicAddresses(log, 3)
+		if err != nil {
+			return nil, err
+		}
+		words, err := dataWords(log, 3)
+		if err != nil {
+			return nil, err
+		}
+		return &event{
+			Type:      typ,
+			Account:   addrs[0],
+			TokenIn:   addrs[1],
+			TokenOut:  addrs[2],
+			AmountIn:  words[0],
+			AmountOut: words[1],
+		}, nil
+	}
+}
+
+// Supply/Withdraw/Borrow/Repay(user indexed, token indexed, amount)
+func decodeLending(typ models.TransactionType, inflow bool) func(chain.Log) (*event, error) {
+	return func(log chain.Log) (*event, error) {
+		addrs, err := topicAddresses(log, 2)
+		if err != nil {
+			return nil, err
+		}
+		words, err := dataWords(log, 1)
+		if err != nil {
+			return nil, err
+		}
+		ev := &event{Type: typ, Account: addrs[0]}
+		if inflow {
+			ev.TokenIn, ev.AmountIn = addrs[1], words[0]
+		} else {
+			ev.TokenOut, ev.AmountOut = addrs[1], words[0]
+		}
+		return ev, nil
+	}
+}
+
+// Deposit/Withdraw/EmergencyWithdraw(user indexed, pid indexed, amount)
+func decodeFarming(typ models.TransactionType, inflow bool) func(chain.Log) (*event, error) {
+	return func(log chain.Log) (*event, error) {
+		if len(log.Topics) != 3 {
+			return nil, fmt.Errorf("expected 3 topics, got %d", len(log.Topics))
+		}
+		account, err := chain.TopicAddress(log.Topics[1])
+		if err != nil {
+			return nil, err
+		}
+		pid, err := chain.TopicUint(log.Topics[2])
+		if err != nil {
+			return nil, err
+		}
+		words, err := dataWords(log, 1)
+		if err != nil {
+			return nil, err
+		}
+		ev := &event{Type: typ, Account: account, PoolID: pid}
+		if inflow {
+			ev.AmountIn = words[0]
+		} else {
+			ev.AmountOut = words[0]
+		}
+		return ev, nil
+	}
+}
+
+func topicAddresses(log chain.Log, n int) ([]string, error) {
+	if len(log.Topics) != n+1 {
+		return nil, fmt.Errorf("expected %d topics, got %d", n+1, len(log.Topics))
+	}
+	addrs := make([]string, n)
+	for i := range addrs {
+		addr, err := chain.TopicAddress(log.Topics[i+1])
+		if err != nil {
+			return nil, err
+		}
+		addrs[i] = addr
+	}
+	return addrs, nil
+}
+
+func dataWords(log chain.Log, n int) ([]*big.Int, error) {
+	words := make([]*big.Int, n)
+	for i := range words {
+		w, err := chain.WordUint(log.Data, i)
+		if err != nil {
+			return nil, err
+		}
+		words[i] = w
+	}
+	return words, nil
+}
@@ -0,0 +1,445 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"defi-backend/chain"
+	"defi-backend/models"
+	"defi-backend/repository"
+	"defi-backend/services"
+
+	"go.uber.org/zap"
+)
+
+const (
+	CheckpointName = "chain_events"
+
+	DefaultBatchSize         = 1000
+	DefaultPollInterval      = 5 * time.Second
+	DefaultConfirmationDepth = 12
+	DefaultFinalityDepth     = 64
+
+	defaultDecimals = 18
+)
+
+var (
+	ErrNoContracts = errors.New("no contract addresses configured")
+	// ErrChainChanged 新区块接不上已索引的链，或同步期间区块哈希发生了变化，稍后重试即可
+	ErrChainChanged = errors.New("chain changed during sync")
+)
+
+// LogSource 索引器依赖的链上数据接口，chain.Client 实现了该接口，
+// 测试时可以换成指向本地假 RPC 服务的 chain.Client
+type LogSource interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	GetLogs(ctx context.Context, q chain.FilterQuery) ([]chain.Log, error)
+	HeaderByNumber(ctx context.Context, number uint64) (*chain.Header, error)
+}
+
+// Contracts 需要索引的合约地址，留空表示不索引该合约
+type Contracts struct {
+	Dex     string
+	Lending string
+	Farming string
+}
+
+type Config struct {
+	Contracts Contracts
+	// StartBlock 没有检查点时开始索引的区块
+	StartBlock   uint64
+	BatchSize    uint64
+	PollInterval time.Duration
+	// ConfirmationDepth 区块在链头之下达到该深度后，其中的交易标记为 confirmed
+	ConfirmationDepth uint64
+	// FinalityDepth 达到该深度后交易标记为 finalized，不再检查重组
+	FinalityDepth uint64
+	// OnIndex 在写入交易的同一数据库事务中关联由这些交易确认的数据
+	OnIndex func(tx repository.Store, txs []*models.Transaction) error
+	// OnRollback 链重组时在同一数据库事务中回滚由被丢弃交易派生的数据
+	OnRollback func(tx repository.Store, hashes []string) error
+}
+
+// Indexer 拉取 Dex/Lending/Farming 合约日志并写入 Transaction 表
+type Indexer struct {
+	source    LogSource
+	store     repository.Store
+	cfg       Config
+	logger    *zap.Logger
+	addresses []string
+	topics    []string
+	decoders  map[string]map[string]eventDecoder
+	decimals  map[string]uint8
+}
+
+func New(source LogSource, store repository.Store, cfg Config, logger *zap.Logger) (*Indexer, error) {
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.FinalityDepth == 0 {
+		cfg.FinalityDepth = DefaultFinalityDepth
+	}
+	if cfg.FinalityDepth < cfg.ConfirmationDepth {
+		cfg.FinalityDepth = cfg.ConfirmationDepth
+	}
+
+	ix := &Indexer{
+		source:   source,
+		store:    store,
+		cfg:      cfg,
+		logger:   logger,
+		decoders: make(map[string]map[string]eventDecoder),
+		decimals: make(map[string]uint8),
+	}
+
+	seen := make(map[string]bool)
+	register := func(address string, events []eventDecoder) {
+		if address == "" {
+			return
+		}
+		address = strings.ToLower(address)
+		ix.addresses = append(ix.addresses, address)
+		ix.decoders[address] = make(map[string]eventDecoder)
+		for _, ev := range events {
+			topic := chain.EventTopic(ev.signature)
+			ix.decoders[address][topic] = ev
+			if !seen[topic] {
+				seen[topic] = true
+				ix.topics = append(ix.topics, topic)
+			}
+		}
+	}
+	register(cfg.Contracts.Dex, dexEvents)
+	register(cfg.Contracts.Lending, lendingEvents)
+	register(cfg.Contracts.Farming, farmingEvents)
+
+	if len(ix.addresses) == 0 {
+		return nil, ErrNoContracts
+	}
+	return ix, nil
+}
+
+// Run 持续同步直到 ctx 结束，追上链头、链发生变化或出错后等待 PollInterval 再继续
+func (ix *Indexer) Run(ctx context.Context) error {
+	for {
+		caughtUp, err := ix.SyncOnce(ctx)
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, ErrChainChanged):
+			// SyncOnce 已经记录了原因，等链稳定后由 handleReorg 找到分叉点
+		default:
+			ix.logger.Error("indexer sync failed", zap.Error(err))
+		}
+
+		if err == nil && !caughtUp {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(ix.cfg.PollInterval):
+		}
+	}
+}
+
+// SyncOnce 先检查链重组，再处理检查点之后的一批区块，返回是否已追上链头；
+// 这一批区块接不上已索引的链时返回 ErrChainChanged，不写入任何数据
+func (ix *Indexer) SyncOnce(ctx context.Context) (bool, error) {
+	head, err := ix.source.BlockNumber(ctx)
+	if err != nil {
+		return false, err
+	}
+	if err := ix.handleReorg(ctx); err != nil {
+		return false, err
+	}
+
+	checkpoint, err := ix.loadCheckpoint()
+	if err != nil {
+		return false, err
+	}
+	from := ix.cfg.StartBlock
+	if checkpoint.ID != 0 {
+		from = checkpoint.BlockNumber + 1
+	}
+	if from > head {
+		return true, ix.advance(head)
+	}
+	to := from + ix.cfg.BatchSize - 1
+	if to > head {
+		to = head
+	}
+
+	// 未最终确认的区块逐个记录区块头，用于之后发现重组
+	headers := make(map[uint64]*chain.Header)
+	var blocks []models.ChainBlock
+	for n := maxUint64(from, ix.unfinalizedFrom(head)); n <= to; n++ {
+		header, err := ix.source.HeaderByNumber(ctx, n)
+		if err != nil {
+			return false, err
+		}
+		headers[n] = header
+		blocks = append(blocks, models.ChainBlock{Number: n, Hash: header.Hash, ParentHash: header.ParentHash})
+	}
+	if ok, err := ix.linksToIndexed(blocks); err != nil {
+		return false, err
+	} else if !ok {
+		// 新区块接不上已索引的链，下一轮 handleReorg 会找到分叉点
+		return false, ErrChainChanged
+	}
+
+	logs, err := ix.source.GetLogs(ctx, chain.FilterQuery{
+		FromBlock: from,
+		ToBlock:   to,
+		Addresses: ix.addresses,
+		Topics:    [][]string{ix.topics},
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, log := range logs {
+		// 拉取区块头和日志之间链发生了变化，整批重试
+		if header, ok := headers[log.BlockNumber]; ok && header.Hash != log.BlockHash {
+			ix.logger.Warn("block hash changed during sync", zap.Uint64("block", log.BlockNumber))
+			return false, ErrChainChanged
+		}
+	}
+
+	txs, err := ix.buildTransactions(ctx, logs, headers, head)
+	if err != nil {
+		return false, err
+	}
+
+	err = ix.store.Transaction(func(tx repository.Store) error {
+		service := services.NewTransactionService(tx.Transactions())
+		for _, t := range txs {
+			if err := service.UpsertTransaction(t); err != nil {
+				return fmt.Errorf("failed to save transaction %s#%d: %v", t.TransactionHash, t.LogIndex, err)
+			}
+		}
+		if ix.cfg.OnIndex != nil && len(txs) > 0 {
+			if err := ix.cfg.OnIndex(tx, txs); err != nil {
+				return err
+			}
+		}
+		for i := range blocks {
+			if err := tx.Chain().UpsertBlock(&blocks[i]); err != nil {
+				return err
+			}
+		}
+		checkpoint.BlockNumber = to
+		return tx.Chain().SaveCheckpoint(checkpoint)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	ix.logger.Info("indexed blocks",
+		zap.Uint64("from", from),
+		zap.Uint64("to", to),
+		zap.Int("transactions", len(txs)),
+	)
+	return to == head, ix.advance(head)
+}
+
+// Checkpoint 返回最近一次处理完成的区块，尚未开始时 ok 为 false
+func (ix *Indexer) Checkpoint() (uint64, bool, error) {
+	checkpoint, err := ix.loadCheckpoint()
+	if err != nil {
+		return 0, false, err
+	}
+	return checkpoint.BlockNumber, checkpoint.ID != 0, nil
+}
+
+func (ix *Indexer) loadCheckpoint() (*models.SyncCheckpoint, error) {
+	checkpoint, err := ix.store.Chain().FindCheckpoint(CheckpointName)
+	if errors.Is(err, repository.ErrNotFound) {
+		return &models.SyncCheckpoint{Name: CheckpointName}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+func (ix *Indexer) buildTransactions(ctx context.Context, logs []chain.Log, headers map[uint64]*chain.Header, head uint64) ([]*models.Transaction, error) {
+	users := make(map[string]uint)
+
+	var txs []*models.Transaction
+	for _, log := range logs {
+		if log.Removed || len(log.Topics) == 0 {
+			continue
+		}
+		decoder, ok := ix.decoders[log.Address][log.Topics[0]]
+		if !ok {
+			continue
+		}
+		ev, err := decoder.decode(log)
+		if err != nil {
+			// 无法解码的日志跳过，不阻塞后续区块
+			ix.logger.Warn("failed to decode log",
+				zap.String("tx", log.TransactionHash),
+				zap.Uint("log_index", log.LogIndex),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		header, ok := headers[log.BlockNumber]
+		if !ok {
+			if header, err = ix.source.HeaderByNumber(ctx, log.BlockNumber); err != nil {
+				return nil, err
+			}
+			headers[log.BlockNumber] = header
+		}
+
+		userID, ok := users[ev.Account]
+		if !ok {
+			if userID, err = ix.lookupUser(ev.Account); err != nil {
+				return nil, err
+			}
+			users[ev.Account] = userID
+		}
+
+		t, err := ix.newTransaction(log, ev)
+		if err != nil {
+			return nil, err
+		}
+		t.UserID = userID
+		t.Status = ix.statusAt(log.BlockNumber, head)
+		t.Timestamp = time.Unix(int64(header.Timestamp), 0)
+		txs = append(txs, t)
+	}
+	return txs, nil
+}
+
+func (ix *Indexer) newTransaction(log chain.Log, ev *event) (*models.Transaction, error) {
+	t := &models.Transaction{
+		Type:            ev.Type,
+		Contract:        log.Address,
+		Account:         ev.Account,
+		TokenIn:         ev.TokenIn,
+		TokenOut:        ev.TokenOut,
+		BlockNumber:     log.BlockNumber,
+		BlockHash:       log.BlockHash,
+		TransactionHash: log.TransactionHash,
+		LogIndex:        log.LogIndex,
+	}
+
+	decimalsIn, decimalsOut := uint8(defaultDecimals), uint8(defaultDecimals)
+	if ev.PoolID != nil {
+		token, decimals, err := ix.lookupPool(ev.PoolID)
+		if err != nil {
+			return nil, err
+		}
+		decimalsIn, decimalsOut = decimals, decimals
+		if ev.AmountIn != nil {
+			t.TokenIn = token
+		} else {
+			t.TokenOut = token
+		}
+	} else {
+		var err error
+		if t.TokenIn != "" {
+			if decimalsIn, err = ix.tokenDecimals(t.TokenIn); err != nil {
+				return nil, err
+			}
+		}
+		if t.TokenOut != "" {
+			if decimalsOut, err = ix.tokenDecimals(t.TokenOut); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if ev.AmountIn != nil {
+		t.AmountIn = models.NewAmount(ev.AmountIn, decimalsIn)
+	}
+	if ev.AmountOut != nil {
+		t.AmountOut = models.NewAmount(ev.AmountOut, decimalsOut)
+	}
+	if ev.Type == models.TransactionTypeSwap && t.AmountIn.Sign() > 0 {
+		t.Price = new(big.Rat).Quo(t.AmountOut.Rat(), t.AmountIn.Rat()).FloatString(18)
+	}
+	return t, nil
+}
+
+// lookupUser 通过钱包地址找到用户，没有绑定钱包的地址记为 0
+func (ix *Indexer) lookupUser(address string) (uint, error) {
+	user, err := ix.store.Users().FindByWallet(address)
+	if errors.Is(err, repository.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// lookupPool 把 Farming 的 pid 换成 LP 代币地址和精度，未登记的池子用 pid 占位
+func (ix *Indexer) lookupPool(pid *big.Int) (string, uint8, error) {
+	if !pid.IsUint64() {
+		return "", 0, fmt.Errorf("invalid pool id: %s", pid)
+	}
+	pool, err := ix.store.Farms().FindPool(context.Background(), uint(pid.Uint64()))
+	if errors.Is(err, repository.ErrNotFound) {
+		return "pid:" + pid.String(), defaultDecimals, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return pool.LPToken, pool.LPDecimals, nil
+}
+
+// tokenDecimals 从借贷市场或交易对中查找代币精度，查不到时按 18 位处理。
+// 市场和交易对都不多，第一次查找未缓存的代币时整表读出
+func (ix *Indexer) tokenDecimals(token string) (uint8, error) {
+	if d, ok := ix.decimals[token]; ok {
+		return d, nil
+	}
+
+	decimals, found, err := ix.findDecimals(token)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		decimals = defaultDecimals
+	}
+	ix.decimals[token] = decimals
+	return decimals, nil
+}
+
+func (ix *Indexer) findDecimals(token string) (uint8, bool, error) {
+	ctx := context.Background()
+	markets, err := ix.store.Markets().ListListed(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, market := range markets {
+		if strings.EqualFold(market.Token, token) {
+			return market.Decimals, true, nil
+		}
+	}
+
+	pairs, err := ix.store.Pairs().List(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, pair := range pairs {
+		switch {
+		case strings.EqualFold(pair.Token0, token):
+			return pair.Decimals0, true, nil
+		case strings.EqualFold(pair.Token1, token):
+			return pair.Decimals1, true, nil
+		}
+	}
+	return 0, false, nil
+}
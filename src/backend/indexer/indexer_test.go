@@ -0,0 +1,215 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"defi-backend/chain"
+	"defi-backend/models"
+	"defi-backend/repository"
+
+	"go.uber.org/zap"
+)
+
+const (
+	dexAddress     = "0x00000000000000000000000000000000000000d1"
+	lendingAddress = "0x00000000000000000000000000000000000000d2"
+	farmingAddress = "0x00000000000000000000000000000000000000d3"
+	userAddress    = "0x00000000000000000000000000000000000000a1"
+	tokenA         = "0x00000000000000000000000000000000000000e1"
+	tokenB         = "0x00000000000000000000000000000000000000e2"
+)
+
+// fakeChain 内存中的链，区块哈希由分叉名和高度组成，reorg 替换某个高度之后的所有区块
+type fakeChain struct {
+	mu      sync.Mutex
+	headers []*chain.Header
+	logs    []chain.Log
+	calls   int
+	// staleLogs 为 true 时 GetLogs 返回的日志带着旧的区块哈希，模拟拉取期间发生重组
+	staleLogs bool
+}
+
+func newFakeChain(blocks int) *fakeChain {
+	c := &fakeChain{}
+	c.extend(0, blocks, "a")
+	return c
+}
+
+func (c *fakeChain) extend(from uint64, count int, fork string) {
+	c.headers = c.headers[:from]
+	for n := from; n < from+uint64(count); n++ {
+		header := &chain.Header{Number: n, Hash: fmt.Sprintf("0x%s%04d", fork, n), Timestamp: 1_700_000_000 + n*12}
+		if n > 0 {
+			header.ParentHash = c.headers[n-1].Hash
+		}
+		c.headers = append(c.headers, header)
+	}
+}
+
+// reorg 用新的分叉替换 from 及之后的区块，被替换区块中的日志随之消失
+func (c *fakeChain) reorg(from uint64, count int, fork string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.extend(from, count, fork)
+	kept := c.logs[:0]
+	for _, log := range c.logs {
+		if log.BlockNumber < from {
+			kept = append(kept, log)
+		}
+	}
+	c.logs = kept
+}
+
+func (c *fakeChain) addLog(log chain.Log) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	log.BlockHash = c.headers[log.BlockNumber].Hash
+	c.logs = append(c.logs, log)
+}
+
+func (c *fakeChain) BlockNumber(ctx context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return uint64(len(c.headers) - 1), nil
+}
+
+func (c *fakeChain) GetLogs(ctx context.Context, q chain.FilterQuery) ([]chain.Log, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var logs []chain.Log
+	for _, log := range c.logs {
+		if log.BlockNumber >= q.FromBlock && log.BlockNumber <= q.ToBlock {
+			if c.staleLogs {
+				log.BlockHash = "0xstale"
+			}
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+func (c *fakeChain) HeaderByNumber(ctx context.Context, number uint64) (*chain.Header, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if number >= uint64(len(c.headers)) {
+		return nil, chain.ErrBlockNotFound
+	}
+	header := *c.headers[number]
+	return &header, nil
+}
+
+func addressTopic(address string) string {
+	return "0x" + strings.Repeat("0", 24) + strings.TrimPrefix(address, "0x")
+}
+
+func words(values ...int64) []byte {
+	data := make([]byte, 32*len(values))
+	for i, v := range values {
+		big.NewInt(v).FillBytes(data[i*32 : (i+1)*32])
+	}
+	return data
+}
+
+func swapLog(block uint64, hash string, amountIn, amountOut int64) chain.Log {
+	return chain.Log{
+		Address: dexAddress,
+		Topics: []string{
+			chain.EventTopic("Swap(address,address,address,uint256,uint256)"),
+			addressTopic(userAddress), addressTopic(tokenA), addressTopic(tokenB),
+		},
+		Data:            words(amountIn, amountOut),
+		BlockNumber:     block,
+		TransactionHash: hash,
+	}
+}
+
+func newTestIndexer(t *testing.T, source LogSource, store repository.Store, onRollback func(repository.Store, []string) error) *Indexer {
+	t.Helper()
+	ix, err := New(source, store, Config{
+		Contracts:         Contracts{Dex: dexAddress, Lending: lendingAddress, Farming: farmingAddress},
+		PollInterval:      20 * time.Millisecond,
+		ConfirmationDepth: 2,
+		FinalityDepth:     6,
+		OnRollback:        onRollback,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ix
+}
+
+func TestSyncOnceIndexesLogs(t *testing.T) {
+	store := repository.NewMemoryStore()
+	wallet := userAddress
+	user := &models.User{Username: "trader", Password: "x", Role: "user", WalletAddress: &wallet}
+	if err := store.Users().Create(user); err != nil {
+		t.Fatal(err)
+	}
+
+	source := newFakeChain(10)
+	source.addLog(swapLog(5, "0x01", 1000, 2000))
+	ix := newTestIndexer(t, source, store, nil)
+
+	caughtUp, err := ix.SyncOnce(context.Background())
+	if err != nil || !caughtUp {
+		t.Fatalf("SyncOnce = %v, %v, want caught up", caughtUp, err)
+	}
+
+	tx, err := store.Transactions().FindByHash("0x01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.UserID != user.ID || tx.Type != models.TransactionTypeSwap || tx.TokenIn != tokenA || tx.TokenOut != tokenB {
+		t.Fatalf("indexed transaction = %+v", tx)
+	}
+	if tx.AmountIn.Raw().Int64() != 1000 || tx.AmountOut.Raw().Int64() != 2000 {
+		t.Fatalf("amounts = %s/%s", tx.AmountIn, tx.AmountOut)
+	}
+	// 链头 9，区块 5 的深度为 4，超过确认深度但未最终确认
+	if tx.Status != models.TransactionStatusConfirmed {
+		t.Fatalf("status = %s, want confirmed", tx.Status)
+	}
+
+	if block, ok, err := ix.Checkpoint(); err != nil || !ok || block != 9 {
+		t.Fatalf("checkpoint = %d, %v, %v, want 9", block, ok, err)
+	}
+	blocks, err := store.Chain().ListBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 6 || blocks[0].Number != 9 || blocks[5].Number != 4 {
+		t.Fatalf("tracked blocks = %+v, want 9..4", blocks)
+	}
+}
+
+func TestRunBacksOffWhenChainChanges(t *testing.T) {
+	source := newFakeChain(10)
+	source.addLog(swapLog(5, "0x01", 1000, 2000))
+	source.staleLogs = true
+	ix := newTestIndexer(t, source, repository.NewMemoryStore(), nil)
+
+	if _, err := ix.SyncOnce(context.Background()); !errors.Is(err, ErrChainChanged) {
+		t.Fatalf("SyncOnce err = %v, want ErrChainChanged", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := ix.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run err = %v", err)
+	}
+
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	// 每 20ms 重试一次，不应该空转
+	if source.calls > 10 {
+		t.Fatalf("Run polled %d times in 100ms without backing off", source.calls)
+	}
+}
@@ -0,0 +1,176 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+
+	"defi-backend/chain"
+	"defi-backend/models"
+	"defi-backend/repository"
+	"defi-backend/services"
+
+	"go.uber.org/zap"
+)
+
+// handleReorg 从最新的已记录区块往回比对区块哈希，找到与当前链一致的分叉点，
+// 把分叉点之后区块中的交易标记为 orphaned，并把检查点退回分叉点以便重新索引
+func (ix *Indexer) handleReorg(ctx context.Context) error {
+	blocks, err := ix.store.Chain().ListBlocks()
+	if err != nil {
+		return err
+	}
+
+	var orphaned []string
+	found := false
+	var ancestor uint64
+	for _, block := range blocks {
+		header, err := ix.source.HeaderByNumber(ctx, block.Number)
+		if err != nil && !errors.Is(err, chain.ErrBlockNotFound) {
+			return err
+		}
+		if err == nil && header.Hash == block.Hash {
+			ancestor, found = block.Number, true
+			break
+		}
+		orphaned = append(orphaned, block.Hash)
+	}
+	if len(orphaned) == 0 {
+		return nil
+	}
+	if !found {
+		// 重组深度超过了保存的区块范围，只能退回到最早记录的区块之前
+		lowest := blocks[len(blocks)-1].Number
+		if lowest > 0 {
+			ancestor = lowest - 1
+		}
+		ix.logger.Error("reorg deeper than tracked blocks", zap.Uint64("lowest_tracked", lowest))
+	}
+
+	var hashes []string
+	err = ix.store.Transaction(func(tx repository.Store) error {
+		var err error
+		if hashes, err = tx.Transactions().ListHashesByBlocks(orphaned); err != nil {
+			return err
+		}
+
+		service := services.NewTransactionService(tx.Transactions())
+		for _, hash := range hashes {
+			if err := service.UpdateTransactionStatus(hash, models.TransactionStatusOrphaned); err != nil {
+				return err
+			}
+		}
+		if ix.cfg.OnRollback != nil {
+			if err := ix.cfg.OnRollback(tx, hashes); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Chain().DeleteBlocksAbove(ancestor); err != nil {
+			return err
+		}
+		return tx.Chain().RewindCheckpoint(CheckpointName, ancestor)
+	})
+	if err != nil {
+		return err
+	}
+
+	ix.logger.Warn("chain reorg detected",
+		zap.Uint64("ancestor", ancestor),
+		zap.Int("orphaned_blocks", len(orphaned)),
+		zap.Int("orphaned_transactions", len(hashes)),
+	)
+	return nil
+}
+
+// linksToIndexed 检查新区块是否首尾相连，并接在已记录的上一个区块之后
+func (ix *Indexer) linksToIndexed(blocks []models.ChainBlock) (bool, error) {
+	if len(blocks) == 0 {
+		return true, nil
+	}
+	for i := 1; i < len(blocks); i++ {
+		if blocks[i].ParentHash != blocks[i-1].Hash {
+			ix.logger.Warn("block parent hash mismatch", zap.Uint64("block", blocks[i].Number))
+			return false, nil
+		}
+	}
+
+	first := blocks[0]
+	if first.Number == 0 {
+		return true, nil
+	}
+	parent, err := ix.store.Chain().FindBlock(first.Number - 1)
+	if errors.Is(err, repository.ErrNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if parent.Hash != first.ParentHash {
+		ix.logger.Warn("block parent hash mismatch", zap.Uint64("block", first.Number))
+		return false, nil
+	}
+	return true, nil
+}
+
+// advance 按链头高度推进交易状态 pending -> confirmed -> finalized，并清理已最终确认的区块记录
+func (ix *Indexer) advance(head uint64) error {
+	service := services.NewTransactionService(ix.store.Transactions())
+	steps := []struct {
+		from, to string
+		depth    uint64
+	}{
+		{models.TransactionStatusPending, models.TransactionStatusConfirmed, ix.cfg.ConfirmationDepth},
+		{models.TransactionStatusConfirmed, models.TransactionStatusFinalized, ix.cfg.FinalityDepth},
+	}
+	for _, step := range steps {
+		if head < step.depth {
+			continue
+		}
+		hashes, err := ix.store.Transactions().ListHashesByStatus(step.from, head-step.depth)
+		if err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if err := service.UpdateTransactionStatus(hash, step.to); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 保留最后一个已最终确认的区块作为分叉点比对的下界
+	if keep := ix.unfinalizedFrom(head); keep > 0 {
+		return ix.store.Chain().DeleteBlocksBelow(keep - 1)
+	}
+	return nil
+}
+
+// statusAt 根据区块在链头之下的深度给出交易状态
+func (ix *Indexer) statusAt(block, head uint64) string {
+	var depth uint64
+	if head > block {
+		depth = head - block
+	}
+	switch {
+	case depth >= ix.cfg.FinalityDepth:
+		return models.TransactionStatusFinalized
+	case depth >= ix.cfg.ConfirmationDepth:
+		return models.TransactionStatusConfirmed
+	default:
+		return models.TransactionStatusPending
+	}
+}
+
+// unfinalizedFrom 返回第一个尚未最终确认的区块高度
+func (ix *Indexer) unfinalizedFrom(head uint64) uint64 {
+	if head < ix.cfg.FinalityDepth {
+		return 0
+	}
+	return head - ix.cfg.FinalityDepth + 1
+}
+
+func maxUint64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,156 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"defi-backend/chain"
+	"defi-backend/models"
+	"defi-backend/repository"
+	"defi-backend/services"
+)
+
+const lpToken = "0x00000000000000000000000000000000000000f1"
+
+func supplyLog(block uint64, hash string, amount int64) chain.Log {
+	return chain.Log{
+		Address:         lendingAddress,
+		Topics:          []string{chain.EventTopic("Supply(address,address,uint256)"), addressTopic(userAddress), addressTopic(tokenA)},
+		Data:            words(amount),
+		BlockNumber:     block,
+		TransactionHash: hash,
+	}
+}
+
+func farmingDepositLog(block uint64, hash string, pid, amount int64) chain.Log {
+	return chain.Log{
+		Address:         farmingAddress,
+		Topics:          []string{chain.EventTopic("Deposit(address,uint256,uint256)"), addressTopic(userAddress), fmt.Sprintf("0x%064x", pid)},
+		Data:            words(amount),
+		BlockNumber:     block,
+		TransactionHash: hash,
+	}
+}
+
+// reorgFixture 用户在 tokenA 市场存入 1000 wei，并在池子 0 上有一条待上链确认的奖励
+type reorgFixture struct {
+	store    repository.Store
+	position *models.LendingPosition
+	reward   *models.Reward
+}
+
+func newReorgFixture(t *testing.T) *reorgFixture {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	wallet := userAddress
+	user := &models.User{Username: "lender", Password: "x", Role: "user", WalletAddress: &wallet}
+	if err := store.Users().Create(user); err != nil {
+		t.Fatal(err)
+	}
+	market := &models.LendingMarket{Token: tokenA, Decimals: 18, Price: services.LendingBase.String(), IsListed: true}
+	if err := store.Markets().Create(market); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Farms().CreatePool(&models.FarmingPool{PoolID: 0, LPToken: lpToken}); err != nil {
+		t.Fatal(err)
+	}
+
+	position, err := services.NewDefiService(store, nil).CreateLendingPosition(user.ID, tokenA, models.NewAmount(big.NewInt(1000), 18), models.PositionTypeSupply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staked := &models.FarmingPosition{UserID: user.ID, PoolID: 0, Token: lpToken, Amount: models.NewAmount(big.NewInt(5), 18), Status: "active"}
+	if err := store.Farms().SavePosition(staked); err != nil {
+		t.Fatal(err)
+	}
+	// 奖励在链上交易之前产生
+	reward := &models.Reward{UserID: user.ID, PositionID: staked.ID, Token: "RWD", Amount: models.NewAmount(big.NewInt(7), 18), Type: "farming", ClaimTime: time.Unix(1_600_000_000, 0)}
+	if err := store.Rewards().Create(reward); err != nil {
+		t.Fatal(err)
+	}
+	return &reorgFixture{store: store, position: position, reward: reward}
+}
+
+func (f *reorgFixture) expect(t *testing.T, positionStatus, rewardStatus, totalSupply string) {
+	t.Helper()
+	positions, err := f.store.Positions().ListByTransactions([]string{"0x01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 1 || positions[0].ID != f.position.ID || positions[0].Status != positionStatus {
+		t.Fatalf("positions for 0x01 = %+v, want position %d %s", positions, f.position.ID, positionStatus)
+	}
+	rewards, err := f.store.Rewards().ListByTransactions([]string{"0x02"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rewards) != 1 || rewards[0].ID != f.reward.ID || rewards[0].Status != rewardStatus {
+		t.Fatalf("rewards for 0x02 = %+v, want reward %d %s", rewards, f.reward.ID, rewardStatus)
+	}
+	market, err := f.store.Markets().FindListed(tokenA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if market.TotalSupply != totalSupply {
+		t.Fatalf("market total supply = %s, want %s", market.TotalSupply, totalSupply)
+	}
+}
+
+func TestReorgRollsBackAndRestoresPositions(t *testing.T) {
+	f := newReorgFixture(t)
+	source := newFakeChain(10)
+	source.addLog(supplyLog(5, "0x01", 1000))
+	source.addLog(farmingDepositLog(6, "0x02", 0, 5))
+	ix := newTestIndexer(t, source, f.store, services.RollbackTransactions)
+	ix.cfg.OnIndex = services.LinkTransactions
+	ctx := context.Background()
+
+	if _, err := ix.SyncOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	f.expect(t, "active", "claimed", "1000")
+
+	// 区块 5 之后被替换，两笔交易都不在新链上
+	source.reorg(5, 6, "b")
+	if _, err := ix.SyncOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	f.expect(t, "orphaned", "orphaned", "0")
+	tx, err := f.store.Transactions().FindByHash("0x01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Status != models.TransactionStatusOrphaned {
+		t.Fatalf("transaction status = %s, want orphaned", tx.Status)
+	}
+	if block, _, _ := ix.Checkpoint(); block != 10 {
+		t.Fatalf("checkpoint = %d, want 10", block)
+	}
+
+	// 同样的交易被打包进另一条分叉上的区块
+	source.reorg(5, 7, "c")
+	source.addLog(supplyLog(7, "0x01", 1000))
+	source.addLog(farmingDepositLog(8, "0x02", 0, 5))
+	if _, err := ix.SyncOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	f.expect(t, "active", "claimed", "1000")
+	if tx, err = f.store.Transactions().FindByHash("0x01"); err != nil || tx.Status == models.TransactionStatusOrphaned || tx.BlockNumber != 7 {
+		t.Fatalf("re-included transaction = %+v, %v", tx, err)
+	}
+
+	// 再次处理同一批交易不会关联其他仓位
+	unlinked, err := services.NewDefiService(f.store, nil).CreateLendingPosition(f.position.UserID, tokenA, models.NewAmount(big.NewInt(1000), 18), models.PositionTypeSupply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.store.Transaction(func(tx repository.Store) error {
+		return services.LinkTransactions(tx, []*models.Transaction{{UserID: f.position.UserID, Type: models.TransactionTypeDeposit, TokenIn: tokenA, AmountIn: unlinked.Amount, TransactionHash: "0x01"}})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	f.expect(t, "active", "claimed", "2000")
+}
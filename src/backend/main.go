@@ -1,42 +1,229 @@
 package main
 
 import (
+	"context"
+	"defi-backend/auth"
+	"defi-backend/chain"
 	"defi-backend/config"
+	"defi-backend/database"
+	"defi-backend/handlers"
+	"defi-backend/indexer"
+	"defi-backend/middleware"
+	"defi-backend/repository"
 	"defi-backend/routes"
-	"fmt"
+	"defi-backend/services"
+	"flag"
 	"log"
 	"os"
+	"strconv"
+
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
 )
 
+// 本地配置文件路径
+const configFile = "config/config.yaml"
+
 func main() {
-	// 加载本地配置
-	cfg, err := config.LoadConfig("config/config.yaml")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "config":
+			os.Exit(runConfigCommand(os.Args[2:]))
+		case "migrate":
+			os.Exit(runMigrateCommand(os.Args[2:]))
+		}
+	}
+
+	offline := flag.Bool("offline", false, "start without Nacos, using local config and environment only")
+	flag.Parse()
+
+	// 加载配置：默认值 < 本地配置 < Nacos < 环境变量
+	loader, err := config.Bootstrap(configFile, config.BootstrapOptions{Offline: *offline})
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	watcher, err := config.NewWatcher(loader)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	cfg := watcher.Current()
 
-	// 创建 Nacos 客户端
-	nacosClient, err := config.NewNacosClient(cfg.Nacos)
+	// 初始化数据库
+	db, err := database.InitDB(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create Nacos client: %v", err)
+		log.Fatalf("Failed to init database: %v", err)
+	}
+	if err := migrateOnStartup(db, cfg.Database.Migrate); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
-	// 从 Nacos 获取配置
-	content, err := config.GetConfig(nacosClient, cfg.Nacos.Group, cfg.Nacos.DataId)
+	redisClient, err := database.InitRedis(cfg)
 	if err != nil {
-		log.Fatalf("Failed to get config from Nacos: %v", err)
+		log.Fatalf("Failed to init redis: %v", err)
 	}
 
-	fmt.Printf("Configuration loaded successfully:\n%s\n", content)
+	zapConfig := zap.NewProductionConfig()
+	logger, err := zapConfig.Build()
+	if err != nil {
+		log.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Sync()
 
 	// 设置路由
-	r := routes.SetupRouter()
+	store := repository.NewGormStore(db)
+	userService := services.NewUserService(store)
+	ethClient := chain.NewClient(cfg.Ethereum.RPCURL)
+	defiService := services.NewDefiService(store, ethClient)
+	candles := services.NewCandleService(redisClient, store)
+
+	// 价格更新来自 RabbitMQ，K 线先用 Redis 中保存的价格历史回填
+	var rabbitMQ *amqp.Connection
+	if cfg.RabbitMQ.URL != "" {
+		if rabbitMQ, err = amqp.Dial(cfg.RabbitMQ.URL); err != nil {
+			logger.Warn("Price updates disabled", zap.Error(err))
+		} else {
+			defer rabbitMQ.Close()
+		}
+	}
+	// 价格更新时检查用户的价格提醒，索引按数据库中的提醒补齐
+	alerts := services.NewAlertService(redisClient, store, candles, cfg.Alerts,
+		services.NewInboxNotifier(store), services.NewWebhookNotifier(cfg.Alerts))
+	go func() {
+		if err := alerts.RebuildIndex(context.Background()); err != nil {
+			logger.Warn("Failed to rebuild alert index", zap.Error(err))
+		}
+	}()
+	priceService := services.NewPriceService(redisClient, rabbitMQ, candles, alerts)
+	go func() {
+		if err := priceService.BackfillCandles(context.Background()); err != nil {
+			logger.Warn("Failed to backfill candles", zap.Error(err))
+		}
+	}()
+
+	// 交易对储备定期采样用于计算 TWAP，配置了 Dex 合约时从链上读取
+	var reserves services.ReserveReader = services.StoredReserves{}
+	if cfg.Ethereum.RPCURL != "" && cfg.Ethereum.Contracts.Dex != "" {
+		reserves = services.NewChainReserves(ethClient, cfg.Ethereum.Contracts.Dex)
+	}
+	twap := services.NewTWAPService(redisClient, store, reserves, cfg.TWAP)
+	go twap.Run(context.Background())
 
-	// 获取端口
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// 队列中的报价和 DEX 价格 (现货或 TWAP) 经预言机聚合后才写入价格，风控也使用聚合价格
+	oracle := services.NewOracle(redisClient, priceService, store, twap, cfg.Oracle)
+	riskEngine := services.NewRiskEngine(store, oracle)
+	go oracle.RunDexQuotes(context.Background())
+	if rabbitMQ != nil {
+		err := priceService.StartPriceUpdates(context.Background(), func(quote services.PriceUpdate) error {
+			return oracle.Submit(context.Background(), quote)
+		})
+		if err != nil {
+			logger.Warn("Price updates disabled", zap.Error(err))
+		}
 	}
+	// 各实例通过 Redis 频道收到价格更新后推送给自己的客户端
+	priceHub := services.NewPriceHub(redisClient, priceService)
+	go func() {
+		if err := priceHub.Run(context.Background()); err != nil {
+			logger.Warn("Price stream disabled", zap.Error(err))
+		}
+	}()
+
+	// 启动链上事件索引
+	if cfg.Ethereum.RPCURL != "" {
+		ix, err := indexer.New(ethClient, store, indexer.Config{
+			Contracts: indexer.Contracts{
+				Dex:     cfg.Ethereum.Contracts.Dex,
+				Lending: cfg.Ethereum.Contracts.Lending,
+				Farming: cfg.Ethereum.Contracts.Farming,
+			},
+			StartBlock:        cfg.Ethereum.Indexer.StartBlock,
+			ConfirmationDepth: cfg.Ethereum.Indexer.Confirmations,
+			FinalityDepth:     cfg.Ethereum.Indexer.FinalityDepth,
+			OnIndex:           services.LinkTransactions,
+			OnRollback:        services.RollbackTransactions,
+		}, logger)
+		if err != nil {
+			logger.Warn("Chain indexer disabled", zap.Error(err))
+		} else {
+			go ix.Run(context.Background())
+		}
+	}
+
+	keys, err := auth.NewKeyManager(cfg.JWT)
+	if err != nil {
+		log.Fatalf("Failed to load jwt keys: %v", err)
+	}
+	tokens := auth.NewTokenService(redisClient, keys, cfg.JWT.AccessTTL, cfg.JWT.RefreshTTL)
+	wallet := handlers.WalletLoginConfig{
+		Domain:  cfg.Server.Domain,
+		ChainID: cfg.Ethereum.ChainID,
+	}
+
+	// 订阅可热更新的配置
+	limiter := middleware.NewRateLimiter()
+	features := middleware.NewFeatureFlags()
+	subscribers := []struct {
+		name string
+		fn   config.Subscriber
+	}{
+		{"jwt", func(_, next *config.Config) error {
+			return keys.Reload(next.JWT)
+		}},
+		{"log", func(_, next *config.Config) error {
+			level := next.Log.Level
+			if level == "" {
+				level = "info"
+			}
+			return zapConfig.Level.UnmarshalText([]byte(level))
+		}},
+		{"rate_limit", func(_, next *config.Config) error {
+			limiter.Update(next.RateLimit.RequestsPerSecond, next.RateLimit.Burst)
+			return nil
+		}},
+		{"features", func(_, next *config.Config) error {
+			features.Set(next.Features)
+			return nil
+		}},
+		{"interest", func(_, next *config.Config) error {
+			return defiService.ApplyMarketRates(next.Interest.Markets)
+		}},
+		{"oracle", func(_, next *config.Config) error {
+			oracle.SetConfig(next.Oracle)
+			return nil
+		}},
+		{"twap", func(_, next *config.Config) error {
+			twap.SetConfig(next.TWAP)
+			return nil
+		}},
+	}
+	for _, s := range subscribers {
+		if err := watcher.Subscribe(s.name, s.fn); err != nil {
+			log.Fatalf("Failed to apply config: %v", err)
+		}
+	}
+	// 配置源变更后推送给订阅者
+	if err := watcher.Start(logger); err != nil {
+		logger.Warn("Config hot reload disabled", zap.Error(err))
+	}
+	defer watcher.Stop()
+
+	opts := routes.Options{
+		Wallet:      wallet,
+		RateLimiter: limiter,
+		Features:    features,
+		Candles:     candles,
+		PriceHub:    priceHub,
+		Oracle:      oracle,
+		TWAP:        twap,
+		Alerts:      alerts,
+	}
+	// 配置了只读副本时，写请求和刚写入过的客户端读主库
+	if len(cfg.Database.Replicas.DSNs) > 0 {
+		opts.Sticky = middleware.NewPrimarySticky(cfg.Database.Replicas.StickyWindow)
+	}
+	r := routes.NewRouter(userService, defiService, riskEngine, tokens, logger, opts).SetupRouter()
+
+	port := strconv.Itoa(cfg.Server.Port)
 
 	// 启动服务器
 	log.Printf("Server starting on port %s", port)
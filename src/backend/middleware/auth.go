@@ -1,21 +1,16 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
-	"github.com/dgrijalva/jwt-go"
+	"defi-backend/auth"
+
 	"github.com/gin-gonic/gin"
 )
 
-var jwtKey = []byte("your-secret-key") // 在生产环境中应该从配置中读取
-
-type Claims struct {
-	UserID uint
-	jwt.StandardClaims
-}
-
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(tokens *auth.TokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -32,32 +27,28 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := parts[1]
-		claims := &Claims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
-
-		if err != nil {
-			if err == jwt.ErrSignatureInvalid {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token signature"})
-				c.Abort()
-				return
-			}
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token"})
+		claims, err := tokens.Validate(c.Request.Context(), parts[1])
+		if errors.Is(err, auth.ErrTokenRevoked) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
 			c.Abort()
 			return
 		}
-
-		if !token.Valid {
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		// 将用户ID添加到上下文中
+		// 旧 token 没有角色信息，按普通用户处理
+		role := claims.Role
+		if role == "" {
+			role = auth.RoleUser
+		}
+
+		// 将用户ID和角色添加到上下文中
 		c.Set("userID", claims.UserID)
+		c.Set("role", role)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
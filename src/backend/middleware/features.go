@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 配置中心 features 中使用的功能名
+const (
+	FeatureSwap    = "swap"
+	FeatureBorrow  = "borrow"
+	FeatureFarming = "farming"
+)
+
+// FeatureFlags 运行时可切换的功能开关，未配置的功能默认开启
+type FeatureFlags struct {
+	flags atomic.Value
+}
+
+func NewFeatureFlags() *FeatureFlags {
+	f := &FeatureFlags{}
+	f.flags.Store(map[string]bool{})
+	return f
+}
+
+// Set 整体替换开关，调用后不要再修改 flags
+func (f *FeatureFlags) Set(flags map[string]bool) {
+	if flags == nil {
+		flags = map[string]bool{}
+	}
+	f.flags.Store(flags)
+}
+
+// Enabled f 为 nil 时所有功能都开启
+func (f *FeatureFlags) Enabled(name string) bool {
+	if f == nil {
+		return true
+	}
+	enabled, ok := f.flags.Load().(map[string]bool)[name]
+	return !ok || enabled
+}
+
+// RequireFeature 功能关闭时返回 503
+func RequireFeature(flags *FeatureFlags, name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !flags.Enabled(name) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Feature is disabled: " + name})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+
+	"defi-backend/auth"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type Permission string
+
+const (
+	// PermTrade 以自己的账户交易、借贷和挖矿
+	PermTrade Permission = "trade"
+	// PermRiskRead 查看全局风险数据，例如可清算账户
+	PermRiskRead Permission = "risk:read"
+	// PermMarketsWrite 管理交易对、借贷市场和挖矿池
+	PermMarketsWrite Permission = "markets:write"
+	// PermUsersWrite 管理用户和角色
+	PermUsersWrite Permission = "users:write"
+	// PermAuditRead 查看审计数据，例如用户及其角色
+	PermAuditRead Permission = "audit:read"
+)
+
+// Policy 角色到权限的映射，新增接口时在这里声明哪些角色可以访问
+var Policy = map[string][]Permission{
+	auth.RoleUser:     {PermTrade},
+	auth.RoleOperator: {PermTrade, PermRiskRead, PermMarketsWrite},
+	auth.RoleAuditor:  {PermRiskRead, PermAuditRead},
+	auth.RoleAdmin:    {PermTrade, PermRiskRead, PermMarketsWrite, PermUsersWrite, PermAuditRead},
+}
+
+// HasPermission 判断角色是否拥有权限
+func HasPermission(role string, perm Permission) bool {
+	for _, p := range Policy[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission 要求当前用户的角色拥有 perm，必须放在 AuthMiddleware 之后
+func RequirePermission(logger *zap.Logger, perm Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if !HasPermission(role, perm) {
+			deny(c, logger, role, string(perm))
+			return
+		}
+		c.Next()
+	}
+}
+
+func deny(c *gin.Context, logger *zap.Logger, role, required string) {
+	logger.Warn("Access denied",
+		zap.Uint("user_id", c.GetUint("userID")),
+		zap.String("role", role),
+		zap.String("required", required),
+		zap.String("method", c.Request.Method),
+		zap.String("path", c.Request.URL.Path),
+	)
+	c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+	c.Abort()
+}
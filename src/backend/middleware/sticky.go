@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"defi-backend/replica"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrimarySticky 写请求以及同一客户端写入后 window 内的请求都读主库，
+// 避免刚写入的数据因为副本延迟而读不到。客户端按 Authorization 头区分，没有时按 IP；
+// 记录只保存在本实例中，多实例部署时 window 应大于副本的最大延迟
+type PrimarySticky struct {
+	mu        sync.Mutex
+	window    time.Duration
+	lastWrite map[string]time.Time
+}
+
+func NewPrimarySticky(window time.Duration) *PrimarySticky {
+	return &PrimarySticky{window: window, lastWrite: make(map[string]time.Time)}
+}
+
+// Middleware 为需要读主库的请求在 ctx 中设置 replica.Primary
+func (p *PrimarySticky) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := stickyKey(c)
+		write := !isReadMethod(c.Request.Method)
+		if write || p.sticky(key) {
+			c.Request = c.Request.WithContext(replica.Primary(c.Request.Context()))
+		}
+
+		c.Next()
+
+		if write && c.Writer.Status() < http.StatusBadRequest {
+			p.record(key)
+		}
+	}
+}
+
+func (p *PrimarySticky) sticky(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	last, ok := p.lastWrite[key]
+	if !ok {
+		return false
+	}
+	if time.Since(last) > p.window {
+		delete(p.lastWrite, key)
+		return false
+	}
+	return true
+}
+
+func (p *PrimarySticky) record(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if len(p.lastWrite) >= maxIdleBuckets {
+		for k, last := range p.lastWrite {
+			if now.Sub(last) > p.window {
+				delete(p.lastWrite, k)
+			}
+		}
+	}
+	p.lastWrite[key] = now
+}
+
+// stickyKey 只保存 Authorization 头的摘要，不在内存中保留令牌
+func stickyKey(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); header != "" {
+		sum := sha256.Sum256([]byte(header))
+		return hex.EncodeToString(sum[:16])
+	}
+	return c.ClientIP()
+}
+
+func isReadMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
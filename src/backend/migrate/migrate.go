@@ -0,0 +1,325 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DefaultLockTTL 超过该时间未续期的迁移锁视为持有者已退出，可以被其他实例获取
+	DefaultLockTTL = 15 * time.Minute
+
+	lockRetryInterval = time.Second
+)
+
+var (
+	ErrSchemaBehind   = errors.New("database schema is behind")
+	ErrIrreversible   = errors.New("migration cannot be reverted")
+	ErrUnknownVersion = errors.New("unknown migration version")
+)
+
+// Migration 一个版本的迁移，Down 为空表示不可回滚。
+// 每个迁移在一个事务中执行并写入 schema_migrations；MySQL 的 DDL 会隐式提交，
+// 失败时可能留下部分变更，因此一个迁移应尽量只包含一个 DDL 语句或可重复执行的语句
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration 已执行的迁移
+type SchemaMigration struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255;not null"`
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migrationLock 只有一行，保证同一时间只有一个实例执行迁移
+type migrationLock struct {
+	ID       uint   `gorm:"primaryKey;autoIncrement:false"`
+	Locked   bool   `gorm:"not null;default:false"`
+	Owner    string `gorm:"size:128"`
+	LockedAt time.Time
+}
+
+func (migrationLock) TableName() string {
+	return "schema_migrations_lock"
+}
+
+// Status 迁移的执行状态，AppliedAt 为空表示尚未执行
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	// Missing 为 true 表示数据库中记录了该版本，但当前程序中没有对应的迁移
+	Missing bool
+}
+
+// Migrator 按版本顺序执行迁移
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+	lockTTL    time.Duration
+	owner      string
+	ready      bool
+}
+
+// New 检查迁移版本没有重复，并按版本排序
+func New(db *gorm.DB, migrations []Migration) (*Migrator, error) {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migration %q has invalid version %d", m.Name, m.Version)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %d_%s has no up step", m.Version, m.Name)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+	}
+
+	host, _ := os.Hostname()
+	return &Migrator{
+		db:         db,
+		migrations: sorted,
+		lockTTL:    DefaultLockTTL,
+		owner:      host + ":" + strconv.Itoa(os.Getpid()) + ":" + strconv.FormatInt(time.Now().UnixNano(), 36),
+	}, nil
+}
+
+// Status 返回所有迁移的状态，按版本排序
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	known := make(map[int64]bool, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = true
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if record, ok := applied[mig.Version]; ok {
+			at := record.AppliedAt
+			s.AppliedAt = &at
+		}
+		statuses = append(statuses, s)
+	}
+	for version, record := range applied {
+		if !known[version] {
+			at := record.AppliedAt
+			statuses = append(statuses, Status{Version: version, Name: record.Name, AppliedAt: &at, Missing: true})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Pending 返回尚未执行的迁移
+func (m *Migrator) Pending() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+// Check 有未执行的迁移时返回 ErrSchemaBehind
+func (m *Migrator) Check() error {
+	pending, err := m.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migration(s), first is %d_%s", ErrSchemaBehind, len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
+
+// Up 执行版本不超过 target 的所有未执行迁移，target 为 0 时执行全部
+func (m *Migrator) Up(ctx context.Context, target int64) ([]Migration, error) {
+	if target != 0 && m.find(target) == nil {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, target)
+	}
+
+	var done []Migration
+	err := m.withLock(ctx, func() error {
+		pending, err := m.Pending()
+		if err != nil {
+			return err
+		}
+		for _, mig := range pending {
+			if target != 0 && mig.Version > target {
+				break
+			}
+			err := m.db.Transaction(func(tx *gorm.DB) error {
+				if err := mig.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %v", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+			if err := m.refreshLock(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down 按版本倒序回滚最近执行的 steps 个迁移
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("steps must be positive, got %d", steps)
+	}
+
+	var done []Migration
+	err := m.withLock(ctx, func() error {
+		var records []SchemaMigration
+		if err := m.db.Order("version DESC").Limit(steps).Find(&records).Error; err != nil {
+			return err
+		}
+		for _, record := range records {
+			mig := m.find(record.Version)
+			if mig == nil {
+				return fmt.Errorf("%w: %d_%s is applied but not known to this build", ErrUnknownVersion, record.Version, record.Name)
+			}
+			if mig.Down == nil {
+				return fmt.Errorf("%w: %d_%s", ErrIrreversible, mig.Version, mig.Name)
+			}
+			err := m.db.Transaction(func(tx *gorm.DB) error {
+				if err := mig.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&SchemaMigration{}, "version = ?", mig.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %v", mig.Version, mig.Name, err)
+			}
+			done = append(done, *mig)
+			if err := m.refreshLock(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) applied() (map[int64]SchemaMigration, error) {
+	if err := m.ensureTables(); err != nil {
+		return nil, err
+	}
+	var records []SchemaMigration
+	if err := m.db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]SchemaMigration, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// ensureTables 创建迁移自身使用的两张表
+func (m *Migrator) ensureTables() error {
+	if m.ready {
+		return nil
+	}
+	if err := m.db.AutoMigrate(&SchemaMigration{}, &migrationLock{}); err != nil {
+		return fmt.Errorf("failed to create migration tables: %v", err)
+	}
+	if err := m.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&migrationLock{ID: 1}).Error; err != nil {
+		return err
+	}
+	m.ready = true
+	return nil
+}
+
+// withLock 获取迁移锁后执行 fn，锁被占用时每秒重试直到 ctx 结束
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	if err := m.ensureTables(); err != nil {
+		return err
+	}
+	for {
+		now := time.Now()
+		result := m.db.Model(&migrationLock{}).
+			Where("id = ? AND (locked = ? OR locked_at < ?)", 1, false, now.Add(-m.lockTTL)).
+			Updates(map[string]interface{}{"locked": true, "owner": m.owner, "locked_at": now})
+		if result.Error != nil {
+			return fmt.Errorf("failed to acquire migration lock: %v", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for migration lock: %w", ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+	defer m.db.Model(&migrationLock{}).
+		Where("id = ? AND owner = ?", 1, m.owner).
+		Updates(map[string]interface{}{"locked": false, "owner": ""})
+
+	return fn()
+}
+
+// refreshLock 每完成一个迁移续期一次，避免长时间迁移的锁被当作过期
+func (m *Migrator) refreshLock() error {
+	result := m.db.Model(&migrationLock{}).
+		Where("id = ? AND owner = ?", 1, m.owner).
+		Update("locked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil
+	}
+
+	// MySQL 在值未变化时返回 0 行，这里再确认一次锁的持有者
+	var count int64
+	if err := m.db.Model(&migrationLock{}).Where("id = ? AND owner = ?", 1, m.owner).Count(&count).Error; err != nil {
+		return err
+	}
+	if count != 1 {
+		return errors.New("migration lock was taken over by another instance")
+	}
+	return nil
+}
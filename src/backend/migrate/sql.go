@@ -0,0 +1,190 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SQL 迁移文件名：<version>_<name>.up.sql 和 <version>_<name>.down.sql，
+// version 一般为创建时间 YYYYMMDDHHMMSS。
+// 方言不同的语句可以写在 <version>_<name>.<dialect>.up.sql 中，dialect 为 mysql、postgres 或 sqlite，
+// 执行时优先使用当前数据库方言的文件，没有时使用通用文件
+var sqlFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+?)(?:\.(mysql|postgres|sqlite))?\.(up|down)\.sql$`)
+
+// sqlScripts 一个迁移方向的脚本，键为方言，通用脚本的键为空字符串
+type sqlScripts map[string][]string
+
+// LoadSQL 读取 dir 下的 SQL 迁移，缺少 down 文件的迁移不可回滚
+func LoadSQL(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type sqlMigration struct {
+		name     string
+		up, down sqlScripts
+	}
+	byVersion := make(map[int64]*sqlMigration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		m := sqlFileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &sqlMigration{name: m[2], up: sqlScripts{}, down: sqlScripts{}}
+			byVersion[version] = mig
+		}
+		if mig.name != m[2] {
+			return nil, fmt.Errorf("migration %d has files with different names", version)
+		}
+		if m[4] == "up" {
+			mig.up[m[3]] = splitStatements(string(data))
+		} else {
+			mig.down[m[3]] = splitStatements(string(data))
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for version, mig := range byVersion {
+		if len(mig.up) == 0 {
+			return nil, fmt.Errorf("migration %d_%s has no up file", version, mig.name)
+		}
+		migration := Migration{Version: version, Name: mig.name, Up: execSQL(version, mig.name, mig.up)}
+		if len(mig.down) > 0 {
+			migration.Down = execSQL(version, mig.name, mig.down)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// execSQL 按当前数据库的方言选择脚本并逐条执行，MySQL 驱动默认不允许一次执行多条语句
+func execSQL(version int64, name string, scripts sqlScripts) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		statements, ok := scripts[tx.Dialector.Name()]
+		if !ok {
+			statements, ok = scripts[""]
+		}
+		if !ok {
+			return fmt.Errorf("migration %d_%s has no script for %s", version, name, tx.Dialector.Name())
+		}
+		for _, stmt := range statements {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// splitStatements 按行尾的分号切分语句，并去掉只有注释的行；
+// 不解析字符串字面量，语句中间的分号不能出现在行尾
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+var goTemplate = template.Must(template.New("migration").Parse(`package migrations
+
+import (
+	"defi-backend/migrate"
+
+	"gorm.io/gorm"
+)
+
+func init() {
+	register(migrate.Migration{
+		Version: {{.Version}},
+		Name:    "{{.Name}}",
+		Up: func(tx *gorm.DB) error {
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	})
+}
+`))
+
+// Create 在 dir 下创建一个新的迁移，版本号为当前 UTC 时间；
+// goMigration 为 true 时创建 Go 迁移，否则创建 sqlDir 下的 up/down SQL 文件
+func Create(dir, sqlDir, name string, goMigration bool, now time.Time) ([]string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(name, "_")
+	name = strings.Trim(name, "_")
+	if name == "" {
+		return nil, fmt.Errorf("migration name is required")
+	}
+	version := now.UTC().Format("20060102150405")
+
+	if goMigration {
+		file := filepath.Join(dir, version+"_"+name+".go")
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if err := goTemplate.Execute(f, struct{ Version, Name string }{version, name}); err != nil {
+			return nil, err
+		}
+		return []string{file}, nil
+	}
+
+	var files []string
+	for _, direction := range []string{"up", "down"} {
+		file := filepath.Join(dir, sqlDir, version+"_"+name+"."+direction+".sql")
+		content := fmt.Sprintf("-- %s %s\n", direction, name)
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return files, err
+		}
+		_, err = f.WriteString(content)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
@@ -0,0 +1,211 @@
+package migrations
+
+import (
+	"time"
+
+	"defi-backend/migrate"
+	"defi-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// baseline 是引入版本化迁移之前 AutoMigrate 创建的表结构。
+// 这里的结构体是当时模型的副本，之后修改 models 时应新增迁移，而不是修改这里；
+// 对已有数据库执行时只会补齐缺少的表和列
+func init() {
+	register(migrate.Migration{
+		Version: 20240101000000,
+		Name:    "baseline",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(baselineTables()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			tables := baselineTables()
+			for i := len(tables) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(tables[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+func baselineTables() []interface{} {
+	type User struct {
+		gorm.Model
+		Username      string  `gorm:"uniqueIndex;not null"`
+		Email         *string `gorm:"uniqueIndex"`
+		Password      string  `gorm:"not null"`
+		WalletAddress *string `gorm:"size:42;uniqueIndex"`
+		Role          string  `gorm:"size:16;not null;default:user"`
+		LastLogin     time.Time
+		IsActive      bool `gorm:"default:true"`
+	}
+
+	type UserProfile struct {
+		gorm.Model
+		UserID      uint `gorm:"uniqueIndex"`
+		FirstName   string
+		LastName    string
+		PhoneNumber string
+		Address     string
+		KYCVerified bool `gorm:"default:false"`
+	}
+
+	type WalletNonce struct {
+		gorm.Model
+		Nonce     string `gorm:"size:64;uniqueIndex;not null"`
+		ExpiresAt time.Time
+		UsedAt    *time.Time
+	}
+
+	type TradingPair struct {
+		gorm.Model
+		Symbol      string `gorm:"uniqueIndex;not null"`
+		Token0      string `gorm:"not null"`
+		Token1      string `gorm:"not null"`
+		Decimals0   uint8  `gorm:"not null;default:18"`
+		Decimals1   uint8  `gorm:"not null;default:18"`
+		Reserve0    string `gorm:"not null;default:0"`
+		Reserve1    string `gorm:"not null;default:0"`
+		TotalSupply string `gorm:"not null;default:0"`
+		IsActive    bool   `gorm:"default:true"`
+	}
+
+	type Trade struct {
+		gorm.Model
+		UserID     uint `gorm:"index"`
+		PairID     uint `gorm:"index"`
+		Type       string
+		Amount     models.Amount `gorm:"not null"`
+		Price      float64
+		TotalValue models.Amount `gorm:"not null"`
+		Status     string
+	}
+
+	type LendingMarket struct {
+		gorm.Model
+		Token                 string `gorm:"uniqueIndex;not null"`
+		Decimals              uint8  `gorm:"not null;default:18"`
+		Price                 string `gorm:"not null;default:0"`
+		CollateralFactor      string `gorm:"not null;default:750000000000000000"`
+		IsListed              bool   `gorm:"default:true"`
+		RateModel             string `gorm:"not null;default:jump"`
+		BaseRatePerYear       string `gorm:"not null;default:20000000000000000"`
+		MultiplierPerYear     string `gorm:"not null;default:200000000000000000"`
+		JumpMultiplierPerYear string `gorm:"not null;default:1000000000000000000"`
+		Kink                  string `gorm:"not null;default:800000000000000000"`
+		ReserveFactor         string `gorm:"not null;default:100000000000000000"`
+		TotalSupply           string `gorm:"not null;default:0"`
+		TotalBorrows          string `gorm:"not null;default:0"`
+		SupplyIndex           string `gorm:"not null;default:1000000000000000000"`
+		BorrowIndex           string `gorm:"not null;default:1000000000000000000"`
+		AccrualTime           time.Time
+	}
+
+	type LendingPosition struct {
+		gorm.Model
+		UserID          uint `gorm:"index"`
+		Token           string
+		Amount          models.Amount `gorm:"not null"`
+		Type            string
+		Status          string
+		StartTime       time.Time
+		InterestRate    float64
+		InterestIndex   string `gorm:"not null;default:1000000000000000000"`
+		TransactionHash string `gorm:"size:66;index"`
+	}
+
+	type Farm struct {
+		gorm.Model
+		RewardToken     string
+		RewardDecimals  uint8  `gorm:"not null;default:18"`
+		RewardPerBlock  string `gorm:"not null;default:0"`
+		StartBlock      uint64
+		TotalAllocPoint uint64
+	}
+
+	type FarmingPool struct {
+		gorm.Model
+		PoolID            uint   `gorm:"uniqueIndex;not null"`
+		LPToken           string `gorm:"not null"`
+		LPDecimals        uint8  `gorm:"not null;default:18"`
+		AllocPoint        uint64
+		LastRewardBlock   uint64
+		AccRewardPerShare string `gorm:"not null;default:0"`
+		TotalStaked       string `gorm:"not null;default:0"`
+	}
+
+	type FarmingPosition struct {
+		gorm.Model
+		UserID        uint `gorm:"uniqueIndex:idx_farming_user_pool"`
+		PoolID        uint `gorm:"uniqueIndex:idx_farming_user_pool"`
+		Token         string
+		Amount        models.Amount `gorm:"not null"`
+		RewardDebt    string        `gorm:"not null;default:0"`
+		StartTime     time.Time
+		LastClaimTime time.Time
+		Status        string
+	}
+
+	type Reward struct {
+		gorm.Model
+		UserID          uint `gorm:"index"`
+		PositionID      uint `gorm:"index"`
+		Token           string
+		Amount          models.Amount `gorm:"not null"`
+		Type            string
+		ClaimTime       time.Time
+		TransactionHash string `gorm:"size:66;index"`
+	}
+
+	type Transaction struct {
+		gorm.Model
+		UserID          uint `gorm:"index"`
+		Type            string
+		Contract        string `gorm:"size:42"`
+		Account         string `gorm:"size:42;index"`
+		TokenIn         string
+		TokenOut        string
+		AmountIn        models.Amount
+		AmountOut       models.Amount
+		Price           string
+		Status          string
+		BlockNumber     uint64 `gorm:"index"`
+		BlockHash       string `gorm:"size:66;index"`
+		TransactionHash string `gorm:"size:66;uniqueIndex:idx_transaction_log"`
+		LogIndex        uint   `gorm:"uniqueIndex:idx_transaction_log"`
+		Timestamp       time.Time
+	}
+
+	type SyncCheckpoint struct {
+		gorm.Model
+		Name        string `gorm:"size:64;uniqueIndex;not null"`
+		BlockNumber uint64
+	}
+
+	type ChainBlock struct {
+		gorm.Model
+		Number     uint64 `gorm:"uniqueIndex;not null"`
+		Hash       string `gorm:"size:66;not null"`
+		ParentHash string `gorm:"size:66"`
+	}
+
+	return []interface{}{
+		&User{},
+		&UserProfile{},
+		&WalletNonce{},
+		&TradingPair{},
+		&Trade{},
+		&LendingMarket{},
+		&LendingPosition{},
+		&Farm{},
+		&FarmingPool{},
+		&FarmingPosition{},
+		&Reward{},
+		&Transaction{},
+		&SyncCheckpoint{},
+		&ChainBlock{},
+	}
+}
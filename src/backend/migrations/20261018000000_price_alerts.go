@@ -0,0 +1,63 @@
+package migrations
+
+import (
+	"time"
+
+	"defi-backend/migrate"
+
+	"gorm.io/gorm"
+)
+
+// price_alerts 新增价格提醒和站内信两张表，结构体是当时模型的副本
+func init() {
+	register(migrate.Migration{
+		Version: 20261018000000,
+		Name:    "price_alerts",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(priceAlertTables()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			tables := priceAlertTables()
+			for i := len(tables) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(tables[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+func priceAlertTables() []interface{} {
+	type PriceAlert struct {
+		gorm.Model
+		UserID          uint   `gorm:"index;not null"`
+		Token           string `gorm:"size:64"`
+		PairID          uint
+		Condition       string  `gorm:"size:16;not null"`
+		Threshold       float64 `gorm:"not null"`
+		Window          string  `gorm:"size:8"`
+		CooldownSeconds int64   `gorm:"not null"`
+		WebhookURL      string  `gorm:"size:512"`
+		Note            string  `gorm:"size:255"`
+		Active          bool    `gorm:"index;not null"`
+		TriggerCount    int64   `gorm:"not null;default:0"`
+		LastTriggeredAt *time.Time
+	}
+
+	type Notification struct {
+		gorm.Model
+		UserID      uint   `gorm:"index;not null"`
+		AlertID     uint   `gorm:"index"`
+		Title       string `gorm:"size:255"`
+		Message     string `gorm:"size:1024"`
+		Price       float64
+		TriggeredAt time.Time
+		ReadAt      *time.Time
+	}
+
+	return []interface{}{
+		&PriceAlert{},
+		&Notification{},
+	}
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"defi-backend/migrate"
+
+	"gorm.io/gorm"
+)
+
+// reward_status 链重组时奖励记录不再删除，改为标记 status，已有记录均为 claimed
+func init() {
+	type Reward struct {
+		Status string `gorm:"size:16;not null;default:claimed"`
+	}
+
+	register(migrate.Migration{
+		Version: 20261019000000,
+		Name:    "reward_status",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&Reward{}, "Status")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&Reward{}, "Status")
+		},
+	})
+}
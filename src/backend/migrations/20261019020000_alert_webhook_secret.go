@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"defi-backend/migrate"
+
+	"gorm.io/gorm"
+)
+
+// alert_webhook_secret 每个提醒使用自己的 webhook 签名密钥；
+// 已有的提醒没有密钥，webhook 不带签名，直到用户轮换密钥
+func init() {
+	type PriceAlert struct {
+		WebhookSecret string `gorm:"size:64"`
+	}
+
+	register(migrate.Migration{
+		Version: 20261019020000,
+		Name:    "alert_webhook_secret",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&PriceAlert{}, "WebhookSecret")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&PriceAlert{}, "WebhookSecret")
+		},
+	})
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"embed"
+	"sort"
+
+	"defi-backend/migrate"
+)
+
+// SQL 迁移放在 sql 目录，Go 迁移在本包中通过 init 注册；
+// 新迁移使用 `go run . migrate create <name> [--go]` 创建
+//
+//go:embed sql
+var sqlFiles embed.FS
+
+// Dir 和 SQLDir 是 migrate create 写入新迁移的目录，相对于 src/backend
+const (
+	Dir    = "migrations"
+	SQLDir = "sql"
+)
+
+var goMigrations []migrate.Migration
+
+func register(m migrate.Migration) {
+	goMigrations = append(goMigrations, m)
+}
+
+// All 返回全部 Go 和 SQL 迁移，按版本排序
+func All() ([]migrate.Migration, error) {
+	sqlMigrations, err := migrate.LoadSQL(sqlFiles, SQLDir)
+	if err != nil {
+		return nil, err
+	}
+	all := append(append([]migrate.Migration{}, goMigrations...), sqlMigrations...)
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all, nil
+}
@@ -0,0 +1,4 @@
+ALTER TABLE users MODIFY username varchar(191) NOT NULL;
+ALTER TABLE users MODIFY email varchar(191) NULL;
+ALTER TABLE trading_pairs MODIFY symbol varchar(191) NOT NULL;
+ALTER TABLE lending_markets MODIFY token varchar(191) NOT NULL;
@@ -0,0 +1,5 @@
+-- 带唯一索引的字符串列使用与模型一致的长度
+ALTER TABLE users MODIFY username varchar(64) NOT NULL;
+ALTER TABLE users MODIFY email varchar(255) NULL;
+ALTER TABLE trading_pairs MODIFY symbol varchar(32) NOT NULL;
+ALTER TABLE lending_markets MODIFY token varchar(64) NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE users ALTER COLUMN username TYPE text;
+ALTER TABLE users ALTER COLUMN email TYPE text;
+ALTER TABLE trading_pairs ALTER COLUMN symbol TYPE text;
+ALTER TABLE lending_markets ALTER COLUMN token TYPE text;
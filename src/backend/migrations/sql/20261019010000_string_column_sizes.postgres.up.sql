@@ -0,0 +1,5 @@
+-- 带唯一索引的字符串列使用与模型一致的长度
+ALTER TABLE users ALTER COLUMN username TYPE varchar(64);
+ALTER TABLE users ALTER COLUMN email TYPE varchar(255);
+ALTER TABLE trading_pairs ALTER COLUMN symbol TYPE varchar(32);
+ALTER TABLE lending_markets ALTER COLUMN token TYPE varchar(64);
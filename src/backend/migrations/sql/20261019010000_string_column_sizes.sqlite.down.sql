@@ -0,0 +1 @@
+-- SQLite 不限制 varchar 的长度，无需修改
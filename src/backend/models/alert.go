@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 价格提醒的条件。above、below、cross 比较价格与 Threshold；
+// rise、drop 比较 Window 内的涨跌幅与 Threshold (百分比，正数)
+const (
+	AlertConditionAbove = "above"
+	AlertConditionBelow = "below"
+	AlertConditionCross = "cross"
+	AlertConditionRise  = "rise"
+	AlertConditionDrop  = "drop"
+)
+
+// PriceAlert 用户的价格提醒，对象为代币 (Token) 或交易对 (PairID)，交易对的价格为 token0 以 token1 计价。
+// 提醒在价格穿过阈值时触发，创建时已经满足条件不会立即触发；触发后 CooldownSeconds 内不再触发。
+// WebhookSecret 用于签名 webhook 请求体，只在创建和轮换时返回给用户
+type PriceAlert struct {
+	gorm.Model
+	UserID          uint       `gorm:"index;not null" json:"user_id"`
+	Token           string     `gorm:"size:64" json:"token,omitempty"`
+	PairID          uint       `json:"pair_id,omitempty"`
+	Condition       string     `gorm:"size:16;not null" json:"condition"`
+	Threshold       float64    `gorm:"not null" json:"threshold"`
+	Window          string     `gorm:"size:8" json:"window,omitempty"`
+	CooldownSeconds int64      `gorm:"not null" json:"cooldown_seconds"`
+	WebhookURL      string     `gorm:"size:512" json:"webhook_url,omitempty"`
+	WebhookSecret   string     `gorm:"size:64" json:"-"`
+	Note            string     `gorm:"size:255" json:"note,omitempty"`
+	Active          bool       `gorm:"index;not null" json:"active"`
+	TriggerCount    int64      `gorm:"not null;default:0" json:"trigger_count"`
+	LastTriggeredAt *time.Time `json:"last_triggered_at"`
+}
+
+// Notification 站内信，ReadAt 为空表示未读
+type Notification struct {
+	gorm.Model
+	UserID      uint       `gorm:"index;not null" json:"user_id"`
+	AlertID     uint       `gorm:"index" json:"alert_id"`
+	Title       string     `gorm:"size:255" json:"title"`
+	Message     string     `gorm:"size:1024" json:"message"`
+	Price       float64    `json:"price"`
+	TriggeredAt time.Time  `json:"triggered_at"`
+	ReadAt      *time.Time `json:"read_at"`
+}
@@ -0,0 +1,276 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// MaxDecimals 代币精度上限，ERC20 的 decimals 为 uint8，实际不会超过 77
+const MaxDecimals = 77
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Amount 任意精度的代币数量，内部保存最小单位整数以及代币精度
+// 在 JSON 和数据库中都序列化为恰好带 Decimals 位小数的定点字符串，例如 6 位精度的 1.5 为 "1.500000"，
+// 因此读取时可以从小数位数还原精度，不会丢失任何信息
+type Amount struct {
+	value    *big.Int
+	decimals uint8
+}
+
+// NewAmount 由最小单位整数构造数量
+func NewAmount(raw *big.Int, decimals uint8) Amount {
+	if raw == nil {
+		raw = new(big.Int)
+	}
+	return Amount{value: new(big.Int).Set(raw), decimals: decimals}
+}
+
+func ZeroAmount(decimals uint8) Amount {
+	return Amount{value: new(big.Int), decimals: decimals}
+}
+
+// ParseUnits 按代币精度解析十进制字符串，例如 ParseUnits("1.5", 6) 得到最小单位 1500000
+// 小数位数超过精度时返回错误，而不是悄悄截断
+func ParseUnits(s string, decimals uint8) (Amount, error) {
+	if decimals > MaxDecimals {
+		return Amount{}, fmt.Errorf("%w: decimals %d out of range", ErrInvalidAmount, decimals)
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Amount{}, fmt.Errorf("%w: empty string", ErrInvalidAmount)
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if !isDigits(whole) || (frac != "" && !isDigits(frac)) {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > int(decimals) {
+		return Amount{}, fmt.Errorf("%w: %q has more than %d decimal places", ErrInvalidAmount, s, decimals)
+	}
+	frac += strings.Repeat("0", int(decimals)-len(frac))
+
+	value, ok := new(big.Int).SetString(whole+frac, 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if neg {
+		value.Neg(value)
+	}
+	return Amount{value: value, decimals: decimals}, nil
+}
+
+// ParseAmount 解析定点字符串，精度取自小数位数，例如 "1.50" 的精度为 2
+// 通常再配合 WithDecimals 换算到代币的实际精度
+func ParseAmount(s string) (Amount, error) {
+	return parseFixed(s)
+}
+
+// ParseRawAmount 解析最小单位的十进制整数字符串，例如链上的 uint256
+func ParseRawAmount(s string, decimals uint8) (Amount, error) {
+	value, ok := new(big.Int).SetString(strings.TrimSpace(s), 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	return Amount{value: value, decimals: decimals}, nil
+}
+
+// Raw 返回最小单位整数的副本
+func (a Amount) Raw() *big.Int {
+	if a.value == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(a.value)
+}
+
+func (a Amount) Decimals() uint8 {
+	return a.decimals
+}
+
+// WithDecimals 换算到指定精度，降精度会丢失非零小数时返回错误
+func (a Amount) WithDecimals(decimals uint8) (Amount, error) {
+	raw := a.rescale(decimals)
+	if a.decimals > decimals {
+		back := new(big.Int).Mul(raw, pow10(a.decimals-decimals))
+		if back.Cmp(a.Raw()) != 0 {
+			return Amount{}, fmt.Errorf("%w: %s has more than %d decimal places", ErrInvalidAmount, a, decimals)
+		}
+	}
+	return Amount{value: raw, decimals: decimals}, nil
+}
+
+func (a Amount) Sign() int {
+	if a.value == nil {
+		return 0
+	}
+	return a.value.Sign()
+}
+
+func (a Amount) IsZero() bool {
+	return a.Sign() == 0
+}
+
+// Add 返回 a + b，b 会先换算到 a 的精度
+func (a Amount) Add(b Amount) Amount {
+	sum := a.Raw()
+	sum.Add(sum, b.rescale(a.decimals))
+	return Amount{value: sum, decimals: a.decimals}
+}
+
+// Sub 返回 a - b，b 会先换算到 a 的精度
+func (a Amount) Sub(b Amount) Amount {
+	diff := a.Raw()
+	diff.Sub(diff, b.rescale(a.decimals))
+	return Amount{value: diff, decimals: a.decimals}
+}
+
+func (a Amount) Cmp(b Amount) int {
+	return a.Raw().Cmp(b.rescale(a.decimals))
+}
+
+// Rat 返回以代币为单位的精确有理数
+func (a Amount) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(a.Raw(), pow10(a.decimals))
+}
+
+// Float64 仅用于展示和近似计算，不要用于记账
+func (a Amount) Float64() float64 {
+	f, _ := a.Rat().Float64()
+	return f
+}
+
+// String 返回带 Decimals 位小数的定点字符串
+func (a Amount) String() string {
+	raw := a.Raw()
+	neg := raw.Sign() < 0
+	digits := raw.Abs(raw).String()
+
+	if a.decimals > 0 {
+		if len(digits) <= int(a.decimals) {
+			digits = strings.Repeat("0", int(a.decimals)-len(digits)+1) + digits
+		}
+		point := len(digits) - int(a.decimals)
+		digits = digits[:point] + "." + digits[point:]
+	}
+	if neg {
+		return "-" + digits
+	}
+	return digits
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON 接受字符串或数字，精度取自小数位数
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var s string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	} else {
+		s = string(data)
+	}
+	parsed, err := parseFixed(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Value 实现 driver.Valuer，按定点字符串无损保存
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan 实现 sql.Scanner
+func (a *Amount) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*a = Amount{}
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case int64:
+		*a = Amount{value: big.NewInt(v)}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Amount", src)
+	}
+	parsed, err := parseFixed(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// GormDataType 使用足够容纳 uint256 和小数点的字符串列
+func (Amount) GormDataType() string {
+	return "varchar(96)"
+}
+
+// parseFixed 解析定点字符串，小数位数即为精度
+func parseFixed(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	decimals := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		decimals = len(s) - i - 1
+	}
+	if decimals > MaxDecimals {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	unscaled := strings.Replace(s, ".", "", 1)
+	value, ok := new(big.Int).SetString(unscaled, 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	return Amount{value: value, decimals: uint8(decimals)}, nil
+}
+
+// rescale 把数量换算到目标精度，降精度时向零截断
+func (a Amount) rescale(decimals uint8) *big.Int {
+	raw := a.Raw()
+	switch {
+	case a.decimals == decimals:
+		return raw
+	case a.decimals < decimals:
+		return raw.Mul(raw, pow10(decimals-a.decimals))
+	default:
+		return raw.Quo(raw, pow10(a.decimals-decimals))
+	}
+}
+
+func pow10(n uint8) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
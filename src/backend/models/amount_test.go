@@ -0,0 +1,121 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestParseUnits(t *testing.T) {
+	cases := []struct {
+		in       string
+		decimals uint8
+		raw      string
+	}{
+		{"1.5", 6, "1500000"},
+		{"0.000001", 6, "1"},
+		{".5", 2, "50"},
+		{"1.50000000", 2, "150"},
+		{"-2", 3, "-2000"},
+		// 超过 uint64 的 uint256 数量
+		{"115792089237316195423570985008687907853269984665640564039457.584007913129639935", 18,
+			"115792089237316195423570985008687907853269984665640564039457584007913129639935"},
+	}
+	for _, c := range cases {
+		amount, err := ParseUnits(c.in, c.decimals)
+		if err != nil {
+			t.Fatalf("ParseUnits(%q, %d): %v", c.in, c.decimals, err)
+		}
+		if amount.Raw().String() != c.raw || amount.Decimals() != c.decimals {
+			t.Errorf("ParseUnits(%q, %d) = %s/%d, want %s", c.in, c.decimals, amount.Raw(), amount.Decimals(), c.raw)
+		}
+	}
+
+	for _, in := range []string{"", "abc", "1.2.3", "1e18", "0.0000001"} {
+		if _, err := ParseUnits(in, 6); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("ParseUnits(%q) err = %v, want ErrInvalidAmount", in, err)
+		}
+	}
+}
+
+func TestAmountWithDecimals(t *testing.T) {
+	amount, err := ParseUnits("1.25", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	six, err := amount.WithDecimals(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if six.String() != "1.250000" || six.Cmp(amount) != 0 {
+		t.Fatalf("WithDecimals(6) = %s", six)
+	}
+
+	// 降精度丢失非零小数时报错而不是截断
+	if _, err := amount.WithDecimals(1); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("WithDecimals(1) err = %v, want ErrInvalidAmount", err)
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	a := NewAmount(big.NewInt(1_500_000), 6)
+	b, _ := ParseUnits("0.25", 18)
+
+	if got := a.Add(b).String(); got != "1.750000" {
+		t.Errorf("Add = %s, want 1.750000", got)
+	}
+	if got := a.Sub(b).Sub(a).String(); got != "-0.250000" {
+		t.Errorf("Sub = %s, want -0.250000", got)
+	}
+	if a.Cmp(b) <= 0 || b.Cmp(a) >= 0 {
+		t.Error("Cmp does not rescale across decimals")
+	}
+	if !ZeroAmount(18).IsZero() || (Amount{}).Sign() != 0 {
+		t.Error("zero amounts are not zero")
+	}
+	if got := NewAmount(big.NewInt(5), 3).String(); got != "0.005" {
+		t.Errorf("String = %s, want 0.005", got)
+	}
+}
+
+func TestAmountJSONRoundTrip(t *testing.T) {
+	amount, _ := ParseUnits("123456789012345678901234567890.000000000000000001", 18)
+	data, err := json.Marshal(amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"123456789012345678901234567890.000000000000000001"` {
+		t.Fatalf("Marshal = %s", data)
+	}
+
+	var decoded Amount
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Cmp(amount) != 0 || decoded.Decimals() != 18 {
+		t.Fatalf("round trip = %s/%d", decoded, decoded.Decimals())
+	}
+
+	// 请求中的数字和字符串都接受，精度取自小数位数
+	if err := json.Unmarshal([]byte(`1.5`), &decoded); err != nil || decoded.Decimals() != 1 || decoded.Raw().Int64() != 15 {
+		t.Fatalf("Unmarshal number = %s/%d, %v", decoded, decoded.Decimals(), err)
+	}
+	if err := json.Unmarshal([]byte(`"not a number"`), &decoded); err == nil {
+		t.Fatal("Unmarshal accepted an invalid amount")
+	}
+}
+
+func TestAmountScan(t *testing.T) {
+	var amount Amount
+	if err := amount.Scan([]byte("42.000001")); err != nil {
+		t.Fatal(err)
+	}
+	if amount.Decimals() != 6 || amount.Raw().Int64() != 42_000_001 {
+		t.Fatalf("Scan = %s/%d", amount, amount.Decimals())
+	}
+	value, err := amount.Value()
+	if err != nil || value != "42.000001" {
+		t.Fatalf("Value = %v, %v", value, err)
+	}
+}
@@ -1 +1,134 @@
- 
\ No newline at end of file
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TradingPair 对应 Dex.sol 中的 pools[Token0][Token1]
+// 注意合约中的池子是有方向的：swap(tokenIn, tokenOut) 读取 pools[tokenIn][tokenOut]，
+// 并把 token0Reserve 当作 reserveIn，所以一行记录只支持 Token0 -> Token1 方向的兑换
+type TradingPair struct {
+	gorm.Model
+	Symbol      string `gorm:"size:32;uniqueIndex;not null" json:"symbol"`
+	Token0      string `gorm:"not null" json:"token0"`
+	Token1      string `gorm:"not null" json:"token1"`
+	Decimals0   uint8  `gorm:"not null;default:18" json:"decimals0"`
+	Decimals1   uint8  `gorm:"not null;default:18" json:"decimals1"`
+	Reserve0    string `gorm:"not null;default:0" json:"reserve0"`
+	Reserve1    string `gorm:"not null;default:0" json:"reserve1"`
+	TotalSupply string `gorm:"not null;default:0" json:"total_supply"`
+	IsActive    bool   `gorm:"default:true" json:"is_active"`
+}
+
+// Trade 的 Amount 以卖出代币计价，TotalValue 以买入代币计价，Price 仅用于展示
+type Trade struct {
+	gorm.Model
+	UserID     uint    `gorm:"index" json:"user_id"`
+	PairID     uint    `gorm:"index" json:"pair_id"`
+	Type       string  `json:"type"`
+	Amount     Amount  `gorm:"not null" json:"amount"`
+	Price      float64 `json:"price"`
+	TotalValue Amount  `gorm:"not null" json:"total_value"`
+	Status     string  `json:"status"`
+}
+
+// LendingMarket 对应 Lending.sol 的 markets[token] 与 prices[token]
+// 价格、抵押率、利率参数和指数都按 1e18 (BASE) 放大，保存为十进制整数字符串
+type LendingMarket struct {
+	gorm.Model
+	Token            string `gorm:"size:64;uniqueIndex;not null" json:"token"`
+	Decimals         uint8  `gorm:"not null;default:18" json:"decimals"`
+	Price            string `gorm:"not null;default:0" json:"price"`
+	CollateralFactor string `gorm:"not null;default:750000000000000000" json:"collateral_factor"`
+	IsListed         bool   `gorm:"default:true" json:"is_listed"`
+
+	// 利率模型：linear 或 jump，利率均为年化
+	RateModel             string `gorm:"not null;default:jump" json:"rate_model"`
+	BaseRatePerYear       string `gorm:"not null;default:20000000000000000" json:"base_rate_per_year"`
+	MultiplierPerYear     string `gorm:"not null;default:200000000000000000" json:"multiplier_per_year"`
+	JumpMultiplierPerYear string `gorm:"not null;default:1000000000000000000" json:"jump_multiplier_per_year"`
+	Kink                  string `gorm:"not null;default:800000000000000000" json:"kink"`
+	ReserveFactor         string `gorm:"not null;default:100000000000000000" json:"reserve_factor"`
+
+	// 计息状态
+	TotalSupply  string    `gorm:"not null;default:0" json:"total_supply"`
+	TotalBorrows string    `gorm:"not null;default:0" json:"total_borrows"`
+	SupplyIndex  string    `gorm:"not null;default:1000000000000000000" json:"supply_index"`
+	BorrowIndex  string    `gorm:"not null;default:1000000000000000000" json:"borrow_index"`
+	AccrualTime  time.Time `json:"accrual_time"`
+}
+
+const (
+	PositionTypeSupply = "supply"
+	PositionTypeBorrow = "borrow"
+)
+
+type LendingPosition struct {
+	gorm.Model
+	UserID       uint      `gorm:"index" json:"user_id"`
+	Token        string    `json:"token"`
+	Amount       Amount    `gorm:"not null" json:"amount"`
+	Type         string    `json:"type"`
+	Status       string    `json:"status"`
+	StartTime    time.Time `json:"start_time"`
+	InterestRate float64   `json:"interest_rate"`
+	// 开仓时市场的 supply/borrow 指数，当前余额 = Amount * 当前指数 / InterestIndex
+	InterestIndex string `gorm:"not null;default:1000000000000000000" json:"interest_index"`
+	// 对应的链上交易，链重组丢弃该交易时仓位会被撤销
+	TransactionHash string `gorm:"size:66;index" json:"transaction_hash,omitempty"`
+
+	Balance         Amount `gorm:"-" json:"balance"`
+	AccruedInterest Amount `gorm:"-" json:"accrued_interest"`
+}
+
+// Farm 对应 Farming.sol 的全局参数，只有一行记录
+type Farm struct {
+	gorm.Model
+	RewardToken     string `json:"reward_token"`
+	RewardDecimals  uint8  `gorm:"not null;default:18" json:"reward_decimals"`
+	RewardPerBlock  string `gorm:"not null;default:0" json:"reward_per_block"`
+	StartBlock      uint64 `json:"start_block"`
+	TotalAllocPoint uint64 `json:"total_alloc_point"`
+}
+
+// FarmingPool 对应 Farming.sol 的 pools[pid]，AccRewardPerShare 按 1e12 放大
+type FarmingPool struct {
+	gorm.Model
+	PoolID            uint   `gorm:"uniqueIndex;not null" json:"pool_id"`
+	LPToken           string `gorm:"not null" json:"lp_token"`
+	LPDecimals        uint8  `gorm:"not null;default:18" json:"lp_decimals"`
+	AllocPoint        uint64 `json:"alloc_point"`
+	LastRewardBlock   uint64 `json:"last_reward_block"`
+	AccRewardPerShare string `gorm:"not null;default:0" json:"acc_reward_per_share"`
+	TotalStaked       string `gorm:"not null;default:0" json:"total_staked"`
+}
+
+// FarmingPosition 对应 Farming.sol 的 userInfo[pid][user]
+type FarmingPosition struct {
+	gorm.Model
+	UserID        uint      `gorm:"uniqueIndex:idx_farming_user_pool" json:"user_id"`
+	PoolID        uint      `gorm:"uniqueIndex:idx_farming_user_pool" json:"pool_id"`
+	Token         string    `json:"token"`
+	Amount        Amount    `gorm:"not null" json:"amount"`
+	RewardDebt    string    `gorm:"not null;default:0" json:"reward_debt"`
+	StartTime     time.Time `json:"start_time"`
+	LastClaimTime time.Time `json:"last_claim_time"`
+	Status        string    `json:"status"`
+
+	PendingReward Amount `gorm:"-" json:"pending_reward"`
+}
+
+type Reward struct {
+	gorm.Model
+	UserID     uint      `gorm:"index" json:"user_id"`
+	PositionID uint      `gorm:"index" json:"position_id"`
+	Token      string    `json:"token"`
+	Amount     Amount    `gorm:"not null" json:"amount"`
+	Type       string    `json:"type"`
+	ClaimTime  time.Time `json:"claim_time"`
+	// 对应的链上交易，链重组丢弃该交易时 Status 变为 orphaned，交易重新上链后恢复为 claimed
+	TransactionHash string `gorm:"size:66;index" json:"transaction_hash,omitempty"`
+	Status          string `gorm:"size:16;not null;default:claimed" json:"status"`
+}
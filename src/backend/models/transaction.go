@@ -14,63 +14,53 @@ const (
 	TransactionTypeWithdraw TransactionType = "withdraw"
 	TransactionTypeBorrow   TransactionType = "borrow"
 	TransactionTypeRepay    TransactionType = "repay"
+
+	// Dex 流动性与 Farming 质押事件
+	TransactionTypeAddLiquidity      TransactionType = "add_liquidity"
+	TransactionTypeRemoveLiquidity   TransactionType = "remove_liquidity"
+	TransactionTypeStake             TransactionType = "stake"
+	TransactionTypeUnstake           TransactionType = "unstake"
+	TransactionTypeEmergencyWithdraw TransactionType = "emergency_withdraw"
+)
+
+const (
+	TransactionStatusPending   = "pending"
+	TransactionStatusConfirmed = "confirmed"
+	TransactionStatusFinalized = "finalized"
+	TransactionStatusOrphaned  = "orphaned"
 )
 
+// Transaction 链上事件记录，由索引器写入；同一笔交易的多条日志以 LogIndex 区分
 type Transaction struct {
 	gorm.Model
-	UserID          uint
+	UserID          uint `gorm:"index"`
 	Type            TransactionType
+	Contract        string `gorm:"size:42"`
+	Account         string `gorm:"size:42;index"`
 	TokenIn         string
 	TokenOut        string
-	AmountIn        string
-	AmountOut       string
+	AmountIn        Amount
+	AmountOut       Amount
 	Price           string
 	Status          string
-	BlockNumber     uint64
-	TransactionHash string
+	BlockNumber     uint64 `gorm:"index"`
+	BlockHash       string `gorm:"size:66;index"`
+	TransactionHash string `gorm:"size:66;uniqueIndex:idx_transaction_log"`
+	LogIndex        uint   `gorm:"uniqueIndex:idx_transaction_log"`
 	Timestamp       time.Time
 }
 
-type TransactionService struct {
-	db *gorm.DB
-}
-
-func NewTransactionService(db *gorm.DB) *TransactionService {
-	return &TransactionService{db: db}
-}
-
-func (s *TransactionService) CreateTransaction(tx *Transaction) error {
-	return s.db.Create(tx).Error
-}
-
-func (s *TransactionService) GetUserTransactions(userID uint, limit int) ([]Transaction, error) {
-	var transactions []Transaction
-	err := s.db.Where("user_id = ?", userID).
-		Order("created_at desc").
-		Limit(limit).
-		Find(&transactions).Error
-	return transactions, err
-}
-
-func (s *TransactionService) GetTransactionByHash(hash string) (*Transaction, error) {
-	var transaction Transaction
-	err := s.db.Where("transaction_hash = ?", hash).First(&transaction).Error
-	if err != nil {
-		return nil, err
-	}
-	return &transaction, nil
-}
-
-func (s *TransactionService) UpdateTransactionStatus(hash string, status string) error {
-	return s.db.Model(&Transaction{}).
-		Where("transaction_hash = ?", hash).
-		Update("status", status).Error
+// SyncCheckpoint 索引器已处理到的区块高度，重启后从 BlockNumber+1 继续
+type SyncCheckpoint struct {
+	gorm.Model
+	Name        string `gorm:"size:64;uniqueIndex;not null"`
+	BlockNumber uint64
 }
 
-func (s *TransactionService) GetRecentTransactions(limit int) ([]Transaction, error) {
-	var transactions []Transaction
-	err := s.db.Order("created_at desc").
-		Limit(limit).
-		Find(&transactions).Error
-	return transactions, err
+// ChainBlock 索引器见过的未最终确认区块，用于发现链重组
+type ChainBlock struct {
+	gorm.Model
+	Number     uint64 `gorm:"uniqueIndex;not null"`
+	Hash       string `gorm:"size:66;not null"`
+	ParentHash string `gorm:"size:66"`
 }
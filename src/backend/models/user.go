@@ -8,14 +8,23 @@ import (
 
 type User struct {
 	gorm.Model
-	Username      string    `gorm:"uniqueIndex;not null" json:"username"`
-	Email         string    `gorm:"uniqueIndex;not null" json:"email"`
+	Username      string    `gorm:"size:64;uniqueIndex;not null" json:"username"`
+	Email         *string   `gorm:"size:255;uniqueIndex" json:"email"`
 	Password      string    `gorm:"not null" json:"-"`
-	WalletAddress string    `gorm:"uniqueIndex" json:"wallet_address"`
+	WalletAddress *string   `gorm:"size:42;uniqueIndex" json:"wallet_address"`
+	Role          string    `gorm:"size:16;not null;default:user" json:"role"`
 	LastLogin     time.Time `json:"last_login"`
 	IsActive      bool      `gorm:"default:true" json:"is_active"`
 }
 
+// WalletNonce Sign-In with Ethereum 的一次性 nonce
+type WalletNonce struct {
+	gorm.Model
+	Nonce     string `gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
 type UserProfile struct {
 	gorm.Model
 	UserID      uint   `gorm:"uniqueIndex" json:"user_id"`
@@ -0,0 +1,84 @@
+package replica
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// replicationLag 查询副本的复制延迟，不支持复制的 SQLite 只检查连接
+func replicationLag(ctx context.Context, dialect string, db *sql.DB) (time.Duration, error) {
+	switch dialect {
+	case "mysql":
+		return mysqlLag(ctx, db)
+	case "postgres":
+		return postgresLag(ctx, db)
+	default:
+		return 0, db.PingContext(ctx)
+	}
+}
+
+// mysqlLag 读取 SHOW REPLICA STATUS 的 Seconds_Behind_Source，8.0.22 之前的版本使用 SHOW SLAVE STATUS；
+// 值为 NULL 表示复制线程没有运行
+func mysqlLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		rows, err = db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("server is not a replica")
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" && column != "Seconds_Behind_Master" {
+			continue
+		}
+		if values[i] == nil {
+			return 0, errors.New("replication is not running")
+		}
+		seconds, err := strconv.ParseInt(string(values[i]), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid replication lag %q", values[i])
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, errors.New("replication lag is not reported")
+}
+
+// postgresLag 以最后一个回放事务的时间计算延迟；已回放完收到的全部 WAL 时视为没有延迟，
+// 否则空闲的主库会让延迟不断增长
+const postgresLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() THEN 0
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`
+
+func postgresLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var seconds float64
+	if err := db.QueryRowContext(ctx, postgresLagQuery).Scan(&seconds); err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
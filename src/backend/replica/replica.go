@@ -0,0 +1,259 @@
+// Package replica 把标记为只读的查询路由到只读副本。
+// 默认所有查询都在主库执行；列表和历史查询通过 ReadOnly 标记 ctx 后才会使用副本，
+// 写请求和刚写入过的客户端通过 Primary 强制读主库。
+// 副本定期检查复制延迟，延迟超过 MaxLag 或无法连接时不再使用，全部不可用时退回主库
+package replica
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	DefaultMaxLag        = 5 * time.Second
+	DefaultCheckInterval = 5 * time.Second
+)
+
+type ctxKey int
+
+const (
+	readOnlyKey ctxKey = iota
+	primaryKey
+)
+
+// ReadOnly 标记 ctx 中的查询可以在副本上执行，可以接受副本上稍旧的数据
+func ReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey, true)
+}
+
+// Primary 标记 ctx 中的查询必须在主库执行，优先于 ReadOnly
+func Primary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey, true)
+}
+
+// Reader 返回可以在副本上查询的 db，没有配置副本时等同于 db.WithContext(ctx)
+func Reader(db *gorm.DB, ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return db.WithContext(ReadOnly(ctx))
+}
+
+func useReplica(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	readOnly, _ := ctx.Value(readOnlyKey).(bool)
+	primary, _ := ctx.Value(primaryKey).(bool)
+	return readOnly && !primary
+}
+
+// Options 副本健康检查参数，为 0 时使用默认值
+type Options struct {
+	MaxLag        time.Duration
+	CheckInterval time.Duration
+}
+
+// Status 副本最近一次健康检查的结果
+type Status struct {
+	Name      string
+	Healthy   bool
+	Lag       time.Duration
+	Err       error
+	CheckedAt time.Time
+}
+
+type node struct {
+	name      string
+	dialector gorm.Dialector
+	db        *sql.DB
+
+	mu     sync.Mutex
+	status Status
+}
+
+// Router 实现 gorm.Plugin，通过 db.Use 安装到主库
+type Router struct {
+	opts    Options
+	nodes   []*node
+	primary gorm.ConnPool
+	logger  logger.Interface
+	next    uint32
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// New 为每个 dialector 创建一个副本，日志中按配置顺序称为 #1、#2……，不打印 DSN
+func New(dialectors []gorm.Dialector, opts Options) *Router {
+	if opts.MaxLag <= 0 {
+		opts.MaxLag = DefaultMaxLag
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = DefaultCheckInterval
+	}
+	r := &Router{opts: opts, stop: make(chan struct{}), done: make(chan struct{})}
+	for i, d := range dialectors {
+		r.nodes = append(r.nodes, &node{name: fmt.Sprintf("#%d", i+1), dialector: d})
+	}
+	return r
+}
+
+func (r *Router) Name() string {
+	return "replica"
+}
+
+// Initialize 注册查询回调并检查所有副本，随后在后台定期检查复制延迟；
+// 启动时连接不上的副本不影响服务，在之后的检查中重新连接
+func (r *Router) Initialize(db *gorm.DB) error {
+	r.primary = db.ConnPool
+	r.logger = db.Logger
+
+	if err := db.Callback().Query().Before("gorm:query").Register("replica:query", r.route); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("replica:row", r.route); err != nil {
+		return err
+	}
+
+	r.checkAll()
+	r.started = true
+	go r.run()
+	return nil
+}
+
+// route 只改写主库上的非事务查询，事务中的 ConnPool 是 *sql.Tx，始终留在主库
+func (r *Router) route(db *gorm.DB) {
+	if db.Statement.ConnPool != r.primary || !useReplica(db.Statement.Context) {
+		return
+	}
+	if pool := r.pick(); pool != nil {
+		db.Statement.ConnPool = pool
+	}
+}
+
+// pick 轮询选择一个健康的副本，都不可用时返回 nil
+func (r *Router) pick() gorm.ConnPool {
+	count := len(r.nodes)
+	start := int(atomic.AddUint32(&r.next, 1))
+	for i := 0; i < count; i++ {
+		if db := r.nodes[(start+i)%count].available(); db != nil {
+			return db
+		}
+	}
+	return nil
+}
+
+func (r *Router) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.opts.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.checkAll()
+		}
+	}
+}
+
+func (r *Router) checkAll() {
+	for _, n := range r.nodes {
+		var lag time.Duration
+		err := n.connect(r.logger)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), r.opts.CheckInterval)
+			lag, err = replicationLag(ctx, n.dialector.Name(), n.db)
+			cancel()
+		}
+		if err == nil && lag > r.opts.MaxLag {
+			err = fmt.Errorf("replication lag %s exceeds %s", lag, r.opts.MaxLag)
+		}
+		n.update(Status{Name: n.name, Healthy: err == nil, Lag: lag, Err: err, CheckedAt: time.Now()})
+	}
+}
+
+// Status 返回所有副本的健康状态
+func (r *Router) Status() []Status {
+	statuses := make([]Status, 0, len(r.nodes))
+	for _, n := range r.nodes {
+		n.mu.Lock()
+		statuses = append(statuses, n.status)
+		n.mu.Unlock()
+	}
+	return statuses
+}
+
+// Close 停止健康检查并关闭副本连接
+func (r *Router) Close() error {
+	if r.started {
+		close(r.stop)
+		<-r.done
+		r.started = false
+	}
+	for _, n := range r.nodes {
+		if n.db != nil {
+			n.db.Close()
+		}
+	}
+	return nil
+}
+
+// connect 在第一次检查或之前连接失败时连接副本，只在健康检查的 goroutine 中调用
+func (n *node) connect(l logger.Interface) error {
+	if n.db != nil {
+		return nil
+	}
+	replicaDB, err := gorm.Open(n.dialector, &gorm.Config{Logger: l})
+	if err != nil {
+		return err
+	}
+	sqlDB, err := replicaDB.DB()
+	if err != nil {
+		return err
+	}
+	if n.dialector.Name() == "sqlite" {
+		sqlDB.SetMaxOpenConns(1)
+	} else {
+		sqlDB.SetMaxIdleConns(10)
+		sqlDB.SetMaxOpenConns(100)
+		sqlDB.SetConnMaxLifetime(time.Hour)
+	}
+	n.mu.Lock()
+	n.db = sqlDB
+	n.mu.Unlock()
+	return nil
+}
+
+// available 副本健康时返回它的连接池
+func (n *node) available() *sql.DB {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.status.Healthy {
+		return nil
+	}
+	return n.db
+}
+
+// update 保存检查结果，健康状态变化时记录日志
+func (n *node) update(status Status) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if status.Healthy != n.status.Healthy || n.status.CheckedAt.IsZero() {
+		if status.Healthy {
+			log.Printf("Database replica %s is healthy (lag %s)", n.name, status.Lag)
+		} else {
+			log.Printf("Database replica %s is unavailable, reads fall back to the primary: %v", n.name, status.Err)
+		}
+	}
+	n.status = status
+}
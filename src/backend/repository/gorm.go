@@ -0,0 +1,603 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"defi-backend/models"
+	"defi-backend/replica"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// newestFirst 按创建时间倒序，时间相同时按 id 倒序。MySQL 的 datetime(3) 只保存到毫秒，
+// 同一批写入的记录经常时间相同，不加 id 时各数据库返回的顺序不一致；
+// 使用 clause 而不是 "created_at desc" 字符串，列名由各方言自己加引号
+var newestFirst = clause.OrderBy{Columns: []clause.OrderByColumn{
+	{Column: clause.Column{Name: "created_at"}, Desc: true},
+	{Column: clause.Column{Name: "id"}, Desc: true},
+}}
+
+// byTimestamp 按链上时间升序，时间相同时按 id 升序
+var byTimestamp = clause.OrderBy{Columns: []clause.OrderByColumn{
+	{Column: clause.Column{Name: "timestamp"}},
+	{Column: clause.Column{Name: "id"}},
+}}
+
+var byID = clause.OrderBy{Columns: []clause.OrderByColumn{{Column: clause.Column{Name: "id"}}}}
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore 返回基于 db 的 Store，db 可以是事务中的 *gorm.DB
+func NewGormStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Users() UserRepository                 { return gormUsers{s.db} }
+func (s *gormStore) Nonces() NonceRepository               { return gormNonces{s.db} }
+func (s *gormStore) Profiles() ProfileRepository           { return gormProfiles{s.db} }
+func (s *gormStore) Pairs() PairRepository                 { return gormPairs{s.db} }
+func (s *gormStore) Trades() TradeRepository               { return gormTrades{s.db} }
+func (s *gormStore) Markets() MarketRepository             { return gormMarkets{s.db} }
+func (s *gormStore) Positions() PositionRepository         { return gormPositions{s.db} }
+func (s *gormStore) Farms() FarmRepository                 { return gormFarms{s.db} }
+func (s *gormStore) Rewards() RewardRepository             { return gormRewards{s.db} }
+func (s *gormStore) Transactions() TransactionRepository   { return gormTransactions{s.db} }
+func (s *gormStore) Chain() ChainRepository                { return gormChain{s.db} }
+func (s *gormStore) Alerts() AlertRepository               { return gormAlerts{s.db} }
+func (s *gormStore) Notifications() NotificationRepository { return gormNotifications{s.db} }
+
+// Transaction 在已有事务中调用时使用 SAVEPOINT 嵌套
+func (s *gormStore) Transaction(fn func(Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&gormStore{db: tx})
+	})
+}
+
+// first 按主键顺序查询第一条记录，没有时返回 ErrNotFound
+func first[T any](db *gorm.DB, query interface{}, args ...interface{}) (*T, error) {
+	var row T
+	if err := db.Where(query, args...).First(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+func find[T any](db *gorm.DB, query interface{}, args ...interface{}) ([]T, error) {
+	var rows []T
+	if err := db.Where(query, args...).Clauses(byID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// updateColumn 按 ID 更新一列，记录不存在时返回 ErrNotFound
+func updateColumn(db *gorm.DB, model interface{}, id uint, column string, value interface{}) error {
+	result := db.Model(model).Where("id = ?", id).Update(column, value)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	// MySQL 的 RowsAffected 只统计值真正改变的行，需要再确认记录是否存在
+	var count int64
+	if err := db.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormUsers struct{ db *gorm.DB }
+
+func (r gormUsers) Create(user *models.User) error {
+	return r.db.Create(user).Error
+}
+
+func (r gormUsers) Save(user *models.User) error {
+	return r.db.Save(user).Error
+}
+
+func (r gormUsers) List(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	if err := replica.Reader(r.db, ctx).Clauses(byID).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r gormUsers) FindByID(id uint) (*models.User, error) {
+	return first[models.User](r.db, "id = ?", id)
+}
+
+func (r gormUsers) FindByUsername(username string) (*models.User, error) {
+	return first[models.User](r.db, "username = ?", username)
+}
+
+func (r gormUsers) FindByEmail(email string) (*models.User, error) {
+	return first[models.User](r.db, "email = ?", email)
+}
+
+func (r gormUsers) FindByWallet(address string) (*models.User, error) {
+	return first[models.User](r.db, "LOWER(wallet_address) = LOWER(?)", address)
+}
+
+func (r gormUsers) UpdateWalletAddress(id uint, address string) error {
+	return updateColumn(r.db, &models.User{}, id, "wallet_address", address)
+}
+
+func (r gormUsers) UpdateRole(id uint, role string) error {
+	return updateColumn(r.db, &models.User{}, id, "role", role)
+}
+
+type gormNonces struct{ db *gorm.DB }
+
+func (r gormNonces) Create(nonce *models.WalletNonce) error {
+	return r.db.Create(nonce).Error
+}
+
+// Use 用条件更新消耗 nonce，并发使用同一个 nonce 时只有一个能成功
+func (r gormNonces) Use(nonce string, now time.Time) error {
+	result := r.db.Model(&models.WalletNonce{}).
+		Where("nonce = ? AND used_at IS NULL AND expires_at > ?", nonce, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormProfiles struct{ db *gorm.DB }
+
+func (r gormProfiles) FindByUserID(userID uint) (*models.UserProfile, error) {
+	return first[models.UserProfile](r.db, "user_id = ?", userID)
+}
+
+func (r gormProfiles) Save(profile *models.UserProfile) error {
+	existing, err := r.FindByUserID(profile.UserID)
+	switch {
+	case err == nil:
+		profile.ID = existing.ID
+		profile.CreatedAt = existing.CreatedAt
+	case !errors.Is(err, ErrNotFound):
+		return err
+	default:
+		profile.ID = 0
+	}
+	return r.db.Save(profile).Error
+}
+
+type gormPairs struct{ db *gorm.DB }
+
+func (r gormPairs) Create(pair *models.TradingPair) error {
+	return r.db.Create(pair).Error
+}
+
+func (r gormPairs) FindByID(id uint) (*models.TradingPair, error) {
+	return first[models.TradingPair](r.db, "id = ?", id)
+}
+
+func (r gormPairs) FindBySymbol(symbol string) (*models.TradingPair, error) {
+	return first[models.TradingPair](r.db, "symbol = ?", symbol)
+}
+
+func (r gormPairs) List(ctx context.Context) ([]models.TradingPair, error) {
+	var pairs []models.TradingPair
+	if err := replica.Reader(r.db, ctx).Clauses(byID).Find(&pairs).Error; err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+type gormTrades struct{ db *gorm.DB }
+
+func (r gormTrades) Create(trade *models.Trade) error {
+	return r.db.Create(trade).Error
+}
+
+func (r gormTrades) ListByUser(ctx context.Context, userID uint, limit int) ([]models.Trade, error) {
+	var trades []models.Trade
+	err := replica.Reader(r.db, ctx).Where("user_id = ?", userID).
+		Clauses(newestFirst).
+		Limit(limit).
+		Find(&trades).Error
+	return trades, err
+}
+
+type gormMarkets struct{ db *gorm.DB }
+
+func (r gormMarkets) Create(market *models.LendingMarket) error {
+	return r.db.Create(market).Error
+}
+
+func (r gormMarkets) Save(market *models.LendingMarket) error {
+	return r.db.Save(market).Error
+}
+
+func (r gormMarkets) FindListed(token string) (*models.LendingMarket, error) {
+	return first[models.LendingMarket](r.db, "token = ? AND is_listed = ?", token, true)
+}
+
+// LockListed SQLite 会忽略 FOR UPDATE，见 gormPositions.LockActive
+func (r gormMarkets) LockListed(token string) (*models.LendingMarket, error) {
+	db := r.db.Clauses(clause.Locking{Strength: "UPDATE"})
+	return first[models.LendingMarket](db, "token = ? AND is_listed = ?", token, true)
+}
+
+func (r gormMarkets) ListListed(ctx context.Context) ([]models.LendingMarket, error) {
+	return find[models.LendingMarket](replica.Reader(r.db, ctx), "is_listed = ?", true)
+}
+
+type gormPositions struct{ db *gorm.DB }
+
+func (r gormPositions) Create(position *models.LendingPosition) error {
+	return r.db.Create(position).Error
+}
+
+func (r gormPositions) Save(position *models.LendingPosition) error {
+	return r.db.Save(position).Error
+}
+
+func (r gormPositions) ListByUser(ctx context.Context, userID uint) ([]models.LendingPosition, error) {
+	return find[models.LendingPosition](replica.Reader(r.db, ctx), "user_id = ?", userID)
+}
+
+func (r gormPositions) ListActive(ctx context.Context, userID uint) ([]models.LendingPosition, error) {
+	return find[models.LendingPosition](replica.Reader(r.db, ctx), "user_id = ? AND status = ?", userID, "active")
+}
+
+func (r gormPositions) ListAllActive(ctx context.Context) ([]models.LendingPosition, error) {
+	return find[models.LendingPosition](replica.Reader(r.db, ctx), "status = ?", "active")
+}
+
+// LockActive SQLite 不支持 FOR UPDATE，驱动会忽略该子句，写事务本身已经串行执行
+func (r gormPositions) LockActive(userID uint) ([]models.LendingPosition, error) {
+	db := r.db.Clauses(clause.Locking{Strength: "UPDATE"})
+	return find[models.LendingPosition](db, "user_id = ? AND status = ?", userID, "active")
+}
+
+func (r gormPositions) ListByTransactions(hashes []string) ([]models.LendingPosition, error) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+	return find[models.LendingPosition](r.db, "transaction_hash IN ?", hashes)
+}
+
+func (r gormPositions) ListUnlinked(userID uint, token, positionType string) ([]models.LendingPosition, error) {
+	return find[models.LendingPosition](r.db,
+		"user_id = ? AND LOWER(token) = LOWER(?) AND type = ? AND status = ? AND transaction_hash = ?",
+		userID, token, positionType, "active", "")
+}
+
+type gormFarms struct{ db *gorm.DB }
+
+func (r gormFarms) CreateFarm(farm *models.Farm) error {
+	return r.db.Create(farm).Error
+}
+
+func (r gormFarms) SaveFarm(farm *models.Farm) error {
+	return r.db.Save(farm).Error
+}
+
+func (r gormFarms) FindFarm(ctx context.Context) (*models.Farm, error) {
+	var farm models.Farm
+	if err := replica.Reader(r.db, ctx).First(&farm).Error; err != nil {
+		return nil, err
+	}
+	return &farm, nil
+}
+
+// LockFarm、LockPool 和 LockPools 在 SQLite 上会忽略 FOR UPDATE，见 gormPositions.LockActive
+func (r gormFarms) LockFarm() (*models.Farm, error) {
+	var farm models.Farm
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&farm).Error; err != nil {
+		return nil, err
+	}
+	return &farm, nil
+}
+
+func (r gormFarms) CreatePool(pool *models.FarmingPool) error {
+	return r.db.Create(pool).Error
+}
+
+func (r gormFarms) SavePool(pool *models.FarmingPool) error {
+	return r.db.Save(pool).Error
+}
+
+func (r gormFarms) FindPool(ctx context.Context, poolID uint) (*models.FarmingPool, error) {
+	return first[models.FarmingPool](replica.Reader(r.db, ctx), "pool_id = ?", poolID)
+}
+
+func (r gormFarms) LockPool(poolID uint) (*models.FarmingPool, error) {
+	return first[models.FarmingPool](r.db.Clauses(clause.Locking{Strength: "UPDATE"}), "pool_id = ?", poolID)
+}
+
+func (r gormFarms) ListPools() ([]models.FarmingPool, error) {
+	return r.listPools(r.db)
+}
+
+func (r gormFarms) LockPools() ([]models.FarmingPool, error) {
+	return r.listPools(r.db.Clauses(clause.Locking{Strength: "UPDATE"}))
+}
+
+func (r gormFarms) listPools(db *gorm.DB) ([]models.FarmingPool, error) {
+	var pools []models.FarmingPool
+	if err := db.Clauses(byID).Find(&pools).Error; err != nil {
+		return nil, err
+	}
+	return pools, nil
+}
+
+func (r gormFarms) CountPools() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.FarmingPool{}).Count(&count).Error
+	return count, err
+}
+
+func (r gormFarms) SavePosition(position *models.FarmingPosition) error {
+	return r.db.Save(position).Error
+}
+
+func (r gormFarms) FindPosition(userID, poolID uint) (*models.FarmingPosition, error) {
+	return first[models.FarmingPosition](r.db, "user_id = ? AND pool_id = ?", userID, poolID)
+}
+
+func (r gormFarms) FindPositionByID(userID, positionID uint) (*models.FarmingPosition, error) {
+	return first[models.FarmingPosition](r.db, "id = ? AND user_id = ?", positionID, userID)
+}
+
+func (r gormFarms) ListPositions(ctx context.Context, userID uint) ([]models.FarmingPosition, error) {
+	return find[models.FarmingPosition](replica.Reader(r.db, ctx), "user_id = ?", userID)
+}
+
+type gormRewards struct{ db *gorm.DB }
+
+func (r gormRewards) Create(reward *models.Reward) error {
+	return r.db.Create(reward).Error
+}
+
+func (r gormRewards) ListByUser(ctx context.Context, userID uint) ([]models.Reward, error) {
+	return find[models.Reward](replica.Reader(r.db, ctx), "user_id = ?", userID)
+}
+
+func (r gormRewards) Save(reward *models.Reward) error {
+	return r.db.Save(reward).Error
+}
+
+func (r gormRewards) ListByTransactions(hashes []string) ([]models.Reward, error) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+	return find[models.Reward](r.db, "transaction_hash IN ?", hashes)
+}
+
+func (r gormRewards) ListUnlinked(userID, positionID uint) ([]models.Reward, error) {
+	return find[models.Reward](r.db, "user_id = ? AND position_id = ? AND transaction_hash = ?", userID, positionID, "")
+}
+
+type gormTransactions struct{ db *gorm.DB }
+
+func (r gormTransactions) Create(tx *models.Transaction) error {
+	return r.db.Create(tx).Error
+}
+
+func (r gormTransactions) Upsert(tx *models.Transaction) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "transaction_hash"}, {Name: "log_index"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"updated_at", "user_id", "type", "contract", "account", "token_in", "token_out",
+			"amount_in", "amount_out", "price", "status", "block_number", "block_hash", "timestamp",
+		}),
+	}).Create(tx).Error
+}
+
+func (r gormTransactions) FindByHash(hash string) (*models.Transaction, error) {
+	return first[models.Transaction](r.db, "transaction_hash = ?", hash)
+}
+
+func (r gormTransactions) UpdateStatus(hash string, status string) error {
+	return r.db.Model(&models.Transaction{}).
+		Where("transaction_hash = ?", hash).
+		Update("status", status).Error
+}
+
+func (r gormTransactions) ListByUser(ctx context.Context, userID uint, limit int) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	err := replica.Reader(r.db, ctx).Where("user_id = ?", userID).
+		Clauses(newestFirst).
+		Limit(limit).
+		Find(&transactions).Error
+	return transactions, err
+}
+
+func (r gormTransactions) ListRecent(ctx context.Context, limit int) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	err := replica.Reader(r.db, ctx).Clauses(newestFirst).
+		Limit(limit).
+		Find(&transactions).Error
+	return transactions, err
+}
+
+func (r gormTransactions) ListSwaps(ctx context.Context, tokenA, tokenB string, from, to time.Time) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	err := replica.Reader(r.db, ctx).
+		Where("type = ? AND status <> ?", models.TransactionTypeSwap, models.TransactionStatusOrphaned).
+		Where("timestamp >= ? AND timestamp < ?", from, to).
+		Where("(LOWER(token_in) = LOWER(?) AND LOWER(token_out) = LOWER(?)) OR (LOWER(token_in) = LOWER(?) AND LOWER(token_out) = LOWER(?))",
+			tokenA, tokenB, tokenB, tokenA).
+		Clauses(byTimestamp).
+		Find(&transactions).Error
+	return transactions, err
+}
+
+func (r gormTransactions) ListHashesByBlocks(blockHashes []string) ([]string, error) {
+	if len(blockHashes) == 0 {
+		return nil, nil
+	}
+	return r.pluckHashes(r.db.Where("block_hash IN ?", blockHashes))
+}
+
+func (r gormTransactions) ListHashesByStatus(status string, maxBlock uint64) ([]string, error) {
+	return r.pluckHashes(r.db.Where("status = ? AND block_number <= ?", status, maxBlock))
+}
+
+func (r gormTransactions) pluckHashes(db *gorm.DB) ([]string, error) {
+	var hashes []string
+	err := db.Model(&models.Transaction{}).
+		Distinct("transaction_hash").
+		Order("transaction_hash").
+		Pluck("transaction_hash", &hashes).Error
+	return hashes, err
+}
+
+type gormChain struct{ db *gorm.DB }
+
+func (r gormChain) FindCheckpoint(name string) (*models.SyncCheckpoint, error) {
+	return first[models.SyncCheckpoint](r.db, "name = ?", name)
+}
+
+func (r gormChain) SaveCheckpoint(checkpoint *models.SyncCheckpoint) error {
+	return r.db.Save(checkpoint).Error
+}
+
+func (r gormChain) RewindCheckpoint(name string, block uint64) error {
+	return r.db.Model(&models.SyncCheckpoint{}).
+		Where("name = ? AND block_number > ?", name, block).
+		Update("block_number", block).Error
+}
+
+func (r gormChain) UpsertBlock(block *models.ChainBlock) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "number"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "hash", "parent_hash"}),
+	}).Create(block).Error
+}
+
+func (r gormChain) FindBlock(number uint64) (*models.ChainBlock, error) {
+	return first[models.ChainBlock](r.db, "number = ?", number)
+}
+
+func (r gormChain) ListBlocks() ([]models.ChainBlock, error) {
+	var blocks []models.ChainBlock
+	err := r.db.Clauses(clause.OrderBy{Columns: []clause.OrderByColumn{
+		{Column: clause.Column{Name: "number"}, Desc: true},
+	}}).Find(&blocks).Error
+	return blocks, err
+}
+
+// DeleteBlocksAbove 和 DeleteBlocksBelow 物理删除，Number 上有唯一索引，软删除的行会阻止重新写入
+func (r gormChain) DeleteBlocksAbove(number uint64) error {
+	return r.db.Unscoped().Where("number > ?", number).Delete(&models.ChainBlock{}).Error
+}
+
+func (r gormChain) DeleteBlocksBelow(number uint64) error {
+	return r.db.Unscoped().Where("number < ?", number).Delete(&models.ChainBlock{}).Error
+}
+
+type gormAlerts struct{ db *gorm.DB }
+
+func (r gormAlerts) Create(alert *models.PriceAlert) error {
+	return r.db.Create(alert).Error
+}
+
+func (r gormAlerts) Save(alert *models.PriceAlert) error {
+	return r.db.Save(alert).Error
+}
+
+func (r gormAlerts) FindByID(userID, id uint) (*models.PriceAlert, error) {
+	return first[models.PriceAlert](r.db, "id = ? AND user_id = ?", id, userID)
+}
+
+func (r gormAlerts) FindByIDs(ids []uint) ([]models.PriceAlert, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return find[models.PriceAlert](r.db, "id IN ?", ids)
+}
+
+func (r gormAlerts) ListByUser(ctx context.Context, userID uint) ([]models.PriceAlert, error) {
+	return find[models.PriceAlert](replica.Reader(r.db, ctx), "user_id = ?", userID)
+}
+
+func (r gormAlerts) ListActive(ctx context.Context) ([]models.PriceAlert, error) {
+	return find[models.PriceAlert](replica.Reader(r.db, ctx), "active = ?", true)
+}
+
+func (r gormAlerts) CountByUser(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.PriceAlert{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r gormAlerts) Delete(userID, id uint) error {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.PriceAlert{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r gormAlerts) RecordTrigger(id uint, at time.Time) error {
+	result := r.db.Model(&models.PriceAlert{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"trigger_count":     gorm.Expr("trigger_count + 1"),
+		"last_triggered_at": at,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormNotifications struct{ db *gorm.DB }
+
+func (r gormNotifications) Create(notification *models.Notification) error {
+	return r.db.Create(notification).Error
+}
+
+func (r gormNotifications) ListByUser(ctx context.Context, userID uint, unreadOnly bool, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	db := replica.Reader(r.db, ctx).Where("user_id = ?", userID)
+	if unreadOnly {
+		db = db.Where("read_at IS NULL")
+	}
+	err := db.Clauses(newestFirst).Limit(limit).Find(&notifications).Error
+	return notifications, err
+}
+
+func (r gormNotifications) CountUnread(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	err := replica.Reader(r.db, ctx).Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r gormNotifications) MarkRead(userID, id uint, at time.Time) error {
+	result := r.db.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", id, userID).
+		Update("read_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	_, err := first[models.Notification](r.db, "id = ? AND user_id = ?", id, userID)
+	return err
+}
@@ -0,0 +1,24 @@
+package repository_test
+
+import (
+	"testing"
+
+	"defi-backend/repository"
+	"defi-backend/repository/repotest"
+	"defi-backend/testenv"
+)
+
+// TestGormStore 每个用例使用一个新的 testenv，数据库为执行过全部迁移的 SQLite 内存库
+func TestGormStore(t *testing.T) {
+	err := repotest.Check(func() (repository.Store, error) {
+		env, err := testenv.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		t.Cleanup(env.Close)
+		return env.Store, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,1018 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"defi-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// memoryStore 所有数据保存在 memoryData 中，读写都持有同一把锁。
+// Transaction 在复制出的数据上执行 fn，成功后整体替换，失败时直接丢弃副本；
+// 事务执行期间其他调用会等待，效果相当于串行化隔离
+type memoryStore struct {
+	mu   sync.Mutex
+	data *memoryData
+}
+
+// NewMemoryStore 返回一个空的内存 Store，行为与 NewGormStore 一致，数据不会持久化
+func NewMemoryStore() Store {
+	return &memoryStore{data: newMemoryData()}
+}
+
+func (s *memoryStore) Users() UserRepository                 { return memoryUsers{s} }
+func (s *memoryStore) Nonces() NonceRepository               { return memoryNonces{s} }
+func (s *memoryStore) Profiles() ProfileRepository           { return memoryProfiles{s} }
+func (s *memoryStore) Pairs() PairRepository                 { return memoryPairs{s} }
+func (s *memoryStore) Trades() TradeRepository               { return memoryTrades{s} }
+func (s *memoryStore) Markets() MarketRepository             { return memoryMarkets{s} }
+func (s *memoryStore) Positions() PositionRepository         { return memoryPositions{s} }
+func (s *memoryStore) Farms() FarmRepository                 { return memoryFarms{s} }
+func (s *memoryStore) Rewards() RewardRepository             { return memoryRewards{s} }
+func (s *memoryStore) Transactions() TransactionRepository   { return memoryTransactions{s} }
+func (s *memoryStore) Chain() ChainRepository                { return memoryChain{s} }
+func (s *memoryStore) Alerts() AlertRepository               { return memoryAlerts{s} }
+func (s *memoryStore) Notifications() NotificationRepository { return memoryNotifications{s} }
+
+func (s *memoryStore) Transaction(fn func(Store) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memoryStore{data: s.data.clone()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.data = tx.data
+	return nil
+}
+
+// do 在锁内访问数据
+func (s *memoryStore) do(fn func(d *memoryData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(s.data)
+}
+
+type memoryData struct {
+	users            *table[models.User]
+	nonces           *table[models.WalletNonce]
+	profiles         *table[models.UserProfile]
+	pairs            *table[models.TradingPair]
+	trades           *table[models.Trade]
+	markets          *table[models.LendingMarket]
+	positions        *table[models.LendingPosition]
+	farms            *table[models.Farm]
+	pools            *table[models.FarmingPool]
+	farmingPositions *table[models.FarmingPosition]
+	rewards          *table[models.Reward]
+	transactions     *table[models.Transaction]
+	checkpoints      *table[models.SyncCheckpoint]
+	blocks           *table[models.ChainBlock]
+	alerts           *table[models.PriceAlert]
+	notifications    *table[models.Notification]
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		users:            newTable(func(r *models.User) *gorm.Model { return &r.Model }),
+		nonces:           newTable(func(r *models.WalletNonce) *gorm.Model { return &r.Model }),
+		profiles:         newTable(func(r *models.UserProfile) *gorm.Model { return &r.Model }),
+		pairs:            newTable(func(r *models.TradingPair) *gorm.Model { return &r.Model }),
+		trades:           newTable(func(r *models.Trade) *gorm.Model { return &r.Model }),
+		markets:          newTable(func(r *models.LendingMarket) *gorm.Model { return &r.Model }),
+		positions:        newTable(func(r *models.LendingPosition) *gorm.Model { return &r.Model }),
+		farms:            newTable(func(r *models.Farm) *gorm.Model { return &r.Model }),
+		pools:            newTable(func(r *models.FarmingPool) *gorm.Model { return &r.Model }),
+		farmingPositions: newTable(func(r *models.FarmingPosition) *gorm.Model { return &r.Model }),
+		rewards:          newTable(func(r *models.Reward) *gorm.Model { return &r.Model }),
+		transactions:     newTable(func(r *models.Transaction) *gorm.Model { return &r.Model }),
+		checkpoints:      newTable(func(r *models.SyncCheckpoint) *gorm.Model { return &r.Model }),
+		blocks:           newTable(func(r *models.ChainBlock) *gorm.Model { return &r.Model }),
+		alerts:           newTable(func(r *models.PriceAlert) *gorm.Model { return &r.Model }),
+		notifications:    newTable(func(r *models.Notification) *gorm.Model { return &r.Model }),
+	}
+}
+
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		users:            d.users.clone(),
+		nonces:           d.nonces.clone(),
+		profiles:         d.profiles.clone(),
+		pairs:            d.pairs.clone(),
+		trades:           d.trades.clone(),
+		markets:          d.markets.clone(),
+		positions:        d.positions.clone(),
+		farms:            d.farms.clone(),
+		pools:            d.pools.clone(),
+		farmingPositions: d.farmingPositions.clone(),
+		rewards:          d.rewards.clone(),
+		transactions:     d.transactions.clone(),
+		checkpoints:      d.checkpoints.clone(),
+		blocks:           d.blocks.clone(),
+		alerts:           d.alerts.clone(),
+		notifications:    d.notifications.clone(),
+	}
+}
+
+// table 一张按 ID 保存的表，行以值保存，读写时都复制，调用方修改返回值不会影响表中的数据。
+// 模型中的指针字段（例如 User.Email）与表共享，只能整体替换，不能修改指向的值
+type table[T any] struct {
+	rows   map[uint]T
+	nextID uint
+	model  func(*T) *gorm.Model
+}
+
+func newTable[T any](model func(*T) *gorm.Model) *table[T] {
+	return &table[T]{rows: make(map[uint]T), model: model}
+}
+
+func (t *table[T]) clone() *table[T] {
+	rows := make(map[uint]T, len(t.rows))
+	for id, row := range t.rows {
+		rows[id] = row
+	}
+	return &table[T]{rows: rows, nextID: t.nextID, model: t.model}
+}
+
+// insert 与 gorm 的 Create 一样分配 ID、设置时间戳并填充默认值
+func (t *table[T]) insert(row *T) error {
+	if err := applyDefaults(row); err != nil {
+		return err
+	}
+	m := t.model(row)
+	if m.ID == 0 {
+		t.nextID++
+		m.ID = t.nextID
+	} else if _, ok := t.rows[m.ID]; ok {
+		return ErrDuplicate
+	} else if m.ID > t.nextID {
+		t.nextID = m.ID
+	}
+	now := time.Now()
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = now
+	}
+	if m.UpdatedAt.IsZero() {
+		m.UpdatedAt = now
+	}
+	t.rows[m.ID] = *row
+	return nil
+}
+
+var schemas sync.Map
+
+// applyDefaults 与 gorm 的 Create 一样，把零值字段设置为 default 标签中的值，
+// 否则模型中依赖数据库默认值的字段（例如 FarmingPool.LPDecimals）在两种实现中会不一致
+func applyDefaults(row interface{}) error {
+	s, err := schema.Parse(row, &schemas, schema.NamingStrategy{})
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	rv := reflect.ValueOf(row)
+	for _, field := range s.Fields {
+		if field.DefaultValueInterface == nil {
+			continue
+		}
+		if _, zero := field.ValueOf(ctx, rv); zero {
+			if err := field.Set(ctx, rv, field.DefaultValueInterface); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// save 与 gorm 的 Save 一样，ID 为 0 或记录不存在时创建，否则整行覆盖
+func (t *table[T]) save(row *T) error {
+	m := t.model(row)
+	existing, ok := t.rows[m.ID]
+	if m.ID == 0 || !ok {
+		return t.insert(row)
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = t.model(&existing).CreatedAt
+	}
+	m.UpdatedAt = time.Now()
+	t.rows[m.ID] = *row
+	return nil
+}
+
+// filter 按 ID 升序返回满足 match 的行
+func (t *table[T]) filter(match func(*T) bool) []T {
+	ids := make([]uint, 0, len(t.rows))
+	for id, row := range t.rows {
+		if match == nil || match(&row) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	rows := make([]T, 0, len(ids))
+	for _, id := range ids {
+		rows = append(rows, t.rows[id])
+	}
+	return rows
+}
+
+// first 返回 ID 最小的满足 match 的行
+func (t *table[T]) first(match func(*T) bool) (*T, error) {
+	rows := t.filter(match)
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return &rows[0], nil
+}
+
+// conflict 判断 row 与 ID 不同的行是否满足 same，用于模拟唯一索引
+func (t *table[T]) conflict(row *T, same func(a, b *T) bool) error {
+	id := t.model(row).ID
+	for otherID, other := range t.rows {
+		if otherID != id && same(row, &other) {
+			return ErrDuplicate
+		}
+	}
+	return nil
+}
+
+// newestFirstLimit 与 GORM 实现的 newestFirst 排序一致：创建时间倒序，相同时 ID 倒序，limit 小于 0 表示不限制
+func newestFirstLimit[T any](t *table[T], rows []T, limit int) []T {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := t.model(&rows[i]), t.model(&rows[j])
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+	if limit >= 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+func sameString(a, b *string) bool {
+	return a != nil && b != nil && *a == *b
+}
+
+type memoryUsers struct{ s *memoryStore }
+
+func uniqueUser(d *memoryData, user *models.User) error {
+	return d.users.conflict(user, func(a, b *models.User) bool {
+		return a.Username == b.Username || sameString(a.Email, b.Email) || sameString(a.WalletAddress, b.WalletAddress)
+	})
+}
+
+func (r memoryUsers) Create(user *models.User) error {
+	return r.s.do(func(d *memoryData) error {
+		if err := uniqueUser(d, user); err != nil {
+			return err
+		}
+		return d.users.insert(user)
+	})
+}
+
+func (r memoryUsers) Save(user *models.User) error {
+	return r.s.do(func(d *memoryData) error {
+		if err := uniqueUser(d, user); err != nil {
+			return err
+		}
+		return d.users.save(user)
+	})
+}
+
+func (r memoryUsers) find(match func(*models.User) bool) (user *models.User, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		user, err = d.users.first(match)
+		return err
+	})
+	return user, err
+}
+
+func (r memoryUsers) List(ctx context.Context) (users []models.User, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		users = d.users.filter(nil)
+		return nil
+	})
+	return users, err
+}
+
+func (r memoryUsers) FindByID(id uint) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.ID == id })
+}
+
+func (r memoryUsers) FindByUsername(username string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.Username == username })
+}
+
+func (r memoryUsers) FindByEmail(email string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.Email != nil && *u.Email == email })
+}
+
+func (r memoryUsers) FindByWallet(address string) (*models.User, error) {
+	return r.find(func(u *models.User) bool {
+		return u.WalletAddress != nil && strings.EqualFold(*u.WalletAddress, address)
+	})
+}
+
+func (r memoryUsers) update(id uint, set func(*models.User)) error {
+	return r.s.do(func(d *memoryData) error {
+		user, ok := d.users.rows[id]
+		if !ok {
+			return ErrNotFound
+		}
+		set(&user)
+		if err := uniqueUser(d, &user); err != nil {
+			return err
+		}
+		return d.users.save(&user)
+	})
+}
+
+func (r memoryUsers) UpdateWalletAddress(id uint, address string) error {
+	return r.update(id, func(u *models.User) { u.WalletAddress = &address })
+}
+
+func (r memoryUsers) UpdateRole(id uint, role string) error {
+	return r.update(id, func(u *models.User) { u.Role = role })
+}
+
+type memoryNonces struct{ s *memoryStore }
+
+func (r memoryNonces) Create(nonce *models.WalletNonce) error {
+	return r.s.do(func(d *memoryData) error {
+		err := d.nonces.conflict(nonce, func(a, b *models.WalletNonce) bool { return a.Nonce == b.Nonce })
+		if err != nil {
+			return err
+		}
+		return d.nonces.insert(nonce)
+	})
+}
+
+func (r memoryNonces) Use(nonce string, now time.Time) error {
+	return r.s.do(func(d *memoryData) error {
+		row, err := d.nonces.first(func(n *models.WalletNonce) bool {
+			return n.Nonce == nonce && n.UsedAt == nil && n.ExpiresAt.After(now)
+		})
+		if err != nil {
+			return err
+		}
+		usedAt := now
+		row.UsedAt = &usedAt
+		return d.nonces.save(row)
+	})
+}
+
+type memoryProfiles struct{ s *memoryStore }
+
+func (r memoryProfiles) FindByUserID(userID uint) (profile *models.UserProfile, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		profile, err = d.profiles.first(func(p *models.UserProfile) bool { return p.UserID == userID })
+		return err
+	})
+	return profile, err
+}
+
+func (r memoryProfiles) Save(profile *models.UserProfile) error {
+	return r.s.do(func(d *memoryData) error {
+		existing, err := d.profiles.first(func(p *models.UserProfile) bool { return p.UserID == profile.UserID })
+		if err == nil {
+			profile.ID = existing.ID
+			profile.CreatedAt = existing.CreatedAt
+		} else {
+			profile.ID = 0
+		}
+		return d.profiles.save(profile)
+	})
+}
+
+type memoryPairs struct{ s *memoryStore }
+
+func (r memoryPairs) Create(pair *models.TradingPair) error {
+	return r.s.do(func(d *memoryData) error {
+		err := d.pairs.conflict(pair, func(a, b *models.TradingPair) bool { return a.Symbol == b.Symbol })
+		if err != nil {
+			return err
+		}
+		return d.pairs.insert(pair)
+	})
+}
+
+func (r memoryPairs) find(match func(*models.TradingPair) bool) (pair *models.TradingPair, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		pair, err = d.pairs.first(match)
+		return err
+	})
+	return pair, err
+}
+
+func (r memoryPairs) FindByID(id uint) (*models.TradingPair, error) {
+	return r.find(func(p *models.TradingPair) bool { return p.ID == id })
+}
+
+func (r memoryPairs) FindBySymbol(symbol string) (*models.TradingPair, error) {
+	return r.find(func(p *models.TradingPair) bool { return p.Symbol == symbol })
+}
+
+func (r memoryPairs) List(ctx context.Context) (pairs []models.TradingPair, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		pairs = d.pairs.filter(nil)
+		return nil
+	})
+	return pairs, err
+}
+
+type memoryTrades struct{ s *memoryStore }
+
+func (r memoryTrades) Create(trade *models.Trade) error {
+	return r.s.do(func(d *memoryData) error {
+		return d.trades.insert(trade)
+	})
+}
+
+func (r memoryTrades) ListByUser(ctx context.Context, userID uint, limit int) (trades []models.Trade, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		trades = newestFirstLimit(d.trades, d.trades.filter(func(t *models.Trade) bool { return t.UserID == userID }), limit)
+		return nil
+	})
+	return trades, err
+}
+
+type memoryMarkets struct{ s *memoryStore }
+
+func uniqueMarket(d *memoryData, market *models.LendingMarket) error {
+	return d.markets.conflict(market, func(a, b *models.LendingMarket) bool { return a.Token == b.Token })
+}
+
+func (r memoryMarkets) Create(market *models.LendingMarket) error {
+	return r.s.do(func(d *memoryData) error {
+		if err := uniqueMarket(d, market); err != nil {
+			return err
+		}
+		return d.markets.insert(market)
+	})
+}
+
+func (r memoryMarkets) Save(market *models.LendingMarket) error {
+	return r.s.do(func(d *memoryData) error {
+		if err := uniqueMarket(d, market); err != nil {
+			return err
+		}
+		return d.markets.save(market)
+	})
+}
+
+func (r memoryMarkets) FindListed(token string) (market *models.LendingMarket, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		market, err = d.markets.first(func(m *models.LendingMarket) bool { return m.Token == token && m.IsListed })
+		return err
+	})
+	return market, err
+}
+
+// LockListed 事务持有整个 Store 的锁，不需要再加行锁
+func (r memoryMarkets) LockListed(token string) (*models.LendingMarket, error) {
+	return r.FindListed(token)
+}
+
+func (r memoryMarkets) ListListed(ctx context.Context) (markets []models.LendingMarket, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		markets = d.markets.filter(func(m *models.LendingMarket) bool { return m.IsListed })
+		return nil
+	})
+	return markets, err
+}
+
+type memoryPositions struct{ s *memoryStore }
+
+func (r memoryPositions) Create(position *models.LendingPosition) error {
+	return r.s.do(func(d *memoryData) error {
+		return d.positions.insert(position)
+	})
+}
+
+func (r memoryPositions) Save(position *models.LendingPosition) error {
+	return r.s.do(func(d *memoryData) error {
+		return d.positions.save(position)
+	})
+}
+
+func (r memoryPositions) list(match func(*models.LendingPosition) bool) (positions []models.LendingPosition, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		positions = d.positions.filter(match)
+		return nil
+	})
+	return positions, err
+}
+
+func (r memoryPositions) ListByUser(ctx context.Context, userID uint) ([]models.LendingPosition, error) {
+	return r.list(func(p *models.LendingPosition) bool { return p.UserID == userID })
+}
+
+func (r memoryPositions) ListActive(ctx context.Context, userID uint) ([]models.LendingPosition, error) {
+	return r.list(func(p *models.LendingPosition) bool { return p.Status == "active" && p.UserID == userID })
+}
+
+func (r memoryPositions) ListAllActive(ctx context.Context) ([]models.LendingPosition, error) {
+	return r.list(func(p *models.LendingPosition) bool { return p.Status == "active" })
+}
+
+// LockActive 事务持有整个 Store 的锁，不需要再加行锁
+func (r memoryPositions) LockActive(userID uint) ([]models.LendingPosition, error) {
+	return r.ListActive(context.Background(), userID)
+}
+
+func (r memoryPositions) ListByTransactions(hashes []string) ([]models.LendingPosition, error) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+	set := stringSet(hashes)
+	return r.list(func(p *models.LendingPosition) bool { return set[p.TransactionHash] })
+}
+
+func (r memoryPositions) ListUnlinked(userID uint, token, positionType string) ([]models.LendingPosition, error) {
+	return r.list(func(p *models.LendingPosition) bool {
+		return p.UserID == userID && strings.EqualFold(p.Token, token) && p.Type == positionType &&
+			p.Status == "active" && p.TransactionHash == ""
+	})
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+type memoryFarms struct{ s *memoryStore }
+
+func (r memoryFarms) CreateFarm(farm *models.Farm) error {
+	return r.s.do(func(d *memoryData) error {
+		return d.farms.insert(farm)
+	})
+}
+
+func (r memoryFarms) SaveFarm(farm *models.Farm) error {
+	return r.s.do(func(d *memoryData) error {
+		return d.farms.save(farm)
+	})
+}
+
+func (r memoryFarms) FindFarm(ctx context.Context) (farm *models.Farm, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		farm, err = d.farms.first(nil)
+		return err
+	})
+	return farm, err
+}
+
+// LockFarm、LockPool 和 LockPools 事务持有整个 Store 的锁，不需要再加行锁
+func (r memoryFarms) LockFarm() (*models.Farm, error) {
+	return r.FindFarm(context.Background())
+}
+
+func uniquePool(d *memoryData, pool *models.FarmingPool) error {
+	return d.pools.conflict(pool, func(a, b *models.FarmingPool) bool { return a.PoolID == b.PoolID })
+}
+
+func (r memoryFarms) CreatePool(pool *models.FarmingPool) error {
+	return r.s.do(func(d *memoryData) error {
+		if err := uniquePool(d, pool); err != nil {
+			return err
+		}
+		return d.pools.insert(pool)
+	})
+}
+
+func (r memoryFarms) SavePool(pool *models.FarmingPool) error {
+	return r.s.do(func(d *memoryData) error {
+		if err := uniquePool(d, pool); err != nil {
+			return err
+		}
+		return d.pools.save(pool)
+	})
+}
+
+func (r memoryFarms) FindPool(ctx context.Context, poolID uint) (pool *models.FarmingPool, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		pool, err = d.pools.first(func(p *models.FarmingPool) bool { return p.PoolID == poolID })
+		return err
+	})
+	return pool, err
+}
+
+func (r memoryFarms) ListPools() (pools []models.FarmingPool, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		pools = d.pools.filter(nil)
+		return nil
+	})
+	return pools, err
+}
+
+func (r memoryFarms) LockPool(poolID uint) (*models.FarmingPool, error) {
+	return r.FindPool(context.Background(), poolID)
+}
+
+func (r memoryFarms) LockPools() ([]models.FarmingPool, error) {
+	return r.ListPools()
+}
+
+func (r memoryFarms) CountPools() (count int64, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		count = int64(len(d.pools.rows))
+		return nil
+	})
+	return count, err
+}
+
+func (r memoryFarms) SavePosition(position *models.FarmingPosition) error {
+	return r.s.do(func(d *memoryData) error {
+		err := d.farmingPositions.conflict(position, func(a, b *models.FarmingPosition) bool {
+			return a.UserID == b.UserID && a.PoolID == b.PoolID
+		})
+		if err != nil {
+			return err
+		}
+		return d.farmingPositions.save(position)
+	})
+}
+
+func (r memoryFarms) findPosition(match func(*models.FarmingPosition) bool) (position *models.FarmingPosition, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		position, err = d.farmingPositions.first(match)
+		return err
+	})
+	return position, err
+}
+
+func (r memoryFarms) FindPosition(userID, poolID uint) (*models.FarmingPosition, error) {
+	return r.findPosition(func(p *models.FarmingPosition) bool { return p.UserID == userID && p.PoolID == poolID })
+}
+
+func (r memoryFarms) FindPositionByID(userID, positionID uint) (*models.FarmingPosition, error) {
+	return r.findPosition(func(p *models.FarmingPosition) bool { return p.ID == positionID && p.UserID == userID })
+}
+
+func (r memoryFarms) ListPositions(ctx context.Context, userID uint) (positions []models.FarmingPosition, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		positions = d.farmingPositions.filter(func(p *models.FarmingPosition) bool { return p.UserID == userID })
+		return nil
+	})
+	return positions, err
+}
+
+type memoryRewards struct{ s *memoryStore }
+
+func (r memoryRewards) Create(reward *models.Reward) error {
+	return r.s.do(func(d *memoryData) error {
+		return d.rewards.insert(reward)
+	})
+}
+
+func (r memoryRewards) Save(reward *models.Reward) error {
+	return r.s.do(func(d *memoryData) error {
+		return d.rewards.save(reward)
+	})
+}
+
+func (r memoryRewards) list(match func(*models.Reward) bool) (rewards []models.Reward, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		rewards = d.rewards.filter(match)
+		return nil
+	})
+	return rewards, err
+}
+
+func (r memoryRewards) ListByUser(ctx context.Context, userID uint) ([]models.Reward, error) {
+	return r.list(func(rw *models.Reward) bool { return rw.UserID == userID })
+}
+
+func (r memoryRewards) ListByTransactions(hashes []string) ([]models.Reward, error) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+	set := stringSet(hashes)
+	return r.list(func(rw *models.Reward) bool { return set[rw.TransactionHash] })
+}
+
+func (r memoryRewards) ListUnlinked(userID, positionID uint) ([]models.Reward, error) {
+	return r.list(func(rw *models.Reward) bool {
+		return rw.UserID == userID && rw.PositionID == positionID && rw.TransactionHash == ""
+	})
+}
+
+type memoryTransactions struct{ s *memoryStore }
+
+func sameLog(a, b *models.Transaction) bool {
+	return a.TransactionHash == b.TransactionHash && a.LogIndex == b.LogIndex
+}
+
+func (r memoryTransactions) Create(tx *models.Transaction) error {
+	return r.s.do(func(d *memoryData) error {
+		if err := d.transactions.conflict(tx, sameLog); err != nil {
+			return err
+		}
+		return d.transactions.insert(tx)
+	})
+}
+
+func (r memoryTransactions) Upsert(tx *models.Transaction) error {
+	return r.s.do(func(d *memoryData) error {
+		existing, err := d.transactions.first(func(t *models.Transaction) bool { return sameLog(t, tx) })
+		if err != nil {
+			return d.transactions.insert(tx)
+		}
+		tx.ID = existing.ID
+		tx.CreatedAt = existing.CreatedAt
+		return d.transactions.save(tx)
+	})
+}
+
+func (r memoryTransactions) FindByHash(hash string) (tx *models.Transaction, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		tx, err = d.transactions.first(func(t *models.Transaction) bool { return t.TransactionHash == hash })
+		return err
+	})
+	return tx, err
+}
+
+func (r memoryTransactions) UpdateStatus(hash string, status string) error {
+	return r.s.do(func(d *memoryData) error {
+		for _, tx := range d.transactions.filter(func(t *models.Transaction) bool { return t.TransactionHash == hash }) {
+			tx.Status = status
+			if err := d.transactions.save(&tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r memoryTransactions) list(match func(*models.Transaction) bool, limit int) (transactions []models.Transaction, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		transactions = newestFirstLimit(d.transactions, d.transactions.filter(match), limit)
+		return nil
+	})
+	return transactions, err
+}
+
+func (r memoryTransactions) ListByUser(ctx context.Context, userID uint, limit int) ([]models.Transaction, error) {
+	return r.list(func(t *models.Transaction) bool { return t.UserID == userID }, limit)
+}
+
+func (r memoryTransactions) ListRecent(ctx context.Context, limit int) ([]models.Transaction, error) {
+	return r.list(nil, limit)
+}
+
+func (r memoryTransactions) ListSwaps(ctx context.Context, tokenA, tokenB string, from, to time.Time) (transactions []models.Transaction, err error) {
+	between := func(t *models.Transaction) bool {
+		return strings.EqualFold(t.TokenIn, tokenA) && strings.EqualFold(t.TokenOut, tokenB) ||
+			strings.EqualFold(t.TokenIn, tokenB) && strings.EqualFold(t.TokenOut, tokenA)
+	}
+	err = r.s.do(func(d *memoryData) error {
+		transactions = d.transactions.filter(func(t *models.Transaction) bool {
+			return t.Type == models.TransactionTypeSwap && t.Status != models.TransactionStatusOrphaned &&
+				!t.Timestamp.Before(from) && t.Timestamp.Before(to) && between(t)
+		})
+		sort.SliceStable(transactions, func(i, j int) bool {
+			if !transactions[i].Timestamp.Equal(transactions[j].Timestamp) {
+				return transactions[i].Timestamp.Before(transactions[j].Timestamp)
+			}
+			return transactions[i].ID < transactions[j].ID
+		})
+		return nil
+	})
+	return transactions, err
+}
+
+func (r memoryTransactions) ListHashesByBlocks(blockHashes []string) ([]string, error) {
+	if len(blockHashes) == 0 {
+		return nil, nil
+	}
+	set := stringSet(blockHashes)
+	return r.hashes(func(t *models.Transaction) bool { return set[t.BlockHash] })
+}
+
+func (r memoryTransactions) ListHashesByStatus(status string, maxBlock uint64) ([]string, error) {
+	return r.hashes(func(t *models.Transaction) bool { return t.Status == status && t.BlockNumber <= maxBlock })
+}
+
+func (r memoryTransactions) hashes(match func(*models.Transaction) bool) (hashes []string, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		seen := make(map[string]bool)
+		for _, t := range d.transactions.filter(match) {
+			if !seen[t.TransactionHash] {
+				seen[t.TransactionHash] = true
+				hashes = append(hashes, t.TransactionHash)
+			}
+		}
+		sort.Strings(hashes)
+		return nil
+	})
+	return hashes, err
+}
+
+type memoryChain struct{ s *memoryStore }
+
+func (r memoryChain) FindCheckpoint(name string) (checkpoint *models.SyncCheckpoint, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		checkpoint, err = d.checkpoints.first(func(c *models.SyncCheckpoint) bool { return c.Name == name })
+		return err
+	})
+	return checkpoint, err
+}
+
+func (r memoryChain) SaveCheckpoint(checkpoint *models.SyncCheckpoint) error {
+	return r.s.do(func(d *memoryData) error {
+		err := d.checkpoints.conflict(checkpoint, func(a, b *models.SyncCheckpoint) bool { return a.Name == b.Name })
+		if err != nil {
+			return err
+		}
+		return d.checkpoints.save(checkpoint)
+	})
+}
+
+func (r memoryChain) RewindCheckpoint(name string, block uint64) error {
+	return r.s.do(func(d *memoryData) error {
+		checkpoint, err := d.checkpoints.first(func(c *models.SyncCheckpoint) bool { return c.Name == name })
+		if err != nil || checkpoint.BlockNumber <= block {
+			return nil
+		}
+		checkpoint.BlockNumber = block
+		return d.checkpoints.save(checkpoint)
+	})
+}
+
+func (r memoryChain) UpsertBlock(block *models.ChainBlock) error {
+	return r.s.do(func(d *memoryData) error {
+		existing, err := d.blocks.first(func(b *models.ChainBlock) bool { return b.Number == block.Number })
+		if err != nil {
+			return d.blocks.insert(block)
+		}
+		block.ID = existing.ID
+		block.CreatedAt = existing.CreatedAt
+		return d.blocks.save(block)
+	})
+}
+
+func (r memoryChain) FindBlock(number uint64) (block *models.ChainBlock, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		block, err = d.blocks.first(func(b *models.ChainBlock) bool { return b.Number == number })
+		return err
+	})
+	return block, err
+}
+
+func (r memoryChain) ListBlocks() (blocks []models.ChainBlock, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		blocks = d.blocks.filter(nil)
+		sort.Slice(blocks, func(i, j int) bool { return blocks[i].Number > blocks[j].Number })
+		return nil
+	})
+	return blocks, err
+}
+
+func (r memoryChain) deleteBlocks(match func(*models.ChainBlock) bool) error {
+	return r.s.do(func(d *memoryData) error {
+		for id, block := range d.blocks.rows {
+			if match(&block) {
+				delete(d.blocks.rows, id)
+			}
+		}
+		return nil
+	})
+}
+
+func (r memoryChain) DeleteBlocksAbove(number uint64) error {
+	return r.deleteBlocks(func(b *models.ChainBlock) bool { return b.Number > number })
+}
+
+func (r memoryChain) DeleteBlocksBelow(number uint64) error {
+	return r.deleteBlocks(func(b *models.ChainBlock) bool { return b.Number < number })
+}
+
+type memoryAlerts struct{ s *memoryStore }
+
+func (r memoryAlerts) Create(alert *models.PriceAlert) error {
+	return r.s.do(func(d *memoryData) error {
+		return d.alerts.insert(alert)
+	})
+}
+
+func (r memoryAlerts) Save(alert *models.PriceAlert) error {
+	return r.s.do(func(d *memoryData) error {
+		return d.alerts.save(alert)
+	})
+}
+
+func (r memoryAlerts) FindByID(userID, id uint) (alert *models.PriceAlert, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		alert, err = d.alerts.first(func(a *models.PriceAlert) bool { return a.ID == id && a.UserID == userID })
+		return err
+	})
+	return alert, err
+}
+
+func (r memoryAlerts) list(match func(*models.PriceAlert) bool) (alerts []models.PriceAlert, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		alerts = d.alerts.filter(match)
+		return nil
+	})
+	return alerts, err
+}
+
+func (r memoryAlerts) FindByIDs(ids []uint) ([]models.PriceAlert, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	set := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return r.list(func(a *models.PriceAlert) bool { return set[a.ID] })
+}
+
+func (r memoryAlerts) ListByUser(ctx context.Context, userID uint) ([]models.PriceAlert, error) {
+	return r.list(func(a *models.PriceAlert) bool { return a.UserID == userID })
+}
+
+func (r memoryAlerts) ListActive(ctx context.Context) ([]models.PriceAlert, error) {
+	return r.list(func(a *models.PriceAlert) bool { return a.Active })
+}
+
+func (r memoryAlerts) CountByUser(userID uint) (int64, error) {
+	alerts, err := r.list(func(a *models.PriceAlert) bool { return a.UserID == userID })
+	return int64(len(alerts)), err
+}
+
+func (r memoryAlerts) Delete(userID, id uint) error {
+	return r.s.do(func(d *memoryData) error {
+		alert, ok := d.alerts.rows[id]
+		if !ok || alert.UserID != userID {
+			return ErrNotFound
+		}
+		delete(d.alerts.rows, id)
+		return nil
+	})
+}
+
+func (r memoryAlerts) RecordTrigger(id uint, at time.Time) error {
+	return r.s.do(func(d *memoryData) error {
+		alert, ok := d.alerts.rows[id]
+		if !ok {
+			return ErrNotFound
+		}
+		alert.TriggerCount++
+		alert.LastTriggeredAt = &at
+		return d.alerts.save(&alert)
+	})
+}
+
+type memoryNotifications struct{ s *memoryStore }
+
+func (r memoryNotifications) Create(notification *models.Notification) error {
+	return r.s.do(func(d *memoryData) error {
+		return d.notifications.insert(notification)
+	})
+}
+
+func (r memoryNotifications) ListByUser(ctx context.Context, userID uint, unreadOnly bool, limit int) (notifications []models.Notification, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		matched := d.notifications.filter(func(n *models.Notification) bool {
+			return n.UserID == userID && (!unreadOnly || n.ReadAt == nil)
+		})
+		notifications = newestFirstLimit(d.notifications, matched, limit)
+		return nil
+	})
+	return notifications, err
+}
+
+func (r memoryNotifications) CountUnread(ctx context.Context, userID uint) (count int64, err error) {
+	err = r.s.do(func(d *memoryData) error {
+		count = int64(len(d.notifications.filter(func(n *models.Notification) bool {
+			return n.UserID == userID && n.ReadAt == nil
+		})))
+		return nil
+	})
+	return count, err
+}
+
+func (r memoryNotifications) MarkRead(userID, id uint, at time.Time) error {
+	return r.s.do(func(d *memoryData) error {
+		notification, ok := d.notifications.rows[id]
+		if !ok || notification.UserID != userID {
+			return ErrNotFound
+		}
+		if notification.ReadAt != nil {
+			return nil
+		}
+		notification.ReadAt = &at
+		return d.notifications.save(&notification)
+	})
+}
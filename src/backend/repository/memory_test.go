@@ -0,0 +1,17 @@
+package repository_test
+
+import (
+	"testing"
+
+	"defi-backend/repository"
+	"defi-backend/repository/repotest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	err := repotest.Check(func() (repository.Store, error) {
+		return repository.NewMemoryStore(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,211 @@
+// Package repository 定义服务层使用的数据访问接口。
+// NewGormStore 通过 GORM 访问数据库，NewMemoryStore 把数据保存在内存中，用于不依赖数据库的单元测试；
+// 两种实现的行为由 repotest.Check 中的一致性测试约束，新增方法时需要同时补充实现和测试
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"defi-backend/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound 记录不存在，与 gorm.ErrRecordNotFound 相同，已有的 errors.Is 判断保持有效
+	ErrNotFound = gorm.ErrRecordNotFound
+	// ErrDuplicate 内存实现中违反唯一约束；数据库实现返回驱动自己的错误
+	ErrDuplicate = errors.New("duplicate key")
+)
+
+// Store 所有仓储的入口。Transaction 中的 fn 必须使用传入的 Store，
+// fn 返回错误或 panic 时其中的所有写入都会回滚
+type Store interface {
+	Users() UserRepository
+	Nonces() NonceRepository
+	Profiles() ProfileRepository
+	Pairs() PairRepository
+	Trades() TradeRepository
+	Markets() MarketRepository
+	Positions() PositionRepository
+	Farms() FarmRepository
+	Rewards() RewardRepository
+	Transactions() TransactionRepository
+	Chain() ChainRepository
+	Alerts() AlertRepository
+	Notifications() NotificationRepository
+
+	Transaction(fn func(Store) error) error
+}
+
+// 带 ctx 的查询可以在只读副本上执行，见 replica.Reader；
+// 没有特别说明时列表按 ID 升序返回
+
+type UserRepository interface {
+	Create(user *models.User) error
+	Save(user *models.User) error
+	FindByID(id uint) (*models.User, error)
+	FindByUsername(username string) (*models.User, error)
+	FindByEmail(email string) (*models.User, error)
+	// FindByWallet 按钱包地址查找，不区分大小写
+	FindByWallet(address string) (*models.User, error)
+	// UpdateWalletAddress 和 UpdateRole 在用户不存在时返回 ErrNotFound
+	UpdateWalletAddress(id uint, address string) error
+	UpdateRole(id uint, role string) error
+	// List 返回所有用户，包括被禁用的
+	List(ctx context.Context) ([]models.User, error)
+}
+
+type NonceRepository interface {
+	Create(nonce *models.WalletNonce) error
+	// Use 把未使用且在 now 时仍然有效的 nonce 标记为已使用，否则返回 ErrNotFound
+	Use(nonce string, now time.Time) error
+}
+
+type ProfileRepository interface {
+	FindByUserID(userID uint) (*models.UserProfile, error)
+	// Save 按 UserID 保存资料，用户已有资料时覆盖
+	Save(profile *models.UserProfile) error
+}
+
+type PairRepository interface {
+	Create(pair *models.TradingPair) error
+	FindByID(id uint) (*models.TradingPair, error)
+	FindBySymbol(symbol string) (*models.TradingPair, error)
+	List(ctx context.Context) ([]models.TradingPair, error)
+}
+
+type TradeRepository interface {
+	Create(trade *models.Trade) error
+	// ListByUser 按创建时间倒序返回用户最近的 limit 条交易
+	ListByUser(ctx context.Context, userID uint, limit int) ([]models.Trade, error)
+}
+
+// MarketRepository 借贷市场，只返回 IsListed 的市场
+type MarketRepository interface {
+	Create(market *models.LendingMarket) error
+	Save(market *models.LendingMarket) error
+	FindListed(token string) (*models.LendingMarket, error)
+	// LockListed 与 FindListed 相同，但在主库上读取并加行锁直到事务结束；
+	// 修改市场总量、利率指数等字段前必须先加锁，只能在 Transaction 中调用
+	LockListed(token string) (*models.LendingMarket, error)
+	ListListed(ctx context.Context) ([]models.LendingMarket, error)
+}
+
+// PositionRepository 借贷仓位
+type PositionRepository interface {
+	Create(position *models.LendingPosition) error
+	Save(position *models.LendingPosition) error
+	ListByUser(ctx context.Context, userID uint) ([]models.LendingPosition, error)
+	// ListActive 返回用户 status 为 active 的仓位
+	ListActive(ctx context.Context, userID uint) ([]models.LendingPosition, error)
+	// ListAllActive 返回所有用户 status 为 active 的仓位
+	ListAllActive(ctx context.Context) ([]models.LendingPosition, error)
+	// LockActive 在主库上读取用户 active 的仓位并加行锁 (SELECT ... FOR UPDATE)，直到事务结束；
+	// 只能在 Transaction 中调用，用于先校验再写入的操作
+	LockActive(userID uint) ([]models.LendingPosition, error)
+	// ListByTransactions 返回关联到这些链上交易的仓位，包括已被撤销的
+	ListByTransactions(hashes []string) ([]models.LendingPosition, error)
+	// ListUnlinked 返回用户 active 且还没有关联链上交易的仓位，代币不区分大小写
+	ListUnlinked(userID uint, token, positionType string) ([]models.LendingPosition, error)
+}
+
+// FarmRepository 挖矿的全局参数、池子和用户质押仓位。
+// Lock 开头的方法与对应的查询相同，但在主库上读取并加行锁直到事务结束，只能在 Transaction 中调用；
+// 修改池子或全局参数前先加锁，同时锁定时按先 Farm 后池子 (按 ID 升序) 的顺序
+type FarmRepository interface {
+	CreateFarm(farm *models.Farm) error
+	SaveFarm(farm *models.Farm) error
+	// FindFarm 返回 ID 最小的一条记录
+	FindFarm(ctx context.Context) (*models.Farm, error)
+	LockFarm() (*models.Farm, error)
+
+	CreatePool(pool *models.FarmingPool) error
+	SavePool(pool *models.FarmingPool) error
+	FindPool(ctx context.Context, poolID uint) (*models.FarmingPool, error)
+	LockPool(poolID uint) (*models.FarmingPool, error)
+	ListPools() ([]models.FarmingPool, error)
+	LockPools() ([]models.FarmingPool, error)
+	CountPools() (int64, error)
+
+	// SavePosition 保存仓位，ID 为 0 时创建
+	SavePosition(position *models.FarmingPosition) error
+	FindPosition(userID, poolID uint) (*models.FarmingPosition, error)
+	FindPositionByID(userID, positionID uint) (*models.FarmingPosition, error)
+	ListPositions(ctx context.Context, userID uint) ([]models.FarmingPosition, error)
+}
+
+type RewardRepository interface {
+	Create(reward *models.Reward) error
+	Save(reward *models.Reward) error
+	ListByUser(ctx context.Context, userID uint) ([]models.Reward, error)
+	// ListByTransactions 返回关联到这些链上交易的奖励，包括已被撤销的
+	ListByTransactions(hashes []string) ([]models.Reward, error)
+	// ListUnlinked 返回挖矿仓位上还没有关联链上交易的奖励
+	ListUnlinked(userID, positionID uint) ([]models.Reward, error)
+}
+
+type TransactionRepository interface {
+	Create(tx *models.Transaction) error
+	// Upsert 按 (TransactionHash, LogIndex) 写入，已存在时覆盖旧记录
+	Upsert(tx *models.Transaction) error
+	// FindByHash 返回交易中的第一条日志
+	FindByHash(hash string) (*models.Transaction, error)
+	UpdateStatus(hash string, status string) error
+	// ListByUser 和 ListRecent 按创建时间倒序，时间相同时按 ID 倒序
+	ListByUser(ctx context.Context, userID uint, limit int) ([]models.Transaction, error)
+	ListRecent(ctx context.Context, limit int) ([]models.Transaction, error)
+	// ListSwaps 返回 tokenA 与 tokenB 之间任一方向、Timestamp 在 [from, to) 内且未被孤立的 swap，
+	// 代币地址不区分大小写，按 Timestamp 升序，时间相同时按 ID 升序
+	ListSwaps(ctx context.Context, tokenA, tokenB string, from, to time.Time) ([]models.Transaction, error)
+	// ListHashesByBlocks 返回区块哈希在 blockHashes 中的交易哈希，去重且按哈希排序
+	ListHashesByBlocks(blockHashes []string) ([]string, error)
+	// ListHashesByStatus 返回 status 且 BlockNumber 不超过 maxBlock 的交易哈希，去重且按哈希排序
+	ListHashesByStatus(status string, maxBlock uint64) ([]string, error)
+}
+
+// ChainRepository 索引器的同步检查点和尚未最终确认的区块
+type ChainRepository interface {
+	// FindCheckpoint 按名称读取检查点，不存在时返回 ErrNotFound
+	FindCheckpoint(name string) (*models.SyncCheckpoint, error)
+	SaveCheckpoint(checkpoint *models.SyncCheckpoint) error
+	// RewindCheckpoint 把高于 block 的检查点退回到 block
+	RewindCheckpoint(name string, block uint64) error
+
+	// UpsertBlock 按 Number 写入，已存在时覆盖哈希
+	UpsertBlock(block *models.ChainBlock) error
+	FindBlock(number uint64) (*models.ChainBlock, error)
+	// ListBlocks 按高度倒序返回所有区块
+	ListBlocks() ([]models.ChainBlock, error)
+	// DeleteBlocksAbove 和 DeleteBlocksBelow 分别删除高度大于、小于 number 的区块
+	DeleteBlocksAbove(number uint64) error
+	DeleteBlocksBelow(number uint64) error
+}
+
+// AlertRepository 用户的价格提醒。FindByIDs 供触发价格提醒时使用，总是读主库
+type AlertRepository interface {
+	Create(alert *models.PriceAlert) error
+	Save(alert *models.PriceAlert) error
+	FindByID(userID, id uint) (*models.PriceAlert, error)
+	FindByIDs(ids []uint) ([]models.PriceAlert, error)
+	ListByUser(ctx context.Context, userID uint) ([]models.PriceAlert, error)
+	// ListActive 返回所有用户 Active 的提醒
+	ListActive(ctx context.Context) ([]models.PriceAlert, error)
+	CountByUser(userID uint) (int64, error)
+	// Delete 删除用户的提醒，不存在时返回 ErrNotFound
+	Delete(userID, id uint) error
+	// RecordTrigger 触发次数加一并记录触发时间，不存在时返回 ErrNotFound
+	RecordTrigger(id uint, at time.Time) error
+}
+
+// NotificationRepository 站内信
+type NotificationRepository interface {
+	Create(notification *models.Notification) error
+	// ListByUser 按创建时间倒序返回最近的 limit 条，unreadOnly 时只返回未读的
+	ListByUser(ctx context.Context, userID uint, unreadOnly bool, limit int) ([]models.Notification, error)
+	CountUnread(ctx context.Context, userID uint) (int64, error)
+	// MarkRead 把用户的站内信标记为已读，已读的不改变时间，不存在时返回 ErrNotFound
+	MarkRead(userID, id uint, at time.Time) error
+}
@@ -0,0 +1,908 @@
+// Package repotest 检查 repository.Store 的实现是否符合接口约定，
+// 用法与 testing/fstest.TestFS 相同，在测试中调用：
+//
+//	err := repotest.Check(func() (repository.Store, error) {
+//		return repository.NewMemoryStore(), nil
+//	})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//
+// GORM 实现需要为每个用例提供执行过全部迁移的空数据库，例如 testenv 中的 SQLite 内存库
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"defi-backend/models"
+	"defi-backend/repository"
+)
+
+// Check 对每个用例调用 newStore 取得一个空的 Store，返回所有不符合约定的行为
+func Check(newStore func() (repository.Store, error)) error {
+	cases := []struct {
+		name string
+		run  func(repository.Store) error
+	}{
+		{"users", checkUsers},
+		{"nonces", checkNonces},
+		{"profiles", checkProfiles},
+		{"pairs", checkPairs},
+		{"trades", checkTrades},
+		{"markets", checkMarkets},
+		{"positions", checkPositions},
+		{"farms", checkFarms},
+		{"rewards", checkRewards},
+		{"transactions", checkTransactions},
+		{"swaps", checkSwaps},
+		{"chain", checkChain},
+		{"alerts", checkAlerts},
+		{"notifications", checkNotifications},
+		{"transaction", checkTransaction},
+	}
+
+	var failures []string
+	for _, c := range cases {
+		store, err := newStore()
+		if err != nil {
+			return fmt.Errorf("repotest: failed to create store: %v", err)
+		}
+		if err := c.run(store); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", c.name, err))
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New("repotest: " + strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+var ctx = context.Background()
+
+// units 由最小单位构造数量
+func units(raw int64, decimals uint8) models.Amount {
+	return models.NewAmount(big.NewInt(raw), decimals)
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// notFound 要求 err 为 repository.ErrNotFound
+func notFound(what string, err error) error {
+	if !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("%s: got error %v, want ErrNotFound", what, err)
+	}
+	return nil
+}
+
+// missing 要求查询返回 repository.ErrNotFound
+func missing[T any](_ T, err error) error {
+	if !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("got error %v, want ErrNotFound", err)
+	}
+	return nil
+}
+
+func ids[T any](rows []T, id func(*T) uint) []uint {
+	out := make([]uint, 0, len(rows))
+	for i := range rows {
+		out = append(out, id(&rows[i]))
+	}
+	return out
+}
+
+func sameIDs(what string, got []uint, want ...uint) error {
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		return fmt.Errorf("%s: got ids %v, want %v", what, got, want)
+	}
+	return nil
+}
+
+func checkUsers(store repository.Store) error {
+	users := store.Users()
+	alice := &models.User{Username: "alice", Email: strPtr("alice@example.com"), Password: "x", Role: "user", IsActive: true}
+	if err := users.Create(alice); err != nil {
+		return err
+	}
+	if alice.ID == 0 || alice.CreatedAt.IsZero() {
+		return errors.New("Create did not set ID and CreatedAt")
+	}
+	if err := users.Create(&models.User{Username: "alice", Password: "x", Role: "user"}); err == nil {
+		return errors.New("Create accepted a duplicate username")
+	}
+	bob := &models.User{Username: "bob", WalletAddress: strPtr("0xAbC0000000000000000000000000000000000001"), Password: "x", Role: "user"}
+	if err := users.Create(bob); err != nil {
+		return err
+	}
+
+	if u, err := users.FindByID(alice.ID); err != nil || u.Username != "alice" {
+		return fmt.Errorf("FindByID: %v, %v", u, err)
+	}
+	if u, err := users.FindByUsername("bob"); err != nil || u.ID != bob.ID {
+		return fmt.Errorf("FindByUsername: %v, %v", u, err)
+	}
+	if u, err := users.FindByEmail("alice@example.com"); err != nil || u.ID != alice.ID {
+		return fmt.Errorf("FindByEmail: %v, %v", u, err)
+	}
+	if u, err := users.FindByWallet("0xabc0000000000000000000000000000000000001"); err != nil || u.ID != bob.ID {
+		return fmt.Errorf("FindByWallet should ignore case: %v, %v", u, err)
+	}
+	if err := missing(users.FindByUsername("carol")); err != nil {
+		return fmt.Errorf("FindByUsername: %v", err)
+	}
+
+	if err := users.UpdateRole(alice.ID, "admin"); err != nil {
+		return err
+	}
+	if err := users.UpdateRole(alice.ID, "admin"); err != nil {
+		return fmt.Errorf("UpdateRole with an unchanged value: %v", err)
+	}
+	if err := notFound("UpdateRole", users.UpdateRole(alice.ID+bob.ID, "admin")); err != nil {
+		return err
+	}
+	if err := users.UpdateWalletAddress(alice.ID, "0x0000000000000000000000000000000000000002"); err != nil {
+		return err
+	}
+	u, err := users.FindByID(alice.ID)
+	if err != nil {
+		return err
+	}
+	if u.Role != "admin" || u.WalletAddress == nil || *u.WalletAddress != "0x0000000000000000000000000000000000000002" {
+		return fmt.Errorf("updates not saved: role %q wallet %v", u.Role, u.WalletAddress)
+	}
+
+	u.LastLogin = time.Now()
+	u.IsActive = false
+	if err := users.Save(u); err != nil {
+		return err
+	}
+	if u, err = users.FindByID(alice.ID); err != nil || u.IsActive || u.LastLogin.IsZero() {
+		return fmt.Errorf("Save: %v, %v", u, err)
+	}
+	list, err := users.List(ctx)
+	if err != nil {
+		return err
+	}
+	return sameIDs("List", ids(list, func(u *models.User) uint { return u.ID }), alice.ID, bob.ID)
+}
+
+func checkNonces(store repository.Store) error {
+	nonces := store.Nonces()
+	now := time.Now()
+	if err := nonces.Create(&models.WalletNonce{Nonce: "fresh", ExpiresAt: now.Add(time.Minute)}); err != nil {
+		return err
+	}
+	if err := nonces.Create(&models.WalletNonce{Nonce: "expired", ExpiresAt: now.Add(-time.Minute)}); err != nil {
+		return err
+	}
+	if err := nonces.Create(&models.WalletNonce{Nonce: "fresh", ExpiresAt: now.Add(time.Minute)}); err == nil {
+		return errors.New("Create accepted a duplicate nonce")
+	}
+
+	if err := nonces.Use("fresh", now); err != nil {
+		return err
+	}
+	if err := notFound("Use twice", nonces.Use("fresh", now)); err != nil {
+		return err
+	}
+	if err := notFound("Use expired", nonces.Use("expired", now)); err != nil {
+		return err
+	}
+	return notFound("Use unknown", nonces.Use("unknown", now))
+}
+
+func checkProfiles(store repository.Store) error {
+	profiles := store.Profiles()
+	if err := missing(profiles.FindByUserID(1)); err != nil {
+		return fmt.Errorf("FindByUserID: %v", err)
+	}
+
+	first := &models.UserProfile{UserID: 1, FirstName: "Ada"}
+	if err := profiles.Save(first); err != nil {
+		return err
+	}
+	// 没有 ID 的资料再次保存时覆盖同一用户的记录
+	second := &models.UserProfile{UserID: 1, FirstName: "Grace", KYCVerified: true}
+	if err := profiles.Save(second); err != nil {
+		return err
+	}
+	if second.ID != first.ID {
+		return fmt.Errorf("Save created a second profile %d for the user, want %d", second.ID, first.ID)
+	}
+	p, err := profiles.FindByUserID(1)
+	if err != nil {
+		return err
+	}
+	if p.FirstName != "Grace" || !p.KYCVerified {
+		return fmt.Errorf("Save did not overwrite the profile: %+v", p)
+	}
+	return nil
+}
+
+func checkPairs(store repository.Store) error {
+	pairs := store.Pairs()
+	var created []uint
+	for _, symbol := range []string{"ETH/USDC", "WBTC/ETH"} {
+		pair := &models.TradingPair{Symbol: symbol, Token0: "a", Token1: "b", Decimals0: 18, Decimals1: 6, Reserve0: "1", Reserve1: "2", TotalSupply: "0", IsActive: true}
+		if err := pairs.Create(pair); err != nil {
+			return err
+		}
+		created = append(created, pair.ID)
+	}
+	if err := pairs.Create(&models.TradingPair{Symbol: "ETH/USDC", Token0: "a", Token1: "b"}); err == nil {
+		return errors.New("Create accepted a duplicate symbol")
+	}
+
+	if p, err := pairs.FindByID(created[1]); err != nil || p.Symbol != "WBTC/ETH" {
+		return fmt.Errorf("FindByID: %v, %v", p, err)
+	}
+	if p, err := pairs.FindBySymbol("ETH/USDC"); err != nil || p.ID != created[0] || p.Decimals1 != 6 {
+		return fmt.Errorf("FindBySymbol: %v, %v", p, err)
+	}
+	if err := missing(pairs.FindBySymbol("DOGE/ETH")); err != nil {
+		return fmt.Errorf("FindBySymbol: %v", err)
+	}
+	list, err := pairs.List(ctx)
+	if err != nil {
+		return err
+	}
+	return sameIDs("List", ids(list, func(p *models.TradingPair) uint { return p.ID }), created...)
+}
+
+func checkTrades(store repository.Store) error {
+	trades := store.Trades()
+	var created []uint
+	for i, userID := range []uint{1, 2, 1, 1} {
+		trade := &models.Trade{UserID: userID, PairID: 1, Type: "swap", Amount: units(int64(i+1), 6), TotalValue: models.ZeroAmount(18), Status: "pending"}
+		if err := trades.Create(trade); err != nil {
+			return err
+		}
+		created = append(created, trade.ID)
+	}
+
+	list, err := trades.ListByUser(ctx, 1, 2)
+	if err != nil {
+		return err
+	}
+	if err := sameIDs("ListByUser", ids(list, func(t *models.Trade) uint { return t.ID }), created[3], created[2]); err != nil {
+		return err
+	}
+	if list[0].Amount.String() != "0.000004" {
+		return fmt.Errorf("Amount round trip: got %s, want 0.000004", list[0].Amount)
+	}
+	return nil
+}
+
+func checkMarkets(store repository.Store) error {
+	markets := store.Markets()
+	listed := &models.LendingMarket{Token: "0xa", Decimals: 6, Price: "1", CollateralFactor: "1", IsListed: true}
+	unlisted := &models.LendingMarket{Token: "0xb", Decimals: 18, Price: "1", CollateralFactor: "1"}
+	for _, m := range []*models.LendingMarket{listed, unlisted} {
+		if err := markets.Create(m); err != nil {
+			return err
+		}
+	}
+	// IsListed 在模型中默认为 true，GORM 创建时会把 false 当作零值写入默认值，这里显式保存
+	unlisted.IsListed = false
+	if err := markets.Save(unlisted); err != nil {
+		return err
+	}
+
+	if err := missing(markets.FindListed("0xb")); err != nil {
+		return fmt.Errorf("FindListed unlisted: %v", err)
+	}
+	m, err := markets.FindListed("0xa")
+	if err != nil {
+		return err
+	}
+	m.TotalSupply = "1000"
+	if err := markets.Save(m); err != nil {
+		return err
+	}
+	list, err := markets.ListListed(ctx)
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 || list[0].ID != listed.ID || list[0].TotalSupply != "1000" {
+		return fmt.Errorf("ListListed: got %+v", list)
+	}
+	return store.Transaction(func(tx repository.Store) error {
+		if err := missing(tx.Markets().LockListed("0xb")); err != nil {
+			return fmt.Errorf("LockListed unlisted: %v", err)
+		}
+		locked, err := tx.Markets().LockListed("0xa")
+		if err != nil {
+			return err
+		}
+		if locked.ID != listed.ID || locked.TotalSupply != "1000" {
+			return fmt.Errorf("LockListed: got %+v", locked)
+		}
+		return nil
+	})
+}
+
+func checkPositions(store repository.Store) error {
+	positions := store.Positions()
+	rows := []*models.LendingPosition{
+		{UserID: 1, Token: "0xa", Type: models.PositionTypeSupply, Status: "active", TransactionHash: "0x01"},
+		{UserID: 1, Token: "0xa", Type: models.PositionTypeBorrow, Status: "orphaned", TransactionHash: "0x02"},
+		{UserID: 2, Token: "0xa", Type: models.PositionTypeSupply, Status: "active", TransactionHash: "0x02"},
+		{UserID: 2, Token: "0xa", Type: models.PositionTypeSupply, Status: "active"},
+	}
+	for _, p := range rows {
+		p.Amount = units(1, 18)
+		p.StartTime = time.Now()
+		if err := positions.Create(p); err != nil {
+			return err
+		}
+	}
+	id := func(p *models.LendingPosition) uint { return p.ID }
+
+	list, err := positions.ListByUser(ctx, 1)
+	if err != nil {
+		return err
+	}
+	if err := sameIDs("ListByUser", ids(list, id), rows[0].ID, rows[1].ID); err != nil {
+		return err
+	}
+	if list, err = positions.ListAllActive(ctx); err != nil {
+		return err
+	}
+	if err := sameIDs("ListAllActive", ids(list, id), rows[0].ID, rows[2].ID, rows[3].ID); err != nil {
+		return err
+	}
+	if list, err = positions.ListActive(ctx, 2); err != nil {
+		return err
+	}
+	if err := sameIDs("ListActive", ids(list, id), rows[2].ID, rows[3].ID); err != nil {
+		return err
+	}
+	err = store.Transaction(func(tx repository.Store) error {
+		locked, err := tx.Positions().LockActive(2)
+		if err != nil {
+			return err
+		}
+		return sameIDs("LockActive", ids(locked, id), rows[2].ID, rows[3].ID)
+	})
+	if err != nil {
+		return err
+	}
+	if list, err = positions.ListByTransactions([]string{"0x02"}); err != nil {
+		return err
+	}
+	if err := sameIDs("ListByTransactions", ids(list, id), rows[1].ID, rows[2].ID); err != nil {
+		return err
+	}
+	if list, err = positions.ListUnlinked(2, "0xA", models.PositionTypeSupply); err != nil {
+		return err
+	}
+	if err := sameIDs("ListUnlinked", ids(list, id), rows[3].ID); err != nil {
+		return err
+	}
+	if list, err = positions.ListUnlinked(2, "0xa", models.PositionTypeBorrow); err != nil || len(list) != 0 {
+		return fmt.Errorf("ListUnlinked should match the position type: %v, %v", list, err)
+	}
+
+	rows[2].Status = "orphaned"
+	if err := positions.Save(rows[2]); err != nil {
+		return err
+	}
+	if list, err = positions.ListActive(ctx, 2); err != nil {
+		return err
+	}
+	return sameIDs("ListActive after Save", ids(list, id), rows[3].ID)
+}
+
+func checkFarms(store repository.Store) error {
+	farms := store.Farms()
+	if err := missing(farms.FindFarm(ctx)); err != nil {
+		return fmt.Errorf("FindFarm: %v", err)
+	}
+	farm := &models.Farm{RewardToken: "0xr", RewardDecimals: 18, RewardPerBlock: "10", StartBlock: 5}
+	if err := farms.CreateFarm(farm); err != nil {
+		return err
+	}
+	if err := farms.CreateFarm(&models.Farm{RewardToken: "0xs", RewardPerBlock: "0"}); err != nil {
+		return err
+	}
+	farm.TotalAllocPoint = 100
+	if err := farms.SaveFarm(farm); err != nil {
+		return err
+	}
+	if f, err := farms.FindFarm(ctx); err != nil || f.ID != farm.ID || f.TotalAllocPoint != 100 {
+		return fmt.Errorf("FindFarm should return the first farm: %v, %v", f, err)
+	}
+
+	for poolID := uint(0); poolID < 2; poolID++ {
+		pool := &models.FarmingPool{PoolID: poolID, LPToken: "0xlp", AllocPoint: 50, AccRewardPerShare: "0", TotalStaked: "0"}
+		if err := farms.CreatePool(pool); err != nil {
+			return err
+		}
+	}
+	if err := farms.CreatePool(&models.FarmingPool{PoolID: 1, LPToken: "0xlp"}); err == nil {
+		return errors.New("CreatePool accepted a duplicate pool id")
+	}
+	if count, err := farms.CountPools(); err != nil || count != 2 {
+		return fmt.Errorf("CountPools: %d, %v", count, err)
+	}
+	pool, err := farms.FindPool(ctx, 1)
+	if err != nil {
+		return err
+	}
+	// 零值字段与 gorm 的 Create 一样取模型 default 标签中的值
+	if pool.LPDecimals != 18 {
+		return fmt.Errorf("CreatePool did not apply the default LPDecimals: got %d", pool.LPDecimals)
+	}
+	pool.TotalStaked = "7"
+	if err := farms.SavePool(pool); err != nil {
+		return err
+	}
+	pools, err := farms.ListPools()
+	if err != nil {
+		return err
+	}
+	if len(pools) != 2 || pools[1].TotalStaked != "7" {
+		return fmt.Errorf("ListPools: got %+v", pools)
+	}
+	if err := missing(farms.FindPool(ctx, 9)); err != nil {
+		return fmt.Errorf("FindPool: %v", err)
+	}
+	err = store.Transaction(func(tx repository.Store) error {
+		if f, err := tx.Farms().LockFarm(); err != nil || f.ID != farm.ID {
+			return fmt.Errorf("LockFarm should return the first farm: %v, %v", f, err)
+		}
+		if p, err := tx.Farms().LockPool(1); err != nil || p.ID != pool.ID || p.TotalStaked != "7" {
+			return fmt.Errorf("LockPool: %v, %v", p, err)
+		}
+		if err := missing(tx.Farms().LockPool(9)); err != nil {
+			return fmt.Errorf("LockPool: %v", err)
+		}
+		locked, err := tx.Farms().LockPools()
+		if err != nil {
+			return err
+		}
+		return sameIDs("LockPools", ids(locked, func(p *models.FarmingPool) uint { return p.ID }), pools[0].ID, pools[1].ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	position := &models.FarmingPosition{UserID: 3, PoolID: 1, Token: "0xlp", Amount: units(2, 18), RewardDebt: "0", Status: "active"}
+	if err := farms.SavePosition(position); err != nil {
+		return err
+	}
+	if position.ID == 0 {
+		return errors.New("SavePosition did not create the position")
+	}
+	position.RewardDebt = "5"
+	if err := farms.SavePosition(position); err != nil {
+		return err
+	}
+	if p, err := farms.FindPosition(3, 1); err != nil || p.ID != position.ID || p.RewardDebt != "5" {
+		return fmt.Errorf("FindPosition: %v, %v", p, err)
+	}
+	if err := missing(farms.FindPositionByID(4, position.ID)); err != nil {
+		return fmt.Errorf("FindPositionByID of another user: %v", err)
+	}
+	if p, err := farms.FindPositionByID(3, position.ID); err != nil || p.PoolID != 1 {
+		return fmt.Errorf("FindPositionByID: %v, %v", p, err)
+	}
+	list, err := farms.ListPositions(ctx, 3)
+	if err != nil {
+		return err
+	}
+	return sameIDs("ListPositions", ids(list, func(p *models.FarmingPosition) uint { return p.ID }), position.ID)
+}
+
+func checkRewards(store repository.Store) error {
+	rewards := store.Rewards()
+	var created []uint
+	for _, hash := range []string{"0x01", "0x02", "", ""} {
+		reward := &models.Reward{UserID: 1, PositionID: 7, Token: "0xr", Amount: units(1, 18), Type: "farming", ClaimTime: time.Now(), TransactionHash: hash}
+		if err := rewards.Create(reward); err != nil {
+			return err
+		}
+		created = append(created, reward.ID)
+	}
+	id := func(r *models.Reward) uint { return r.ID }
+
+	list, err := rewards.ListByTransactions([]string{"0x01", "0x03"})
+	if err != nil {
+		return err
+	}
+	if err := sameIDs("ListByTransactions", ids(list, id), created[0]); err != nil {
+		return err
+	}
+	if list[0].Status != "claimed" {
+		return fmt.Errorf("Create did not apply the default status: %q", list[0].Status)
+	}
+	list[0].Status = "orphaned"
+	if err := rewards.Save(&list[0]); err != nil {
+		return err
+	}
+
+	if list, err = rewards.ListUnlinked(1, 7); err != nil {
+		return err
+	}
+	if err := sameIDs("ListUnlinked", ids(list, id), created[2], created[3]); err != nil {
+		return err
+	}
+	if list, err = rewards.ListByUser(ctx, 1); err != nil {
+		return err
+	}
+	if err := sameIDs("ListByUser", ids(list, id), created...); err != nil {
+		return err
+	}
+	if list[0].Status != "orphaned" {
+		return fmt.Errorf("Save did not update the status: %q", list[0].Status)
+	}
+	return nil
+}
+
+func checkTransactions(store repository.Store) error {
+	transactions := store.Transactions()
+	logs := []*models.Transaction{
+		{UserID: 1, TransactionHash: "0x01", LogIndex: 0, Status: models.TransactionStatusPending},
+		{UserID: 1, TransactionHash: "0x01", LogIndex: 1, Status: models.TransactionStatusPending},
+		{UserID: 2, TransactionHash: "0x02", LogIndex: 0, Status: models.TransactionStatusPending},
+	}
+	for _, t := range logs {
+		t.Type = models.TransactionTypeSwap
+		t.AmountIn = units(1, 18)
+		t.AmountOut = units(2, 6)
+		if err := transactions.Upsert(t); err != nil {
+			return err
+		}
+	}
+	if err := transactions.Create(&models.Transaction{TransactionHash: "0x02", LogIndex: 0}); err == nil {
+		return errors.New("Create accepted a duplicate (hash, log index)")
+	}
+
+	// 重复写入同一条日志时覆盖而不是新增
+	again := &models.Transaction{UserID: 2, TransactionHash: "0x02", LogIndex: 0, Status: models.TransactionStatusConfirmed, BlockNumber: 9}
+	if err := transactions.Upsert(again); err != nil {
+		return err
+	}
+	recent, err := transactions.ListRecent(ctx, -1)
+	if err != nil {
+		return err
+	}
+	if len(recent) != 3 {
+		return fmt.Errorf("Upsert of an existing log added a row: got %d rows", len(recent))
+	}
+	t, err := transactions.FindByHash("0x02")
+	if err != nil {
+		return err
+	}
+	if t.Status != models.TransactionStatusConfirmed || t.BlockNumber != 9 {
+		return fmt.Errorf("Upsert did not update the log: %+v", t)
+	}
+
+	if err := transactions.UpdateStatus("0x01", models.TransactionStatusOrphaned); err != nil {
+		return err
+	}
+	id := func(t *models.Transaction) uint { return t.ID }
+	list, err := transactions.ListByUser(ctx, 1, 10)
+	if err != nil {
+		return err
+	}
+	if err := sameIDs("ListByUser", ids(list, id), logs[1].ID, logs[0].ID); err != nil {
+		return err
+	}
+	for _, t := range list {
+		if t.Status != models.TransactionStatusOrphaned {
+			return fmt.Errorf("UpdateStatus did not update log %d", t.LogIndex)
+		}
+	}
+	if list, err = transactions.ListRecent(ctx, 2); err != nil {
+		return err
+	}
+	if err := sameIDs("ListRecent", ids(list, id), logs[2].ID, logs[1].ID); err != nil {
+		return err
+	}
+	if err := missing(transactions.FindByHash("0x03")); err != nil {
+		return fmt.Errorf("FindByHash: %v", err)
+	}
+
+	if err := transactions.Upsert(&models.Transaction{TransactionHash: "0x03", BlockNumber: 12, BlockHash: "0xb2", Status: models.TransactionStatusPending}); err != nil {
+		return err
+	}
+	hashes, err := transactions.ListHashesByStatus(models.TransactionStatusConfirmed, 9)
+	if err != nil {
+		return err
+	}
+	if fmt.Sprint(hashes) != "[0x02]" {
+		return fmt.Errorf("ListHashesByStatus: got %v, want [0x02]", hashes)
+	}
+	if hashes, err = transactions.ListHashesByStatus(models.TransactionStatusPending, 11); err != nil || len(hashes) != 0 {
+		return fmt.Errorf("ListHashesByStatus should respect maxBlock: %v, %v", hashes, err)
+	}
+	if hashes, err = transactions.ListHashesByBlocks([]string{"0xb2", "0xb3"}); err != nil || fmt.Sprint(hashes) != "[0x03]" {
+		return fmt.Errorf("ListHashesByBlocks: %v, %v", hashes, err)
+	}
+	return nil
+}
+
+func checkChain(store repository.Store) error {
+	chain := store.Chain()
+	if err := missing(chain.FindCheckpoint("events")); err != nil {
+		return fmt.Errorf("FindCheckpoint: %v", err)
+	}
+	checkpoint := &models.SyncCheckpoint{Name: "events", BlockNumber: 10}
+	if err := chain.SaveCheckpoint(checkpoint); err != nil {
+		return err
+	}
+	if err := chain.RewindCheckpoint("events", 12); err != nil {
+		return err
+	}
+	if c, err := chain.FindCheckpoint("events"); err != nil || c.BlockNumber != 10 {
+		return fmt.Errorf("RewindCheckpoint moved the checkpoint forward: %v, %v", c, err)
+	}
+	if err := chain.RewindCheckpoint("events", 7); err != nil {
+		return err
+	}
+	if c, err := chain.FindCheckpoint("events"); err != nil || c.BlockNumber != 7 || c.ID != checkpoint.ID {
+		return fmt.Errorf("RewindCheckpoint: %v, %v", c, err)
+	}
+
+	for n := uint64(1); n <= 5; n++ {
+		block := &models.ChainBlock{Number: n, Hash: fmt.Sprintf("0xa%d", n), ParentHash: fmt.Sprintf("0xa%d", n-1)}
+		if err := chain.UpsertBlock(block); err != nil {
+			return err
+		}
+	}
+	// 同一高度再次写入时覆盖哈希
+	if err := chain.UpsertBlock(&models.ChainBlock{Number: 3, Hash: "0xb3", ParentHash: "0xa2"}); err != nil {
+		return err
+	}
+	if b, err := chain.FindBlock(3); err != nil || b.Hash != "0xb3" {
+		return fmt.Errorf("UpsertBlock did not replace block 3: %v, %v", b, err)
+	}
+
+	if err := chain.DeleteBlocksAbove(4); err != nil {
+		return err
+	}
+	if err := chain.DeleteBlocksBelow(2); err != nil {
+		return err
+	}
+	blocks, err := chain.ListBlocks()
+	if err != nil {
+		return err
+	}
+	numbers := make([]uint64, 0, len(blocks))
+	for _, b := range blocks {
+		numbers = append(numbers, b.Number)
+	}
+	if fmt.Sprint(numbers) != "[4 3 2]" {
+		return fmt.Errorf("ListBlocks: got %v, want [4 3 2]", numbers)
+	}
+	// 删除后可以重新写入同一高度
+	if err := chain.UpsertBlock(&models.ChainBlock{Number: 5, Hash: "0xc5", ParentHash: "0xa4"}); err != nil {
+		return err
+	}
+	return missing(chain.FindBlock(1))
+}
+
+func checkSwaps(store repository.Store) error {
+	transactions := store.Transactions()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	swap := func(hash string, in, out string, at time.Duration) *models.Transaction {
+		return &models.Transaction{
+			Type: models.TransactionTypeSwap, TokenIn: in, TokenOut: out,
+			AmountIn: units(1, 18), AmountOut: units(2, 18),
+			Status: models.TransactionStatusConfirmed, TransactionHash: hash, Timestamp: start.Add(at),
+		}
+	}
+	logs := []*models.Transaction{
+		swap("0x01", "0xAAAA", "0xbbbb", 2*time.Minute),
+		swap("0x02", "0xbbbb", "0xaaaa", time.Minute),
+		swap("0x03", "0xaaaa", "0xcccc", time.Minute),  // 其他交易对
+		swap("0x04", "0xaaaa", "0xbbbb", time.Hour),    // 超出范围
+		swap("0x05", "0xaaaa", "0xbbbb", -time.Second), // 超出范围
+		swap("0x06", "0xaaaa", "0xbbbb", 0),
+		swap("0x07", "0xaaaa", "0xbbbb", time.Minute),
+		swap("0x08", "0xaaaa", "0xbbbb", time.Minute),
+		swap("0x09", "0xaaaa", "0xbbbb", time.Minute),
+	}
+	logs[7].Status = models.TransactionStatusOrphaned
+	logs[8].Type = models.TransactionTypeAddLiquidity
+	for _, t := range logs {
+		if err := transactions.Create(t); err != nil {
+			return err
+		}
+	}
+
+	list, err := transactions.ListSwaps(ctx, "0xaaaa", "0xBBBB", start, start.Add(time.Hour))
+	if err != nil {
+		return err
+	}
+	id := func(t *models.Transaction) uint { return t.ID }
+	return sameIDs("ListSwaps", ids(list, id), logs[5].ID, logs[1].ID, logs[6].ID, logs[0].ID)
+}
+
+func checkAlerts(store repository.Store) error {
+	alerts := store.Alerts()
+	var created []*models.PriceAlert
+	for _, a := range []struct {
+		userID uint
+		active bool
+	}{{1, true}, {1, false}, {2, true}} {
+		alert := &models.PriceAlert{UserID: a.userID, Token: "ETH", Condition: models.AlertConditionAbove, Threshold: 3000, CooldownSeconds: 60, Active: a.active}
+		if err := alerts.Create(alert); err != nil {
+			return err
+		}
+		created = append(created, alert)
+	}
+	id := func(a *models.PriceAlert) uint { return a.ID }
+
+	if alert, err := alerts.FindByID(1, created[1].ID); err != nil || alert.Active {
+		return fmt.Errorf("FindByID: got %+v, %v; want the inactive alert", alert, err)
+	}
+	if err := missing(alerts.FindByID(2, created[0].ID)); err != nil {
+		return fmt.Errorf("FindByID of another user: %v", err)
+	}
+	list, err := alerts.ListActive(ctx)
+	if err != nil {
+		return err
+	}
+	if err := sameIDs("ListActive", ids(list, id), created[0].ID, created[2].ID); err != nil {
+		return err
+	}
+	list, err = alerts.FindByIDs([]uint{created[2].ID, created[0].ID, 999})
+	if err != nil {
+		return err
+	}
+	if err := sameIDs("FindByIDs", ids(list, id), created[0].ID, created[2].ID); err != nil {
+		return err
+	}
+
+	at := time.Now().Truncate(time.Second)
+	for i := 0; i < 2; i++ {
+		if err := alerts.RecordTrigger(created[0].ID, at); err != nil {
+			return err
+		}
+	}
+	alert, err := alerts.FindByID(1, created[0].ID)
+	if err != nil {
+		return err
+	}
+	if alert.TriggerCount != 2 || alert.LastTriggeredAt == nil || !alert.LastTriggeredAt.Equal(at) {
+		return fmt.Errorf("RecordTrigger: got count %d at %v", alert.TriggerCount, alert.LastTriggeredAt)
+	}
+	if err := notFound("RecordTrigger of missing alert", alerts.RecordTrigger(999, at)); err != nil {
+		return err
+	}
+
+	if err := notFound("Delete of another user's alert", alerts.Delete(2, created[0].ID)); err != nil {
+		return err
+	}
+	if err := alerts.Delete(1, created[0].ID); err != nil {
+		return err
+	}
+	if err := notFound("Delete twice", alerts.Delete(1, created[0].ID)); err != nil {
+		return err
+	}
+	list, err = alerts.ListByUser(ctx, 1)
+	if err != nil {
+		return err
+	}
+	if err := sameIDs("ListByUser after Delete", ids(list, id), created[1].ID); err != nil {
+		return err
+	}
+	count, err := alerts.CountByUser(1)
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return fmt.Errorf("CountByUser: got %d, want 1", count)
+	}
+	return nil
+}
+
+func checkNotifications(store repository.Store) error {
+	notifications := store.Notifications()
+	var created []uint
+	for _, userID := range []uint{1, 1, 1, 2} {
+		n := &models.Notification{UserID: userID, AlertID: 1, Title: "ETH above 3000", TriggeredAt: time.Now()}
+		if err := notifications.Create(n); err != nil {
+			return err
+		}
+		created = append(created, n.ID)
+	}
+	id := func(n *models.Notification) uint { return n.ID }
+
+	at := time.Now().Truncate(time.Second)
+	if err := notifications.MarkRead(1, created[1], at); err != nil {
+		return err
+	}
+	// 已读的再次标记不报错，也不改变时间
+	if err := notifications.MarkRead(1, created[1], at.Add(time.Hour)); err != nil {
+		return err
+	}
+	if err := notFound("MarkRead of another user's notification", notifications.MarkRead(2, created[0], at)); err != nil {
+		return err
+	}
+
+	list, err := notifications.ListByUser(ctx, 1, false, 2)
+	if err != nil {
+		return err
+	}
+	if err := sameIDs("ListByUser", ids(list, id), created[2], created[1]); err != nil {
+		return err
+	}
+	if list[1].ReadAt == nil || !list[1].ReadAt.Equal(at) {
+		return fmt.Errorf("MarkRead: got read_at %v, want %v", list[1].ReadAt, at)
+	}
+	list, err = notifications.ListByUser(ctx, 1, true, -1)
+	if err != nil {
+		return err
+	}
+	if err := sameIDs("ListByUser unread", ids(list, id), created[2], created[0]); err != nil {
+		return err
+	}
+	count, err := notifications.CountUnread(ctx, 1)
+	if err != nil {
+		return err
+	}
+	if count != 2 {
+		return fmt.Errorf("CountUnread: got %d, want 2", count)
+	}
+	return nil
+}
+
+var errRollback = errors.New("rollback")
+
+func checkTransaction(store repository.Store) error {
+	pair := func(symbol string) *models.TradingPair {
+		return &models.TradingPair{Symbol: symbol, Token0: "a", Token1: "b", Reserve0: "0", Reserve1: "0", TotalSupply: "0"}
+	}
+
+	err := store.Transaction(func(tx repository.Store) error {
+		if err := tx.Pairs().Create(pair("ROLLED/BACK")); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		return fmt.Errorf("Transaction returned %v, want the error from fn", err)
+	}
+	if err := missing(store.Pairs().FindBySymbol("ROLLED/BACK")); err != nil {
+		return fmt.Errorf("write after rollback: %v", err)
+	}
+
+	// 内层事务失败只回滚内层的写入
+	err = store.Transaction(func(tx repository.Store) error {
+		if err := tx.Pairs().Create(pair("OUTER/X")); err != nil {
+			return err
+		}
+		err := tx.Transaction(func(inner repository.Store) error {
+			if err := inner.Pairs().Create(pair("INNER/X")); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			return fmt.Errorf("nested Transaction returned %v", err)
+		}
+		if _, err := tx.Pairs().FindBySymbol("OUTER/X"); err != nil {
+			return fmt.Errorf("read own write in transaction: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := store.Pairs().FindBySymbol("OUTER/X"); err != nil {
+		return fmt.Errorf("committed write: %v", err)
+	}
+	if err := missing(store.Pairs().FindBySymbol("INNER/X")); err != nil {
+		return fmt.Errorf("nested rollback: %v", err)
+	}
+	return nil
+}
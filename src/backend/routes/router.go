@@ -3,6 +3,7 @@ package routes
 import (
 	"net/http"
 
+	"defi-backend/auth"
 	"defi-backend/handlers"
 	"defi-backend/middleware"
 	"defi-backend/services"
@@ -11,17 +12,63 @@ import (
 	"go.uber.org/zap"
 )
 
+// Options 路由的可选组件，RateLimiter 为空时不限流，Features 为空时所有功能开启，
+// Sticky 为空时写入后的读请求不会强制使用主库，Candles 为空时不提供 K 线接口，
+// PriceHub 为空时不提供价格推送，Oracle 为空时不提供预言机接口，TWAP 为空时不提供 TWAP 接口，
+// Alerts 为空时不提供价格提醒和站内信接口
+type Options struct {
+	Wallet      handlers.WalletLoginConfig
+	RateLimiter *middleware.RateLimiter
+	Features    *middleware.FeatureFlags
+	Sticky      *middleware.PrimarySticky
+	Candles     *services.CandleService
+	PriceHub    *services.PriceHub
+	Oracle      *services.Oracle
+	TWAP        *services.TWAPService
+	Alerts      *services.AlertService
+}
+
 type Router struct {
 	userHandler *handlers.UserHandler
 	defiHandler *handlers.DefiHandler
+	priceStream *handlers.PriceStreamHandler
+	oracle      *handlers.OracleHandler
+	alerts      *handlers.AlertHandler
+	tokens      *auth.TokenService
 	logger      *zap.Logger
+	limiter     *middleware.RateLimiter
+	features    *middleware.FeatureFlags
+	sticky      *middleware.PrimarySticky
+	candles     bool
+	twap        bool
 }
 
-func NewRouter(userService *services.UserService, defiService *services.DefiService, logger *zap.Logger) *Router {
+func NewRouter(userService *services.UserService, defiService *services.DefiService, riskEngine *services.RiskEngine, tokens *auth.TokenService, logger *zap.Logger, opts Options) *Router {
+	var priceStream *handlers.PriceStreamHandler
+	if opts.PriceHub != nil {
+		priceStream = handlers.NewPriceStreamHandler(opts.PriceHub, defiService)
+	}
+	var oracle *handlers.OracleHandler
+	if opts.Oracle != nil {
+		oracle = handlers.NewOracleHandler(opts.Oracle)
+	}
+	var alerts *handlers.AlertHandler
+	if opts.Alerts != nil {
+		alerts = handlers.NewAlertHandler(opts.Alerts)
+	}
 	return &Router{
-		userHandler: handlers.NewUserHandler(userService),
-		defiHandler: handlers.NewDefiHandler(defiService),
+		userHandler: handlers.NewUserHandler(userService, tokens, opts.Wallet),
+		defiHandler: handlers.NewDefiHandler(defiService, riskEngine, opts.Candles, opts.TWAP),
+		priceStream: priceStream,
+		oracle:      oracle,
+		alerts:      alerts,
+		tokens:      tokens,
 		logger:      logger,
+		limiter:     opts.RateLimiter,
+		features:    opts.Features,
+		sticky:      opts.Sticky,
+		candles:     opts.Candles != nil,
+		twap:        opts.TWAP != nil,
 	}
 }
 
@@ -30,6 +77,17 @@ func (r *Router) SetupRouter() *gin.Engine {
 
 	// 使用日志中间件
 	router.Use(middleware.LoggerMiddleware(r.logger))
+	if r.limiter != nil {
+		router.Use(r.limiter.Middleware())
+	}
+	if r.sticky != nil {
+		router.Use(r.sticky.Middleware())
+	}
+
+	authRequired := middleware.AuthMiddleware(r.tokens)
+
+	// 令牌校验公钥
+	router.GET("/.well-known/jwks.json", r.userHandler.JWKS)
 
 	// API 路由组
 	api := router.Group("/api")
@@ -47,37 +105,119 @@ func (r *Router) SetupRouter() *gin.Engine {
 		{
 			user.POST("/register", r.userHandler.Register)
 			user.POST("/login", r.userHandler.Login)
-			user.GET("/profile", middleware.AuthMiddleware(), r.userHandler.GetProfile)
+			user.GET("/profile", authRequired, r.userHandler.GetProfile)
+			user.POST("/refresh", r.userHandler.Refresh)
+			user.POST("/logout", authRequired, r.userHandler.Logout)
+			user.POST("/logout-all", authRequired, r.userHandler.LogoutAll)
+
+			// Sign-In with Ethereum 钱包登录
+			user.POST("/wallet/nonce", r.userHandler.WalletNonce)
+			user.POST("/wallet/login", r.userHandler.WalletLogin)
+			user.POST("/wallet/link", authRequired, r.userHandler.LinkWallet)
 		}
 
-		// DeFi 相关路由
+		// DeFi 相关路由，需要登录的接口按权限分组
 		defi := api.Group("/defi")
 		{
 			// DEX 路由
 			dex := defi.Group("/dex")
 			{
-				dex.POST("/swap", middleware.AuthMiddleware(), r.defiHandler.SwapTokens)
+				dex.GET("/quote", r.defiHandler.QuoteSwap)
+				dex.GET("/route", r.defiHandler.FindRoute)
 				dex.GET("/pairs", r.defiHandler.GetTradingPairs)
 				dex.GET("/price/:pair", r.defiHandler.GetTokenPrice)
+				if r.candles {
+					dex.GET("/candles/:pair", r.defiHandler.GetCandles)
+				}
+				if r.twap {
+					dex.GET("/twap/:pair", r.defiHandler.GetTWAP)
+				}
+
+				trader := dex.Group("", authRequired, r.require(middleware.PermTrade))
+				trader.POST("/swap", r.feature(middleware.FeatureSwap), r.defiHandler.SwapTokens)
+			}
+
+			// 预言机各来源的报价和聚合结果
+			if r.oracle != nil {
+				defi.GET("/oracle/:token", r.oracle.GetPrice)
 			}
 
 			// 借贷路由
 			lending := defi.Group("/lending")
 			{
-				lending.POST("/deposit", middleware.AuthMiddleware(), r.defiHandler.Deposit)
-				lending.POST("/borrow", middleware.AuthMiddleware(), r.defiHandler.Borrow)
-				lending.GET("/positions", middleware.AuthMiddleware(), r.defiHandler.GetPositions)
+				lending.GET("/markets/:token/rates", r.defiHandler.GetMarketRates)
+
+				trader := lending.Group("", authRequired, r.require(middleware.PermTrade))
+				trader.POST("/deposit", r.defiHandler.Deposit)
+				trader.POST("/borrow", r.feature(middleware.FeatureBorrow), r.defiHandler.Borrow)
+				trader.GET("/positions", r.defiHandler.GetPositions)
+
+				risk := lending.Group("", authRequired, r.require(middleware.PermRiskRead))
+				risk.GET("/liquidatable", r.defiHandler.GetLiquidatableAccounts)
 			}
 
-			// 挖矿路由
-			farming := defi.Group("/farming")
+			// 挖矿路由，功能关闭时仍允许用户取回质押
+			farming := defi.Group("/farming", authRequired, r.require(middleware.PermTrade))
 			{
-				farming.POST("/stake", middleware.AuthMiddleware(), r.defiHandler.StakeTokens)
-				farming.POST("/unstake", middleware.AuthMiddleware(), r.defiHandler.UnstakeTokens)
-				farming.GET("/rewards", middleware.AuthMiddleware(), r.defiHandler.GetRewards)
+				farming.POST("/stake", r.feature(middleware.FeatureFarming), r.defiHandler.StakeTokens)
+				farming.POST("/unstake", r.defiHandler.UnstakeTokens)
+				farming.POST("/emergency-withdraw/:pool", r.defiHandler.EmergencyWithdraw)
+				farming.POST("/claim/:position", r.feature(middleware.FeatureFarming), r.defiHandler.ClaimRewards)
+				farming.GET("/rewards", r.defiHandler.GetRewards)
+				farming.GET("/pending/:pool", r.defiHandler.GetPendingReward)
+			}
+		}
+
+		// 价格推送，SSE 和 WebSocket 的事件相同
+		if r.priceStream != nil {
+			prices := api.Group("/prices")
+			prices.GET("/stream", r.priceStream.Stream)
+			prices.GET("/ws", r.priceStream.WebSocket)
+		}
+
+		// 价格提醒，触发后写入站内信并回调提醒的 webhook
+		if r.alerts != nil {
+			alerts := api.Group("/alerts", authRequired)
+			alerts.GET("", r.alerts.ListAlerts)
+			alerts.POST("", r.alerts.CreateAlert)
+			alerts.GET("/:id", r.alerts.GetAlert)
+			alerts.PUT("/:id", r.alerts.UpdateAlert)
+			alerts.DELETE("/:id", r.alerts.DeleteAlert)
+			alerts.POST("/:id/webhook-secret", r.alerts.RotateWebhookSecret)
+
+			notifications := api.Group("/notifications", authRequired)
+			notifications.GET("", r.alerts.ListNotifications)
+			notifications.POST("/:id/read", r.alerts.MarkNotificationRead)
+		}
+
+		// 管理路由
+		admin := api.Group("/admin", authRequired)
+		{
+			users := admin.Group("/users")
+			users.GET("", r.require(middleware.PermAuditRead), r.userHandler.ListUsers)
+			users.PUT("/:id/role", r.require(middleware.PermUsersWrite), r.userHandler.UpdateUserRole)
+
+			farming := admin.Group("/farming", r.require(middleware.PermMarketsWrite))
+			farming.POST("", r.defiHandler.InitFarm)
+			farming.PUT("/reward-per-block", r.defiHandler.SetRewardPerBlock)
+			farming.POST("/pools", r.defiHandler.AddFarmingPool)
+			farming.PUT("/pools/:pool", r.defiHandler.SetFarmingPool)
+
+			if r.oracle != nil {
+				oracle := admin.Group("/oracle", r.require(middleware.PermMarketsWrite))
+				oracle.PUT("/:token", r.oracle.SetManualPrice)
+				oracle.DELETE("/:token", r.oracle.DeleteManualPrice)
 			}
 		}
 	}
 
 	return router
 }
+
+func (r *Router) require(perm middleware.Permission) gin.HandlerFunc {
+	return middleware.RequirePermission(r.logger, perm)
+}
+
+func (r *Router) feature(name string) gin.HandlerFunc {
+	return middleware.RequireFeature(r.features, name)
+}
@@ -0,0 +1,58 @@
+package routes_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"defi-backend/auth"
+	"defi-backend/testenv"
+)
+
+// TestAuditorAccess 审计员只能访问只读的审计和风险接口，写接口返回 403
+func TestAuditorAccess(t *testing.T) {
+	env, err := testenv.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Close()
+
+	user, err := env.Users.Register("auditor", "auditor@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Users.UpdateRole(user.ID, auth.RoleAuditor); err != nil {
+		t.Fatal(err)
+	}
+	if user, err = env.Users.GetUser(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := env.Tokens.Issue(context.Background(), auth.NewUser(user))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/admin/users", http.StatusOK},
+		{http.MethodGet, "/api/defi/lending/liquidatable", http.StatusOK},
+		{http.MethodPut, fmt.Sprintf("/api/admin/users/%d/role", user.ID), http.StatusForbidden},
+		{http.MethodPost, "/api/admin/farming/pools", http.StatusForbidden},
+		{http.MethodPost, "/api/defi/dex/swap", http.StatusForbidden},
+		{http.MethodPost, "/api/defi/lending/deposit", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s %s = %d, want %d: %s", tc.method, tc.path, w.Code, tc.want, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"defi-backend/config"
+	"defi-backend/models"
+	"defi-backend/repository"
+)
+
+// InboxNotifier 把触发的提醒写入用户的站内信
+type InboxNotifier struct {
+	store repository.Store
+}
+
+func NewInboxNotifier(store repository.Store) *InboxNotifier {
+	return &InboxNotifier{store: store}
+}
+
+func (n *InboxNotifier) Notify(_ context.Context, alert *models.PriceAlert, event *AlertEvent) error {
+	return n.store.Notifications().Create(&models.Notification{
+		UserID:      alert.UserID,
+		AlertID:     alert.ID,
+		Title:       event.Title,
+		Message:     event.Message,
+		Price:       event.Price,
+		TriggeredAt: time.UnixMilli(event.Timestamp),
+	})
+}
+
+var errPrivateWebhook = errors.New("webhook address is not public")
+
+// nonPublicNetworks net.IP 的方法没有覆盖的非公网地址段
+var nonPublicNetworks = []*net.IPNet{
+	mustCIDR("0.0.0.0/8"),     // 本网络，部分系统上连接到本机
+	mustCIDR("100.64.0.0/10"), // 运营商级 NAT
+}
+
+func mustCIDR(s string) *net.IPNet {
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// publicIP 判断 ip 是否为可以回调的公网地址
+func publicIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// WebhookNotifier 把 AlertEvent 以 JSON POST 到提醒的 WebhookURL，没有设置的提醒跳过。
+// 请求带 X-Alert-Signature: sha256=<HMAC-SHA256(提醒的 WebhookSecret, body)>；
+// 默认拒绝连接回环、内网和链路本地地址，在建立连接时检查，域名解析到这些地址也会被拒绝
+type WebhookNotifier struct {
+	client *http.Client
+}
+
+func NewWebhookNotifier(cfg config.AlertsConfig) *WebhookNotifier {
+	dialer := &net.Dialer{Timeout: cfg.WebhookTimeout}
+	if !cfg.AllowPrivateWebhooks {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicIP(net.ParseIP(host)) {
+				return fmt.Errorf("%w: %s", errPrivateWebhook, host)
+			}
+			return nil
+		}
+	}
+	return &WebhookNotifier{
+		client: &http.Client{
+			Timeout:   cfg.WebhookTimeout,
+			Transport: &http.Transport{Proxy: nil, DialContext: dialer.DialContext},
+			// 重定向可能指向内网地址，不跟随
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert *models.PriceAlert, event *AlertEvent) error {
+	if alert.WebhookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, alert.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if alert.WebhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(alert.WebhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Alert-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,773 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"defi-backend/config"
+	"defi-backend/models"
+	"defi-backend/repository"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// AlertWindows rise 和 drop 提醒可选的时间窗口，参考价格来自 1 分钟 K 线
+var AlertWindows = []string{"5m", "15m", "1h", "4h", "24h"}
+
+// alertDeliveries 同时发送的通知数
+const alertDeliveries = 8
+
+var (
+	ErrInvalidAlert  = errors.New("invalid alert")
+	ErrAlertNotFound = errors.New("alert not found")
+	ErrTooManyAlerts = errors.New("too many alerts")
+
+	ErrNotificationNotFound = errors.New("notification not found")
+)
+
+// AlertInput 创建或修改提醒的参数，Token 和 PairID 二选一，rise 和 drop 只支持代币；
+// CooldownSeconds 为 0 时使用默认冷却时间
+type AlertInput struct {
+	Token           string
+	PairID          uint
+	Condition       string
+	Threshold       float64
+	Window          string
+	CooldownSeconds int64
+	WebhookURL      string
+	Note            string
+	Active          bool
+}
+
+// AlertEvent 一次提醒触发。Value 和 Previous 为触发前后比较的值：
+// 价格提醒为价格，rise 和 drop 为 Window 内的涨跌幅 (百分比)；Price 为触发时的价格
+type AlertEvent struct {
+	AlertID   uint    `json:"alert_id"`
+	UserID    uint    `json:"user_id"`
+	Token     string  `json:"token,omitempty"`
+	PairID    uint    `json:"pair_id,omitempty"`
+	Condition string  `json:"condition"`
+	Threshold float64 `json:"threshold"`
+	Window    string  `json:"window,omitempty"`
+	Previous  float64 `json:"previous"`
+	Value     float64 `json:"value"`
+	Price     float64 `json:"price"`
+	Timestamp int64   `json:"timestamp"`
+	Title     string  `json:"title"`
+	Message   string  `json:"message"`
+	Note      string  `json:"note,omitempty"`
+}
+
+// AlertNotifier 发送触发的提醒，例如站内信和 webhook；一个通道失败不影响其他通道
+type AlertNotifier interface {
+	Notify(ctx context.Context, alert *models.PriceAlert, event *AlertEvent) error
+}
+
+// AlertService 管理价格提醒并在价格更新时检查。提醒以数据库为准，Redis 中按比较对象保存阈值索引：
+// alerts:up:<subject> 和 alerts:down:<subject> 是向上和向下穿过时触发的提醒，分数为阈值，
+// subject 为 token:<代币>、pair:<ID> 或 change:<代币>:<窗口>。每次更新只取出上一个值和当前值之间的阈值，
+// 不扫描其他提醒；alert_last:<subject> 保存上一个值，乱序到达的旧更新被忽略
+type AlertService struct {
+	redisClient *redis.Client
+	store       repository.Store
+	candles     *CandleService
+	cfg         config.AlertsConfig
+	notifiers   []AlertNotifier
+
+	pairs      sync.Map
+	deliveries chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewAlertService candles 为空时不支持 rise 和 drop 提醒
+func NewAlertService(redisClient *redis.Client, store repository.Store, candles *CandleService, cfg config.AlertsConfig, notifiers ...AlertNotifier) *AlertService {
+	return &AlertService{
+		redisClient: redisClient,
+		store:       store,
+		candles:     candles,
+		cfg:         cfg,
+		notifiers:   notifiers,
+		deliveries:  make(chan struct{}, alertDeliveries),
+	}
+}
+
+func tokenSubject(token string) string {
+	return "token:" + token
+}
+
+func pairSubject(pairID uint) string {
+	return fmt.Sprintf("pair:%d", pairID)
+}
+
+func changeSubject(token, window string) string {
+	return fmt.Sprintf("change:%s:%s", token, window)
+}
+
+func alertUpKey(subject string) string {
+	return "alerts:up:" + subject
+}
+
+func alertDownKey(subject string) string {
+	return "alerts:down:" + subject
+}
+
+func alertLastKey(subject string) string {
+	return "alert_last:" + subject
+}
+
+// alertPairsKey 有提醒的交易对，代币更新时据此重新计算交易对价格
+func alertPairsKey(token string) string {
+	return "alert_pairs:" + token
+}
+
+func alertCooldownKey(id uint) string {
+	return fmt.Sprintf("alert_cooldown:%d", id)
+}
+
+// alertIndex 提醒在索引中的位置；drop 的阈值以负数保存，与涨跌幅直接比较
+type alertIndex struct {
+	subject  string
+	score    float64
+	up, down bool
+}
+
+func indexOf(alert *models.PriceAlert) alertIndex {
+	switch alert.Condition {
+	case models.AlertConditionRise:
+		return alertIndex{subject: changeSubject(alert.Token, alert.Window), score: alert.Threshold, up: true}
+	case models.AlertConditionDrop:
+		return alertIndex{subject: changeSubject(alert.Token, alert.Window), score: -alert.Threshold, down: true}
+	}
+	subject := tokenSubject(alert.Token)
+	if alert.PairID != 0 {
+		subject = pairSubject(alert.PairID)
+	}
+	return alertIndex{
+		subject: subject,
+		score:   alert.Threshold,
+		up:      alert.Condition != models.AlertConditionBelow,
+		down:    alert.Condition != models.AlertConditionAbove,
+	}
+}
+
+func alertTitle(alert *models.PriceAlert) string {
+	name := alert.Token
+	if alert.PairID != 0 {
+		name = fmt.Sprintf("pair %d", alert.PairID)
+	}
+	switch alert.Condition {
+	case models.AlertConditionRise:
+		return fmt.Sprintf("%s rises %g%% in %s", name, alert.Threshold, alert.Window)
+	case models.AlertConditionDrop:
+		return fmt.Sprintf("%s drops %g%% in %s", name, alert.Threshold, alert.Window)
+	case models.AlertConditionCross:
+		return fmt.Sprintf("%s crosses %g", name, alert.Threshold)
+	default:
+		return fmt.Sprintf("%s %s %g", name, alert.Condition, alert.Threshold)
+	}
+}
+
+// apply 校验 input 并写入 alert
+func (s *AlertService) apply(alert *models.PriceAlert, input AlertInput) error {
+	if (input.Token == "") == (input.PairID == 0) {
+		return fmt.Errorf("%w: exactly one of token and pair_id is required", ErrInvalidAlert)
+	}
+	if len(input.Token) > 64 || len(input.Note) > 255 || len(input.WebhookURL) > 512 {
+		return fmt.Errorf("%w: token, note or webhook_url is too long", ErrInvalidAlert)
+	}
+	if !(input.Threshold > 0) || math.IsInf(input.Threshold, 0) {
+		return fmt.Errorf("%w: threshold must be positive", ErrInvalidAlert)
+	}
+	switch input.Condition {
+	case models.AlertConditionAbove, models.AlertConditionBelow, models.AlertConditionCross:
+		if input.Window != "" {
+			return fmt.Errorf("%w: window is only used by rise and drop", ErrInvalidAlert)
+		}
+	case models.AlertConditionRise, models.AlertConditionDrop:
+		if s.candles == nil {
+			return fmt.Errorf("%w: %s alerts are not available", ErrInvalidAlert, input.Condition)
+		}
+		if input.Token == "" {
+			return fmt.Errorf("%w: %s alerts require a token", ErrInvalidAlert, input.Condition)
+		}
+		if !validAlertWindow(input.Window) {
+			return fmt.Errorf("%w: window must be one of %v", ErrInvalidAlert, AlertWindows)
+		}
+		if input.Condition == models.AlertConditionDrop && input.Threshold >= 100 {
+			return fmt.Errorf("%w: drop threshold must be less than 100", ErrInvalidAlert)
+		}
+	default:
+		return fmt.Errorf("%w: unknown condition %q", ErrInvalidAlert, input.Condition)
+	}
+	if input.PairID != 0 {
+		if _, err := s.pair(input.PairID); err != nil {
+			return fmt.Errorf("%w: pair %d not found", ErrInvalidAlert, input.PairID)
+		}
+	}
+
+	cooldown := time.Duration(input.CooldownSeconds) * time.Second
+	if input.CooldownSeconds == 0 {
+		cooldown = s.cfg.DefaultCooldown
+	}
+	if cooldown < s.cfg.MinCooldown {
+		return fmt.Errorf("%w: cooldown must be at least %s", ErrInvalidAlert, s.cfg.MinCooldown)
+	}
+	if input.WebhookURL != "" {
+		u, err := url.Parse(input.WebhookURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%w: webhook_url must be an http or https url", ErrInvalidAlert)
+		}
+	}
+
+	alert.Token = input.Token
+	alert.PairID = input.PairID
+	alert.Condition = input.Condition
+	alert.Threshold = input.Threshold
+	alert.Window = input.Window
+	alert.CooldownSeconds = int64(cooldown / time.Second)
+	alert.WebhookURL = input.WebhookURL
+	alert.Note = input.Note
+	alert.Active = input.Active
+	return nil
+}
+
+func validAlertWindow(window string) bool {
+	for _, w := range AlertWindows {
+		if w == window {
+			return true
+		}
+	}
+	return false
+}
+
+// pair 交易对的代币不会改变，查到后缓存在内存中
+func (s *AlertService) pair(id uint) (*models.TradingPair, error) {
+	if cached, ok := s.pairs.Load(id); ok {
+		return cached.(*models.TradingPair), nil
+	}
+	pair, err := s.store.Pairs().FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	s.pairs.Store(id, pair)
+	return pair, nil
+}
+
+// index 把有效的提醒加入索引
+func (s *AlertService) index(ctx context.Context, pipe redis.Pipeliner, alert *models.PriceAlert) error {
+	if !alert.Active {
+		return nil
+	}
+	idx := indexOf(alert)
+	member := &redis.Z{Score: idx.score, Member: alert.ID}
+	if idx.up {
+		pipe.ZAdd(ctx, alertUpKey(idx.subject), member)
+	}
+	if idx.down {
+		pipe.ZAdd(ctx, alertDownKey(idx.subject), member)
+	}
+	if alert.PairID != 0 {
+		pair, err := s.pair(alert.PairID)
+		if err != nil {
+			return err
+		}
+		pipe.SAdd(ctx, alertPairsKey(pair.Token0), alert.PairID)
+		pipe.SAdd(ctx, alertPairsKey(pair.Token1), alert.PairID)
+	}
+	return nil
+}
+
+// unindex 把提醒移出索引；交易对的 alert_pairs 成员保留，没有提醒时只多一次比较
+func unindex(ctx context.Context, pipe redis.Pipeliner, alert *models.PriceAlert) {
+	idx := indexOf(alert)
+	pipe.ZRem(ctx, alertUpKey(idx.subject), alert.ID)
+	pipe.ZRem(ctx, alertDownKey(idx.subject), alert.ID)
+}
+
+func (s *AlertService) reindex(ctx context.Context, old, alert *models.PriceAlert) error {
+	pipe := s.redisClient.TxPipeline()
+	if old != nil {
+		unindex(ctx, pipe, old)
+	}
+	if alert != nil {
+		if err := s.index(ctx, pipe, alert); err != nil {
+			return err
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to update alert index: %v", err)
+	}
+	return nil
+}
+
+// RebuildIndex 把数据库中所有有效的提醒写入索引，用于启动时补齐 Redis 中缺少的数据
+func (s *AlertService) RebuildIndex(ctx context.Context) error {
+	alerts, err := s.store.Alerts().ListActive(ctx)
+	if err != nil {
+		return err
+	}
+	pipe := s.redisClient.Pipeline()
+	for i := range alerts {
+		if err := s.index(ctx, pipe, &alerts[i]); err != nil {
+			log.Printf("Error indexing alert %d: %v", alerts[i].ID, err)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to rebuild alert index: %v", err)
+	}
+	return nil
+}
+
+// newWebhookSecret 生成提醒签名 webhook 请求体使用的密钥
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// CreateAlert 创建提醒并生成 webhook 签名密钥，密钥只在返回值中出现这一次
+func (s *AlertService) CreateAlert(ctx context.Context, userID uint, input AlertInput) (*models.PriceAlert, error) {
+	count, err := s.store.Alerts().CountByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= int64(s.cfg.MaxPerUser) {
+		return nil, fmt.Errorf("%w: at most %d alerts per user", ErrTooManyAlerts, s.cfg.MaxPerUser)
+	}
+	alert := &models.PriceAlert{UserID: userID}
+	if err := s.apply(alert, input); err != nil {
+		return nil, err
+	}
+	if alert.WebhookSecret, err = newWebhookSecret(); err != nil {
+		return nil, err
+	}
+	if err := s.store.Alerts().Create(alert); err != nil {
+		return nil, fmt.Errorf("failed to create alert: %v", err)
+	}
+	if err := s.reindex(ctx, nil, alert); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+func (s *AlertService) GetAlert(userID, id uint) (*models.PriceAlert, error) {
+	alert, err := s.store.Alerts().FindByID(userID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrAlertNotFound
+	}
+	return alert, err
+}
+
+func (s *AlertService) ListAlerts(ctx context.Context, userID uint) ([]models.PriceAlert, error) {
+	return s.store.Alerts().ListByUser(ctx, userID)
+}
+
+// UpdateAlert 用 input 替换提醒的设置，触发次数和时间保留
+func (s *AlertService) UpdateAlert(ctx context.Context, userID, id uint, input AlertInput) (*models.PriceAlert, error) {
+	alert, err := s.GetAlert(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	old := *alert
+	if err := s.apply(alert, input); err != nil {
+		return nil, err
+	}
+	if err := s.store.Alerts().Save(alert); err != nil {
+		return nil, fmt.Errorf("failed to update alert: %v", err)
+	}
+	if err := s.reindex(ctx, &old, alert); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+// RotateWebhookSecret 为提醒生成新的 webhook 签名密钥，旧密钥立即失效
+func (s *AlertService) RotateWebhookSecret(userID, id uint) (*models.PriceAlert, error) {
+	alert, err := s.GetAlert(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.WebhookSecret, err = newWebhookSecret(); err != nil {
+		return nil, err
+	}
+	if err := s.store.Alerts().Save(alert); err != nil {
+		return nil, fmt.Errorf("failed to update alert: %v", err)
+	}
+	return alert, nil
+}
+
+func (s *AlertService) DeleteAlert(ctx context.Context, userID, id uint) error {
+	alert, err := s.GetAlert(userID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Alerts().Delete(userID, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrAlertNotFound
+		}
+		return err
+	}
+	return s.reindex(ctx, alert, nil)
+}
+
+// Notifications 返回用户最近的 limit 条站内信和未读数量
+func (s *AlertService) Notifications(ctx context.Context, userID uint, unreadOnly bool, limit int) ([]models.Notification, int64, error) {
+	notifications, err := s.store.Notifications().ListByUser(ctx, userID, unreadOnly, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	unread, err := s.store.Notifications().CountUnread(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return notifications, unread, nil
+}
+
+func (s *AlertService) MarkNotificationRead(userID, id uint) error {
+	err := s.store.Notifications().MarkRead(userID, id, time.Now())
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrNotificationNotFound
+	}
+	return err
+}
+
+// alertValue alert_last 中保存的上一个值
+type alertValue struct {
+	Value     float64 `json:"value"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// advanceScript 保存比较对象的最新值并返回上一个值，时间戳不比已保存的新时返回 false
+var advanceScript = redis.NewScript(`
+local saved = redis.call('GET', KEYS[1])
+if saved and cjson.decode(saved).timestamp >= tonumber(ARGV[2]) then
+	return false
+end
+redis.call('SET', KEYS[1], ARGV[1])
+return saved or ''
+`)
+
+// advance 记录 subject 的新值，返回上一个值；第一次记录或更新过旧时 ok 为 false
+func (s *AlertService) advance(ctx context.Context, subject string, value float64, at int64) (prev float64, ok bool, err error) {
+	data, err := json.Marshal(alertValue{Value: value, Timestamp: at})
+	if err != nil {
+		return 0, false, err
+	}
+	saved, err := advanceScript.Run(ctx, s.redisClient, []string{alertLastKey(subject)}, data, at).Text()
+	if errors.Is(err, redis.Nil) || saved == "" {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to update alert state: %v", err)
+	}
+	var last alertValue
+	if err := json.Unmarshal([]byte(saved), &last); err != nil {
+		return 0, false, nil
+	}
+	return last.Value, true, nil
+}
+
+// alertHit 索引中被穿过的一个阈值
+type alertHit struct {
+	id      uint
+	key     string
+	subject string
+	prev    float64
+	value   float64
+	price   float64
+}
+
+// crossed 返回 subject 从 prev 变为 value 时穿过的提醒：向上为 (prev, value]，向下为 [value, prev)
+func (s *AlertService) crossed(ctx context.Context, subject string, prev, value, price float64) ([]alertHit, error) {
+	var key string
+	var by redis.ZRangeBy
+	format := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+	switch {
+	case value > prev:
+		key = alertUpKey(subject)
+		by = redis.ZRangeBy{Min: "(" + format(prev), Max: format(value)}
+	case value < prev:
+		key = alertDownKey(subject)
+		by = redis.ZRangeBy{Min: format(value), Max: "(" + format(prev)}
+	default:
+		return nil, nil
+	}
+	members, err := s.redisClient.ZRangeByScore(ctx, key, &by).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alerts: %v", err)
+	}
+	hits := make([]alertHit, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.ParseUint(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		hits = append(hits, alertHit{id: uint(id), key: key, subject: subject, prev: prev, value: value, price: price})
+	}
+	return hits, nil
+}
+
+// Evaluate 检查 update 触发的提醒：代币价格、包含该代币的交易对价格和各时间窗口的涨跌幅。
+// 通知在后台发送，不阻塞价格更新
+func (s *AlertService) Evaluate(ctx context.Context, update PriceUpdate) error {
+	at := update.Timestamp
+	var hits []alertHit
+
+	subject := tokenSubject(update.Token)
+	prev, ok, err := s.advance(ctx, subject, update.Price, at)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// 旧的更新不影响交易对和涨跌幅
+		last, err := s.lastValue(ctx, subject)
+		if err != nil || last == nil || last.Timestamp != at {
+			return err
+		}
+	} else {
+		crossed, err := s.crossed(ctx, subject, prev, update.Price, update.Price)
+		if err != nil {
+			return err
+		}
+		hits = append(hits, crossed...)
+	}
+
+	changes, err := s.changeHits(ctx, update)
+	if err != nil {
+		return err
+	}
+	hits = append(hits, changes...)
+	pairs, err := s.pairHits(ctx, update)
+	if err != nil {
+		return err
+	}
+	hits = append(hits, pairs...)
+
+	return s.fire(ctx, hits, at)
+}
+
+func (s *AlertService) lastValue(ctx context.Context, subject string) (*alertValue, error) {
+	saved, err := s.redisClient.Get(ctx, alertLastKey(subject)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alert state: %v", err)
+	}
+	var last alertValue
+	if err := json.Unmarshal(saved, &last); err != nil {
+		return nil, nil
+	}
+	return &last, nil
+}
+
+// changeHits 只计算有提醒的时间窗口的涨跌幅
+func (s *AlertService) changeHits(ctx context.Context, update PriceUpdate) ([]alertHit, error) {
+	if s.candles == nil {
+		return nil, nil
+	}
+	pipe := s.redisClient.Pipeline()
+	counts := make([]*redis.IntCmd, len(AlertWindows))
+	for i, window := range AlertWindows {
+		subject := changeSubject(update.Token, window)
+		counts[i] = pipe.Exists(ctx, alertUpKey(subject), alertDownKey(subject))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get alerts: %v", err)
+	}
+
+	var hits []alertHit
+	for i, window := range AlertWindows {
+		if counts[i].Val() == 0 {
+			continue
+		}
+		duration, _ := time.ParseDuration(window)
+		ref, ok, err := s.candles.PriceAt(ctx, update.Token, update.Timestamp-duration.Milliseconds())
+		if err != nil {
+			return nil, err
+		}
+		if !ok || ref <= 0 {
+			continue
+		}
+		change := (update.Price - ref) / ref * 100
+		subject := changeSubject(update.Token, window)
+		prev, ok, err := s.advance(ctx, subject, change, update.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		crossed, err := s.crossed(ctx, subject, prev, change, update.Price)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, crossed...)
+	}
+	return hits, nil
+}
+
+// pairHits 用本次更新和另一个代币最近的价格计算交易对价格
+func (s *AlertService) pairHits(ctx context.Context, update PriceUpdate) ([]alertHit, error) {
+	members, err := s.redisClient.SMembers(ctx, alertPairsKey(update.Token)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alert pairs: %v", err)
+	}
+	var hits []alertHit
+	for _, member := range members {
+		id, err := strconv.ParseUint(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		pair, err := s.pair(uint(id))
+		if err != nil {
+			continue
+		}
+		other := pair.Token1
+		if update.Token == pair.Token1 {
+			other = pair.Token0
+		}
+		last, err := s.lastValue(ctx, tokenSubject(other))
+		if err != nil {
+			return nil, err
+		}
+		if last == nil || last.Value <= 0 {
+			continue
+		}
+		price := update.Price / last.Value
+		if update.Token == pair.Token1 {
+			price = last.Value / update.Price
+		}
+		subject := pairSubject(pair.ID)
+		prev, ok, err := s.advance(ctx, subject, price, update.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		crossed, err := s.crossed(ctx, subject, prev, price, price)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, crossed...)
+	}
+	return hits, nil
+}
+
+// matches 检查索引中的命中是否与提醒当前的设置一致
+func (h alertHit) matches(alert *models.PriceAlert) bool {
+	idx := indexOf(alert)
+	if h.value > h.prev {
+		return idx.up && h.key == alertUpKey(h.subject) && idx.score > h.prev && idx.score <= h.value
+	}
+	return idx.down && h.key == alertDownKey(h.subject) && idx.score >= h.value && idx.score < h.prev
+}
+
+// fire 对不在冷却中的提醒记录触发并发送通知，冷却在 Redis 中设置，多个实例只会触发一次
+func (s *AlertService) fire(ctx context.Context, hits []alertHit, at int64) error {
+	if len(hits) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.id)
+	}
+	alerts, err := s.store.Alerts().FindByIDs(ids)
+	if err != nil {
+		return err
+	}
+	found := make(map[uint]*models.PriceAlert, len(alerts))
+	for i := range alerts {
+		found[alerts[i].ID] = &alerts[i]
+	}
+
+	triggeredAt := time.UnixMilli(at)
+	for _, hit := range hits {
+		alert := found[hit.id]
+		if alert == nil || !alert.Active || indexOf(alert).subject != hit.subject {
+			if err := s.redisClient.ZRem(ctx, hit.key, hit.id).Err(); err != nil {
+				return fmt.Errorf("failed to remove stale alert: %v", err)
+			}
+			continue
+		}
+		// 阈值在查询后被修改
+		if !hit.matches(alert) {
+			continue
+		}
+		cooldown := time.Duration(alert.CooldownSeconds) * time.Second
+		set, err := s.redisClient.SetNX(ctx, alertCooldownKey(alert.ID), at, cooldown).Result()
+		if err != nil {
+			return fmt.Errorf("failed to set alert cooldown: %v", err)
+		}
+		if !set {
+			continue
+		}
+		if err := s.store.Alerts().RecordTrigger(alert.ID, triggeredAt); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				continue
+			}
+			return err
+		}
+		s.dispatch(alert, s.event(alert, hit, at))
+	}
+	return nil
+}
+
+func (s *AlertService) event(alert *models.PriceAlert, hit alertHit, at int64) *AlertEvent {
+	event := &AlertEvent{
+		AlertID:   alert.ID,
+		UserID:    alert.UserID,
+		Token:     alert.Token,
+		PairID:    alert.PairID,
+		Condition: alert.Condition,
+		Threshold: alert.Threshold,
+		Window:    alert.Window,
+		Previous:  hit.prev,
+		Value:     hit.value,
+		Price:     hit.price,
+		Timestamp: at,
+		Title:     alertTitle(alert),
+		Note:      alert.Note,
+	}
+	when := time.UnixMilli(at).UTC().Format(time.RFC3339)
+	switch alert.Condition {
+	case models.AlertConditionRise, models.AlertConditionDrop:
+		event.Message = fmt.Sprintf("price %g, %+.2f%% in %s at %s", hit.price, hit.value, alert.Window, when)
+	default:
+		event.Message = fmt.Sprintf("price %g at %s", hit.price, when)
+	}
+	return event
+}
+
+// dispatch 在后台把 event 发给所有通道，同时发送的数量不超过 alertDeliveries
+func (s *AlertService) dispatch(alert *models.PriceAlert, event *AlertEvent) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.deliveries <- struct{}{}
+		defer func() { <-s.deliveries }()
+		for _, notifier := range s.notifiers {
+			if err := notifier.Notify(context.Background(), alert, event); err != nil {
+				log.Printf("Error sending alert %d: %v", alert.ID, err)
+			}
+		}
+	}()
+}
+
+// Wait 等待已触发的通知发送完成
+func (s *AlertService) Wait() {
+	s.wg.Wait()
+}
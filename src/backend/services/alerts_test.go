@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"defi-backend/config"
+	"defi-backend/models"
+	"defi-backend/repository"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func testAlertsConfig() config.AlertsConfig {
+	return config.AlertsConfig{
+		DefaultCooldown:      time.Minute,
+		MinCooldown:          time.Second,
+		MaxPerUser:           10,
+		WebhookTimeout:       time.Second,
+		AllowPrivateWebhooks: true,
+	}
+}
+
+func newAlertTest(t *testing.T, notifiers ...AlertNotifier) (*AlertService, repository.Store, *miniredis.Miniredis) {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store := repository.NewMemoryStore()
+	if len(notifiers) == 0 {
+		notifiers = []AlertNotifier{NewInboxNotifier(store)}
+	}
+	return NewAlertService(client, store, nil, testAlertsConfig(), notifiers...), store, mr
+}
+
+// evaluate 依次提交 ETH 价格并等待通知发送完成，时间戳从 base 开始每次加 1 秒
+func evaluate(t *testing.T, s *AlertService, base int64, prices ...float64) {
+	t.Helper()
+	for i, price := range prices {
+		if err := s.Evaluate(context.Background(), PriceUpdate{Token: "ETH", Price: price, Timestamp: base + int64(i)*1000}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Wait()
+}
+
+func triggerCounts(t *testing.T, store repository.Store, alerts ...*models.PriceAlert) []int64 {
+	t.Helper()
+	counts := make([]int64, len(alerts))
+	for i, alert := range alerts {
+		saved, err := store.Alerts().FindByID(alert.UserID, alert.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[i] = saved.TriggerCount
+	}
+	return counts
+}
+
+func TestAlertsFireOnCrossing(t *testing.T) {
+	s, store, mr := newAlertTest(t)
+	ctx := context.Background()
+	create := func(condition string, threshold float64) *models.PriceAlert {
+		alert, err := s.CreateAlert(ctx, 1, AlertInput{Token: "ETH", Condition: condition, Threshold: threshold, CooldownSeconds: 1, Active: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return alert
+	}
+	above := create(models.AlertConditionAbove, 100)
+	below := create(models.AlertConditionBelow, 90)
+	cross := create(models.AlertConditionCross, 95)
+
+	// 第一个价格只作为起点；已经满足条件的提醒不触发
+	evaluate(t, s, 1_700_000_000_000, 85, 101)
+	if got := triggerCounts(t, store, above, below, cross); got[0] != 1 || got[1] != 0 || got[2] != 1 {
+		t.Fatalf("trigger counts after rising to 101 = %v, want [1 0 1]", got)
+	}
+
+	mr.FastForward(time.Second)
+	evaluate(t, s, 1_700_000_010_000, 100, 89)
+	if got := triggerCounts(t, store, above, below, cross); got[0] != 1 || got[1] != 1 || got[2] != 2 {
+		t.Fatalf("trigger counts after falling to 89 = %v, want [1 1 2]", got)
+	}
+
+	notifications, unread, err := s.Notifications(ctx, 1, true, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 4 || unread != 4 {
+		t.Fatalf("notifications = %d, unread = %d, want 4", len(notifications), unread)
+	}
+}
+
+func TestAlertsRespectCooldown(t *testing.T) {
+	s, store, mr := newAlertTest(t)
+	alert, err := s.CreateAlert(context.Background(), 1, AlertInput{Token: "ETH", Condition: models.AlertConditionCross, Threshold: 100, CooldownSeconds: 60, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evaluate(t, s, 1_700_000_000_000, 99, 101, 99, 101)
+	if got := triggerCounts(t, store, alert); got[0] != 1 {
+		t.Fatalf("trigger count within cooldown = %d, want 1", got[0])
+	}
+
+	mr.FastForward(time.Minute)
+	evaluate(t, s, 1_700_000_100_000, 99)
+	if got := triggerCounts(t, store, alert); got[0] != 2 {
+		t.Fatalf("trigger count after cooldown = %d, want 2", got[0])
+	}
+}
+
+func TestAlertsIgnoreOutOfOrderUpdates(t *testing.T) {
+	s, store, _ := newAlertTest(t)
+	alert, err := s.CreateAlert(context.Background(), 1, AlertInput{Token: "ETH", Condition: models.AlertConditionAbove, Threshold: 100, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evaluate(t, s, 1_700_000_010_000, 90)
+	// 比已保存的价格更早的更新不改变上一个值，也不触发
+	evaluate(t, s, 1_700_000_000_000, 110)
+	if got := triggerCounts(t, store, alert); got[0] != 0 {
+		t.Fatalf("trigger count after stale update = %d, want 0", got[0])
+	}
+	evaluate(t, s, 1_700_000_020_000, 105)
+	if got := triggerCounts(t, store, alert); got[0] != 1 {
+		t.Fatalf("trigger count = %d, want 1", got[0])
+	}
+}
+
+func TestWebhookSignedWithAlertSecret(t *testing.T) {
+	signatures := make(chan string, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signatures <- r.Header.Get("X-Alert-Signature")
+		bodies <- body
+	}))
+	defer server.Close()
+
+	s, _, _ := newAlertTest(t, NewWebhookNotifier(testAlertsConfig()))
+	ctx := context.Background()
+	alert, err := s.CreateAlert(ctx, 1, AlertInput{Token: "ETH", Condition: models.AlertConditionAbove, Threshold: 100, WebhookURL: server.URL, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.CreateAlert(ctx, 1, AlertInput{Token: "BTC", Condition: models.AlertConditionAbove, Threshold: 100, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alert.WebhookSecret) != 64 || alert.WebhookSecret == other.WebhookSecret {
+		t.Fatalf("webhook secrets %q and %q, want distinct 32 byte secrets", alert.WebhookSecret, other.WebhookSecret)
+	}
+
+	rotated, err := s.RotateWebhookSecret(1, alert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.WebhookSecret == alert.WebhookSecret {
+		t.Fatal("rotated webhook secret did not change")
+	}
+
+	evaluate(t, s, 1_700_000_000_000, 90, 110)
+	mac := hmac.New(sha256.New, []byte(rotated.WebhookSecret))
+	mac.Write(<-bodies)
+	if got, want := <-signatures, "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Fatalf("signature = %q, want %q", got, want)
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	for ip, want := range map[string]bool{
+		"8.8.8.8":           true,
+		"2001:4860::8888":   true,
+		"127.0.0.1":         false,
+		"10.1.2.3":          false,
+		"192.168.1.1":       false,
+		"169.254.169.254":   false,
+		"100.64.1.1":        false,
+		"100.127.255.255":   false,
+		"100.128.0.1":       true,
+		"0.1.2.3":           false,
+		"0.0.0.0":           false,
+		"::1":               false,
+		"::ffff:100.64.0.1": false,
+	} {
+		if got := publicIP(net.ParseIP(ip)); got != want {
+			t.Errorf("publicIP(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
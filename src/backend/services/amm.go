@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"defi-backend/models"
+)
+
+// 与 Dex.sol getAmountOut 保持一致：收取 0.3% 手续费
+const (
+	SwapFeeNumerator   = 997
+	SwapFeeDenominator = 1000
+)
+
+var (
+	ErrInsufficientInputAmount = errors.New("INSUFFICIENT_INPUT_AMOUNT")
+	ErrInsufficientLiquidity   = errors.New("INSUFFICIENT_LIQUIDITY")
+	ErrInsufficientOutput      = errors.New("insufficient output amount")
+	ErrPoolNotFound            = errors.New("pool does not exist")
+)
+
+// SwapQuote 兑换报价，价格均以代币单位 (已按精度换算) 表示
+type SwapQuote struct {
+	PairID         uint          `json:"pair_id"`
+	TokenIn        string        `json:"token_in"`
+	TokenOut       string        `json:"token_out"`
+	AmountIn       models.Amount `json:"amount_in"`
+	AmountOut      models.Amount `json:"amount_out"`
+	Fee            models.Amount `json:"fee"`
+	ReserveIn      models.Amount `json:"reserve_in"`
+	ReserveOut     models.Amount `json:"reserve_out"`
+	SpotPrice      float64       `json:"spot_price"`
+	ExecutionPrice float64       `json:"execution_price"`
+	PriceImpact    float64       `json:"price_impact"`
+}
+
+// GetAmountOut 复刻 Dex.sol 的 getAmountOut，使用整数除法向下取整
+func GetAmountOut(amountIn, reserveIn, reserveOut *big.Int) (*big.Int, error) {
+	if amountIn == nil || amountIn.Sign() <= 0 {
+		return nil, ErrInsufficientInputAmount
+	}
+	if reserveIn == nil || reserveOut == nil || reserveIn.Sign() <= 0 || reserveOut.Sign() <= 0 {
+		return nil, ErrInsufficientLiquidity
+	}
+
+	amountInWithFee := new(big.Int).Mul(amountIn, big.NewInt(SwapFeeNumerator))
+	numerator := new(big.Int).Mul(amountInWithFee, reserveOut)
+	denominator := new(big.Int).Mul(reserveIn, big.NewInt(SwapFeeDenominator))
+	denominator.Add(denominator, amountInWithFee)
+
+	return numerator.Quo(numerator, denominator), nil
+}
+
+// SwapFee 计算 amountIn 中被收取的手续费部分
+func SwapFee(amountIn *big.Int) *big.Int {
+	fee := new(big.Int).Mul(amountIn, big.NewInt(SwapFeeDenominator-SwapFeeNumerator))
+	return fee.Quo(fee, big.NewInt(SwapFeeDenominator))
+}
+
+// parseRaw 解析以最小单位保存的十进制整数，例如池子储备量
+func parseRaw(s string) (*big.Int, error) {
+	amount, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount: %q", s)
+	}
+	return amount, nil
+}
+
+// PairReserves 返回交易对的储备量 (token0Reserve, token1Reserve)
+func PairReserves(pair *models.TradingPair) (*big.Int, *big.Int, error) {
+	reserve0, err := parseRaw(pair.Reserve0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid reserve0 for pair %d: %v", pair.ID, err)
+	}
+	reserve1, err := parseRaw(pair.Reserve1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid reserve1 for pair %d: %v", pair.ID, err)
+	}
+	return reserve0, reserve1, nil
+}
+
+// poolExists 对应 Dex.sol swap 中的 require(pool.totalSupply > 0, "Pool does not exist")，
+// 停用的交易对同样视为不存在
+func poolExists(pair *models.TradingPair) bool {
+	if !pair.IsActive {
+		return false
+	}
+	supply, err := parseRaw(pair.TotalSupply)
+	return err == nil && supply.Sign() > 0
+}
+
+// QuotePair 针对单个交易对计算兑换报价，amountIn 会换算到 Token0 的精度
+func QuotePair(pair *models.TradingPair, tokenIn string, amountIn models.Amount) (*SwapQuote, error) {
+	if !poolExists(pair) {
+		return nil, ErrPoolNotFound
+	}
+	// Dex.sol 的池子只能按 pools[tokenIn][tokenOut] 方向兑换
+	if tokenIn != pair.Token0 {
+		return nil, fmt.Errorf("pair %s only supports swaps from %s", pair.Symbol, pair.Token0)
+	}
+
+	amountIn, err := amountIn.WithDecimals(pair.Decimals0)
+	if err != nil {
+		return nil, err
+	}
+	reserveIn, reserveOut, err := PairReserves(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	rawIn := amountIn.Raw()
+	rawOut, err := GetAmountOut(rawIn, reserveIn, reserveOut)
+	if err != nil {
+		return nil, err
+	}
+	if rawOut.Sign() <= 0 {
+		return nil, ErrInsufficientOutput
+	}
+
+	quote := &SwapQuote{
+		PairID:     pair.ID,
+		TokenIn:    pair.Token0,
+		TokenOut:   pair.Token1,
+		AmountIn:   amountIn,
+		AmountOut:  models.NewAmount(rawOut, pair.Decimals1),
+		Fee:        models.NewAmount(SwapFee(rawIn), pair.Decimals0),
+		ReserveIn:  models.NewAmount(reserveIn, pair.Decimals0),
+		ReserveOut: models.NewAmount(reserveOut, pair.Decimals1),
+	}
+
+	spot := new(big.Rat).Quo(quote.ReserveOut.Rat(), quote.ReserveIn.Rat())
+	execution := new(big.Rat).Quo(quote.AmountOut.Rat(), quote.AmountIn.Rat())
+	impact := new(big.Rat).Quo(execution, spot)
+	impact.Sub(big.NewRat(1, 1), impact)
+
+	quote.SpotPrice, _ = spot.Float64()
+	quote.ExecutionPrice, _ = execution.Float64()
+	quote.PriceImpact, _ = impact.Float64()
+	return quote, nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"defi-backend/models"
+	"defi-backend/repository"
+)
+
+func TestGetAmountOut(t *testing.T) {
+	cases := []struct {
+		amountIn, reserveIn, reserveOut int64
+		want                            int64
+	}{
+		// 997000000000 / 1000997000 向下取整
+		{1000, 1_000_000, 1_000_000, 996},
+		{1_000_000, 1_000_000, 1_000_000, 499_248},
+		{1, 1_000_000, 1_000_000, 0},
+	}
+	for _, c := range cases {
+		got, err := GetAmountOut(big.NewInt(c.amountIn), big.NewInt(c.reserveIn), big.NewInt(c.reserveOut))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Int64() != c.want {
+			t.Errorf("GetAmountOut(%d, %d, %d) = %s, want %d", c.amountIn, c.reserveIn, c.reserveOut, got, c.want)
+		}
+	}
+
+	if _, err := GetAmountOut(big.NewInt(0), big.NewInt(1), big.NewInt(1)); !errors.Is(err, ErrInsufficientInputAmount) {
+		t.Errorf("zero input err = %v, want ErrInsufficientInputAmount", err)
+	}
+	if _, err := GetAmountOut(big.NewInt(1), big.NewInt(0), big.NewInt(1)); !errors.Is(err, ErrInsufficientLiquidity) {
+		t.Errorf("empty reserve err = %v, want ErrInsufficientLiquidity", err)
+	}
+}
+
+// usdcPair 1000 ETH (18 位) 对 2,000,000 USDC (6 位)
+func usdcPair() *models.TradingPair {
+	return &models.TradingPair{
+		Symbol:      "ETH/USDC",
+		Token0:      "ETH",
+		Token1:      "USDC",
+		Decimals0:   18,
+		Decimals1:   6,
+		Reserve0:    "1000000000000000000000",
+		Reserve1:    "2000000000000",
+		TotalSupply: "44721359549995793",
+		IsActive:    true,
+	}
+}
+
+func TestQuotePair(t *testing.T) {
+	quote, err := QuotePair(usdcPair(), "ETH", units(t, "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1997 * 2e12 / 1000997 按 6 位精度向下取整
+	if got := quote.AmountOut.String(); got != "1992.013962" {
+		t.Fatalf("amount out = %s, want 1992.013962", got)
+	}
+	if got := quote.Fee.String(); got != "0.003000000000000000" {
+		t.Fatalf("fee = %s, want 0.003", got)
+	}
+	if quote.SpotPrice != 2000 {
+		t.Fatalf("spot price = %v, want 2000", quote.SpotPrice)
+	}
+	if quote.PriceImpact <= 0.003 || quote.PriceImpact > 0.005 {
+		t.Fatalf("price impact = %v, want fee plus slippage", quote.PriceImpact)
+	}
+
+	if _, err := QuotePair(usdcPair(), "USDC", units(t, "1")); err == nil {
+		t.Fatal("QuotePair accepted a swap against the pool direction")
+	}
+	inactive := usdcPair()
+	inactive.IsActive = false
+	if _, err := QuotePair(inactive, "ETH", units(t, "1")); !errors.Is(err, ErrPoolNotFound) {
+		t.Fatalf("inactive pair err = %v, want ErrPoolNotFound", err)
+	}
+	// Dex.sol 在没有 LP 份额或储备为空的池子上 revert
+	empty := usdcPair()
+	empty.TotalSupply = "0"
+	if _, err := QuotePair(empty, "ETH", units(t, "1")); !errors.Is(err, ErrPoolNotFound) {
+		t.Fatalf("pair without liquidity shares err = %v, want ErrPoolNotFound", err)
+	}
+	drained := usdcPair()
+	drained.Reserve0, drained.Reserve1 = "0", "0"
+	if _, err := QuotePair(drained, "ETH", units(t, "1")); !errors.Is(err, ErrInsufficientLiquidity) {
+		t.Fatalf("pair with empty reserves err = %v, want ErrInsufficientLiquidity", err)
+	}
+	tooPrecise, err := models.ParseUnits("0.0000000000000000001", 19)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := QuotePair(usdcPair(), "ETH", tooPrecise); !errors.Is(err, models.ErrInvalidAmount) {
+		t.Fatalf("amount beyond token precision err = %v, want ErrInvalidAmount", err)
+	}
+}
+
+func TestSwapMinAmountOut(t *testing.T) {
+	store := repository.NewMemoryStore()
+	pair := usdcPair()
+	if err := store.Pairs().Create(pair); err != nil {
+		t.Fatal(err)
+	}
+	defi := NewDefiService(store, nil)
+
+	minOut, err := models.ParseUnits("1993", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := defi.Swap(1, pair.ID, "ETH", units(t, "1"), minOut); !errors.Is(err, ErrInsufficientOutput) {
+		t.Fatalf("swap below min output err = %v, want ErrInsufficientOutput", err)
+	}
+
+	trade, quote, err := defi.Swap(1, pair.ID, "ETH", units(t, "1"), models.ZeroAmount(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trade.Amount.Cmp(quote.AmountIn) != 0 || trade.TotalValue.Cmp(quote.AmountOut) != 0 || trade.Status != "pending" {
+		t.Fatalf("trade = %+v does not match quote %+v", trade, quote)
+	}
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"defi-backend/models"
+	"defi-backend/repository"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// CandleInterval K 线周期，Retention 之前的 K 线会被清理，0 表示一直保留
+type CandleInterval struct {
+	Name      string
+	Duration  time.Duration
+	Retention time.Duration
+}
+
+var CandleIntervals = []CandleInterval{
+	{Name: "1m", Duration: time.Minute, Retention: 7 * 24 * time.Hour},
+	{Name: "5m", Duration: 5 * time.Minute, Retention: 30 * 24 * time.Hour},
+	{Name: "1h", Duration: time.Hour, Retention: 365 * 24 * time.Hour},
+	{Name: "1d", Duration: 24 * time.Hour},
+}
+
+// MaxCandles 单次查询最多返回的 K 线数量
+const MaxCandles = 1000
+
+var (
+	ErrInvalidCandleInterval = errors.New("invalid candle interval")
+	ErrInvalidCandleRange    = errors.New("invalid candle range")
+)
+
+func ParseCandleInterval(name string) (CandleInterval, error) {
+	for _, interval := range CandleIntervals {
+		if interval.Name == name {
+			return interval, nil
+		}
+	}
+	return CandleInterval{}, ErrInvalidCandleInterval
+}
+
+// open 返回 ts (Unix 毫秒) 所在周期的开始时间，按 UTC 对齐
+func (i CandleInterval) open(ts int64) int64 {
+	ms := i.Duration.Milliseconds()
+	return ts - ((ts%ms)+ms)%ms
+}
+
+// Candle 一根 OHLCV K 线，Time 为周期开始时间 (Unix 毫秒)。
+// 价格来自 PriceService，Volume 和 Trades 为周期内链上 swap 的 token0 成交量和笔数
+type Candle struct {
+	Time   int64         `json:"time"`
+	Open   float64       `json:"open"`
+	High   float64       `json:"high"`
+	Low    float64       `json:"low"`
+	Close  float64       `json:"close"`
+	Volume models.Amount `json:"volume"`
+	Trades int           `json:"trades"`
+}
+
+// CandleService 在价格更新时维护每个代币各周期的 OHLC，保存在 Redis：
+// candle:<token>:<interval>:<open> 是一根 K 线的 hash，candles:<token>:<interval> 是按开始时间排序的索引。
+// Redis 中只有价格，Volume 和 Trades 不落地，每次查询时由索引器写入的 swap 交易汇总，
+// 因此链重组后被标记为 orphaned 的交易自然不再计入；
+// Trade 只是通过接口提交的兑换，成交后会以 swap 交易出现，不重复统计
+type CandleService struct {
+	redisClient *redis.Client
+	store       repository.Store
+}
+
+func NewCandleService(redisClient *redis.Client, store repository.Store) *CandleService {
+	return &CandleService{
+		redisClient: redisClient,
+		store:       store,
+	}
+}
+
+func candleKey(token string, interval CandleInterval, open int64) string {
+	return fmt.Sprintf("candle:%s:%s:%d", token, interval.Name, open)
+}
+
+func candleIndexKey(token string, interval CandleInterval) string {
+	return fmt.Sprintf("candles:%s:%s", token, interval.Name)
+}
+
+// recordScript 把一个价格点合并进各周期的 K 线。合并只取最高、最低、最早和最晚的价格，
+// 同一个价格点重复写入不会改变结果，回填可以和实时更新交错执行。
+// KEYS 每个周期两个：K 线 hash 和索引；ARGV 为 price、ts，之后每个周期 open、expire_at、trim_before
+var recordScript = redis.NewScript(`
+local price, ts = tonumber(ARGV[1]), tonumber(ARGV[2])
+local n = 3
+for i = 1, #KEYS, 2 do
+	local candle, index = KEYS[i], KEYS[i + 1]
+	local open, expireAt, trimBefore = ARGV[n], tonumber(ARGV[n + 1]), ARGV[n + 2]
+	n = n + 3
+	local first = redis.call('HGET', candle, 'first')
+	if not first then
+		redis.call('HSET', candle, 'o', ARGV[1], 'h', ARGV[1], 'l', ARGV[1], 'c', ARGV[1], 'first', ARGV[2], 'last', ARGV[2])
+	else
+		if price > tonumber(redis.call('HGET', candle, 'h')) then
+			redis.call('HSET', candle, 'h', ARGV[1])
+		end
+		if price < tonumber(redis.call('HGET', candle, 'l')) then
+			redis.call('HSET', candle, 'l', ARGV[1])
+		end
+		if ts < tonumber(first) then
+			redis.call('HSET', candle, 'o', ARGV[1], 'first', ARGV[2])
+		end
+		if ts >= tonumber(redis.call('HGET', candle, 'last')) then
+			redis.call('HSET', candle, 'c', ARGV[1], 'last', ARGV[2])
+		end
+	end
+	redis.call('ZADD', index, open, open)
+	if expireAt > 0 then
+		redis.call('PEXPIREAT', candle, expireAt)
+		redis.call('ZREMRANGEBYSCORE', index, '-inf', '(' .. trimBefore)
+	end
+end
+return 0
+`)
+
+// Record 把一个价格点计入所有周期的 K 线，超出保留时间的周期直接跳过
+func (s *CandleService) Record(ctx context.Context, update PriceUpdate) error {
+	now := time.Now().UnixMilli()
+	var keys []string
+	args := []interface{}{strconv.FormatFloat(update.Price, 'g', -1, 64), update.Timestamp}
+	for _, interval := range CandleIntervals {
+		open := interval.open(update.Timestamp)
+		var expireAt, trimBefore int64
+		if interval.Retention > 0 {
+			expireAt = open + (interval.Duration + interval.Retention).Milliseconds()
+			if expireAt <= now {
+				continue
+			}
+			trimBefore = interval.open(now - interval.Retention.Milliseconds())
+		}
+		keys = append(keys, candleKey(update.Token, interval, open), candleIndexKey(update.Token, interval))
+		args = append(args, open, expireAt, trimBefore)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := recordScript.Run(ctx, s.redisClient, keys, args...).Err(); err != nil {
+		return fmt.Errorf("failed to update candles: %v", err)
+	}
+	return nil
+}
+
+// Candles 返回 token 在 [from, to) 内开始的 K 线，按时间升序，不包含成交量；
+// 没有价格更新的周期不返回
+func (s *CandleService) Candles(ctx context.Context, token string, interval CandleInterval, from, to int64) ([]Candle, error) {
+	opens, err := s.redisClient.ZRangeByScore(ctx, candleIndexKey(token, interval), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from, 10),
+		Max: "(" + strconv.FormatInt(to, 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get candles: %v", err)
+	}
+	return s.load(ctx, token, interval, opens)
+}
+
+// previous 返回 from 之前最近的一根 K 线，没有时返回 nil
+func (s *CandleService) previous(ctx context.Context, token string, interval CandleInterval, from int64) (*Candle, error) {
+	opens, err := s.redisClient.ZRevRangeByScore(ctx, candleIndexKey(token, interval), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "(" + strconv.FormatInt(from, 10),
+		Count: 1,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get candles: %v", err)
+	}
+	candles, err := s.load(ctx, token, interval, opens)
+	if err != nil || len(candles) == 0 {
+		return nil, err
+	}
+	return &candles[0], nil
+}
+
+// PriceAt 返回 at (Unix 毫秒) 时的价格，即 at 所在或之前最近的 1 分钟 K 线的收盘价，精度为 1 分钟；
+// 没有 K 线时返回 false
+func (s *CandleService) PriceAt(ctx context.Context, token string, at int64) (float64, bool, error) {
+	candle, err := s.previous(ctx, token, CandleIntervals[0], at+1)
+	if err != nil || candle == nil {
+		return 0, false, err
+	}
+	return candle.Close, true, nil
+}
+
+func (s *CandleService) load(ctx context.Context, token string, interval CandleInterval, opens []string) ([]Candle, error) {
+	if len(opens) == 0 {
+		return nil, nil
+	}
+	pipe := s.redisClient.Pipeline()
+	times := make([]int64, 0, len(opens))
+	var cmds []*redis.SliceCmd
+	for _, member := range opens {
+		open, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		times = append(times, open)
+		cmds = append(cmds, pipe.HMGet(ctx, candleKey(token, interval, open), "o", "h", "l", "c"))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get candles: %v", err)
+	}
+
+	candles := make([]Candle, 0, len(cmds))
+	for i, cmd := range cmds {
+		var prices [4]float64
+		ok := true
+		for j, value := range cmd.Val() {
+			str, isString := value.(string)
+			if !isString {
+				// 索引还没清理，K 线已经过期
+				ok = false
+				break
+			}
+			price, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				ok = false
+				break
+			}
+			prices[j] = price
+		}
+		if ok {
+			candles = append(candles, Candle{Time: times[i], Open: prices[0], High: prices[1], Low: prices[2], Close: prices[3]})
+		}
+	}
+	return candles, nil
+}
+
+// PairCandles 返回交易对 token0 的 K 线和 [from, to) 内的链上成交量。
+// 有成交但没有价格更新的周期以上一根 K 线的收盘价补齐，之前没有任何价格时不返回
+func (s *CandleService) PairCandles(ctx context.Context, pair *models.TradingPair, interval CandleInterval, from, to int64) ([]Candle, error) {
+	if from >= to || (to-from)/interval.Duration.Milliseconds() > MaxCandles {
+		return nil, ErrInvalidCandleRange
+	}
+	from = interval.open(from)
+
+	candles, err := s.Candles(ctx, pair.Token0, interval, from, to)
+	if err != nil {
+		return nil, err
+	}
+	swaps, err := s.store.Transactions().ListSwaps(ctx, pair.Token0, pair.Token1, time.UnixMilli(from), time.UnixMilli(to))
+	if err != nil {
+		return nil, err
+	}
+	zero := models.ZeroAmount(pair.Decimals0)
+	for i := range candles {
+		candles[i].Volume = zero
+	}
+	if len(swaps) == 0 {
+		return candles, nil
+	}
+
+	prev, err := s.previous(ctx, pair.Token0, interval, from)
+	if err != nil {
+		return nil, err
+	}
+	merged := make([]Candle, 0, len(candles))
+	next := 0
+	for _, swap := range swaps {
+		open := interval.open(swap.Timestamp.UnixMilli())
+		for next < len(candles) && candles[next].Time <= open {
+			merged = append(merged, candles[next])
+			next++
+		}
+		if len(merged) == 0 || merged[len(merged)-1].Time != open {
+			if len(merged) > 0 {
+				prev = &merged[len(merged)-1]
+			} else if prev == nil {
+				continue
+			}
+			price := prev.Close
+			merged = append(merged, Candle{Time: open, Open: price, High: price, Low: price, Close: price, Volume: zero})
+		}
+		amount := swap.AmountOut
+		if strings.EqualFold(swap.TokenIn, pair.Token0) {
+			amount = swap.AmountIn
+		}
+		candle := &merged[len(merged)-1]
+		candle.Volume = candle.Volume.Add(amount)
+		candle.Trades++
+	}
+	return append(merged, candles[next:]...), nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"defi-backend/models"
+	"defi-backend/repository"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newCandleTest(t *testing.T) (*PriceService, *CandleService, repository.Store) {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store := repository.NewMemoryStore()
+	candles := NewCandleService(client, store)
+	return NewPriceService(client, nil, candles, nil), candles, store
+}
+
+// minuteAgo 返回上一个整分钟的 Unix 毫秒，保证在 1 分钟 K 线的保留时间内
+func minuteAgo() int64 {
+	return time.Now().Add(-time.Minute).Truncate(time.Minute).UnixMilli()
+}
+
+func TestCandlesMergeOutOfOrderUpdates(t *testing.T) {
+	prices, candles, _ := newCandleTest(t)
+	ctx := context.Background()
+	open := minuteAgo()
+
+	for _, u := range []PriceUpdate{
+		{Price: 11, Timestamp: open + 30_000},
+		{Price: 10, Timestamp: open},
+		{Price: 12, Timestamp: open + 10_000},
+		{Price: 9, Timestamp: open + 20_000},
+		// 按 Unix 秒提交的更新
+		{Price: 13, Timestamp: (open + 40_000) / 1000},
+	} {
+		u.Token = "ETH"
+		if err := prices.UpdatePrice(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	interval, err := ParseCandleInterval("1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := candles.Candles(ctx, "ETH", interval, open, open+time.Minute.Milliseconds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Candle{Time: open, Open: 10, High: 13, Low: 9, Close: 13}
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("candles = %+v, want [%+v]", got, want)
+	}
+
+	if price, ok, err := candles.PriceAt(ctx, "ETH", open+time.Hour.Milliseconds()); err != nil || !ok || price != 13 {
+		t.Fatalf("PriceAt = %v, %v, %v, want 13", price, ok, err)
+	}
+}
+
+func TestUpdatePriceRejectsNegativeTimestamp(t *testing.T) {
+	prices, _, _ := newCandleTest(t)
+	if err := prices.UpdatePrice(PriceUpdate{Token: "ETH", Price: 1, Timestamp: -1}); !errors.Is(err, ErrInvalidTimestamp) {
+		t.Fatalf("err = %v, want ErrInvalidTimestamp", err)
+	}
+}
+
+func TestPairCandlesVolume(t *testing.T) {
+	prices, candles, store := newCandleTest(t)
+	ctx := context.Background()
+	open := minuteAgo() - time.Minute.Milliseconds()
+	pair := &models.TradingPair{Token0: "0xETH", Token1: "0xUSDC", Decimals0: 18, Decimals1: 6}
+
+	if err := prices.UpdatePrice(PriceUpdate{Token: pair.Token0, Price: 2000, Timestamp: open + 5_000}); err != nil {
+		t.Fatal(err)
+	}
+	swaps := []models.Transaction{
+		// 卖出 3 ETH
+		{TokenIn: "0xeth", TokenOut: pair.Token1, AmountIn: models.NewAmount(big.NewInt(3), 18), AmountOut: models.NewAmount(big.NewInt(6000), 6), TransactionHash: "0x01", Timestamp: time.UnixMilli(open + 10_000)},
+		// 买入 2 ETH
+		{TokenIn: pair.Token1, TokenOut: pair.Token0, AmountIn: models.NewAmount(big.NewInt(4000), 6), AmountOut: models.NewAmount(big.NewInt(2), 18), TransactionHash: "0x02", Timestamp: time.UnixMilli(open + 20_000)},
+		// 被链重组孤立，不计入
+		{TokenIn: pair.Token0, TokenOut: pair.Token1, AmountIn: models.NewAmount(big.NewInt(100), 18), AmountOut: models.NewAmount(big.NewInt(1), 6), TransactionHash: "0x03", Status: models.TransactionStatusOrphaned, Timestamp: time.UnixMilli(open + 30_000)},
+		// 下一分钟没有价格更新，用上一根 K 线的收盘价补齐
+		{TokenIn: pair.Token0, TokenOut: pair.Token1, AmountIn: models.NewAmount(big.NewInt(1), 18), AmountOut: models.NewAmount(big.NewInt(2000), 6), TransactionHash: "0x04", Timestamp: time.UnixMilli(open + 70_000)},
+	}
+	for i := range swaps {
+		swaps[i].Type = models.TransactionTypeSwap
+		if swaps[i].Status == "" {
+			swaps[i].Status = models.TransactionStatusConfirmed
+		}
+		if err := store.Transactions().Create(&swaps[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	interval, _ := ParseCandleInterval("1m")
+	got, err := candles.PairCandles(ctx, pair, interval, open, open+2*time.Minute.Milliseconds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("candles = %+v, want 2", got)
+	}
+	if got[0].Time != open || got[0].Close != 2000 || got[0].Volume.Raw().Int64() != 5 || got[0].Trades != 2 {
+		t.Fatalf("first candle = %+v, want close 2000, volume 5, 2 trades", got[0])
+	}
+	if got[1].Time != open+time.Minute.Milliseconds() || got[1].Open != 2000 || got[1].Volume.Raw().Int64() != 1 || got[1].Trades != 1 {
+		t.Fatalf("second candle = %+v, want filled at 2000 with volume 1", got[1])
+	}
+
+	if _, err := candles.PairCandles(ctx, pair, interval, open, open); !errors.Is(err, ErrInvalidCandleRange) {
+		t.Fatalf("empty range err = %v, want ErrInvalidCandleRange", err)
+	}
+}
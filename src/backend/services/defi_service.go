@@ -1,134 +1,449 @@
 package services
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
 	"time"
 
 	"defi-backend/models"
-
-	"gorm.io/gorm"
+	"defi-backend/repository"
 )
 
 type DefiService struct {
-	db *gorm.DB
+	store  repository.Store
+	blocks BlockNumberProvider
+	rates  marketRateOverrides
 }
 
-func NewDefiService(db *gorm.DB) *DefiService {
-	return &DefiService{db: db}
+func NewDefiService(store repository.Store, blocks BlockNumberProvider) *DefiService {
+	return &DefiService{
+		store:  store,
+		blocks: blocks,
+	}
 }
 
 // DEX 相关服务
-func (s *DefiService) CreateTrade(userID uint, pairID uint, tradeType string, amount, price float64) (*models.Trade, error) {
+
+// CreateTrade 记录交易，amount 为卖出数量，totalValue 为买入数量
+func (s *DefiService) CreateTrade(userID uint, pairID uint, tradeType string, amount, totalValue models.Amount) (*models.Trade, error) {
+	var price float64
+	if amount.Sign() > 0 {
+		price, _ = new(big.Rat).Quo(totalValue.Rat(), amount.Rat()).Float64()
+	}
+
 	trade := &models.Trade{
 		UserID:     userID,
 		PairID:     pairID,
 		Type:       tradeType,
 		Amount:     amount,
 		Price:      price,
-		TotalValue: amount * price,
+		TotalValue: totalValue,
 		Status:     "pending",
 	}
 
-	if err := s.db.Create(trade).Error; err != nil {
+	if err := s.store.Trades().Create(trade); err != nil {
 		return nil, err
 	}
 
 	return trade, nil
 }
 
-func (s *DefiService) GetTradingPairs() ([]models.TradingPair, error) {
-	var pairs []models.TradingPair
-	if err := s.db.Find(&pairs).Error; err != nil {
+// GetTradingPairs 列出所有交易对，可以在只读副本上查询
+func (s *DefiService) GetTradingPairs(ctx context.Context) ([]models.TradingPair, error) {
+	return s.store.Pairs().List(ctx)
+}
+
+func (s *DefiService) GetTradingPair(pairID uint) (*models.TradingPair, error) {
+	pair, err := s.store.Pairs().FindByID(pairID)
+	if err != nil {
+		return nil, ErrPoolNotFound
+	}
+	return pair, nil
+}
+
+func (s *DefiService) GetTradingPairBySymbol(symbol string) (*models.TradingPair, error) {
+	pair, err := s.store.Pairs().FindBySymbol(symbol)
+	if err != nil {
+		return nil, ErrPoolNotFound
+	}
+	return pair, nil
+}
+
+// QuoteSwap 按链上 getAmountOut 计算兑换报价，不落库
+func (s *DefiService) QuoteSwap(pairID uint, tokenIn string, amountIn models.Amount) (*SwapQuote, error) {
+	pair, err := s.GetTradingPair(pairID)
+	if err != nil {
 		return nil, err
 	}
-	return pairs, nil
+	return QuotePair(pair, tokenIn, amountIn)
 }
 
-// 借贷相关服务
-func (s *DefiService) CreateLendingPosition(userID uint, token string, amount float64, positionType string) (*models.LendingPosition, error) {
-	position := &models.LendingPosition{
-		UserID:       userID,
-		Token:        token,
-		Amount:       amount,
-		Type:         positionType,
-		Status:       "active",
-		StartTime:    time.Now(),
-		InterestRate: 0.05, // 示例利率
+// Swap 计算报价并通过 CreateTrade 记录待上链的交易，minAmountOut 为零表示不设滑点保护
+func (s *DefiService) Swap(userID uint, pairID uint, tokenIn string, amountIn, minAmountOut models.Amount) (*models.Trade, *SwapQuote, error) {
+	quote, err := s.QuoteSwap(pairID, tokenIn, amountIn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if quote.AmountOut.Cmp(minAmountOut) < 0 {
+		return nil, nil, ErrInsufficientOutput
+	}
+
+	trade, err := s.CreateTrade(userID, pairID, "swap", quote.AmountIn, quote.AmountOut)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if err := s.db.Create(position).Error; err != nil {
+	return trade, quote, nil
+}
+
+// FindRoute 在所有交易对构成的图上寻找最优兑换路径
+func (s *DefiService) FindRoute(tradeType, tokenIn, tokenOut string, amount models.Amount, maxHops, maxSplits int) (*RouteResult, error) {
+	pairs, err := s.GetTradingPairs(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return NewSwapGraph(pairs).FindRoute(tradeType, tokenIn, tokenOut, amount, maxHops, maxSplits)
+}
+
+// 借贷相关服务
+func (s *DefiService) CreateLendingPosition(userID uint, token string, amount models.Amount, positionType string) (*models.LendingPosition, error) {
+	var position *models.LendingPosition
+	err := s.store.Transaction(func(tx repository.Store) error {
+		var err error
+		position, err = createPosition(tx, userID, token, amount, positionType)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return position, nil
 }
 
-func (s *DefiService) GetUserPositions(userID uint) ([]models.LendingPosition, error) {
-	var positions []models.LendingPosition
-	if err := s.db.Where("user_id = ?", userID).Find(&positions).Error; err != nil {
+// Borrow 在同一个事务中通过 risk 校验抵押并写入借款，校验不通过时不写入
+func (s *DefiService) Borrow(risk *RiskEngine, userID uint, token string, amount models.Amount) (*models.LendingPosition, error) {
+	var position *models.LendingPosition
+	err := s.store.Transaction(func(tx repository.Store) error {
+		if err := risk.CheckBorrow(tx, userID, token, amount); err != nil {
+			return err
+		}
+		var err error
+		position, err = createPosition(tx, userID, token, amount, models.PositionTypeBorrow)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
-	return positions, nil
+
+	return position, nil
 }
 
-// 挖矿相关服务
-func (s *DefiService) CreateFarmingPosition(userID uint, poolID uint, token string, amount float64) (*models.FarmingPosition, error) {
-	position := &models.FarmingPosition{
-		UserID:        userID,
-		PoolID:        poolID,
-		Token:         token,
-		Amount:        amount,
-		APY:           0.15, // 示例年化收益率
-		StartTime:     time.Now(),
-		LastClaimTime: time.Now(),
-		Status:        "active",
-	}
-
-	if err := s.db.Create(position).Error; err != nil {
+func createPosition(tx repository.Store, userID uint, token string, amount models.Amount, positionType string) (*models.LendingPosition, error) {
+	state, err := accrueMarket(tx, token)
+	if err != nil {
 		return nil, err
 	}
+	if amount, err = amount.WithDecimals(state.market.Decimals); err != nil {
+		return nil, err
+	}
+
+	rates := state.rates()
+	interestRate := rates.SupplyAPR
+	if positionType == models.PositionTypeBorrow {
+		interestRate = rates.BorrowAPR
+	}
 
+	position := &models.LendingPosition{
+		UserID:          userID,
+		Token:           token,
+		Amount:          amount,
+		Type:            positionType,
+		Status:          "active",
+		StartTime:       time.Now(),
+		InterestRate:    interestRate,
+		InterestIndex:   state.index(positionType).String(),
+		Balance:         amount,
+		AccruedInterest: models.ZeroAmount(amount.Decimals()),
+	}
+	if err := tx.Positions().Create(position); err != nil {
+		return nil, err
+	}
+
+	principal := amount.Raw()
+	if positionType == models.PositionTypeBorrow {
+		state.totalBorrows.Add(state.totalBorrows, principal)
+	} else {
+		state.totalSupply.Add(state.totalSupply, principal)
+	}
+	state.flush()
+	if err := tx.Markets().Save(state.market); err != nil {
+		return nil, err
+	}
 	return position, nil
 }
 
-func (s *DefiService) ClaimRewards(userID uint, positionID uint) (*models.Reward, error) {
-	// 获取挖矿仓位
-	var position models.FarmingPosition
-	if err := s.db.First(&position, positionID).Error; err != nil {
-		return nil, errors.New("position not found")
+// GetUserPositions 返回用户仓位，active 仓位的 Balance 为本金加上按指数累计到当前的利息，
+// 其他仓位保持保存时的值。利息只在内存中累计，不写入数据库，整个查询可以在只读副本上执行
+func (s *DefiService) GetUserPositions(ctx context.Context, userID uint) ([]models.LendingPosition, error) {
+	positions, err := s.store.Positions().ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	markets, err := s.store.Markets().ListListed(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// 计算奖励
-	timeSinceLastClaim := time.Since(position.LastClaimTime)
-	rewardAmount := position.Amount * position.APY * float64(timeSinceLastClaim.Hours()) / (24 * 365)
+	states := make(map[string]*marketState, len(markets))
+	now := time.Now()
+	for i := range markets {
+		state, err := loadMarketState(&markets[i])
+		if err != nil {
+			return nil, err
+		}
+		state.accrue(now)
+		states[markets[i].Token] = state
+	}
 
-	// 创建奖励记录
-	reward := &models.Reward{
-		UserID:     userID,
-		PositionID: positionID,
-		Token:      position.Token,
-		Amount:     rewardAmount,
-		Type:       "farming",
-		ClaimTime:  time.Now(),
+	for i := range positions {
+		position := &positions[i]
+		state, ok := states[position.Token]
+		if position.Status != "active" || !ok {
+			continue
+		}
+
+		positionIndex, err := parseRaw(position.InterestIndex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interest index for position %d: %v", position.ID, err)
+		}
+		balance := positionBalance(position.Amount.Raw(), positionIndex, state.index(position.Type))
+		position.Balance = models.NewAmount(balance, state.market.Decimals)
+		position.AccruedInterest = position.Balance.Sub(position.Amount)
 	}
+	return positions, nil
+}
 
-	if err := s.db.Create(reward).Error; err != nil {
+// AccrueInterest 把市场利息累计到当前时间并保存
+func (s *DefiService) AccrueInterest(token string) (*models.LendingMarket, error) {
+	state, err := s.accrueInterest(token)
+	if err != nil {
 		return nil, err
 	}
+	return state.market, nil
+}
+
+func (s *DefiService) accrueInterest(token string) (*marketState, error) {
+	var state *marketState
+	err := s.store.Transaction(func(tx repository.Store) error {
+		var err error
+		if state, err = accrueMarket(tx, token); err != nil {
+			return err
+		}
+		return tx.Markets().Save(state.market)
+	})
+	return state, err
+}
 
-	// 更新最后领取时间
-	position.LastClaimTime = time.Now()
-	if err := s.db.Save(&position).Error; err != nil {
+// GetMarketRates 返回市场当前利用率与存借款年化利率，利息只在内存中累计
+func (s *DefiService) GetMarketRates(token string) (*MarketRates, error) {
+	market, err := s.store.Markets().FindListed(token)
+	if err != nil {
+		return nil, ErrMarketNotListed
+	}
+	state, err := loadMarketState(market)
+	if err != nil {
 		return nil, err
 	}
+	state.accrue(time.Now())
+	rates := state.rates()
+	return &rates, nil
+}
+
+// RollbackTransactions 撤销由被链重组丢弃的交易记录的借贷仓位和奖励，需在数据库事务中调用。
+// 仓位和奖励只标记为 orphaned，交易重新上链时由 LinkTransactions 恢复
+func RollbackTransactions(tx repository.Store, hashes []string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	positions, err := tx.Positions().ListByTransactions(hashes)
+	if err != nil {
+		return err
+	}
+	for i := range positions {
+		if positions[i].Status != "active" {
+			continue
+		}
+		if err := setPositionStatus(tx, &positions[i], "orphaned"); err != nil {
+			return err
+		}
+	}
+
+	rewards, err := tx.Rewards().ListByTransactions(hashes)
+	if err != nil {
+		return err
+	}
+	for i := range rewards {
+		if rewards[i].Status != "claimed" {
+			continue
+		}
+		rewards[i].Status = "orphaned"
+		if err := tx.Rewards().Save(&rewards[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LinkTransactions 把索引到的链上交易关联到由它确认的借贷仓位和挖矿奖励，需在数据库事务中调用。
+// 已经关联过的交易不会再关联新的记录；关联的记录被链重组撤销过时，交易重新上链后恢复这些记录
+func LinkTransactions(tx repository.Store, txs []*models.Transaction) error {
+	hashes := make([]string, 0, len(txs))
+	for _, t := range txs {
+		hashes = append(hashes, t.TransactionHash)
+	}
+
+	linked := make(map[string]bool)
+	positions, err := tx.Positions().ListByTransactions(hashes)
+	if err != nil {
+		return err
+	}
+	for i := range positions {
+		linked[positions[i].TransactionHash] = true
+		if positions[i].Status != "orphaned" {
+			continue
+		}
+		if err := setPositionStatus(tx, &positions[i], "active"); err != nil {
+			return err
+		}
+	}
+	rewards, err := tx.Rewards().ListByTransactions(hashes)
+	if err != nil {
+		return err
+	}
+	for i := range rewards {
+		linked[rewards[i].TransactionHash] = true
+		if rewards[i].Status != "orphaned" {
+			continue
+		}
+		rewards[i].Status = "claimed"
+		if err := tx.Rewards().Save(&rewards[i]); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range txs {
+		if linked[t.TransactionHash] || t.UserID == 0 || t.Status == models.TransactionStatusOrphaned {
+			continue
+		}
+		var ok bool
+		switch t.Type {
+		case models.TransactionTypeDeposit:
+			ok, err = linkPosition(tx, t, models.PositionTypeSupply, t.TokenIn, t.AmountIn)
+		case models.TransactionTypeBorrow:
+			ok, err = linkPosition(tx, t, models.PositionTypeBorrow, t.TokenOut, t.AmountOut)
+		case models.TransactionTypeStake:
+			ok, err = linkReward(tx, t, t.TokenIn)
+		case models.TransactionTypeUnstake:
+			ok, err = linkReward(tx, t, t.TokenOut)
+		}
+		if err != nil {
+			return err
+		}
+		linked[t.TransactionHash] = ok
+	}
+	return nil
+}
+
+// linkPosition 把交易关联到用户最早的一个数量相同、尚未关联交易的仓位
+func linkPosition(tx repository.Store, t *models.Transaction, positionType, token string, amount models.Amount) (bool, error) {
+	positions, err := tx.Positions().ListUnlinked(t.UserID, token, positionType)
+	if err != nil {
+		return false, err
+	}
+	for i := range positions {
+		if positions[i].Amount.Cmp(amount) != 0 {
+			continue
+		}
+		positions[i].TransactionHash = t.TransactionHash
+		return true, tx.Positions().Save(&positions[i])
+	}
+	return false, nil
+}
 
-	return reward, nil
+// linkReward 把质押变动交易关联到该挖矿仓位上最早一条在交易之前产生、尚未关联交易的奖励；
+// 没有待领取奖励时质押变动不产生奖励记录
+func linkReward(tx repository.Store, t *models.Transaction, lpToken string) (bool, error) {
+	farming, err := tx.Farms().ListPositions(context.Background(), t.UserID)
+	if err != nil {
+		return false, err
+	}
+	for _, position := range farming {
+		if !strings.EqualFold(position.Token, lpToken) {
+			continue
+		}
+		rewards, err := tx.Rewards().ListUnlinked(t.UserID, position.ID)
+		if err != nil {
+			return false, err
+		}
+		for i := range rewards {
+			if rewards[i].ClaimTime.After(t.Timestamp) {
+				continue
+			}
+			rewards[i].TransactionHash = t.TransactionHash
+			return true, tx.Rewards().Save(&rewards[i])
+		}
+	}
+	return false, nil
 }
 
-func (s *DefiService) GetUserRewards(userID uint) ([]models.Reward, error) {
-	var rewards []models.Reward
-	if err := s.db.Where("user_id = ?", userID).Find(&rewards).Error; err != nil {
+// setPositionStatus 撤销或恢复仓位，同时从市场总量中扣除或加回仓位本金
+func setPositionStatus(tx repository.Store, position *models.LendingPosition, status string) error {
+	state, err := accrueMarket(tx, position.Token)
+	if err != nil {
+		return err
+	}
+
+	total := state.totalSupply
+	if position.Type == models.PositionTypeBorrow {
+		total = state.totalBorrows
+	}
+	if status == "active" {
+		total.Add(total, position.Amount.Raw())
+	} else {
+		total.Sub(total, position.Amount.Raw())
+		if total.Sign() < 0 {
+			total.SetInt64(0)
+		}
+	}
+	state.flush()
+	if err := tx.Markets().Save(state.market); err != nil {
+		return err
+	}
+
+	position.Status = status
+	return tx.Positions().Save(position)
+}
+
+// accrueMarket 锁定市场并把利息累计到当前时间，调用方在同一事务中保存
+func accrueMarket(tx repository.Store, token string) (*marketState, error) {
+	market, err := tx.Markets().LockListed(token)
+	if err != nil {
+		return nil, ErrMarketNotListed
+	}
+
+	state, err := loadMarketState(market)
+	if err != nil {
 		return nil, err
 	}
-	return rewards, nil
+	state.accrue(time.Now())
+	return state, nil
+}
+
+// 挖矿相关服务
+func (s *DefiService) GetUserRewards(ctx context.Context, userID uint) ([]models.Reward, error) {
+	return s.store.Rewards().ListByUser(ctx, userID)
 }
@@ -0,0 +1,543 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"defi-backend/models"
+	"defi-backend/repository"
+)
+
+// Farming.sol 中 accRewardPerShare 的精度
+var accRewardPrecision = big.NewInt(1e12)
+
+var (
+	ErrFarmNotInitialized    = errors.New("farm not initialized")
+	ErrFarmInitialized       = errors.New("farm already initialized")
+	ErrFarmingPoolNotFound   = errors.New("farming pool not found")
+	ErrInsufficientStake     = errors.New("withdraw: not good")
+	ErrNoBlockNumberProvider = errors.New("block number provider is not configured")
+)
+
+// BlockNumberProvider 提供当前区块高度，挖矿奖励按区块计算
+type BlockNumberProvider interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+}
+
+// InitFarm 对应 Farming.sol 的 constructor，rewardPerBlock 以奖励代币为单位，只能初始化一次
+func (s *DefiService) InitFarm(rewardToken string, rewardDecimals uint8, rewardPerBlock models.Amount, startBlock uint64) (*models.Farm, error) {
+	perBlock, err := rewardAmount(rewardPerBlock, rewardDecimals)
+	if err != nil {
+		return nil, err
+	}
+
+	var farm *models.Farm
+	err = s.store.Transaction(func(tx repository.Store) error {
+		_, err := tx.Farms().FindFarm(context.Background())
+		if err == nil {
+			return ErrFarmInitialized
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		farm = &models.Farm{
+			RewardToken:    rewardToken,
+			RewardDecimals: rewardDecimals,
+			RewardPerBlock: perBlock.String(),
+			StartBlock:     startBlock,
+		}
+		return tx.Farms().CreateFarm(farm)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return farm, nil
+}
+
+// rewardAmount 把以代币为单位的每区块奖励换算为最小单位
+func rewardAmount(amount models.Amount, decimals uint8) (*big.Int, error) {
+	if amount.Sign() < 0 {
+		return nil, models.ErrInvalidAmount
+	}
+	amount, err := amount.WithDecimals(decimals)
+	if err != nil {
+		return nil, err
+	}
+	return amount.Raw(), nil
+}
+
+// AddFarmingPool 对应 addPool，lpDecimals 为 LP 代币的精度
+func (s *DefiService) AddFarmingPool(lpToken string, lpDecimals uint8, allocPoint uint64, withUpdate bool) (*models.FarmingPool, error) {
+	block, err := s.currentBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var pool *models.FarmingPool
+	err = s.store.Transaction(func(tx repository.Store) error {
+		farms := tx.Farms()
+		// 锁定 Farm，并发添加的池子依次分配 PoolID 并累加 TotalAllocPoint
+		farm, err := lockFarm(farms)
+		if err != nil {
+			return err
+		}
+		if withUpdate {
+			if err := massUpdatePools(farms, farm, block); err != nil {
+				return err
+			}
+		}
+
+		count, err := farms.CountPools()
+		if err != nil {
+			return err
+		}
+
+		lastRewardBlock := farm.StartBlock
+		if block > farm.StartBlock {
+			lastRewardBlock = block
+		}
+		farm.TotalAllocPoint += allocPoint
+
+		pool = &models.FarmingPool{
+			PoolID:            uint(count),
+			LPToken:           lpToken,
+			LPDecimals:        lpDecimals,
+			AllocPoint:        allocPoint,
+			LastRewardBlock:   lastRewardBlock,
+			AccRewardPerShare: "0",
+			TotalStaked:       "0",
+		}
+		if err := farms.CreatePool(pool); err != nil {
+			return err
+		}
+		return farms.SaveFarm(farm)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// SetFarmingPool 对应 setPool，调整池子权重
+func (s *DefiService) SetFarmingPool(poolID uint, allocPoint uint64, withUpdate bool) (*models.FarmingPool, error) {
+	block, err := s.currentBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var pool *models.FarmingPool
+	err = s.store.Transaction(func(tx repository.Store) error {
+		farms := tx.Farms()
+		farm, err := lockFarm(farms)
+		if err != nil {
+			return err
+		}
+		if withUpdate {
+			if err := massUpdatePools(farms, farm, block); err != nil {
+				return err
+			}
+		}
+		if pool, err = lockFarmingPool(farms, poolID); err != nil {
+			return err
+		}
+
+		farm.TotalAllocPoint = farm.TotalAllocPoint - pool.AllocPoint + allocPoint
+		pool.AllocPoint = allocPoint
+		if err := farms.SavePool(pool); err != nil {
+			return err
+		}
+		return farms.SaveFarm(farm)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// SetRewardPerBlock 调整每区块奖励 (以奖励代币为单位)，调整前先按旧速率结算所有池子
+func (s *DefiService) SetRewardPerBlock(rewardPerBlock models.Amount) (*models.Farm, error) {
+	block, err := s.currentBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var farm *models.Farm
+	err = s.store.Transaction(func(tx repository.Store) error {
+		farms := tx.Farms()
+		if farm, err = lockFarm(farms); err != nil {
+			return err
+		}
+		perBlock, err := rewardAmount(rewardPerBlock, farm.RewardDecimals)
+		if err != nil {
+			return err
+		}
+		if err := massUpdatePools(farms, farm, block); err != nil {
+			return err
+		}
+		farm.RewardPerBlock = perBlock.String()
+		return farms.SaveFarm(farm)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return farm, nil
+}
+
+// Stake 对应 deposit：先发放待领取奖励，再增加质押
+func (s *DefiService) Stake(userID uint, poolID uint, amount models.Amount) (*models.FarmingPosition, *models.Reward, error) {
+	return s.changeStake(userID, poolID, func(pool *models.FarmingPool, staked *big.Int) (*big.Int, error) {
+		amount, err := amount.WithDecimals(pool.LPDecimals)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).Add(staked, amount.Raw()), nil
+	})
+}
+
+// Unstake 对应 withdraw
+func (s *DefiService) Unstake(userID uint, poolID uint, amount models.Amount) (*models.FarmingPosition, *models.Reward, error) {
+	return s.changeStake(userID, poolID, func(pool *models.FarmingPool, staked *big.Int) (*big.Int, error) {
+		amount, err := amount.WithDecimals(pool.LPDecimals)
+		if err != nil {
+			return nil, err
+		}
+		if staked.Cmp(amount.Raw()) < 0 {
+			return nil, ErrInsufficientStake
+		}
+		return new(big.Int).Sub(staked, amount.Raw()), nil
+	})
+}
+
+// ClaimRewards 领取奖励，等价于 deposit(pid, 0)
+func (s *DefiService) ClaimRewards(userID uint, positionID uint) (*models.Reward, error) {
+	position, err := s.store.Farms().FindPositionByID(userID, positionID)
+	if err != nil {
+		return nil, errors.New("position not found")
+	}
+
+	_, reward, err := s.changeStake(userID, position.PoolID, func(_ *models.FarmingPool, staked *big.Int) (*big.Int, error) {
+		return staked, nil
+	})
+	return reward, err
+}
+
+// EmergencyWithdraw 放弃奖励直接取回全部质押
+func (s *DefiService) EmergencyWithdraw(userID uint, poolID uint) (*models.FarmingPosition, error) {
+	var position *models.FarmingPosition
+	err := s.store.Transaction(func(tx repository.Store) error {
+		farms := tx.Farms()
+		pool, err := lockFarmingPool(farms, poolID)
+		if err != nil {
+			return err
+		}
+		if position, err = loadFarmingPosition(farms, userID, pool); err != nil {
+			return err
+		}
+		if position.ID == 0 {
+			return errors.New("position not found")
+		}
+
+		totalStaked, _ := parseRaw(pool.TotalStaked)
+		totalStaked.Sub(totalStaked, position.Amount.Raw())
+		pool.TotalStaked = totalStaked.String()
+
+		position.Amount = models.ZeroAmount(pool.LPDecimals)
+		position.RewardDebt = "0"
+		position.Status = "closed"
+		if err := farms.SavePool(pool); err != nil {
+			return err
+		}
+		return farms.SavePosition(position)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return position, nil
+}
+
+// PendingReward 对应 pendingReward(pid, user)，用户在池子中没有仓位时为 0
+func (s *DefiService) PendingReward(ctx context.Context, userID uint, poolID uint) (models.Amount, error) {
+	block, err := s.currentBlock()
+	if err != nil {
+		return models.Amount{}, err
+	}
+
+	farms := s.store.Farms()
+	farm, err := loadFarm(ctx, farms)
+	if err != nil {
+		return models.Amount{}, err
+	}
+	pool, err := loadFarmingPool(ctx, farms, poolID)
+	if err != nil {
+		return models.Amount{}, err
+	}
+
+	position, err := farms.FindPosition(userID, poolID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.ZeroAmount(farm.RewardDecimals), nil
+	}
+	if err != nil {
+		return models.Amount{}, err
+	}
+	pending, err := pendingReward(farm, pool, position, block)
+	if err != nil {
+		return models.Amount{}, err
+	}
+	return models.NewAmount(pending, farm.RewardDecimals), nil
+}
+
+// GetFarmingPositions 返回用户所有质押仓位以及待领取奖励，可以在只读副本上查询
+func (s *DefiService) GetFarmingPositions(ctx context.Context, userID uint) ([]models.FarmingPosition, error) {
+	block, err := s.currentBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	farms := s.store.Farms()
+	positions, err := farms.ListPositions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(positions) == 0 {
+		return positions, nil
+	}
+
+	farm, err := loadFarm(ctx, farms)
+	if err != nil {
+		return nil, err
+	}
+	for i := range positions {
+		pool, err := loadFarmingPool(ctx, farms, positions[i].PoolID)
+		if err != nil {
+			return nil, err
+		}
+		pending, err := pendingReward(farm, pool, &positions[i], block)
+		if err != nil {
+			return nil, err
+		}
+		positions[i].PendingReward = models.NewAmount(pending, farm.RewardDecimals)
+	}
+	return positions, nil
+}
+
+func (s *DefiService) changeStake(userID uint, poolID uint, next func(pool *models.FarmingPool, staked *big.Int) (*big.Int, error)) (*models.FarmingPosition, *models.Reward, error) {
+	block, err := s.currentBlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var position *models.FarmingPosition
+	var reward *models.Reward
+	err = s.store.Transaction(func(tx repository.Store) error {
+		farms := tx.Farms()
+		// 先锁定池子，同一池子上并发的质押变动依次结算 TotalStaked 和 AccRewardPerShare；
+		// Farm 只读取，在加锁之后读取才能看到已提交的权重调整
+		pool, err := lockFarmingPool(farms, poolID)
+		if err != nil {
+			return err
+		}
+		farm, err := loadFarm(context.Background(), farms)
+		if err != nil {
+			return err
+		}
+		if position, err = loadFarmingPosition(farms, userID, pool); err != nil {
+			return err
+		}
+
+		updatePool(farm, pool, block)
+		acc, _ := parseRaw(pool.AccRewardPerShare)
+
+		staked := position.Amount.Raw()
+		pending, err := accruedReward(staked, acc, position.RewardDebt)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if pending.Sign() > 0 {
+			reward = &models.Reward{
+				UserID:     userID,
+				PositionID: position.ID,
+				Token:      farm.RewardToken,
+				Amount:     models.NewAmount(pending, farm.RewardDecimals),
+				Type:       "farming",
+				Status:     "claimed",
+				ClaimTime:  now,
+			}
+			if err := tx.Rewards().Create(reward); err != nil {
+				return err
+			}
+			position.LastClaimTime = now
+		}
+
+		newStaked, err := next(pool, staked)
+		if err != nil {
+			return err
+		}
+		totalStaked, _ := parseRaw(pool.TotalStaked)
+		totalStaked.Add(totalStaked, new(big.Int).Sub(newStaked, staked))
+		pool.TotalStaked = totalStaked.String()
+
+		position.Amount = models.NewAmount(newStaked, pool.LPDecimals)
+		position.RewardDebt = rewardDebt(newStaked, acc).String()
+		position.Status = "active"
+		if newStaked.Sign() == 0 {
+			position.Status = "closed"
+		}
+
+		if err := farms.SavePool(pool); err != nil {
+			return err
+		}
+		return farms.SavePosition(position)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return position, reward, nil
+}
+
+func (s *DefiService) currentBlock() (uint64, error) {
+	if s.blocks == nil {
+		return 0, ErrNoBlockNumberProvider
+	}
+	return s.blocks.BlockNumber(context.Background())
+}
+
+// loadFarm 和 loadFarmingPool 在事务中调用时 ctx 不影响查询，使用 context.Background()
+func loadFarm(ctx context.Context, farms repository.FarmRepository) (*models.Farm, error) {
+	farm, err := farms.FindFarm(ctx)
+	if err != nil {
+		return nil, ErrFarmNotInitialized
+	}
+	return farm, nil
+}
+
+func loadFarmingPool(ctx context.Context, farms repository.FarmRepository, poolID uint) (*models.FarmingPool, error) {
+	pool, err := farms.FindPool(ctx, poolID)
+	if err != nil {
+		return nil, ErrFarmingPoolNotFound
+	}
+	return pool, nil
+}
+
+// lockFarm 和 lockFarmingPool 只能在事务中调用，加锁顺序见 repository.FarmRepository
+func lockFarm(farms repository.FarmRepository) (*models.Farm, error) {
+	farm, err := farms.LockFarm()
+	if err != nil {
+		return nil, ErrFarmNotInitialized
+	}
+	return farm, nil
+}
+
+func lockFarmingPool(farms repository.FarmRepository, poolID uint) (*models.FarmingPool, error) {
+	pool, err := farms.LockPool(poolID)
+	if err != nil {
+		return nil, ErrFarmingPoolNotFound
+	}
+	return pool, nil
+}
+
+// loadFarmingPosition 读取用户在池子里的仓位，不存在时返回一个未保存的空仓位
+func loadFarmingPosition(farms repository.FarmRepository, userID uint, pool *models.FarmingPool) (*models.FarmingPosition, error) {
+	position, err := farms.FindPosition(userID, pool.PoolID)
+	if errors.Is(err, repository.ErrNotFound) {
+		now := time.Now()
+		return &models.FarmingPosition{
+			UserID:        userID,
+			PoolID:        pool.PoolID,
+			Token:         pool.LPToken,
+			Amount:        models.ZeroAmount(pool.LPDecimals),
+			RewardDebt:    "0",
+			StartTime:     now,
+			LastClaimTime: now,
+			Status:        "active",
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return position, nil
+}
+
+// massUpdatePools 锁定并结算所有池子，调用方已经锁定 farm
+func massUpdatePools(farms repository.FarmRepository, farm *models.Farm, block uint64) error {
+	pools, err := farms.LockPools()
+	if err != nil {
+		return err
+	}
+	for i := range pools {
+		updatePool(farm, &pools[i], block)
+		if err := farms.SavePool(&pools[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updatePool 对应 Farming.sol 的 updatePool
+func updatePool(farm *models.Farm, pool *models.FarmingPool, block uint64) {
+	if block <= pool.LastRewardBlock {
+		return
+	}
+	lpSupply, _ := parseRaw(pool.TotalStaked)
+	if lpSupply == nil || lpSupply.Sign() == 0 {
+		pool.LastRewardBlock = block
+		return
+	}
+
+	acc, _ := parseRaw(pool.AccRewardPerShare)
+	acc.Add(acc, rewardPerShare(farm, pool, block, lpSupply))
+	pool.AccRewardPerShare = acc.String()
+	pool.LastRewardBlock = block
+}
+
+// pendingReward 对应 Farming.sol 的 pendingReward，不修改池子状态
+func pendingReward(farm *models.Farm, pool *models.FarmingPool, position *models.FarmingPosition, block uint64) (*big.Int, error) {
+	acc, err := parseRaw(pool.AccRewardPerShare)
+	if err != nil {
+		return nil, err
+	}
+	lpSupply, err := parseRaw(pool.TotalStaked)
+	if err != nil {
+		return nil, err
+	}
+	if block > pool.LastRewardBlock && lpSupply.Sign() != 0 {
+		acc.Add(acc, rewardPerShare(farm, pool, block, lpSupply))
+	}
+	return accruedReward(position.Amount.Raw(), acc, position.RewardDebt)
+}
+
+// rewardPerShare = (block - lastRewardBlock) * rewardPerBlock * allocPoint / totalAllocPoint * 1e12 / lpSupply
+func rewardPerShare(farm *models.Farm, pool *models.FarmingPool, block uint64, lpSupply *big.Int) *big.Int {
+	if farm.TotalAllocPoint == 0 {
+		return new(big.Int)
+	}
+	rewardPerBlock, err := parseRaw(farm.RewardPerBlock)
+	if err != nil {
+		return new(big.Int)
+	}
+
+	reward := new(big.Int).SetUint64(block - pool.LastRewardBlock)
+	reward.Mul(reward, rewardPerBlock)
+	reward.Mul(reward, new(big.Int).SetUint64(pool.AllocPoint))
+	reward.Quo(reward, new(big.Int).SetUint64(farm.TotalAllocPoint))
+
+	reward.Mul(reward, accRewardPrecision)
+	return reward.Quo(reward, lpSupply)
+}
+
+func rewardDebt(amount, acc *big.Int) *big.Int {
+	debt := new(big.Int).Mul(amount, acc)
+	return debt.Quo(debt, accRewardPrecision)
+}
+
+func accruedReward(amount, acc *big.Int, debt string) (*big.Int, error) {
+	rewardDebtValue, err := parseRaw(debt)
+	if err != nil {
+		return nil, err
+	}
+	accrued := rewardDebt(amount, acc)
+	return accrued.Sub(accrued, rewardDebtValue), nil
+}
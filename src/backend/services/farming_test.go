@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"defi-backend/models"
+	"defi-backend/repository"
+)
+
+type fixedBlocks struct {
+	number uint64
+}
+
+func (b *fixedBlocks) BlockNumber(ctx context.Context) (uint64, error) {
+	return b.number, nil
+}
+
+func TestFarmAdministration(t *testing.T) {
+	blocks := &fixedBlocks{number: 100}
+	defi := NewDefiService(repository.NewMemoryStore(), blocks)
+	ctx := context.Background()
+
+	// 每区块奖励 10，池子 0 占 1/4 权重
+	if _, err := defi.InitFarm("RWD", 18, units(t, "10"), 100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := defi.InitFarm("RWD", 18, units(t, "10"), 100); !errors.Is(err, ErrFarmInitialized) {
+		t.Fatalf("second InitFarm err = %v, want ErrFarmInitialized", err)
+	}
+	pool, err := defi.AddFarmingPool("LP-A", 6, 100, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.PoolID != 0 || pool.LPDecimals != 6 {
+		t.Fatalf("pool = %+v, want pool 0 with 6 decimals", pool)
+	}
+	if _, err := defi.AddFarmingPool("LP-B", 18, 300, false); err != nil {
+		t.Fatal(err)
+	}
+
+	stake, err := models.ParseUnits("1", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := defi.Stake(1, 0, stake); err != nil {
+		t.Fatal(err)
+	}
+
+	expectPending := func(want string) {
+		t.Helper()
+		pending, err := defi.PendingReward(ctx, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pending.Cmp(units(t, want)) != 0 {
+			t.Fatalf("pending at block %d = %s, want %s", blocks.number, pending, want)
+		}
+	}
+
+	blocks.number = 110
+	expectPending("25")
+
+	// 调整前的 10 个区块按旧速率结算
+	if _, err := defi.SetRewardPerBlock(units(t, "20")); err != nil {
+		t.Fatal(err)
+	}
+	blocks.number = 120
+	expectPending("75")
+
+	if _, err := defi.SetFarmingPool(0, 300, true); err != nil {
+		t.Fatal(err)
+	}
+	blocks.number = 130
+	expectPending("175")
+
+	if pending, err := defi.PendingReward(ctx, 2, 0); err != nil || !pending.IsZero() {
+		t.Fatalf("pending without position = %s, %v, want 0", pending, err)
+	}
+	if _, err := defi.PendingReward(ctx, 1, 7); !errors.Is(err, ErrFarmingPoolNotFound) {
+		t.Fatalf("pending for unknown pool err = %v, want ErrFarmingPoolNotFound", err)
+	}
+}
+
+func TestFarmRequiresInit(t *testing.T) {
+	defi := NewDefiService(repository.NewMemoryStore(), &fixedBlocks{number: 1})
+	if _, err := defi.AddFarmingPool("LP", 18, 1, false); !errors.Is(err, ErrFarmNotInitialized) {
+		t.Fatalf("AddFarmingPool err = %v, want ErrFarmNotInitialized", err)
+	}
+	if _, err := defi.SetRewardPerBlock(units(t, "1")); !errors.Is(err, ErrFarmNotInitialized) {
+		t.Fatalf("SetRewardPerBlock err = %v, want ErrFarmNotInitialized", err)
+	}
+}
+
+func TestConcurrentStakesKeepPoolTotals(t *testing.T) {
+	blocks := &fixedBlocks{number: 100}
+	store := repository.NewMemoryStore()
+	defi := NewDefiService(store, blocks)
+	if _, err := defi.InitFarm("RWD", 18, units(t, "10"), 100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := defi.AddFarmingPool("LP", 18, 100, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 个用户同时各质押 4，之后同时各取回 1，池子总量不丢失更新
+	var wg sync.WaitGroup
+	run := func(change func(userID uint) error) {
+		for user := uint(1); user <= 10; user++ {
+			wg.Add(1)
+			go func(userID uint) {
+				defer wg.Done()
+				if err := change(userID); err != nil {
+					t.Error(err)
+				}
+			}(user)
+		}
+		wg.Wait()
+	}
+	run(func(userID uint) error {
+		_, _, err := defi.Stake(userID, 0, units(t, "4"))
+		return err
+	})
+	blocks.number = 110
+	run(func(userID uint) error {
+		_, _, err := defi.Unstake(userID, 0, units(t, "1"))
+		return err
+	})
+
+	pool, err := store.Farms().FindPool(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.TotalStaked != units(t, "30").Raw().String() {
+		t.Fatalf("total staked = %s, want 30e18", pool.TotalStaked)
+	}
+	// 10 个区块共 100 奖励，每个用户质押相同，各得 10
+	rewards, err := defi.GetUserRewards(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rewards) != 1 || rewards[0].Amount.Cmp(units(t, "10")) != 0 {
+		t.Fatalf("rewards = %+v, want one reward of 10", rewards)
+	}
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"defi-backend/models"
+)
+
+const (
+	RateModelLinear = "linear"
+	RateModelJump   = "jump"
+
+	secondsPerYear = 365 * 24 * 60 * 60
+)
+
+// InterestRateModel 根据资金利用率给出年化借款利率，所有数值按 1e18 放大
+type InterestRateModel interface {
+	BorrowRate(utilization *big.Int) *big.Int
+}
+
+// LinearRateModel borrowRate = base + utilization * multiplier
+type LinearRateModel struct {
+	BaseRate   *big.Int
+	Multiplier *big.Int
+}
+
+func (m *LinearRateModel) BorrowRate(utilization *big.Int) *big.Int {
+	rate := mulBase(utilization, m.Multiplier)
+	return rate.Add(rate, m.BaseRate)
+}
+
+// JumpRateModel 利用率超过 Kink 之后按 JumpMultiplier 陡增
+type JumpRateModel struct {
+	BaseRate       *big.Int
+	Multiplier     *big.Int
+	JumpMultiplier *big.Int
+	Kink           *big.Int
+}
+
+func (m *JumpRateModel) BorrowRate(utilization *big.Int) *big.Int {
+	if utilization.Cmp(m.Kink) <= 0 {
+		rate := mulBase(utilization, m.Multiplier)
+		return rate.Add(rate, m.BaseRate)
+	}
+
+	normal := mulBase(m.Kink, m.Multiplier)
+	normal.Add(normal, m.BaseRate)
+	excess := new(big.Int).Sub(utilization, m.Kink)
+	return normal.Add(normal, mulBase(excess, m.JumpMultiplier))
+}
+
+// NewInterestRateModel 根据市场配置创建利率模型
+func NewInterestRateModel(market *models.LendingMarket) (InterestRateModel, error) {
+	base, err := parseMarketField(market, "base_rate_per_year", market.BaseRatePerYear)
+	if err != nil {
+		return nil, err
+	}
+	multiplier, err := parseMarketField(market, "multiplier_per_year", market.MultiplierPerYear)
+	if err != nil {
+		return nil, err
+	}
+
+	switch market.RateModel {
+	case RateModelLinear:
+		return &LinearRateModel{BaseRate: base, Multiplier: multiplier}, nil
+	case RateModelJump, "":
+		jump, err := parseMarketField(market, "jump_multiplier_per_year", market.JumpMultiplierPerYear)
+		if err != nil {
+			return nil, err
+		}
+		kink, err := parseMarketField(market, "kink", market.Kink)
+		if err != nil {
+			return nil, err
+		}
+		return &JumpRateModel{BaseRate: base, Multiplier: multiplier, JumpMultiplier: jump, Kink: kink}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate model %q for market %s", market.RateModel, market.Token)
+	}
+}
+
+// MarketRates 市场当前的利用率和年化利率
+type MarketRates struct {
+	Token       string  `json:"token"`
+	Utilization float64 `json:"utilization"`
+	BorrowAPR   float64 `json:"borrow_apr"`
+	SupplyAPR   float64 `json:"supply_apr"`
+}
+
+// Utilization = totalBorrows / totalSupply
+func Utilization(totalSupply, totalBorrows *big.Int) *big.Int {
+	if totalSupply.Sign() <= 0 || totalBorrows.Sign() <= 0 {
+		return new(big.Int)
+	}
+	u := new(big.Int).Mul(totalBorrows, LendingBase)
+	return u.Quo(u, totalSupply)
+}
+
+// SupplyRate = borrowRate * utilization * (1 - reserveFactor)
+func SupplyRate(borrowRate, utilization, reserveFactor *big.Int) *big.Int {
+	rate := mulBase(borrowRate, utilization)
+	return mulBase(rate, new(big.Int).Sub(LendingBase, reserveFactor))
+}
+
+// marketState 解析后的市场计息状态
+type marketState struct {
+	market        *models.LendingMarket
+	model         InterestRateModel
+	reserveFactor *big.Int
+	totalSupply   *big.Int
+	totalBorrows  *big.Int
+	supplyIndex   *big.Int
+	borrowIndex   *big.Int
+}
+
+func loadMarketState(market *models.LendingMarket) (*marketState, error) {
+	model, err := NewInterestRateModel(market)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &marketState{market: market, model: model}
+	fields := []struct {
+		name  string
+		value string
+		dst   **big.Int
+	}{
+		{"reserve_factor", market.ReserveFactor, &state.reserveFactor},
+		{"total_supply", market.TotalSupply, &state.totalSupply},
+		{"total_borrows", market.TotalBorrows, &state.totalBorrows},
+		{"supply_index", market.SupplyIndex, &state.supplyIndex},
+		{"borrow_index", market.BorrowIndex, &state.borrowIndex},
+	}
+	for _, f := range fields {
+		if *f.dst, err = parseMarketField(market, f.name, f.value); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// accrue 把利息从 AccrualTime 累计到 now，并更新总量与指数
+func (st *marketState) accrue(now time.Time) {
+	market := st.market
+	if market.AccrualTime.IsZero() {
+		market.AccrualTime = now
+		return
+	}
+	elapsed := int64(now.Sub(market.AccrualTime) / time.Second)
+	if elapsed <= 0 {
+		return
+	}
+
+	borrowRate := st.model.BorrowRate(Utilization(st.totalSupply, st.totalBorrows))
+	factor := new(big.Int).Mul(borrowRate, big.NewInt(elapsed))
+	factor.Quo(factor, big.NewInt(secondsPerYear))
+
+	interest := mulBase(st.totalBorrows, factor)
+	st.totalBorrows.Add(st.totalBorrows, interest)
+	st.borrowIndex.Add(st.borrowIndex, mulBase(st.borrowIndex, factor))
+
+	// 扣除储备金后的利息归存款人所有
+	supplierInterest := mulBase(interest, new(big.Int).Sub(LendingBase, st.reserveFactor))
+	if st.totalSupply.Sign() > 0 && supplierInterest.Sign() > 0 {
+		growth := new(big.Int).Mul(st.supplyIndex, supplierInterest)
+		growth.Quo(growth, st.totalSupply)
+		st.supplyIndex.Add(st.supplyIndex, growth)
+		st.totalSupply.Add(st.totalSupply, supplierInterest)
+	}
+
+	market.AccrualTime = market.AccrualTime.Add(time.Duration(elapsed) * time.Second)
+	st.flush()
+}
+
+func (st *marketState) flush() {
+	st.market.TotalSupply = st.totalSupply.String()
+	st.market.TotalBorrows = st.totalBorrows.String()
+	st.market.SupplyIndex = st.supplyIndex.String()
+	st.market.BorrowIndex = st.borrowIndex.String()
+}
+
+func (st *marketState) rates() MarketRates {
+	utilization := Utilization(st.totalSupply, st.totalBorrows)
+	borrowRate := st.model.BorrowRate(utilization)
+	supplyRate := SupplyRate(borrowRate, utilization, st.reserveFactor)
+
+	return MarketRates{
+		Token:       st.market.Token,
+		Utilization: baseToFloat(utilization),
+		BorrowAPR:   baseToFloat(borrowRate),
+		SupplyAPR:   baseToFloat(supplyRate),
+	}
+}
+
+func (st *marketState) index(positionType string) *big.Int {
+	if positionType == models.PositionTypeBorrow {
+		return st.borrowIndex
+	}
+	return st.supplyIndex
+}
+
+// positionBalance 按指数计算仓位的本金加利息
+func positionBalance(principal *big.Int, positionIndex, currentIndex *big.Int) *big.Int {
+	if positionIndex == nil || positionIndex.Sign() <= 0 {
+		return new(big.Int).Set(principal)
+	}
+	balance := new(big.Int).Mul(principal, currentIndex)
+	return balance.Quo(balance, positionIndex)
+}
+
+func parseMarketField(market *models.LendingMarket, name, value string) (*big.Int, error) {
+	v, err := parseRaw(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s for market %s: %v", name, market.Token, err)
+	}
+	return v, nil
+}
+
+func mulBase(a, b *big.Int) *big.Int {
+	v := new(big.Int).Mul(a, b)
+	return v.Quo(v, LendingBase)
+}
+
+func baseToFloat(v *big.Int) float64 {
+	f, _ := new(big.Rat).SetFrac(v, LendingBase).Float64()
+	return f
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"defi-backend/models"
+)
+
+func percent(n int64) *big.Int {
+	return new(big.Int).Div(new(big.Int).Mul(LendingBase, big.NewInt(n)), big.NewInt(100))
+}
+
+func TestJumpRateModel(t *testing.T) {
+	model := &JumpRateModel{BaseRate: percent(2), Multiplier: percent(20), JumpMultiplier: percent(100), Kink: percent(80)}
+	cases := []struct {
+		utilization int64
+		want        *big.Int
+	}{
+		{0, percent(2)},
+		{50, percent(12)},
+		{80, percent(18)},
+		// 超过拐点的 10% 按 100% 的斜率计算
+		{90, percent(28)},
+	}
+	for _, c := range cases {
+		if got := model.BorrowRate(percent(c.utilization)); got.Cmp(c.want) != 0 {
+			t.Errorf("BorrowRate(%d%%) = %s, want %s", c.utilization, got, c.want)
+		}
+	}
+}
+
+func TestSupplyRate(t *testing.T) {
+	// 借款利率 10%，利用率 50%，储备金 10%
+	if got, want := SupplyRate(percent(10), percent(50), percent(10)), new(big.Int).Div(percent(45), big.NewInt(10)); got.Cmp(want) != 0 {
+		t.Fatalf("SupplyRate = %s, want %s", got, want)
+	}
+}
+
+func TestAccrueOneYear(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	market := &models.LendingMarket{
+		Token:                 "USDC",
+		RateModel:             RateModelLinear,
+		BaseRatePerYear:       percent(10).String(),
+		MultiplierPerYear:     "0",
+		ReserveFactor:         percent(10).String(),
+		TotalSupply:           "1000",
+		TotalBorrows:          "500",
+		SupplyIndex:           LendingBase.String(),
+		BorrowIndex:           LendingBase.String(),
+		AccrualTime:           start,
+		JumpMultiplierPerYear: "0",
+		Kink:                  "0",
+	}
+	state, err := loadMarketState(market)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.accrue(start.Add(secondsPerYear * time.Second))
+
+	// 借款利息 50，其中 45 归存款人
+	if market.TotalBorrows != "550" || market.TotalSupply != "1045" {
+		t.Fatalf("totals = %s/%s, want 550/1045", market.TotalBorrows, market.TotalSupply)
+	}
+	if got, want := state.borrowIndex, new(big.Int).Add(LendingBase, percent(10)); got.Cmp(want) != 0 {
+		t.Fatalf("borrow index = %s, want %s", got, want)
+	}
+	if got := positionBalance(big.NewInt(1000), LendingBase, state.supplyIndex); got.Int64() != 1045 {
+		t.Fatalf("supply balance = %s, want 1045", got)
+	}
+}
+
+func TestGetUserPositionsDoesNotWrite(t *testing.T) {
+	store := newLendingStore(t)
+	defi := NewDefiService(store, nil)
+	risk := NewRiskEngine(store, nil)
+
+	if _, err := defi.CreateLendingPosition(1, "ETH", units(t, "100"), models.PositionTypeSupply); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := defi.CreateLendingPosition(2, "USDC", units(t, "1000"), models.PositionTypeSupply); err != nil {
+		t.Fatal(err)
+	}
+	borrow, err := defi.Borrow(risk, 1, "USDC", units(t, "50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphaned, err := defi.Borrow(risk, 1, "USDC", units(t, "10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphaned.Status = "orphaned"
+	if err := store.Positions().Save(orphaned); err != nil {
+		t.Fatal(err)
+	}
+
+	// 上次计息在一年前
+	market, err := store.Markets().FindListed("USDC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	market.AccrualTime = market.AccrualTime.Add(-secondsPerYear * time.Second)
+	if err := store.Markets().Save(market); err != nil {
+		t.Fatal(err)
+	}
+
+	positions, err := defi.GetUserPositions(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, position := range positions {
+		switch position.ID {
+		case borrow.ID:
+			if position.Balance.Cmp(position.Amount) <= 0 || position.AccruedInterest.Sign() <= 0 {
+				t.Errorf("active borrow did not accrue: balance %s", position.Balance)
+			}
+		case orphaned.ID:
+			if position.Balance.Cmp(position.Amount) != 0 || !position.AccruedInterest.IsZero() {
+				t.Errorf("orphaned borrow accrued: balance %s", position.Balance)
+			}
+		}
+	}
+
+	after, err := store.Markets().FindListed("USDC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.AccrualTime.Equal(market.AccrualTime) || after.TotalBorrows != market.TotalBorrows {
+		t.Fatalf("GetUserPositions saved the market: %+v", after)
+	}
+}
+
+func TestGetUserPositionsInvalidIndex(t *testing.T) {
+	store := newLendingStore(t)
+	defi := NewDefiService(store, nil)
+
+	position, err := defi.CreateLendingPosition(1, "ETH", units(t, "1"), models.PositionTypeSupply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	position.InterestIndex = "not-a-number"
+	if err := store.Positions().Save(position); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := defi.GetUserPositions(context.Background(), 1); err == nil {
+		t.Fatal("GetUserPositions accepted an invalid interest index")
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"defi-backend/config"
+	"defi-backend/models"
+	"defi-backend/repository"
+)
+
+// marketRateOverrides 记录被配置中心覆盖过的市场及其在数据库中的原始参数，
+// 配置中移除某个市场时用于恢复
+type marketRateOverrides struct {
+	mu       sync.Mutex
+	baseline map[string]config.MarketRateConfig
+}
+
+// ApplyMarketRates 按配置覆盖借贷市场的利率参数。
+// 参数生效前先按旧参数累计利息；overrides 中不再出现的市场恢复原始参数，
+// 因此用旧配置再调用一次即可回滚。任一市场失败时不修改任何市场
+func (s *DefiService) ApplyMarketRates(overrides map[string]config.MarketRateConfig) error {
+	s.rates.mu.Lock()
+	defer s.rates.mu.Unlock()
+
+	// viper 会把 map 的键转成小写，这里统一按小写匹配代币
+	wanted := make(map[string]config.MarketRateConfig, len(overrides))
+	for token, override := range overrides {
+		wanted[strings.ToLower(token)] = override
+	}
+	tokens := make(map[string]bool)
+	for token := range wanted {
+		tokens[token] = true
+	}
+	for token := range s.rates.baseline {
+		tokens[token] = true
+	}
+
+	baseline := make(map[string]config.MarketRateConfig)
+	err := s.store.Transaction(func(tx repository.Store) error {
+		markets, err := listedByLowerToken(tx.Markets())
+		if err != nil {
+			return err
+		}
+		for token := range tokens {
+			listed, ok := markets[token]
+			if !ok {
+				return ErrMarketNotListed
+			}
+			// 保存时会写回整行，先锁定再读取最新的总量和指数
+			market, err := tx.Markets().LockListed(listed.Token)
+			if err != nil {
+				return ErrMarketNotListed
+			}
+			state, err := loadMarketState(market)
+			if err != nil {
+				return err
+			}
+			state.accrue(time.Now())
+
+			original, ok := s.rates.baseline[token]
+			if !ok {
+				original = marketRateConfig(market)
+			}
+			params := original
+			override, ok := wanted[token]
+			if ok {
+				baseline[token] = original
+				params = mergeMarketRates(original, override)
+			}
+			market.RateModel = params.RateModel
+			market.BaseRatePerYear = params.BaseRatePerYear
+			market.MultiplierPerYear = params.MultiplierPerYear
+			market.JumpMultiplierPerYear = params.JumpMultiplierPerYear
+			market.Kink = params.Kink
+			market.ReserveFactor = params.ReserveFactor
+
+			// 确认新参数能够构造利率模型
+			if _, err := loadMarketState(market); err != nil {
+				return err
+			}
+			if err := tx.Markets().Save(market); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.rates.baseline = baseline
+	return nil
+}
+
+// listedByLowerToken 按小写代币地址索引已上线的市场，同一地址有多条时取 ID 最小的
+func listedByLowerToken(markets repository.MarketRepository) (map[string]*models.LendingMarket, error) {
+	rows, err := markets.ListListed(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	byToken := make(map[string]*models.LendingMarket, len(rows))
+	for i := range rows {
+		token := strings.ToLower(rows[i].Token)
+		if _, ok := byToken[token]; !ok {
+			byToken[token] = &rows[i]
+		}
+	}
+	return byToken, nil
+}
+
+func marketRateConfig(market *models.LendingMarket) config.MarketRateConfig {
+	return config.MarketRateConfig{
+		RateModel:             market.RateModel,
+		BaseRatePerYear:       market.BaseRatePerYear,
+		MultiplierPerYear:     market.MultiplierPerYear,
+		JumpMultiplierPerYear: market.JumpMultiplierPerYear,
+		Kink:                  market.Kink,
+		ReserveFactor:         market.ReserveFactor,
+	}
+}
+
+// mergeMarketRates 用 override 中的非空字段覆盖 base
+func mergeMarketRates(base, override config.MarketRateConfig) config.MarketRateConfig {
+	pick := func(a, b string) string {
+		if b != "" {
+			return b
+		}
+		return a
+	}
+	return config.MarketRateConfig{
+		RateModel:             pick(base.RateModel, override.RateModel),
+		BaseRatePerYear:       pick(base.BaseRatePerYear, override.BaseRatePerYear),
+		MultiplierPerYear:     pick(base.MultiplierPerYear, override.MultiplierPerYear),
+		JumpMultiplierPerYear: pick(base.JumpMultiplierPerYear, override.JumpMultiplierPerYear),
+		Kink:                  pick(base.Kink, override.Kink),
+		ReserveFactor:         pick(base.ReserveFactor, override.ReserveFactor),
+	}
+}
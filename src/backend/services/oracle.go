@@ -0,0 +1,392 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"defi-backend/config"
+	"defi-backend/models"
+	"defi-backend/repository"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 报价来源的类型。外部报价 (price_updates 队列) 的 Source 必须是 OracleConfig.Sources 中的
+// "cex:<名称>"，例如 cex:binance；dex 和 manual 只由 RunDexQuotes 和 SetManualPrice 在内部提交。
+// 每个不同的 Source 计为一个来源
+const (
+	SourceCEX    = "cex"
+	SourceDEX    = "dex"
+	SourceManual = "manual"
+)
+
+// SourceOracle 预言机发布的聚合价格的来源
+const SourceOracle = "oracle"
+
+// 报价在聚合中的状态
+const (
+	QuoteAccepted = "accepted"
+	QuoteStale    = "stale"
+	QuoteOutlier  = "outlier"
+)
+
+var (
+	ErrInvalidQuote = errors.New("invalid price quote")
+	// ErrNoPriceSources 代币没有任何来源的报价
+	ErrNoPriceSources = errors.New("no price sources")
+	// ErrPriceUnavailable 有报价但有效来源不足，价格不可信
+	ErrPriceUnavailable = errors.New("price unavailable")
+)
+
+// OracleQuote 一个来源的最新报价
+type OracleQuote struct {
+	PriceUpdate
+	Status string `json:"status"`
+}
+
+// OraclePrice 一个代币的聚合结果，Price 为被采用报价的中位数，Timestamp 为其中最新报价的时间；
+// 来源不足时 Price 为 0，Error 说明原因
+type OraclePrice struct {
+	Token     string        `json:"token"`
+	Price     float64       `json:"price"`
+	Timestamp int64         `json:"timestamp"`
+	Quotes    []OracleQuote `json:"quotes"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Oracle 按来源保存报价并计算可信的中位数价格。报价保存在 Redis 的 oracle:<token> hash 中，
+// 多个实例共享；聚合在读取时进行，报价是否过期始终按当前时间判断
+type Oracle struct {
+	redisClient *redis.Client
+	prices      *PriceService
+	store       repository.Store
+	twap        *TWAPService
+
+	mu  sync.RWMutex
+	cfg config.OracleConfig
+}
+
+// NewOracle twap 为空时 DEX 价格只能使用现货价格
+func NewOracle(redisClient *redis.Client, prices *PriceService, store repository.Store, twap *TWAPService, cfg config.OracleConfig) *Oracle {
+	return &Oracle{
+		redisClient: redisClient,
+		prices:      prices,
+		store:       store,
+		twap:        twap,
+		cfg:         cfg,
+	}
+}
+
+// SetConfig 应用热更新的配置
+func (o *Oracle) SetConfig(cfg config.OracleConfig) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.cfg = cfg
+}
+
+func (o *Oracle) config() config.OracleConfig {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.cfg
+}
+
+func oracleKey(token string) string {
+	return fmt.Sprintf("oracle:%s", token)
+}
+
+func sourceKind(source string) string {
+	kind, _, _ := strings.Cut(source, ":")
+	return kind
+}
+
+func (o *Oracle) maxAge(source string) time.Duration {
+	cfg := o.config()
+	if sourceKind(source) == SourceManual {
+		return cfg.ManualMaxAge
+	}
+	return cfg.MaxAge
+}
+
+// saveQuoteScript 只在报价比同一来源已保存的报价新时写入，乱序到达的旧报价被忽略
+var saveQuoteScript = redis.NewScript(`
+local saved = redis.call('HGET', KEYS[1], ARGV[1])
+if saved and cjson.decode(saved).timestamp > tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// Submit 保存一个外部来源的报价，来源必须在配置中列出，见 submit。
+// 报价无效、来源未配置或到达时已经过期时返回 ErrInvalidQuote
+func (o *Oracle) Submit(ctx context.Context, quote PriceUpdate) error {
+	if !o.externalSource(quote.Source) {
+		return fmt.Errorf("%w: unknown source %q", ErrInvalidQuote, quote.Source)
+	}
+	return o.submit(ctx, quote)
+}
+
+// SetManualPrice 以 manual 来源提交管理员价格，与其他来源一起参与聚合
+func (o *Oracle) SetManualPrice(ctx context.Context, token string, price float64) error {
+	return o.submit(ctx, PriceUpdate{Token: token, Price: price, Source: SourceManual})
+}
+
+// submit 保存报价，聚合后满足条件时通过 PriceService 发布中位数价格；来源不足不是错误，只是不发布价格。
+// 不检查来源，外部报价由 Submit 检查
+func (o *Oracle) submit(ctx context.Context, quote PriceUpdate) error {
+	now := time.Now()
+	ts, err := normalizeTimestamp(quote.Timestamp, now)
+	if err != nil {
+		return err
+	}
+	quote.Timestamp = ts
+	if err := o.validate(quote, now); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(quote)
+	if err != nil {
+		return fmt.Errorf("failed to encode quote: %v", err)
+	}
+	if err := saveQuoteScript.Run(ctx, o.redisClient, []string{oracleKey(quote.Token)}, quote.Source, data, quote.Timestamp).Err(); err != nil {
+		return fmt.Errorf("failed to save quote: %v", err)
+	}
+
+	price, err := o.Price(ctx, quote.Token)
+	if errors.Is(err, ErrPriceUnavailable) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return o.prices.UpdatePrice(PriceUpdate{
+		Token:     price.Token,
+		Price:     price.Price,
+		Timestamp: price.Timestamp,
+		Source:    SourceOracle,
+	})
+}
+
+func (o *Oracle) validate(quote PriceUpdate, now time.Time) error {
+	if quote.Token == "" {
+		return fmt.Errorf("%w: token is required", ErrInvalidQuote)
+	}
+	if !(quote.Price > 0) || math.IsInf(quote.Price, 0) {
+		return fmt.Errorf("%w: price must be positive", ErrInvalidQuote)
+	}
+	maxAge := o.maxAge(quote.Source)
+	at := time.UnixMilli(quote.Timestamp)
+	if now.Sub(at) > maxAge {
+		return fmt.Errorf("%w: quote from %s is stale", ErrInvalidQuote, quote.Source)
+	}
+	// 来源的时钟最多允许比本机快 MaxAge
+	if at.Sub(now) > maxAge {
+		return fmt.Errorf("%w: quote from %s is in the future", ErrInvalidQuote, quote.Source)
+	}
+	return nil
+}
+
+// externalSource 外部报价只接受配置中列出的具名来源
+func (o *Oracle) externalSource(source string) bool {
+	for _, allowed := range o.config().Sources {
+		if source == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveQuote 删除一个来源的报价，例如撤销手动价格
+func (o *Oracle) RemoveQuote(ctx context.Context, token, source string) error {
+	if err := o.redisClient.HDel(ctx, oracleKey(token), source).Err(); err != nil {
+		return fmt.Errorf("failed to remove quote: %v", err)
+	}
+	return nil
+}
+
+// Inspect 返回代币所有来源的报价和聚合结果，来源不足时结果的 Error 不为空
+func (o *Oracle) Inspect(ctx context.Context, token string) (*OraclePrice, error) {
+	saved, err := o.redisClient.HGetAll(ctx, oracleKey(token)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quotes: %v", err)
+	}
+
+	result := &OraclePrice{Token: token, Quotes: make([]OracleQuote, 0, len(saved))}
+	for _, data := range saved {
+		var quote OracleQuote
+		if err := json.Unmarshal([]byte(data), &quote.PriceUpdate); err != nil {
+			continue
+		}
+		result.Quotes = append(result.Quotes, quote)
+	}
+	sort.Slice(result.Quotes, func(i, j int) bool { return result.Quotes[i].Source < result.Quotes[j].Source })
+	if len(result.Quotes) == 0 {
+		result.Error = ErrNoPriceSources.Error()
+		return result, nil
+	}
+
+	// 先排除过期报价，再按新鲜报价的中位数剔除偏离过大的报价
+	cfg := o.config()
+	now := time.Now()
+	var fresh []float64
+	for i := range result.Quotes {
+		quote := &result.Quotes[i]
+		if now.Sub(time.UnixMilli(quote.Timestamp)) > o.maxAge(quote.Source) {
+			quote.Status = QuoteStale
+			continue
+		}
+		quote.Status = QuoteAccepted
+		fresh = append(fresh, quote.Price)
+	}
+	var accepted []float64
+	if len(fresh) > 0 {
+		mid := median(fresh)
+		for i := range result.Quotes {
+			quote := &result.Quotes[i]
+			if quote.Status != QuoteAccepted {
+				continue
+			}
+			if math.Abs(quote.Price-mid)/mid > cfg.MaxDeviation {
+				quote.Status = QuoteOutlier
+				continue
+			}
+			accepted = append(accepted, quote.Price)
+			if quote.Timestamp > result.Timestamp {
+				result.Timestamp = quote.Timestamp
+			}
+		}
+	}
+
+	if len(accepted) < cfg.MinSources {
+		result.Timestamp = 0
+		result.Error = fmt.Sprintf("%v: %d of %d required sources", ErrPriceUnavailable, len(accepted), cfg.MinSources)
+		return result, nil
+	}
+	result.Price = median(accepted)
+	return result, nil
+}
+
+// Price 返回可信的聚合价格；没有任何报价时返回 ErrNoPriceSources，来源不足时返回 ErrPriceUnavailable
+func (o *Oracle) Price(ctx context.Context, token string) (*OraclePrice, error) {
+	result, err := o.Inspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Quotes) == 0 {
+		return nil, ErrNoPriceSources
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("%w: %s", ErrPriceUnavailable, token)
+	}
+	return result, nil
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// RunDexQuotes 每隔 DexInterval 计算 DEX 价格并以 dex 来源提交，直到 ctx 结束。
+// 只使用与 DexQuoteTokens 组成的交易对，报价代币按 1 计价；同一代币有多个交易对时取当前流动性最大的。
+// DexPrice 为 twap 时使用该交易对最近 DexTWAPWindow 的 TWAP，观测点不足时不提交
+func (o *Oracle) RunDexQuotes(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(o.config().DexInterval):
+		}
+		if err := o.submitDexQuotes(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error submitting dex quotes: %v", err)
+		}
+	}
+}
+
+func (o *Oracle) submitDexQuotes(ctx context.Context) error {
+	cfg := o.config()
+	if cfg.DexPrice == config.DexPriceTWAP && o.twap == nil {
+		return errors.New("twap service is not configured")
+	}
+	quoteTokens := make(map[string]bool)
+	for _, token := range cfg.DexQuoteTokens {
+		quoteTokens[strings.ToLower(token)] = true
+	}
+	if len(quoteTokens) == 0 {
+		return nil
+	}
+
+	pairs, err := o.store.Pairs().List(ctx)
+	if err != nil {
+		return err
+	}
+	// 每个代币取报价代币一侧储备最大的交易对
+	type spot struct {
+		pair      *models.TradingPair
+		price     float64
+		liquidity *big.Rat
+	}
+	best := make(map[string]spot)
+	for i := range pairs {
+		pair := &pairs[i]
+		if !pair.IsActive {
+			continue
+		}
+		reserve0, reserve1, err := PairReserves(pair)
+		if err != nil || reserve0.Sign() <= 0 || reserve1.Sign() <= 0 {
+			continue
+		}
+		amount0 := models.NewAmount(reserve0, pair.Decimals0).Rat()
+		amount1 := models.NewAmount(reserve1, pair.Decimals1).Rat()
+
+		token, base, quote := pair.Token0, amount0, amount1
+		switch {
+		case quoteTokens[strings.ToLower(pair.Token1)] && !quoteTokens[strings.ToLower(pair.Token0)]:
+		case quoteTokens[strings.ToLower(pair.Token0)] && !quoteTokens[strings.ToLower(pair.Token1)]:
+			token, base, quote = pair.Token1, amount1, amount0
+		default:
+			continue
+		}
+		if current, ok := best[token]; ok && current.liquidity.Cmp(quote) >= 0 {
+			continue
+		}
+		price, _ := new(big.Rat).Quo(quote, base).Float64()
+		best[token] = spot{pair: pair, price: price, liquidity: quote}
+	}
+
+	now := time.Now().UnixMilli()
+	for token, s := range best {
+		price := s.price
+		if cfg.DexPrice == config.DexPriceTWAP {
+			twap, err := o.twap.TWAP(ctx, s.pair, now-cfg.DexTWAPWindow.Milliseconds(), now)
+			if errors.Is(err, ErrTWAPUnavailable) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			price = twap.Price0
+			if token == s.pair.Token1 {
+				price = twap.Price1
+			}
+		}
+		err := o.submit(ctx, PriceUpdate{Token: token, Price: price, Timestamp: now, Source: SourceDEX})
+		if err != nil && !errors.Is(err, ErrInvalidQuote) {
+			return err
+		}
+	}
+	return nil
+}
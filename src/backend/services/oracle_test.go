@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"defi-backend/config"
+)
+
+func testOracleConfig() config.OracleConfig {
+	return config.OracleConfig{
+		Sources:       []string{"cex:binance", "cex:coinbase", "cex:okx"},
+		MaxAge:        2 * time.Minute,
+		ManualMaxAge:  24 * time.Hour,
+		MaxDeviation:  0.05,
+		MinSources:    2,
+		DexInterval:   30 * time.Second,
+		DexPrice:      config.DexPriceSpot,
+		DexTWAPWindow: 30 * time.Minute,
+	}
+}
+
+func newTestOracle(t *testing.T) *Oracle {
+	t.Helper()
+	prices, _, store := newCandleTest(t)
+	return NewOracle(prices.redisClient, prices, store, nil, testOracleConfig())
+}
+
+func TestOracleRejectsUnknownSources(t *testing.T) {
+	o := newTestOracle(t)
+	ctx := context.Background()
+	// 队列中的报价不能冒充内部的 dex 和 manual 来源
+	for _, source := range []string{"", "chainlink", SourceCEX, SourceDEX, SourceManual, "cex:evil", "cex:Binance", "dex:uniswap", "manual:admin"} {
+		err := o.Submit(ctx, PriceUpdate{Token: "ETH", Price: 2000, Source: source})
+		if !errors.Is(err, ErrInvalidQuote) {
+			t.Errorf("Submit from %q err = %v, want ErrInvalidQuote", source, err)
+		}
+	}
+	if err := o.Submit(ctx, PriceUpdate{Token: "ETH", Price: 2000, Source: "cex:binance"}); err != nil {
+		t.Errorf("Submit from cex:binance: %v", err)
+	}
+	if err := o.SetManualPrice(ctx, "ETH", 2000); err != nil {
+		t.Errorf("SetManualPrice: %v", err)
+	}
+
+	// 热更新后新来源立即生效
+	cfg := testOracleConfig()
+	cfg.Sources = append(cfg.Sources, "cex:kraken")
+	o.SetConfig(cfg)
+	if err := o.Submit(ctx, PriceUpdate{Token: "ETH", Price: 2000, Source: "cex:kraken"}); err != nil {
+		t.Fatalf("Submit from configured cex:kraken: %v", err)
+	}
+}
+
+func TestOracleMedianWithGuards(t *testing.T) {
+	o := newTestOracle(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	submit := func(source string, price float64, at time.Time) {
+		t.Helper()
+		if err := o.Submit(ctx, PriceUpdate{Token: "ETH", Price: price, Timestamp: at.UnixMilli(), Source: source}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	submit("cex:binance", 2000, now)
+	if _, err := o.Price(ctx, "ETH"); !errors.Is(err, ErrPriceUnavailable) {
+		t.Fatalf("one source err = %v, want ErrPriceUnavailable", err)
+	}
+	submit("cex:coinbase", 2010, now)
+	submit("cex:okx", 2500, now)
+	// 手动价格的有效期更长
+	if err := o.submit(ctx, PriceUpdate{Token: "ETH", Price: 2004, Timestamp: now.Add(-time.Hour).UnixMilli(), Source: SourceManual}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := o.Price(ctx, "ETH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Price != 2004 {
+		t.Fatalf("price = %v, want median 2004 of the accepted quotes", result.Price)
+	}
+	statuses := make(map[string]string)
+	for _, q := range result.Quotes {
+		statuses[q.Source] = q.Status
+	}
+	if statuses["cex:okx"] != QuoteOutlier || statuses["cex:binance"] != QuoteAccepted || statuses[SourceManual] != QuoteAccepted {
+		t.Fatalf("quote statuses = %v", statuses)
+	}
+
+	// 过期和来自未来的报价直接拒绝，乱序到达的旧报价不覆盖新报价
+	if err := o.Submit(ctx, PriceUpdate{Token: "ETH", Price: 1, Timestamp: now.Add(-3 * time.Minute).UnixMilli(), Source: "cex:binance"}); !errors.Is(err, ErrInvalidQuote) {
+		t.Fatalf("stale quote err = %v", err)
+	}
+	if err := o.Submit(ctx, PriceUpdate{Token: "ETH", Price: 1, Timestamp: now.Add(3 * time.Minute).UnixMilli(), Source: "cex:binance"}); !errors.Is(err, ErrInvalidQuote) {
+		t.Fatalf("future quote err = %v", err)
+	}
+	submit("cex:binance", 1900, now.Add(-time.Second))
+	if result, err = o.Price(ctx, "ETH"); err != nil || result.Price != 2004 {
+		t.Fatalf("price after older quote = %+v, %v", result, err)
+	}
+
+	if _, err := o.Price(ctx, "BTC"); !errors.Is(err, ErrNoPriceSources) {
+		t.Fatalf("unknown token err = %v, want ErrNoPriceSources", err)
+	}
+}
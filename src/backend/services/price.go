@@ -3,8 +3,11 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -13,28 +16,69 @@ import (
 
 type PriceService struct {
 	redisClient *redis.Client
-	rabbitMQ    *amqp.Connection
+	openChannel func() (priceChannel, error)
+	candles     *CandleService
+	alerts      *AlertService
 }
 
+// priceChannel amqp.Channel 中消费价格更新用到的方法
+type priceChannel interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Close() error
+}
+
+// PriceUpdate 的 Timestamp 为 Unix 毫秒，为 0 时使用收到更新的时间，小于 1e12 时按 Unix 秒处理；
+// Source 为报价来源，见 Oracle，PriceService 发布的价格为 oracle
 type PriceUpdate struct {
 	Token     string  `json:"token"`
 	Price     float64 `json:"price"`
 	Timestamp int64   `json:"timestamp"`
+	Source    string  `json:"source,omitempty"`
+}
+
+var ErrInvalidTimestamp = errors.New("invalid timestamp")
+
+// normalizeTimestamp 返回 Unix 毫秒：0 使用 now，小于 1e12 (2001 年之前的毫秒) 的值视为 Unix 秒
+func normalizeTimestamp(ts int64, now time.Time) (int64, error) {
+	switch {
+	case ts < 0:
+		return 0, fmt.Errorf("%w: %d", ErrInvalidTimestamp, ts)
+	case ts == 0:
+		return now.UnixMilli(), nil
+	case ts < 1e12:
+		return ts * 1000, nil
+	}
+	return ts, nil
 }
 
-func NewPriceService(redisClient *redis.Client, rabbitMQ *amqp.Connection) *PriceService {
-	return &PriceService{
+// NewPriceService rabbitMQ 为空时不能消费价格队列，candles 为空时不维护 K 线，alerts 为空时不检查价格提醒
+func NewPriceService(redisClient *redis.Client, rabbitMQ *amqp.Connection, candles *CandleService, alerts *AlertService) *PriceService {
+	s := &PriceService{
 		redisClient: redisClient,
-		rabbitMQ:    rabbitMQ,
+		candles:     candles,
+		alerts:      alerts,
+	}
+	if rabbitMQ != nil {
+		s.openChannel = func() (priceChannel, error) { return rabbitMQ.Channel() }
 	}
+	return s
 }
 
-func (s *PriceService) StartPriceUpdates() error {
-	ch, err := s.rabbitMQ.Channel()
+// StartPriceUpdates 在后台消费 price_updates 队列，每条更新交给 handle，通常为 Oracle.Submit；
+// handle 为空时直接作为价格写入。channel 在 ctx 取消或连接断开时关闭
+func (s *PriceService) StartPriceUpdates(ctx context.Context, handle func(PriceUpdate) error) error {
+	if handle == nil {
+		handle = s.UpdatePrice
+	}
+	if s.openChannel == nil {
+		return errors.New("rabbitmq is not configured")
+	}
+
+	ch, err := s.openChannel()
 	if err != nil {
 		return fmt.Errorf("failed to open channel: %v", err)
 	}
-	defer ch.Close()
 
 	q, err := ch.QueueDeclare(
 		"price_updates",
@@ -45,6 +89,7 @@ func (s *PriceService) StartPriceUpdates() error {
 		nil,
 	)
 	if err != nil {
+		ch.Close()
 		return fmt.Errorf("failed to declare queue: %v", err)
 	}
 
@@ -58,18 +103,32 @@ func (s *PriceService) StartPriceUpdates() error {
 		nil,
 	)
 	if err != nil {
+		ch.Close()
 		return fmt.Errorf("failed to register consumer: %v", err)
 	}
 
 	go func() {
-		for msg := range msgs {
+		defer ch.Close()
+		for {
+			var msg amqp.Delivery
+			select {
+			case <-ctx.Done():
+				return
+			case delivery, ok := <-msgs:
+				if !ok {
+					log.Printf("Price updates channel closed")
+					return
+				}
+				msg = delivery
+			}
+
 			var update PriceUpdate
 			if err := json.Unmarshal(msg.Body, &update); err != nil {
 				log.Printf("Error decoding price update: %v", err)
 				continue
 			}
 
-			if err := s.UpdatePrice(update); err != nil {
+			if err := handle(update); err != nil {
 				log.Printf("Error updating price: %v", err)
 			}
 		}
@@ -81,18 +140,23 @@ func (s *PriceService) StartPriceUpdates() error {
 func (s *PriceService) UpdatePrice(update PriceUpdate) error {
 	ctx := context.Background()
 	key := fmt.Sprintf("price:%s", update.Token)
+	ts, err := normalizeTimestamp(update.Timestamp, time.Now())
+	if err != nil {
+		return err
+	}
+	update.Timestamp = ts
 
 	// Store price in Redis with expiration
-	err := s.redisClient.Set(ctx, key, update.Price, 24*time.Hour).Err()
+	err = s.redisClient.Set(ctx, key, update.Price, 24*time.Hour).Err()
 	if err != nil {
 		return fmt.Errorf("failed to set price in Redis: %v", err)
 	}
 
 	// Store price history
 	historyKey := fmt.Sprintf("price_history:%s", update.Token)
-	historyData := map[string]interface{}{
-		"price":     update.Price,
-		"timestamp": update.Timestamp,
+	historyData, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("failed to encode price update: %v", err)
 	}
 
 	err = s.redisClient.ZAdd(ctx, historyKey, &redis.Z{
@@ -106,6 +170,49 @@ func (s *PriceService) UpdatePrice(update PriceUpdate) error {
 	// Keep only last 1000 price points
 	s.redisClient.ZRemRangeByRank(ctx, historyKey, 0, -1001)
 
+	// 通知所有实例的 PriceHub
+	if err := s.redisClient.Publish(ctx, PriceUpdatesChannel, historyData).Err(); err != nil {
+		return fmt.Errorf("failed to publish price update: %v", err)
+	}
+
+	if s.candles != nil {
+		if err := s.candles.Record(ctx, update); err != nil {
+			return err
+		}
+	}
+	if s.alerts != nil {
+		return s.alerts.Evaluate(ctx, update)
+	}
+	return nil
+}
+
+// BackfillCandles 用 Redis 中保存的价格历史重建所有代币的 K 线，
+// 合并是幂等的，可以在接收实时更新的同时执行
+func (s *PriceService) BackfillCandles(ctx context.Context) error {
+	if s.candles == nil {
+		return nil
+	}
+	iter := s.redisClient.Scan(ctx, 0, "price_history:*", 100).Iterator()
+	for iter.Next(ctx) {
+		token := strings.TrimPrefix(iter.Val(), "price_history:")
+		history, err := s.GetPriceHistory(token, 0, math.MaxInt64)
+		if err != nil {
+			return err
+		}
+		for _, update := range history {
+			update.Token = token
+			// 历史中可能有修正之前按秒写入的价格点
+			if update.Timestamp, err = normalizeTimestamp(update.Timestamp, time.Now()); err != nil {
+				continue
+			}
+			if err := s.candles.Record(ctx, update); err != nil {
+				return err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to scan price history: %v", err)
+	}
 	return nil
 }
 
@@ -121,6 +228,23 @@ func (s *PriceService) GetCurrentPrice(token string) (float64, error) {
 	return price, nil
 }
 
+// LatestPrice 返回价格历史中最新的一条，没有历史时返回 nil
+func (s *PriceService) LatestPrice(ctx context.Context, token string) (*PriceUpdate, error) {
+	results, err := s.redisClient.ZRevRange(ctx, fmt.Sprintf("price_history:%s", token), 0, 0).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest price: %v", err)
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	var update PriceUpdate
+	if err := json.Unmarshal([]byte(results[0]), &update); err != nil {
+		return nil, fmt.Errorf("failed to decode latest price: %v", err)
+	}
+	update.Token = token
+	return &update, nil
+}
+
 func (s *PriceService) GetPriceHistory(token string, start, end int64) ([]PriceUpdate, error) {
 	ctx := context.Background()
 	key := fmt.Sprintf("price_history:%s", token)
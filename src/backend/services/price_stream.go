@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// PriceUpdatesChannel 价格更新广播的 Redis 频道。RabbitMQ 队列中的每条更新只由一个实例消费，
+// 消费后通过这个频道发给所有实例的 PriceHub
+const PriceUpdatesChannel = "price_updates"
+
+// 推送给订阅者的事件类型
+const (
+	PriceEventSnapshot = "snapshot"
+	PriceEventUpdate   = "update"
+)
+
+// PriceEvent 的 JSON 为 {"type": ..., "token": ..., "price": ..., "timestamp": ...}
+type PriceEvent struct {
+	Type string `json:"type"`
+	PriceUpdate
+}
+
+// PriceHub 把价格更新分发给本实例的订阅者
+type PriceHub struct {
+	redisClient *redis.Client
+	prices      *PriceService
+
+	mu   sync.Mutex
+	subs map[string]map[*PriceSubscription]struct{}
+}
+
+func NewPriceHub(redisClient *redis.Client, prices *PriceService) *PriceHub {
+	return &PriceHub{
+		redisClient: redisClient,
+		prices:      prices,
+		subs:        make(map[string]map[*PriceSubscription]struct{}),
+	}
+}
+
+// Run 订阅 PriceUpdatesChannel 并分发收到的更新，直到 ctx 结束；断线后由 go-redis 自动重新订阅
+func (h *PriceHub) Run(ctx context.Context) error {
+	pubsub := h.redisClient.Subscribe(ctx, PriceUpdatesChannel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to price updates: %v", err)
+	}
+
+	msgs := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			var update PriceUpdate
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err != nil {
+				log.Printf("Error decoding price update: %v", err)
+				continue
+			}
+			h.Publish(update)
+		}
+	}
+}
+
+// Publish 把 update 交给本实例中订阅了该代币的订阅者，不会阻塞
+func (h *PriceHub) Publish(update PriceUpdate) {
+	h.mu.Lock()
+	subs := make([]*PriceSubscription, 0, len(h.subs[update.Token]))
+	for sub := range h.subs[update.Token] {
+		subs = append(subs, sub)
+	}
+	h.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.offer(PriceEvent{Type: PriceEventUpdate, PriceUpdate: update})
+	}
+}
+
+// Subscribe 创建订阅并放入 tokens 的当前价格快照
+func (h *PriceHub) Subscribe(ctx context.Context, tokens []string) (*PriceSubscription, error) {
+	sub := &PriceSubscription{
+		hub:     h,
+		tokens:  make(map[string]bool),
+		pending: make(map[string]PriceEvent),
+		sent:    make(map[string]int64),
+		ready:   make(chan struct{}, 1),
+	}
+	if err := sub.Add(ctx, tokens); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (h *PriceHub) register(sub *PriceSubscription, token string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[token] == nil {
+		h.subs[token] = make(map[*PriceSubscription]struct{})
+	}
+	h.subs[token][sub] = struct{}{}
+}
+
+func (h *PriceHub) unregister(sub *PriceSubscription, token string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[token], sub)
+	if len(h.subs[token]) == 0 {
+		delete(h.subs, token)
+	}
+}
+
+// PriceSubscription 一个客户端的订阅。每个代币只保留最新一条未发送的事件：
+// 客户端读得慢时跳过中间的价格而不是无限堆积，也不会拖慢其他订阅者
+type PriceSubscription struct {
+	hub *PriceHub
+
+	mu      sync.Mutex
+	tokens  map[string]bool
+	pending map[string]PriceEvent
+	order   []string
+	// sent 每个代币已发送的最新时间戳，更旧的事件不再发送
+	sent    map[string]int64
+	dropped int
+	closed  bool
+	ready   chan struct{}
+}
+
+// Add 订阅 tokens，已订阅的代币不会重复发送快照。
+// 先注册再读取快照，两者之间到达的更新不会丢失，较旧的快照会被丢弃
+func (s *PriceSubscription) Add(ctx context.Context, tokens []string) error {
+	var added []string
+	s.mu.Lock()
+	for _, token := range tokens {
+		if !s.tokens[token] && !s.closed {
+			s.tokens[token] = true
+			added = append(added, token)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, token := range added {
+		s.hub.register(s, token)
+	}
+	for _, token := range added {
+		latest, err := s.hub.prices.LatestPrice(ctx, token)
+		if err != nil {
+			return err
+		}
+		if latest != nil {
+			s.offer(PriceEvent{Type: PriceEventSnapshot, PriceUpdate: *latest})
+		}
+	}
+	return nil
+}
+
+// Remove 取消订阅 tokens，丢弃还没发送的事件
+func (s *PriceSubscription) Remove(tokens []string) {
+	s.mu.Lock()
+	var removed []string
+	for _, token := range tokens {
+		if s.tokens[token] {
+			delete(s.tokens, token)
+			delete(s.pending, token)
+			delete(s.sent, token)
+			removed = append(removed, token)
+		}
+	}
+	order := s.order[:0]
+	for _, token := range s.order {
+		if s.tokens[token] {
+			order = append(order, token)
+		}
+	}
+	s.order = order
+	s.mu.Unlock()
+
+	for _, token := range removed {
+		s.hub.unregister(s, token)
+	}
+}
+
+// Len 返回已订阅的代币数
+func (s *PriceSubscription) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tokens)
+}
+
+// Ready 在有待发送的事件时可读，之后调用 Drain 取出
+func (s *PriceSubscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Drain 取出所有待发送的事件，按代币进入队列的顺序
+func (s *PriceSubscription) Drain() []PriceEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]PriceEvent, 0, len(s.order))
+	for _, token := range s.order {
+		event := s.pending[token]
+		events = append(events, event)
+		s.sent[token] = event.Timestamp
+		delete(s.pending, token)
+	}
+	s.order = s.order[:0]
+	return events
+}
+
+// Dropped 返回因为客户端读得慢而被更新的价格覆盖掉的事件数
+func (s *PriceSubscription) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close 取消所有订阅，可以重复调用
+func (s *PriceSubscription) Close() {
+	s.mu.Lock()
+	s.closed = true
+	tokens := make([]string, 0, len(s.tokens))
+	for token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+	s.mu.Unlock()
+	s.Remove(tokens)
+}
+
+func (s *PriceSubscription) offer(event PriceEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token := event.Token
+	if s.closed || !s.tokens[token] {
+		return
+	}
+	if last, ok := s.sent[token]; ok && event.Timestamp <= last {
+		return
+	}
+	if queued, ok := s.pending[token]; ok {
+		if queued.Timestamp > event.Timestamp || event.Type == PriceEventSnapshot && queued.Timestamp == event.Timestamp {
+			return
+		}
+		if queued.Type == PriceEventUpdate {
+			s.dropped++
+		}
+	} else {
+		s.order = append(s.order, token)
+	}
+	s.pending[token] = event
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
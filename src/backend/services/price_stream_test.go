@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPriceSubscriptionCoalescesUpdates(t *testing.T) {
+	prices, _, _ := newCandleTest(t)
+	ctx := context.Background()
+	if err := prices.UpdatePrice(PriceUpdate{Token: "ETH", Price: 2000, Timestamp: 1_700_000_000_000}); err != nil {
+		t.Fatal(err)
+	}
+	hub := NewPriceHub(prices.redisClient, prices)
+
+	sub, err := hub.Subscribe(ctx, []string{"ETH", "BTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	events := sub.Drain()
+	if len(events) != 1 || events[0].Type != PriceEventSnapshot || events[0].Price != 2000 {
+		t.Fatalf("snapshot = %+v", events)
+	}
+
+	// 客户端没有读取时同一代币只保留最新的价格，旧价格和未订阅的代币被忽略
+	hub.Publish(PriceUpdate{Token: "ETH", Price: 2010, Timestamp: 1_700_000_001_000})
+	hub.Publish(PriceUpdate{Token: "BTC", Price: 40000, Timestamp: 1_700_000_001_000})
+	hub.Publish(PriceUpdate{Token: "ETH", Price: 2020, Timestamp: 1_700_000_002_000})
+	hub.Publish(PriceUpdate{Token: "ETH", Price: 1990, Timestamp: 1_700_000_000_500})
+	hub.Publish(PriceUpdate{Token: "SOL", Price: 100, Timestamp: 1_700_000_002_000})
+
+	select {
+	case <-sub.Ready():
+	default:
+		t.Fatal("subscription not ready after publish")
+	}
+	events = sub.Drain()
+	if len(events) != 2 || events[0].Token != "ETH" || events[0].Price != 2020 || events[1].Token != "BTC" {
+		t.Fatalf("events = %+v, want latest ETH then BTC", events)
+	}
+	if sub.Dropped() != 1 {
+		t.Fatalf("dropped = %d, want 1", sub.Dropped())
+	}
+
+	// 已发送过的时间戳不再重复发送
+	hub.Publish(PriceUpdate{Token: "ETH", Price: 2020, Timestamp: 1_700_000_002_000})
+	if events := sub.Drain(); len(events) != 0 {
+		t.Fatalf("duplicate events = %+v", events)
+	}
+
+	sub.Remove([]string{"BTC"})
+	hub.Publish(PriceUpdate{Token: "BTC", Price: 41000, Timestamp: 1_700_000_003_000})
+	if events := sub.Drain(); len(events) != 0 || sub.Len() != 1 {
+		t.Fatalf("events after Remove = %+v, subscribed = %d", events, sub.Len())
+	}
+
+	sub.Close()
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if len(hub.subs) != 0 {
+		t.Fatalf("hub still has subscribers after Close: %v", hub.subs)
+	}
+}
+
+func TestPriceHubFansOutRedisUpdates(t *testing.T) {
+	prices, _, _ := newCandleTest(t)
+	hub := NewPriceHub(prices.redisClient, prices)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- hub.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	sub, err := hub.Subscribe(ctx, []string{"ETH"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	// Run 订阅频道前发布的消息会丢失，重复发布直到收到
+	deadline := time.After(2 * time.Second)
+	for ts := int64(1_700_000_000_000); ; ts += 1000 {
+		if err := prices.UpdatePrice(PriceUpdate{Token: "ETH", Price: 2000, Timestamp: ts}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-sub.Ready():
+			for _, event := range sub.Drain() {
+				if event.Type == PriceEventUpdate && event.Price == 2000 {
+					return
+				}
+			}
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no update received through Redis")
+		}
+	}
+}
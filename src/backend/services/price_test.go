@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// fakePriceChannel 代替 RabbitMQ channel，deliveries 中的消息即队列中的消息
+type fakePriceChannel struct {
+	deliveries chan amqp.Delivery
+	closed     chan struct{}
+}
+
+func newFakePriceChannel() *fakePriceChannel {
+	return &fakePriceChannel{deliveries: make(chan amqp.Delivery, 1), closed: make(chan struct{})}
+}
+
+func (c *fakePriceChannel) QueueDeclare(name string, _, _, _, _ bool, _ amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakePriceChannel) Consume(string, string, bool, bool, bool, bool, amqp.Table) (<-chan amqp.Delivery, error) {
+	return c.deliveries, nil
+}
+
+func (c *fakePriceChannel) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func (c *fakePriceChannel) publish(t *testing.T, update PriceUpdate) {
+	t.Helper()
+	body, err := json.Marshal(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.deliveries <- amqp.Delivery{Body: body}
+}
+
+func TestPriceUpdatesConsumeAfterStart(t *testing.T) {
+	ch := newFakePriceChannel()
+	s := &PriceService{openChannel: func() (priceChannel, error) { return ch, nil }}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handled := make(chan PriceUpdate, 1)
+	if err := s.StartPriceUpdates(ctx, func(update PriceUpdate) error {
+		handled <- update
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ch.closed:
+		t.Fatal("channel closed when StartPriceUpdates returned")
+	default:
+	}
+
+	ch.publish(t, PriceUpdate{Token: "ETH", Price: 2000, Source: "cex:binance"})
+	select {
+	case update := <-handled:
+		if update.Token != "ETH" || update.Price != 2000 || update.Source != "cex:binance" {
+			t.Fatalf("handled %+v", update)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("published update was not handled")
+	}
+
+	cancel()
+	select {
+	case <-ch.closed:
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after context was cancelled")
+	}
+}
@@ -0,0 +1,364 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"defi-backend/models"
+	"defi-backend/repository"
+)
+
+// 与 Lending.sol 保持一致的常量
+var (
+	LendingBase = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+	// Lending.sol 没有清算逻辑，这里采用常见的 50% 清算上限和 8% 清算奖励
+	CloseFactor          = new(big.Int).Div(LendingBase, big.NewInt(2))
+	LiquidationIncentive = new(big.Int).Div(new(big.Int).Mul(LendingBase, big.NewInt(108)), big.NewInt(100))
+)
+
+var (
+	ErrMarketNotListed        = errors.New("market not listed")
+	ErrInsufficientCollateral = errors.New("insufficient collateral")
+	ErrInsufficientMarketCash = errors.New("insufficient liquidity")
+)
+
+// AccountLiquidity 账户风险状况，所有价值按 1e18 放大
+type AccountLiquidity struct {
+	UserID          uint     `json:"user_id"`
+	CollateralValue string   `json:"collateral_value"`
+	BorrowLimit     string   `json:"borrow_limit"`
+	BorrowValue     string   `json:"borrow_value"`
+	HealthFactor    *float64 `json:"health_factor"`
+	Liquidatable    bool     `json:"liquidatable"`
+
+	supplies map[string]*big.Int
+	borrows  map[string]*big.Int
+	limit    *big.Int
+	debt     *big.Int
+}
+
+// LiquidationCandidate 可被清算的账户以及单次清算的最大偿还和扣押数量
+type LiquidationCandidate struct {
+	UserID          uint          `json:"user_id"`
+	HealthFactor    float64       `json:"health_factor"`
+	BorrowToken     string        `json:"borrow_token"`
+	CollateralToken string        `json:"collateral_token"`
+	MaxRepay        models.Amount `json:"max_repay"`
+	SeizeAmount     models.Amount `json:"seize_amount"`
+}
+
+// PriceOracle 为风险计算提供可信价格，见 Oracle.Price
+type PriceOracle interface {
+	Price(ctx context.Context, token string) (*OraclePrice, error)
+}
+
+// RiskEngine 优先使用预言机的价格。代币没有任何预言机来源时使用市场中保存的合约价格；
+// 有来源但价格不可信时，涉及该代币的计算返回 ErrPriceUnavailable
+type RiskEngine struct {
+	store  repository.Store
+	oracle PriceOracle
+}
+
+// NewRiskEngine oracle 为空时只使用合约价格
+func NewRiskEngine(store repository.Store, oracle PriceOracle) *RiskEngine {
+	return &RiskEngine{store: store, oracle: oracle}
+}
+
+// AccountLiquidity 按 calculateCollateralValue 的规则计算抵押价值、借款价值和健康因子
+func (e *RiskEngine) AccountLiquidity(userID uint) (*AccountLiquidity, error) {
+	ctx := context.Background()
+	markets, err := e.markets(ctx, e.store)
+	if err != nil {
+		return nil, err
+	}
+
+	positions, err := e.store.Positions().ListActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return accountLiquidity(userID, positions, markets)
+}
+
+// CheckBorrow 校验借款后账户仍然安全，对应 Lending.sol borrow 中的 require。
+// tx 为写入借款的事务，校验前先锁定借款市场再锁定用户的仓位 (与 createPosition 的加锁顺序一致)，
+// 同一市场和同一用户并发的借款依次校验，见 DefiService.Borrow
+func (e *RiskEngine) CheckBorrow(tx repository.Store, userID uint, token string, borrowAmount models.Amount) error {
+	locked, err := accrueMarket(tx, token)
+	if err != nil {
+		return err
+	}
+	positions, err := tx.Positions().LockActive(userID)
+	if err != nil {
+		return err
+	}
+	markets, err := e.markets(context.Background(), tx)
+	if err != nil {
+		return err
+	}
+	market, ok := markets[token]
+	if !ok {
+		return ErrMarketNotListed
+	}
+	if market.priceErr != nil {
+		return market.priceErr
+	}
+	if borrowAmount.Sign() <= 0 {
+		return ErrInsufficientInputAmount
+	}
+	borrowAmount, err = borrowAmount.WithDecimals(locked.market.Decimals)
+	if err != nil {
+		return err
+	}
+	amount := borrowAmount.Raw()
+
+	// Lending.sol 只要求 totalSupply >= amount，借款不减少 totalSupply，多笔借款合计可以超过存款；
+	// 这里按锁定的市场行要求可借资金 (存款减去已借出) 足够
+	cash := new(big.Int).Sub(locked.totalSupply, locked.totalBorrows)
+	if cash.Cmp(amount) < 0 {
+		return ErrInsufficientMarketCash
+	}
+
+	account, err := accountLiquidity(userID, positions, markets)
+	if err != nil {
+		return err
+	}
+
+	debt := new(big.Int).Add(account.debt, tokenValue(amount, market.price))
+	if debt.Cmp(account.limit) > 0 {
+		return ErrInsufficientCollateral
+	}
+	return nil
+}
+
+// LiquidatableAccounts 列出健康因子低于 1 的账户，扫描全部仓位，可以在只读副本上查询；
+// 涉及价格不可信的代币的账户暂不列出
+func (e *RiskEngine) LiquidatableAccounts(ctx context.Context) ([]LiquidationCandidate, error) {
+	markets, err := e.markets(ctx, e.store)
+	if err != nil {
+		return nil, err
+	}
+
+	positions, err := e.store.Positions().ListAllActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byUser := make(map[uint][]models.LendingPosition)
+	for _, position := range positions {
+		byUser[position.UserID] = append(byUser[position.UserID], position)
+	}
+
+	var candidates []LiquidationCandidate
+	for userID, userPositions := range byUser {
+		account, err := accountLiquidity(userID, userPositions, markets)
+		if errors.Is(err, ErrPriceUnavailable) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !account.Liquidatable {
+			continue
+		}
+		if candidate, ok := liquidationCandidate(account, markets); ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].HealthFactor < candidates[j].HealthFactor
+	})
+	return candidates, nil
+}
+
+type marketParams struct {
+	price            *big.Int
+	collateralFactor *big.Int
+	state            *marketState
+	// priceErr 不为空时 price 不可信
+	priceErr error
+}
+
+func (e *RiskEngine) markets(ctx context.Context, store repository.Store) (map[string]marketParams, error) {
+	rows, err := store.Markets().ListListed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	markets := make(map[string]marketParams, len(rows))
+	now := time.Now()
+	for i := range rows {
+		row := &rows[i]
+		price, err := parseRaw(row.Price)
+		if err != nil {
+			return nil, fmt.Errorf("invalid price for market %s: %v", row.Token, err)
+		}
+		factor, err := parseRaw(row.CollateralFactor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid collateral factor for market %s: %v", row.Token, err)
+		}
+		// 只在内存中累计利息，用于得到当前的指数
+		state, err := loadMarketState(row)
+		if err != nil {
+			return nil, err
+		}
+		state.accrue(now)
+		market := marketParams{price: price, collateralFactor: factor, state: state}
+		if e.oracle != nil {
+			quote, err := e.oracle.Price(ctx, row.Token)
+			switch {
+			case err == nil:
+				market.price = lendingPrice(quote.Price, row.Decimals)
+			case errors.Is(err, ErrPriceUnavailable):
+				market.priceErr = err
+			case !errors.Is(err, ErrNoPriceSources):
+				return nil, err
+			}
+		}
+		markets[row.Token] = market
+	}
+	return markets, nil
+}
+
+// lendingPrice 把每个代币的价格换算为 Lending.sol prices[token] 的口径：
+// 最小单位的数量乘以价格再除以 BASE，得到按 1e18 放大的价值
+func lendingPrice(price float64, decimals uint8) *big.Int {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(36-int64(decimals)), nil)
+	raw, _ := new(big.Float).Mul(big.NewFloat(price), new(big.Float).SetInt(scale)).Int(nil)
+	return raw
+}
+
+func accountLiquidity(userID uint, positions []models.LendingPosition, markets map[string]marketParams) (*AccountLiquidity, error) {
+	account := &AccountLiquidity{
+		UserID:   userID,
+		supplies: make(map[string]*big.Int),
+		borrows:  make(map[string]*big.Int),
+	}
+
+	for _, position := range positions {
+		balances := account.supplies
+		if position.Type == models.PositionTypeBorrow {
+			balances = account.borrows
+		}
+		if balances[position.Token] == nil {
+			balances[position.Token] = new(big.Int)
+		}
+
+		balance := position.Amount.Raw()
+		if market, ok := markets[position.Token]; ok {
+			positionIndex, err := parseRaw(position.InterestIndex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid interest index for position %d: %v", position.ID, err)
+			}
+			balance = positionBalance(balance, positionIndex, market.state.index(position.Type))
+		}
+		balances[position.Token].Add(balances[position.Token], balance)
+	}
+
+	collateral, limit, debt := new(big.Int), new(big.Int), new(big.Int)
+	for token, amount := range account.supplies {
+		market, ok := markets[token]
+		if !ok {
+			continue
+		}
+		if market.priceErr != nil {
+			return nil, market.priceErr
+		}
+		value := tokenValue(amount, market.price)
+		collateral.Add(collateral, value)
+		limit.Add(limit, new(big.Int).Div(new(big.Int).Mul(value, market.collateralFactor), LendingBase))
+	}
+	for token, amount := range account.borrows {
+		market, ok := markets[token]
+		if !ok {
+			return nil, fmt.Errorf("borrow in unlisted market %s", token)
+		}
+		if market.priceErr != nil {
+			return nil, market.priceErr
+		}
+		debt.Add(debt, tokenValue(amount, market.price))
+	}
+
+	account.limit, account.debt = limit, debt
+	account.CollateralValue = collateral.String()
+	account.BorrowLimit = limit.String()
+	account.BorrowValue = debt.String()
+	if debt.Sign() > 0 {
+		hf, _ := new(big.Rat).SetFrac(limit, debt).Float64()
+		account.HealthFactor = &hf
+		account.Liquidatable = limit.Cmp(debt) < 0
+	}
+
+	return account, nil
+}
+
+// liquidationCandidate 选择价值最大的借款和抵押资产，计算最大偿还量和对应扣押量
+func liquidationCandidate(account *AccountLiquidity, markets map[string]marketParams) (LiquidationCandidate, bool) {
+	borrowToken := largestByValue(account.borrows, markets)
+	collateralToken := largestByValue(account.supplies, markets)
+	if borrowToken == "" || collateralToken == "" {
+		return LiquidationCandidate{}, false
+	}
+
+	borrowPrice := markets[borrowToken].price
+	collateralPrice := markets[collateralToken].price
+	if collateralPrice.Sign() == 0 {
+		return LiquidationCandidate{}, false
+	}
+
+	maxRepay := new(big.Int).Mul(account.borrows[borrowToken], CloseFactor)
+	maxRepay.Div(maxRepay, LendingBase)
+	seize := seizeAmount(maxRepay, borrowPrice, collateralPrice)
+
+	// 抵押物不足时按可扣押数量反推偿还量
+	if available := account.supplies[collateralToken]; seize.Cmp(available) > 0 {
+		seize = new(big.Int).Set(available)
+		maxRepay = new(big.Int).Mul(seize, collateralPrice)
+		maxRepay.Mul(maxRepay, LendingBase)
+		maxRepay.Div(maxRepay, new(big.Int).Mul(borrowPrice, LiquidationIncentive))
+	}
+
+	return LiquidationCandidate{
+		UserID:          account.UserID,
+		HealthFactor:    *account.HealthFactor,
+		BorrowToken:     borrowToken,
+		CollateralToken: collateralToken,
+		MaxRepay:        models.NewAmount(maxRepay, markets[borrowToken].state.market.Decimals),
+		SeizeAmount:     models.NewAmount(seize, markets[collateralToken].state.market.Decimals),
+	}, true
+}
+
+func seizeAmount(repay, borrowPrice, collateralPrice *big.Int) *big.Int {
+	seize := new(big.Int).Mul(repay, borrowPrice)
+	seize.Mul(seize, LiquidationIncentive)
+	return seize.Div(seize, new(big.Int).Mul(collateralPrice, LendingBase))
+}
+
+func largestByValue(balances map[string]*big.Int, markets map[string]marketParams) string {
+	var best string
+	var bestValue *big.Int
+	for token, amount := range balances {
+		market, ok := markets[token]
+		if !ok {
+			continue
+		}
+		value := tokenValue(amount, market.price)
+		if bestValue == nil || value.Cmp(bestValue) > 0 || (value.Cmp(bestValue) == 0 && token < best) {
+			best, bestValue = token, value
+		}
+	}
+	return best
+}
+
+// tokenValue 对应 calculateCollateralValue 中的 amount * prices[token] / BASE
+// 合约 borrow() 计算借款价值时没有除以 BASE，这里借贷两侧统一按同一口径计算
+func tokenValue(amount, price *big.Int) *big.Int {
+	value := new(big.Int).Mul(amount, price)
+	return value.Div(value, LendingBase)
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+
+	"defi-backend/models"
+	"defi-backend/repository"
+)
+
+// newLendingStore 两个 18 位精度、价格为 1 的市场，抵押率 75%
+func newLendingStore(t *testing.T) repository.Store {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	for _, token := range []string{"ETH", "USDC"} {
+		market := &models.LendingMarket{Token: token, Decimals: 18, Price: LendingBase.String(), IsListed: true}
+		if err := store.Markets().Create(market); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func units(t *testing.T, s string) models.Amount {
+	t.Helper()
+	amount, err := models.ParseUnits(s, 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amount
+}
+
+func TestBorrowRespectsCollateralUnderConcurrency(t *testing.T) {
+	store := newLendingStore(t)
+	defi := NewDefiService(store, nil)
+	risk := NewRiskEngine(store, nil)
+
+	if _, err := defi.CreateLendingPosition(1, "ETH", units(t, "100"), models.PositionTypeSupply); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := defi.CreateLendingPosition(2, "USDC", units(t, "1000"), models.PositionTypeSupply); err != nil {
+		t.Fatal(err)
+	}
+
+	// 借款上限为 75，每次借 10，最多成功 7 次
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var succeeded int
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := defi.Borrow(risk, 1, "USDC", units(t, "10"))
+			switch {
+			case err == nil:
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			case !errors.Is(err, ErrInsufficientCollateral):
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 7 {
+		t.Fatalf("succeeded borrows = %d, want 7", succeeded)
+	}
+	account, err := risk.AccountLiquidity(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Liquidatable {
+		t.Fatalf("account is liquidatable after concurrent borrows: %+v", account)
+	}
+}
+
+func TestBorrowRespectsMarketCashAcrossUsers(t *testing.T) {
+	store := newLendingStore(t)
+	defi := NewDefiService(store, nil)
+	risk := NewRiskEngine(store, nil)
+
+	for _, user := range []uint{1, 3} {
+		if _, err := defi.CreateLendingPosition(user, "ETH", units(t, "100"), models.PositionTypeSupply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := defi.CreateLendingPosition(2, "USDC", units(t, "30"), models.PositionTypeSupply); err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个用户的抵押都足够，市场只有 30 可借，每次借 10，合计最多成功 3 次
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var succeeded int
+	for i := 0; i < 10; i++ {
+		user := uint(1 + 2*(i%2))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := defi.Borrow(risk, user, "USDC", units(t, "10"))
+			switch {
+			case err == nil:
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			case !errors.Is(err, ErrInsufficientMarketCash):
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 3 {
+		t.Fatalf("succeeded borrows = %d, want 3", succeeded)
+	}
+	market, err := store.Markets().FindListed("USDC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if market.TotalBorrows != units(t, "30").Raw().String() {
+		t.Fatalf("total borrows = %s, want 30e18", market.TotalBorrows)
+	}
+}
+
+func TestLiquidatableAccounts(t *testing.T) {
+	store := newLendingStore(t)
+	defi := NewDefiService(store, nil)
+	risk := NewRiskEngine(store, nil)
+
+	if _, err := defi.CreateLendingPosition(1, "ETH", units(t, "100"), models.PositionTypeSupply); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := defi.CreateLendingPosition(2, "USDC", units(t, "1000"), models.PositionTypeSupply); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := defi.Borrow(risk, 1, "USDC", units(t, "70")); err != nil {
+		t.Fatal(err)
+	}
+
+	// ETH 价格下跌一半后借款上限为 37.5
+	market, err := store.Markets().FindListed("ETH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	market.Price = "500000000000000000"
+	if err := store.Markets().Save(market); err != nil {
+		t.Fatal(err)
+	}
+
+	candidates, err := risk.LiquidatableAccounts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 || candidates[0].UserID != 1 {
+		t.Fatalf("candidates = %+v, want user 1", candidates)
+	}
+	c := candidates[0]
+	if c.BorrowToken != "USDC" || c.CollateralToken != "ETH" {
+		t.Fatalf("candidate tokens = %s/%s", c.BorrowToken, c.CollateralToken)
+	}
+	if c.HealthFactor >= 1 || c.HealthFactor < 0.53 {
+		t.Fatalf("health factor = %v, want about 0.536", c.HealthFactor)
+	}
+	// 最多偿还一半借款，扣押价值为偿还价值的 108%
+	if got := c.MaxRepay.Float64(); math.Abs(got-35) > 1e-6 {
+		t.Fatalf("max repay = %v, want 35", got)
+	}
+	if got := c.SeizeAmount.Float64(); math.Abs(got-75.6) > 1e-6 {
+		t.Fatalf("seize amount = %v, want 75.6", got)
+	}
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"defi-backend/models"
+)
+
+const (
+	TradeTypeExactIn  = "exact_in"
+	TradeTypeExactOut = "exact_out"
+
+	DefaultMaxHops = 3
+	MaxAllowedHops = 5
+
+	// 拆单时把总量切成若干份，逐份分配给边际收益最好的路径
+	splitChunks = 20
+)
+
+var ErrNoRoute = errors.New("no route found")
+
+// RouteLeg 路径中的一跳，对应一个 Dex.sol 池子
+type RouteLeg struct {
+	PairID   uint   `json:"pair_id"`
+	TokenIn  string `json:"token_in"`
+	TokenOut string `json:"token_out"`
+}
+
+// SwapRoute 一条兑换路径及其分配到的数量
+type SwapRoute struct {
+	Path      []string      `json:"path"`
+	Legs      []RouteLeg    `json:"legs"`
+	AmountIn  models.Amount `json:"amount_in"`
+	AmountOut models.Amount `json:"amount_out"`
+}
+
+// RouteResult 路由结果，Routes 多于一条时表示拆单
+type RouteResult struct {
+	TradeType string        `json:"trade_type"`
+	TokenIn   string        `json:"token_in"`
+	TokenOut  string        `json:"token_out"`
+	AmountIn  models.Amount `json:"amount_in"`
+	AmountOut models.Amount `json:"amount_out"`
+	Routes    []SwapRoute   `json:"routes"`
+}
+
+// GetAmountIn 是 GetAmountOut 的反函数，返回得到 amountOut 所需的最小输入
+func GetAmountIn(amountOut, reserveIn, reserveOut *big.Int) (*big.Int, error) {
+	if amountOut == nil || amountOut.Sign() <= 0 {
+		return nil, ErrInsufficientOutput
+	}
+	if reserveIn == nil || reserveOut == nil || reserveIn.Sign() <= 0 || reserveOut.Sign() <= 0 {
+		return nil, ErrInsufficientLiquidity
+	}
+	if amountOut.Cmp(reserveOut) >= 0 {
+		return nil, ErrInsufficientLiquidity
+	}
+
+	numerator := new(big.Int).Mul(reserveIn, amountOut)
+	numerator.Mul(numerator, big.NewInt(SwapFeeDenominator))
+	denominator := new(big.Int).Sub(reserveOut, amountOut)
+	denominator.Mul(denominator, big.NewInt(SwapFeeNumerator))
+
+	amountIn := numerator.Quo(numerator, denominator)
+	return amountIn.Add(amountIn, big.NewInt(1)), nil
+}
+
+type poolState struct {
+	reserveIn  *big.Int
+	reserveOut *big.Int
+}
+
+// SwapGraph 由所有交易对构成的有向图，边方向为 Token0 -> Token1
+type SwapGraph struct {
+	edges    map[string][]*models.TradingPair
+	pools    map[uint]poolState
+	decimals map[string]uint8
+}
+
+func NewSwapGraph(pairs []models.TradingPair) *SwapGraph {
+	g := &SwapGraph{
+		edges:    make(map[string][]*models.TradingPair),
+		pools:    make(map[uint]poolState),
+		decimals: make(map[string]uint8),
+	}
+	for i := range pairs {
+		pair := &pairs[i]
+		if !poolExists(pair) {
+			continue
+		}
+		reserve0, reserve1, err := PairReserves(pair)
+		if err != nil || reserve0.Sign() <= 0 || reserve1.Sign() <= 0 {
+			continue
+		}
+		g.edges[pair.Token0] = append(g.edges[pair.Token0], pair)
+		g.decimals[pair.Token0] = pair.Decimals0
+		g.decimals[pair.Token1] = pair.Decimals1
+		g.pools[pair.ID] = poolState{reserveIn: reserve0, reserveOut: reserve1}
+	}
+	return g
+}
+
+// Paths 枚举 tokenIn 到 tokenOut 之间不超过 maxHops 跳的所有简单路径
+func (g *SwapGraph) Paths(tokenIn, tokenOut string, maxHops int) [][]*models.TradingPair {
+	var paths [][]*models.TradingPair
+	visited := map[string]bool{tokenIn: true}
+	var current []*models.TradingPair
+
+	var walk func(token string)
+	walk = func(token string) {
+		if len(current) >= maxHops {
+			return
+		}
+		for _, pair := range g.edges[token] {
+			if visited[pair.Token1] {
+				continue
+			}
+			current = append(current, pair)
+			if pair.Token1 == tokenOut {
+				paths = append(paths, append([]*models.TradingPair(nil), current...))
+			} else {
+				visited[pair.Token1] = true
+				walk(pair.Token1)
+				visited[pair.Token1] = false
+			}
+			current = current[:len(current)-1]
+		}
+	}
+	walk(tokenIn)
+
+	return paths
+}
+
+// FindRoute 寻找最优路径；maxSplits > 1 时允许把数量拆分到多条路径上
+// exact_in 时 amount 以 tokenIn 计价，exact_out 时以 tokenOut 计价
+func (g *SwapGraph) FindRoute(tradeType, tokenIn, tokenOut string, exactAmount models.Amount, maxHops, maxSplits int) (*RouteResult, error) {
+	if tradeType != TradeTypeExactIn && tradeType != TradeTypeExactOut {
+		return nil, fmt.Errorf("invalid trade type: %s", tradeType)
+	}
+	if exactAmount.Sign() <= 0 {
+		return nil, ErrInsufficientInputAmount
+	}
+	if tokenIn == tokenOut {
+		return nil, errors.New("token_in and token_out must differ")
+	}
+
+	exactToken := tokenIn
+	if tradeType == TradeTypeExactOut {
+		exactToken = tokenOut
+	}
+	decimals, ok := g.decimals[exactToken]
+	if !ok {
+		return nil, ErrNoRoute
+	}
+	exactAmount, err := exactAmount.WithDecimals(decimals)
+	if err != nil {
+		return nil, err
+	}
+	amount := exactAmount.Raw()
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
+	}
+	if maxHops > MaxAllowedHops {
+		maxHops = MaxAllowedHops
+	}
+	if maxSplits <= 0 {
+		maxSplits = 1
+	}
+
+	paths := g.Paths(tokenIn, tokenOut, maxHops)
+	if len(paths) == 0 {
+		return nil, ErrNoRoute
+	}
+
+	chunks := 1
+	if maxSplits > 1 && len(paths) > 1 {
+		chunks = splitChunks
+	}
+
+	state := g.clonePools()
+	allocIn := make([]*big.Int, len(paths))
+	allocOut := make([]*big.Int, len(paths))
+
+	remaining := new(big.Int).Set(amount)
+	chunkSize := new(big.Int).Quo(amount, big.NewInt(int64(chunks)))
+	for i := 0; i < chunks; i++ {
+		size := chunkSize
+		if i == chunks-1 || size.Sign() == 0 {
+			size = new(big.Int).Set(remaining)
+		}
+		if size.Sign() == 0 {
+			break
+		}
+
+		best, bestIn, bestOut := -1, (*big.Int)(nil), (*big.Int)(nil)
+		for idx, path := range paths {
+			// 已经用满拆单数量时只能继续往已选路径上加
+			if allocIn[idx] == nil && countUsed(allocIn) >= maxSplits {
+				continue
+			}
+			in, out, err := simulate(state, path, tradeType, size)
+			if err != nil {
+				continue
+			}
+			if best < 0 || better(tradeType, in, out, bestIn, bestOut) {
+				best, bestIn, bestOut = idx, in, out
+			}
+		}
+		if best < 0 {
+			return nil, ErrInsufficientLiquidity
+		}
+
+		apply(state, paths[best], tradeType, size)
+		if allocIn[best] == nil {
+			allocIn[best], allocOut[best] = new(big.Int), new(big.Int)
+		}
+		allocIn[best].Add(allocIn[best], bestIn)
+		allocOut[best].Add(allocOut[best], bestOut)
+		remaining.Sub(remaining, size)
+	}
+
+	result := &RouteResult{TradeType: tradeType, TokenIn: tokenIn, TokenOut: tokenOut}
+	totalIn, totalOut := new(big.Int), new(big.Int)
+	for idx, path := range paths {
+		if allocIn[idx] == nil {
+			continue
+		}
+		totalIn.Add(totalIn, allocIn[idx])
+		totalOut.Add(totalOut, allocOut[idx])
+		result.Routes = append(result.Routes, g.newSwapRoute(tokenIn, tokenOut, path, allocIn[idx], allocOut[idx]))
+	}
+	result.AmountIn = models.NewAmount(totalIn, g.decimals[tokenIn])
+	result.AmountOut = models.NewAmount(totalOut, g.decimals[tokenOut])
+
+	return result, nil
+}
+
+func (g *SwapGraph) clonePools() map[uint]poolState {
+	state := make(map[uint]poolState, len(g.pools))
+	for id, pool := range g.pools {
+		state[id] = poolState{
+			reserveIn:  new(big.Int).Set(pool.reserveIn),
+			reserveOut: new(big.Int).Set(pool.reserveOut),
+		}
+	}
+	return state
+}
+
+// simulate 在当前储备状态下计算一条路径的输入和输出，不修改状态
+func simulate(state map[uint]poolState, path []*models.TradingPair, tradeType string, amount *big.Int) (*big.Int, *big.Int, error) {
+	if tradeType == TradeTypeExactIn {
+		out := amount
+		for _, pair := range path {
+			pool := state[pair.ID]
+			next, err := GetAmountOut(out, pool.reserveIn, pool.reserveOut)
+			if err != nil {
+				return nil, nil, err
+			}
+			if next.Sign() <= 0 {
+				return nil, nil, ErrInsufficientOutput
+			}
+			out = next
+		}
+		return amount, out, nil
+	}
+
+	in := amount
+	for i := len(path) - 1; i >= 0; i-- {
+		pool := state[path[i].ID]
+		prev, err := GetAmountIn(in, pool.reserveIn, pool.reserveOut)
+		if err != nil {
+			return nil, nil, err
+		}
+		in = prev
+	}
+	return in, amount, nil
+}
+
+// apply 按 Dex.sol swap 的方式更新路径上每个池子的储备
+func apply(state map[uint]poolState, path []*models.TradingPair, tradeType string, amount *big.Int) {
+	amounts := make([]*big.Int, len(path)+1)
+	if tradeType == TradeTypeExactIn {
+		amounts[0] = amount
+		for i, pair := range path {
+			pool := state[pair.ID]
+			amounts[i+1], _ = GetAmountOut(amounts[i], pool.reserveIn, pool.reserveOut)
+		}
+	} else {
+		amounts[len(path)] = amount
+		for i := len(path) - 1; i >= 0; i-- {
+			pool := state[path[i].ID]
+			amounts[i], _ = GetAmountIn(amounts[i+1], pool.reserveIn, pool.reserveOut)
+		}
+	}
+
+	for i, pair := range path {
+		pool := state[pair.ID]
+		pool.reserveIn.Add(pool.reserveIn, amounts[i])
+		pool.reserveOut.Sub(pool.reserveOut, amounts[i+1])
+	}
+}
+
+func better(tradeType string, in, out, bestIn, bestOut *big.Int) bool {
+	if tradeType == TradeTypeExactIn {
+		return out.Cmp(bestOut) > 0
+	}
+	return in.Cmp(bestIn) < 0
+}
+
+func countUsed(alloc []*big.Int) int {
+	n := 0
+	for _, a := range alloc {
+		if a != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (g *SwapGraph) newSwapRoute(tokenIn, tokenOut string, path []*models.TradingPair, amountIn, amountOut *big.Int) SwapRoute {
+	route := SwapRoute{
+		Path:      []string{tokenIn},
+		AmountIn:  models.NewAmount(amountIn, g.decimals[tokenIn]),
+		AmountOut: models.NewAmount(amountOut, g.decimals[tokenOut]),
+	}
+	for _, pair := range path {
+		route.Path = append(route.Path, pair.Token1)
+		route.Legs = append(route.Legs, RouteLeg{
+			PairID:   pair.ID,
+			TokenIn:  pair.Token0,
+			TokenOut: pair.Token1,
+		})
+	}
+	return route
+}
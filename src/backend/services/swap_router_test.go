@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"defi-backend/models"
+)
+
+func testPair(id uint, token0, token1, reserve0, reserve1 string) models.TradingPair {
+	p := models.TradingPair{
+		Symbol:      token0 + "/" + token1,
+		Token0:      token0,
+		Token1:      token1,
+		Decimals0:   18,
+		Decimals1:   18,
+		Reserve0:    reserve0,
+		Reserve1:    reserve1,
+		TotalSupply: "1",
+		IsActive:    true,
+	}
+	p.ID = id
+	return p
+}
+
+func TestGetAmountInInvertsGetAmountOut(t *testing.T) {
+	reserveIn, reserveOut := big.NewInt(5_000_000), big.NewInt(3_000_000)
+	for _, out := range []int64{1, 997, 123_456, 2_999_999} {
+		amountOut := big.NewInt(out)
+		amountIn, err := GetAmountIn(amountOut, reserveIn, reserveOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// amountIn 足够得到 amountOut，少 1 则不够
+		got, _ := GetAmountOut(amountIn, reserveIn, reserveOut)
+		if got.Cmp(amountOut) < 0 {
+			t.Errorf("GetAmountOut(GetAmountIn(%d)) = %s", out, got)
+		}
+		if less, err := GetAmountOut(new(big.Int).Sub(amountIn, big.NewInt(1)), reserveIn, reserveOut); err == nil && less.Cmp(amountOut) >= 0 {
+			t.Errorf("GetAmountIn(%d) = %s is not minimal", out, amountIn)
+		}
+	}
+
+	if _, err := GetAmountIn(reserveOut, reserveIn, reserveOut); !errors.Is(err, ErrInsufficientLiquidity) {
+		t.Fatalf("draining the pool err = %v, want ErrInsufficientLiquidity", err)
+	}
+}
+
+func TestFindRouteMultiHop(t *testing.T) {
+	graph := NewSwapGraph([]models.TradingPair{
+		// 直连池子很浅，经 B 的两跳更好
+		testPair(1, "A", "C", "1000000000000000000", "1000000000000000000"),
+		testPair(2, "A", "B", "1000000000000000000000", "1000000000000000000000"),
+		testPair(3, "B", "C", "1000000000000000000000", "1000000000000000000000"),
+		testPair(4, "C", "A", "1000000000000000000000", "1000000000000000000000"),
+	})
+
+	if paths := graph.Paths("A", "C", 1); len(paths) != 1 {
+		t.Fatalf("one-hop paths = %d, want 1", len(paths))
+	}
+
+	result, err := graph.FindRoute(TradeTypeExactIn, "A", "C", units(t, "1"), 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Routes) != 1 {
+		t.Fatalf("routes = %d, want 1", len(result.Routes))
+	}
+	route := result.Routes[0]
+	if len(route.Legs) != 2 || route.Legs[0].PairID != 2 || route.Legs[1].PairID != 3 {
+		t.Fatalf("legs = %+v, want pairs 2 and 3", route.Legs)
+	}
+	if got := route.Path; len(got) != 3 || got[0] != "A" || got[1] != "B" || got[2] != "C" {
+		t.Fatalf("path = %v, want A -> B -> C", got)
+	}
+
+	if _, err := graph.FindRoute(TradeTypeExactIn, "A", "D", units(t, "1"), 0, 1); !errors.Is(err, ErrNoRoute) {
+		t.Fatalf("unknown token err = %v, want ErrNoRoute", err)
+	}
+}
+
+func TestFindRouteSplits(t *testing.T) {
+	graph := NewSwapGraph([]models.TradingPair{
+		testPair(1, "A", "B", "100000000000000000000", "100000000000000000000"),
+		testPair(2, "A", "B", "100000000000000000000", "100000000000000000000"),
+	})
+
+	single, err := graph.FindRoute(TradeTypeExactIn, "A", "B", units(t, "20"), 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	split, err := graph.FindRoute(TradeTypeExactIn, "A", "B", units(t, "20"), 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(single.Routes) != 1 || len(split.Routes) != 2 {
+		t.Fatalf("routes = %d/%d, want 1/2", len(single.Routes), len(split.Routes))
+	}
+	if split.AmountOut.Cmp(single.AmountOut) <= 0 {
+		t.Fatalf("split output %s is not better than %s", split.AmountOut, single.AmountOut)
+	}
+	if split.AmountIn.Cmp(units(t, "20")) != 0 {
+		t.Fatalf("split input = %s, want 20", split.AmountIn)
+	}
+}
+
+func TestFindRouteExactOut(t *testing.T) {
+	graph := NewSwapGraph([]models.TradingPair{
+		testPair(1, "A", "B", "1000000000000000000000", "1000000000000000000000"),
+		testPair(2, "B", "C", "1000000000000000000000", "1000000000000000000000"),
+	})
+
+	result, err := graph.FindRoute(TradeTypeExactOut, "A", "C", units(t, "10"), 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.AmountOut.Cmp(units(t, "10")) < 0 {
+		t.Fatalf("amount out = %s, want at least 10", result.AmountOut)
+	}
+	// 两跳各收 0.3% 手续费，再加上滑点
+	if result.AmountIn.Cmp(units(t, "10.2")) <= 0 || result.AmountIn.Cmp(units(t, "10.3")) >= 0 {
+		t.Fatalf("amount in = %s, want about 10.26", result.AmountIn)
+	}
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+
+	"defi-backend/models"
+	"defi-backend/repository"
+)
+
+type TransactionService struct {
+	transactions repository.TransactionRepository
+}
+
+func NewTransactionService(transactions repository.TransactionRepository) *TransactionService {
+	return &TransactionService{transactions: transactions}
+}
+
+func (s *TransactionService) CreateTransaction(tx *models.Transaction) error {
+	return s.transactions.Create(tx)
+}
+
+// UpsertTransaction 按 (TransactionHash, LogIndex) 写入，重复索引同一条日志时覆盖旧记录
+func (s *TransactionService) UpsertTransaction(tx *models.Transaction) error {
+	return s.transactions.Upsert(tx)
+}
+
+// GetUserTransactions 用户的交易历史，可以在只读副本上查询
+func (s *TransactionService) GetUserTransactions(ctx context.Context, userID uint, limit int) ([]models.Transaction, error) {
+	return s.transactions.ListByUser(ctx, userID, limit)
+}
+
+func (s *TransactionService) GetTransactionByHash(hash string) (*models.Transaction, error) {
+	return s.transactions.FindByHash(hash)
+}
+
+func (s *TransactionService) UpdateTransactionStatus(hash string, status string) error {
+	return s.transactions.UpdateStatus(hash, status)
+}
+
+// GetRecentTransactions 最近的交易，可以在只读副本上查询
+func (s *TransactionService) GetRecentTransactions(ctx context.Context, limit int) ([]models.Transaction, error) {
+	return s.transactions.ListRecent(ctx, limit)
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"defi-backend/chain"
+	"defi-backend/config"
+	"defi-backend/models"
+	"defi-backend/repository"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// twapMaxGapSamples 相邻观测点相隔超过这么多个采样间隔时认为采样中断，
+// 之前的观测点作废，跨越中断的区间无法计算 TWAP
+const twapMaxGapSamples = 3
+
+var (
+	ErrInvalidTWAPRange = errors.New("invalid twap range")
+	// ErrTWAPUnavailable 区间没有被连续的观测点覆盖
+	ErrTWAPUnavailable = errors.New("twap unavailable")
+)
+
+// ReserveReader 读取交易对当前的储备 (token0Reserve, token1Reserve)
+type ReserveReader interface {
+	Reserves(ctx context.Context, pair *models.TradingPair) (*big.Int, *big.Int, error)
+}
+
+// StoredReserves 使用数据库中交易对记录的储备
+type StoredReserves struct{}
+
+func (StoredReserves) Reserves(_ context.Context, pair *models.TradingPair) (*big.Int, *big.Int, error) {
+	return PairReserves(pair)
+}
+
+var poolsMethod = chain.MethodID("pools(address,address)")
+
+// ChainReserves 通过 eth_call 读取 Dex.sol 的 pools(token0, token1)
+type ChainReserves struct {
+	client *chain.Client
+	dex    string
+}
+
+func NewChainReserves(client *chain.Client, dex string) *ChainReserves {
+	return &ChainReserves{client: client, dex: dex}
+}
+
+func (r *ChainReserves) Reserves(ctx context.Context, pair *models.TradingPair) (*big.Int, *big.Int, error) {
+	token0, err := chain.AddressWord(pair.Token0)
+	if err != nil {
+		return nil, nil, err
+	}
+	token1, err := chain.AddressWord(pair.Token1)
+	if err != nil {
+		return nil, nil, err
+	}
+	data := make([]byte, 0, len(poolsMethod)+64)
+	data = append(append(append(data, poolsMethod...), token0...), token1...)
+	out, err := r.client.CallContract(ctx, r.dex, data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read reserves for pair %d: %v", pair.ID, err)
+	}
+	reserve0, err := chain.WordUint(out, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	reserve1, err := chain.WordUint(out, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reserve0, reserve1, nil
+}
+
+// TWAPObservation 一次储备采样。Price0 为 token0 以 token1 计价的现货价格，Price1 相反，均已按精度换算；
+// Cumulative0/1 为从第一个观测点起价格对时间 (秒) 的累计，每一段按段首观测点的价格计算
+type TWAPObservation struct {
+	Timestamp   int64   `json:"timestamp"`
+	Price0      float64 `json:"price0"`
+	Price1      float64 `json:"price1"`
+	Cumulative0 float64 `json:"cumulative0"`
+	Cumulative1 float64 `json:"cumulative1"`
+}
+
+// PairTWAP 交易对在 [From, To] (Unix 毫秒) 内的时间加权平均价格，Observations 为区间内的观测点数
+type PairTWAP struct {
+	PairID       uint    `json:"pair_id"`
+	Token0       string  `json:"token0"`
+	Token1       string  `json:"token1"`
+	From         int64   `json:"from"`
+	To           int64   `json:"to"`
+	Price0       float64 `json:"price0"`
+	Price1       float64 `json:"price1"`
+	Observations int64   `json:"observations"`
+}
+
+// TWAPService 定期采样交易对储备，把累计价格的观测点保存在 Redis 的 twap:<pairID> 中，
+// 按时间排序，多个实例共享。任意区间的 TWAP 为两端累计价格之差除以时长，
+// 短时间操纵储备只影响恰好被采样到的那一次
+type TWAPService struct {
+	redisClient *redis.Client
+	store       repository.Store
+	reserves    ReserveReader
+
+	mu  sync.RWMutex
+	cfg config.TWAPConfig
+}
+
+func NewTWAPService(redisClient *redis.Client, store repository.Store, reserves ReserveReader, cfg config.TWAPConfig) *TWAPService {
+	return &TWAPService{
+		redisClient: redisClient,
+		store:       store,
+		reserves:    reserves,
+		cfg:         cfg,
+	}
+}
+
+// SetConfig 应用热更新的配置
+func (s *TWAPService) SetConfig(cfg config.TWAPConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = cfg
+}
+
+func (s *TWAPService) config() config.TWAPConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg
+}
+
+func (s *TWAPService) maxGap() int64 {
+	return twapMaxGapSamples * s.config().SampleInterval.Milliseconds()
+}
+
+func twapKey(pairID uint) string {
+	return fmt.Sprintf("twap:%d", pairID)
+}
+
+// observeScript 在最后一个观测点之后追加观测点并累计价格。
+// 距上一个观测点不到 min_gap 的采样被忽略，多个实例同时采样只保留一个；超过 max_gap 时从头开始累计。
+// ARGV 为 timestamp、price0、price1、min_gap、max_gap、trim_before
+var observeScript = redis.NewScript(`
+local ts = tonumber(ARGV[1])
+local c0, c1 = 0, 0
+local last = redis.call('ZREVRANGE', KEYS[1], 0, 0)
+if last[1] then
+	local prev = cjson.decode(last[1])
+	local gap = ts - prev.timestamp
+	if gap < tonumber(ARGV[4]) then
+		return 0
+	end
+	if gap > tonumber(ARGV[5]) then
+		redis.call('DEL', KEYS[1])
+	else
+		c0 = prev.cumulative0 + prev.price0 * gap / 1000
+		c1 = prev.cumulative1 + prev.price1 * gap / 1000
+	end
+end
+local member = '{"timestamp":' .. ARGV[1] .. ',"price0":' .. ARGV[2] .. ',"price1":' .. ARGV[3] ..
+	',"cumulative0":' .. string.format('%.17g', c0) .. ',"cumulative1":' .. string.format('%.17g', c1) .. '}'
+redis.call('ZADD', KEYS[1], ts, member)
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[6])
+return 1
+`)
+
+// Record 记录交易对在 at (Unix 毫秒) 的储备，储备为零时没有价格，不记录
+func (s *TWAPService) Record(ctx context.Context, pair *models.TradingPair, reserve0, reserve1 *big.Int, at int64) error {
+	if reserve0.Sign() <= 0 || reserve1.Sign() <= 0 {
+		return nil
+	}
+	amount0 := models.NewAmount(reserve0, pair.Decimals0).Rat()
+	amount1 := models.NewAmount(reserve1, pair.Decimals1).Rat()
+	price0, _ := new(big.Rat).Quo(amount1, amount0).Float64()
+	price1, _ := new(big.Rat).Quo(amount0, amount1).Float64()
+
+	cfg := s.config()
+	minGap := cfg.SampleInterval.Milliseconds() / 2
+	if minGap < 1 {
+		minGap = 1
+	}
+	args := []interface{}{
+		at,
+		strconv.FormatFloat(price0, 'g', -1, 64),
+		strconv.FormatFloat(price1, 'g', -1, 64),
+		minGap,
+		s.maxGap(),
+		at - cfg.Retention.Milliseconds(),
+	}
+	if err := observeScript.Run(ctx, s.redisClient, []string{twapKey(pair.ID)}, args...).Err(); err != nil {
+		return fmt.Errorf("failed to record reserves: %v", err)
+	}
+	return nil
+}
+
+// Sample 读取所有有效交易对的储备并记录，单个交易对失败不影响其他交易对
+func (s *TWAPService) Sample(ctx context.Context) error {
+	pairs, err := s.store.Pairs().List(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixMilli()
+	var failed int
+	var lastErr error
+	for i := range pairs {
+		pair := &pairs[i]
+		if !pair.IsActive {
+			continue
+		}
+		reserve0, reserve1, err := s.reserves.Reserves(ctx, pair)
+		if err == nil {
+			err = s.Record(ctx, pair, reserve0, reserve1, now)
+		}
+		if err != nil {
+			failed++
+			lastErr = err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to sample %d of %d pairs: %v", failed, len(pairs), lastErr)
+	}
+	return nil
+}
+
+// Run 每隔 SampleInterval 采样一次，直到 ctx 结束
+func (s *TWAPService) Run(ctx context.Context) {
+	for {
+		if err := s.Sample(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error sampling pair reserves: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.config().SampleInterval):
+		}
+	}
+}
+
+// cumulativeAt 用 at 之前最近的观测点 (members 为 0 或 1 个) 推算 at 时的累计价格，观测点之后价格保持不变
+func (s *TWAPService) cumulativeAt(members []string, at int64) (float64, float64, error) {
+	if len(members) == 0 {
+		return 0, 0, ErrTWAPUnavailable
+	}
+	var observation TWAPObservation
+	if err := json.Unmarshal([]byte(members[0]), &observation); err != nil {
+		return 0, 0, fmt.Errorf("invalid observation: %v", err)
+	}
+	// 之后的观测点在 max_gap 内到达，否则是采样中断或还没采样到 at
+	elapsed := at - observation.Timestamp
+	if elapsed > s.maxGap() {
+		return 0, 0, ErrTWAPUnavailable
+	}
+	seconds := float64(elapsed) / 1000
+	return observation.Cumulative0 + observation.Price0*seconds, observation.Cumulative1 + observation.Price1*seconds, nil
+}
+
+// TWAP 返回交易对在 [from, to] (Unix 毫秒) 内的时间加权平均价格。
+// 区间不能晚于当前时间；区间开始前没有观测点或中间采样中断时返回 ErrTWAPUnavailable
+func (s *TWAPService) TWAP(ctx context.Context, pair *models.TradingPair, from, to int64) (*PairTWAP, error) {
+	if from >= to || to > time.Now().UnixMilli() {
+		return nil, ErrInvalidTWAPRange
+	}
+	// 在同一个事务中读取两端，采样中断清空观测点时不会混用前后两段的累计价格
+	key := twapKey(pair.ID)
+	latest := func(pipe redis.Pipeliner, at int64) *redis.StringSliceCmd {
+		return pipe.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(at, 10), Count: 1})
+	}
+	pipe := s.redisClient.TxPipeline()
+	startCmd := latest(pipe, from)
+	endCmd := latest(pipe, to)
+	countCmd := pipe.ZCount(ctx, key, strconv.FormatInt(from, 10), strconv.FormatInt(to, 10))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get observations: %v", err)
+	}
+
+	start0, start1, err := s.cumulativeAt(startCmd.Val(), from)
+	if err != nil {
+		return nil, fmt.Errorf("%w: pair %d from %d", err, pair.ID, from)
+	}
+	end0, end1, err := s.cumulativeAt(endCmd.Val(), to)
+	if err != nil {
+		return nil, fmt.Errorf("%w: pair %d to %d", err, pair.ID, to)
+	}
+	seconds := float64(to-from) / 1000
+	return &PairTWAP{
+		PairID:       pair.ID,
+		Token0:       pair.Token0,
+		Token1:       pair.Token1,
+		From:         from,
+		To:           to,
+		Price0:       (end0 - start0) / seconds,
+		Price1:       (end1 - start1) / seconds,
+		Observations: countCmd.Val(),
+	}, nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"defi-backend/config"
+	"defi-backend/models"
+)
+
+var testTWAPConfig = config.TWAPConfig{SampleInterval: 10 * time.Second, Retention: time.Hour}
+
+func newTestTWAP(t *testing.T) *TWAPService {
+	t.Helper()
+	prices, _, store := newCandleTest(t)
+	return NewTWAPService(prices.redisClient, store, StoredReserves{}, testTWAPConfig)
+}
+
+// ethReserves 1 ETH 对 price 个 USDC (6 位精度) 的储备
+func ethReserves(price int64) (*big.Int, *big.Int) {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil), big.NewInt(price * 1_000_000)
+}
+
+func TestTWAPWeightsPricesByTime(t *testing.T) {
+	s := newTestTWAP(t)
+	ctx := context.Background()
+	pair := &models.TradingPair{Token0: "ETH", Token1: "USDC", Decimals0: 18, Decimals1: 6}
+	pair.ID = 1
+	t0 := time.Now().Add(-10 * time.Minute).UnixMilli()
+
+	record := func(at, price int64) {
+		t.Helper()
+		r0, r1 := ethReserves(price)
+		if err := s.Record(ctx, pair, r0, r1, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record(t0, 2000)
+	record(t0+10_000, 2100)
+	// 不到半个采样间隔的重复采样被忽略
+	record(t0+12_000, 9000)
+	record(t0+20_000, 2000)
+
+	for _, tc := range []struct{ from, to int64 }{
+		{t0, t0 + 20_000},
+		{t0 + 5_000, t0 + 15_000},
+	} {
+		twap, err := s.TWAP(ctx, pair, tc.from, tc.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(twap.Price0-2050) > 1e-9 || math.Abs(twap.Price1*2050-1) > 1e-3 {
+			t.Fatalf("TWAP [%d, %d] = %+v, want price0 2050", tc.from-t0, tc.to-t0, twap)
+		}
+	}
+
+	if _, err := s.TWAP(ctx, pair, t0-1, t0+10_000); !errors.Is(err, ErrTWAPUnavailable) {
+		t.Fatalf("range before first observation err = %v, want ErrTWAPUnavailable", err)
+	}
+	if _, err := s.TWAP(ctx, pair, t0, t0); !errors.Is(err, ErrInvalidTWAPRange) {
+		t.Fatalf("empty range err = %v, want ErrInvalidTWAPRange", err)
+	}
+
+	// 采样中断超过 3 个间隔后重新累计，跨越中断的区间不可用
+	record(t0+100_000, 2200)
+	record(t0+110_000, 2200)
+	if _, err := s.TWAP(ctx, pair, t0, t0+110_000); !errors.Is(err, ErrTWAPUnavailable) {
+		t.Fatalf("range across gap err = %v, want ErrTWAPUnavailable", err)
+	}
+	if twap, err := s.TWAP(ctx, pair, t0+100_000, t0+110_000); err != nil || twap.Price0 != 2200 {
+		t.Fatalf("TWAP after gap = %+v, %v, want 2200", twap, err)
+	}
+}
+
+func TestOracleUsesDexTWAP(t *testing.T) {
+	prices, _, store := newCandleTest(t)
+	ctx := context.Background()
+	twap := NewTWAPService(prices.redisClient, store, StoredReserves{}, testTWAPConfig)
+
+	// 当前储备被操纵到 10000，现货价格不可信
+	r0, r1 := ethReserves(10000)
+	pair := &models.TradingPair{Symbol: "ETH/USDC", Token0: "ETH", Token1: "USDC", Decimals0: 18, Decimals1: 6, Reserve0: r0.String(), Reserve1: r1.String(), IsActive: true}
+	if err := store.Pairs().Create(pair); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UnixMilli()
+	for i, price := range []int64{2000, 2000, 4000, 2000, 2000, 2000} {
+		r0, r1 := ethReserves(price)
+		if err := twap.Record(ctx, pair, r0, r1, now-int64(60_000-i*10_000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := testOracleConfig()
+	cfg.DexQuoteTokens = []string{"usdc"}
+	cfg.DexPrice = config.DexPriceTWAP
+	cfg.DexTWAPWindow = time.Minute
+	o := NewOracle(prices.redisClient, prices, store, twap, cfg)
+	if err := o.submitDexQuotes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := o.Inspect(ctx, "ETH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Quotes) != 1 || result.Quotes[0].Source != SourceDEX {
+		t.Fatalf("quotes = %+v, want one dex quote", result.Quotes)
+	}
+	// (2000*50s + 4000*10s) / 60s
+	if got := result.Quotes[0].Price; math.Abs(got-7000.0/3) > 1 {
+		t.Fatalf("dex quote = %v, want the 1 minute TWAP ~2333", got)
+	}
+}
@@ -1,33 +1,49 @@
 package services
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"time"
 
+	"defi-backend/auth"
 	"defi-backend/models"
+	"defi-backend/repository"
 
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
+)
+
+// WalletNonceTTL 钱包登录 nonce 的有效期
+const WalletNonceTTL = 10 * time.Minute
+
+var (
+	ErrInvalidNonce        = errors.New("invalid or expired nonce")
+	ErrWalletAlreadyLinked = errors.New("wallet is already linked to another user")
+	ErrInvalidRole         = errors.New("invalid role")
+	ErrUserInactive        = errors.New("user is inactive")
+	ErrWalletLoginDisabled = errors.New("wallet login is not configured")
 )
 
 type UserService struct {
-	db *gorm.DB
+	store repository.Store
 }
 
-func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+func NewUserService(store repository.Store) *UserService {
+	return &UserService{store: store}
 }
 
 // Register 用户注册
 func (s *UserService) Register(username, email, password string) (*models.User, error) {
+	users := s.store.Users()
+
 	// 检查用户名是否已存在
-	var existingUser models.User
-	if err := s.db.Where("username = ?", username).First(&existingUser).Error; err == nil {
+	if _, err := users.FindByUsername(username); err == nil {
 		return nil, errors.New("username already exists")
 	}
 
 	// 检查邮箱是否已存在
-	if err := s.db.Where("email = ?", email).First(&existingUser).Error; err == nil {
+	if _, err := users.FindByEmail(email); err == nil {
 		return nil, errors.New("email already exists")
 	}
 
@@ -40,13 +56,14 @@ func (s *UserService) Register(username, email, password string) (*models.User,
 	// 创建用户
 	user := &models.User{
 		Username:  username,
-		Email:     email,
+		Email:     &email,
 		Password:  string(hashedPassword),
+		Role:      auth.RoleUser,
 		LastLogin: time.Now(),
 		IsActive:  true,
 	}
 
-	if err := s.db.Create(user).Error; err != nil {
+	if err := users.Create(user); err != nil {
 		return nil, err
 	}
 
@@ -55,8 +72,9 @@ func (s *UserService) Register(username, email, password string) (*models.User,
 
 // Login 用户登录
 func (s *UserService) Login(username, password string) (*models.User, error) {
-	var user models.User
-	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
+	users := s.store.Users()
+	user, err := users.FindByUsername(username)
+	if err != nil {
 		return nil, errors.New("invalid username or password")
 	}
 
@@ -67,29 +85,147 @@ func (s *UserService) Login(username, password string) (*models.User, error) {
 
 	// 更新最后登录时间
 	user.LastLogin = time.Now()
-	if err := s.db.Save(&user).Error; err != nil {
+	if err := users.Save(user); err != nil {
 		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
+}
+
+// GetUser 按 ID 获取用户
+func (s *UserService) GetUser(userID uint) (*models.User, error) {
+	return s.store.Users().FindByID(userID)
+}
+
+// ListUsers 返回所有用户及其角色，用于审计，可以在只读副本上查询
+func (s *UserService) ListUsers(ctx context.Context) ([]models.User, error) {
+	return s.store.Users().List(ctx)
 }
 
 // GetProfile 获取用户资料
 func (s *UserService) GetProfile(userID uint) (*models.UserProfile, error) {
-	var profile models.UserProfile
-	if err := s.db.Where("user_id = ?", userID).First(&profile).Error; err != nil {
-		return nil, err
-	}
-	return &profile, nil
+	return s.store.Profiles().FindByUserID(userID)
 }
 
-// UpdateProfile 更新用户资料
+// UpdateProfile 更新用户资料，没有资料时创建
 func (s *UserService) UpdateProfile(userID uint, profile *models.UserProfile) error {
 	profile.UserID = userID
-	return s.db.Save(profile).Error
+	return s.store.Profiles().Save(profile)
 }
 
 // UpdateWalletAddress 更新钱包地址
 func (s *UserService) UpdateWalletAddress(userID uint, walletAddress string) error {
-	return s.db.Model(&models.User{}).Where("id = ?", userID).Update("wallet_address", walletAddress).Error
+	return s.store.Users().UpdateWalletAddress(userID, walletAddress)
+}
+
+// UpdateRole 修改用户角色，新角色在用户下次登录取得的 token 中生效
+func (s *UserService) UpdateRole(userID uint, role string) error {
+	if !auth.ValidRole(role) {
+		return ErrInvalidRole
+	}
+	return s.store.Users().UpdateRole(userID, role)
+}
+
+// IssueWalletNonce 生成 Sign-In with Ethereum 使用的一次性 nonce
+func (s *UserService) IssueWalletNonce() (*models.WalletNonce, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	nonce := &models.WalletNonce{
+		Nonce:     hex.EncodeToString(buf),
+		ExpiresAt: time.Now().Add(WalletNonceTTL),
+	}
+	if err := s.store.Nonces().Create(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// LoginWithWallet 校验 SIWE 消息和签名后按钱包地址登录，没有对应用户时自动创建，被禁用的用户不能登录
+func (s *UserService) LoginWithWallet(message, signature, domain string, chainID uint64) (*models.User, error) {
+	var user *models.User
+	err := s.store.Transaction(func(tx repository.Store) error {
+		address, err := verifyWallet(tx, message, signature, domain, chainID)
+		if err != nil {
+			return err
+		}
+
+		users := tx.Users()
+		user, err = users.FindByWallet(address)
+		if errors.Is(err, repository.ErrNotFound) {
+			user = &models.User{
+				Username:      address,
+				WalletAddress: &address,
+				Role:          auth.RoleUser,
+				IsActive:      true,
+			}
+			err = users.Create(user)
+		}
+		if err != nil {
+			return err
+		}
+		if !user.IsActive {
+			return ErrUserInactive
+		}
+
+		user.LastLogin = time.Now()
+		return users.Save(user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LinkWallet 校验 SIWE 消息和签名后把钱包绑定到已登录的用户
+func (s *UserService) LinkWallet(userID uint, message, signature, domain string, chainID uint64) (*models.User, error) {
+	var user *models.User
+	err := s.store.Transaction(func(tx repository.Store) error {
+		address, err := verifyWallet(tx, message, signature, domain, chainID)
+		if err != nil {
+			return err
+		}
+
+		users := tx.Users()
+		owner, err := users.FindByWallet(address)
+		if err == nil && owner.ID != userID {
+			return ErrWalletAlreadyLinked
+		}
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+
+		if user, err = users.FindByID(userID); err != nil {
+			return err
+		}
+		user.WalletAddress = &address
+		return users.Save(user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// verifyWallet 校验签名并消耗消息中的 nonce，nonce 只能使用一次；没有配置域名时拒绝校验
+func verifyWallet(tx repository.Store, message, signature, domain string, chainID uint64) (string, error) {
+	if domain == "" {
+		return "", ErrWalletLoginDisabled
+	}
+	now := time.Now()
+	msg, err := auth.VerifySIWE(message, signature, domain, chainID, now)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Nonces().Use(msg.Nonce, now)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", ErrInvalidNonce
+	}
+	if err != nil {
+		return "", err
+	}
+	return msg.Address, nil
 }
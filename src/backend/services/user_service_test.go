@@ -0,0 +1,91 @@
+package services
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"defi-backend/chain"
+	"defi-backend/repository"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+const walletDomain = "app.example.com"
+
+// signIn 生成一条带新 nonce 的 SIWE 消息，并用 key 做 personal_sign 签名
+func signIn(t *testing.T, s *UserService, key *secp256k1.PrivateKey) (string, string) {
+	t.Helper()
+	nonce, err := s.IssueWalletNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := chain.PubkeyToAddress(key.PubKey())
+	message := fmt.Sprintf("%s wants you to sign in with your Ethereum account:\n%s\n\nURI: https://%s\nVersion: 1\nChain ID: 1\nNonce: %s\nIssued At: %s",
+		walletDomain, address, walletDomain, nonce.Nonce, time.Now().UTC().Format(time.RFC3339))
+
+	compact := ecdsa.SignCompact(key, chain.PersonalMessageHash([]byte(message)), false)
+	signature := append(compact[1:], compact[0])
+	return message, "0x" + hex.EncodeToString(signature)
+}
+
+func TestLoginWithWallet(t *testing.T) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewUserService(repository.NewMemoryStore())
+
+	message, signature := signIn(t, s, key)
+	user, err := s.LoginWithWallet(message, signature, walletDomain, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsActive || user.WalletAddress == nil || *user.WalletAddress != chain.PubkeyToAddress(key.PubKey()) {
+		t.Fatalf("wallet user = %+v", user)
+	}
+	// nonce 只能使用一次
+	if _, err := s.LoginWithWallet(message, signature, walletDomain, 1); !errors.Is(err, ErrInvalidNonce) {
+		t.Fatalf("replayed login err = %v, want ErrInvalidNonce", err)
+	}
+}
+
+func TestLoginWithWalletRejectsInactiveUser(t *testing.T) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewUserService(repository.NewMemoryStore())
+	message, signature := signIn(t, s, key)
+	user, err := s.LoginWithWallet(message, signature, walletDomain, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user.IsActive = false
+	if err := s.store.Users().Save(user); err != nil {
+		t.Fatal(err)
+	}
+	message, signature = signIn(t, s, key)
+	if _, err := s.LoginWithWallet(message, signature, walletDomain, 1); !errors.Is(err, ErrUserInactive) {
+		t.Fatalf("inactive login err = %v, want ErrUserInactive", err)
+	}
+}
+
+func TestWalletLoginRequiresDomain(t *testing.T) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewUserService(repository.NewMemoryStore())
+	message, signature := signIn(t, s, key)
+	if _, err := s.LoginWithWallet(message, signature, "", 1); !errors.Is(err, ErrWalletLoginDisabled) {
+		t.Fatalf("login without domain err = %v, want ErrWalletLoginDisabled", err)
+	}
+	if _, err := s.LinkWallet(1, message, signature, "", 1); !errors.Is(err, ErrWalletLoginDisabled) {
+		t.Fatalf("link without domain err = %v, want ErrWalletLoginDisabled", err)
+	}
+}
@@ -0,0 +1,240 @@
+// Package testenv 在进程内启动完整的后端，用于集成测试和本地调试：
+// 数据库为执行过全部迁移的 SQLite 内存库，Redis 为 miniredis，
+// 不连接 Nacos、RabbitMQ 和以太坊节点，区块高度由 Blocks 手动推进
+package testenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"defi-backend/auth"
+	"defi-backend/config"
+	"defi-backend/database"
+	"defi-backend/handlers"
+	"defi-backend/middleware"
+	"defi-backend/migrate"
+	"defi-backend/migrations"
+	"defi-backend/repository"
+	"defi-backend/routes"
+	"defi-backend/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 测试环境使用的固定配置，可以通过 New 的 settings 覆盖
+var defaults = map[string]interface{}{
+	"nacos.offline":    true,
+	"database.driver":  config.DriverSQLite,
+	"database.dsn":     ":memory:",
+	"database.migrate": config.MigrateOff,
+	"redis.addr":       "127.0.0.1:0",
+	"jwt.secret":       "testenv-secret",
+	"log.level":        "error",
+}
+
+// Env 一个独立的后端实例，多个 Env 之间不共享任何状态
+type Env struct {
+	Config   *config.Config
+	DB       *gorm.DB
+	Store    repository.Store
+	Redis    *redis.Client
+	Blocks   *Blocks
+	Users    *services.UserService
+	Defi     *services.DefiService
+	Risk     *services.RiskEngine
+	Prices   *services.PriceService
+	Candles  *services.CandleService
+	PriceHub *services.PriceHub
+	Oracle   *services.Oracle
+	TWAP     *services.TWAPService
+	Alerts   *services.AlertService
+	Tokens   *auth.TokenService
+	Features *middleware.FeatureFlags
+	Router   *gin.Engine
+
+	miniredis *miniredis.Miniredis
+	stopHub   context.CancelFunc
+	hubDone   chan error
+}
+
+// New 启动一个测试环境，settings 使用配置文件中的点分键，例如 "features.swap": false
+func New(settings map[string]interface{}) (*Env, error) {
+	merged := make(map[string]interface{}, len(defaults)+len(settings))
+	for key, value := range defaults {
+		merged[key] = value
+	}
+	for key, value := range settings {
+		merged[key] = value
+	}
+	resolved, err := config.NewLoader(config.NewMemorySource(config.SourceMemory, merged)).Load()
+	if err != nil {
+		return nil, err
+	}
+	cfg := resolved.Config
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	env := &Env{Config: cfg, Blocks: &Blocks{}}
+	if err := env.start(); err != nil {
+		env.Close()
+		return nil, err
+	}
+	return env, nil
+}
+
+func (e *Env) start() error {
+	cfg := e.Config
+
+	db, err := database.InitDB(cfg)
+	if err != nil {
+		return err
+	}
+	e.DB = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	all, err := migrations.All()
+	if err != nil {
+		return err
+	}
+	migrator, err := migrate.New(e.DB, all)
+	if err != nil {
+		return err
+	}
+	if _, err := migrator.Up(context.Background(), 0); err != nil {
+		return err
+	}
+
+	e.miniredis, err = miniredis.Run()
+	if err != nil {
+		return fmt.Errorf("failed to start miniredis: %v", err)
+	}
+	cfg.Redis.Addr = e.miniredis.Addr()
+	if e.Redis, err = database.InitRedis(cfg); err != nil {
+		return err
+	}
+
+	keys, err := auth.NewKeyManager(cfg.JWT)
+	if err != nil {
+		return err
+	}
+	e.Tokens = auth.NewTokenService(e.Redis, keys, cfg.JWT.AccessTTL, cfg.JWT.RefreshTTL)
+
+	e.Store = repository.NewGormStore(e.DB)
+	e.Users = services.NewUserService(e.Store)
+	e.Defi = services.NewDefiService(e.Store, e.Blocks)
+	// 没有 RabbitMQ，报价通过 Oracle.Submit 提交，或者用 Prices.UpdatePrice 直接写入价格
+	e.Candles = services.NewCandleService(e.Redis, e.Store)
+	// 通知在后台发送，检查站内信前先调用 Alerts.Wait
+	e.Alerts = services.NewAlertService(e.Redis, e.Store, e.Candles, cfg.Alerts,
+		services.NewInboxNotifier(e.Store), services.NewWebhookNotifier(cfg.Alerts))
+	e.Prices = services.NewPriceService(e.Redis, nil, e.Candles, e.Alerts)
+	// 不自动采样，储备通过 TWAP.Sample 读取数据库中的交易对，或者用 TWAP.Record 写入
+	e.TWAP = services.NewTWAPService(e.Redis, e.Store, services.StoredReserves{}, cfg.TWAP)
+	e.Oracle = services.NewOracle(e.Redis, e.Prices, e.Store, e.TWAP, cfg.Oracle)
+	e.Risk = services.NewRiskEngine(e.Store, e.Oracle)
+	if err := e.startPriceHub(); err != nil {
+		return err
+	}
+	if err := e.Defi.ApplyMarketRates(cfg.Interest.Markets); err != nil {
+		return err
+	}
+	e.Features = middleware.NewFeatureFlags()
+	e.Features.Set(cfg.Features)
+
+	opts := routes.Options{
+		Wallet:   handlers.WalletLoginConfig{Domain: cfg.Server.Domain, ChainID: cfg.Ethereum.ChainID},
+		Features: e.Features,
+		Candles:  e.Candles,
+		PriceHub: e.PriceHub,
+		Oracle:   e.Oracle,
+		TWAP:     e.TWAP,
+		Alerts:   e.Alerts,
+	}
+	if len(cfg.Database.Replicas.DSNs) > 0 {
+		opts.Sticky = middleware.NewPrimarySticky(cfg.Database.Replicas.StickyWindow)
+	}
+	gin.SetMode(gin.TestMode)
+	e.Router = routes.NewRouter(e.Users, e.Defi, e.Risk, e.Tokens, zap.NewNop(), opts).SetupRouter()
+	return nil
+}
+
+// startPriceHub 在返回前确认已经订阅 Redis 频道，之后写入的价格都会推送给订阅者
+func (e *Env) startPriceHub() error {
+	e.PriceHub = services.NewPriceHub(e.Redis, e.Prices)
+	ctx, cancel := context.WithCancel(context.Background())
+	e.stopHub = cancel
+	e.hubDone = make(chan error, 1)
+	go func() { e.hubDone <- e.PriceHub.Run(ctx) }()
+
+	// Run 订阅成功后 Redis 中才有订阅者
+	for i := 0; i < 100; i++ {
+		counts, err := e.Redis.PubSubNumSub(ctx, services.PriceUpdatesChannel).Result()
+		if err != nil {
+			return err
+		}
+		if counts[services.PriceUpdatesChannel] > 0 {
+			return nil
+		}
+		select {
+		case err := <-e.hubDone:
+			return err
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return errors.New("price hub did not subscribe")
+}
+
+// Close 关闭数据库和 Redis，内存数据库随之丢弃
+func (e *Env) Close() {
+	if e.stopHub != nil {
+		e.stopHub()
+		<-e.hubDone
+	}
+	if e.Alerts != nil {
+		e.Alerts.Wait()
+	}
+	if e.Redis != nil {
+		e.Redis.Close()
+	}
+	if e.miniredis != nil {
+		e.miniredis.Close()
+	}
+	if e.DB != nil {
+		if sqlDB, err := e.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+}
+
+// Blocks 代替以太坊节点提供区块高度
+type Blocks struct {
+	mu     sync.Mutex
+	number uint64
+}
+
+func (b *Blocks) BlockNumber(ctx context.Context) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.number, nil
+}
+
+// Set 设置当前区块高度
+func (b *Blocks) Set(number uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.number = number
+}
+
+// Mine 把区块高度推进 n 个块
+func (b *Blocks) Mine(n uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.number += n
+}